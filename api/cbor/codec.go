@@ -0,0 +1,411 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/miruken-go/miruken/internal/jsontree"
+	"math"
+	"strconv"
+	"time"
+)
+
+// decoder reads a cbor data item into a json tree.
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+// major types of a cbor data item.
+const (
+	majorUint   = 0
+	majorNegInt = 1
+	majorBytes  = 2
+	majorText   = 3
+	majorArray  = 4
+	majorMap    = 5
+	majorTag    = 6
+	majorSimple = 7
+
+	indefinite  = 31
+)
+
+
+var (
+	errShortData = errors.New("cbor: unexpected end of data")
+	errBreak     = errors.New("cbor: unexpected break")
+)
+
+
+// decode reads a cbor value into a json tree.
+func decode(data []byte) (any, error) {
+	dec := decoder{data: data}
+	tree, err := dec.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if dec.pos != len(data) {
+		return nil, errors.New("cbor: unexpected data after top-level value")
+	}
+	return tree, nil
+}
+
+func encode(buf *bytes.Buffer, v any) error {
+	switch t := v.(type) {
+	case nil:
+		buf.WriteByte(majorSimple<<5 | 22)
+	case bool:
+		if t {
+			buf.WriteByte(majorSimple<<5 | 21)
+		} else {
+			buf.WriteByte(majorSimple<<5 | 20)
+		}
+	case string:
+		encodeHead(buf, majorText, uint64(len(t)))
+		buf.WriteString(t)
+	case []byte:
+		encodeHead(buf, majorBytes, uint64(len(t)))
+		buf.Write(t)
+	case json.Number:
+		n, err := jsontree.Number(t)
+		if err != nil {
+			return fmt.Errorf("cbor: %w", err)
+		}
+		switch n := n.(type) {
+		case int64:
+			if n >= 0 {
+				encodeHead(buf, majorUint, uint64(n))
+			} else {
+				encodeHead(buf, majorNegInt, uint64(-1-n))
+			}
+		case uint64:
+			encodeHead(buf, majorUint, n)
+		case float64:
+			encodeFloat(buf, n)
+		}
+	case []any:
+		encodeHead(buf, majorArray, uint64(len(t)))
+		for _, item := range t {
+			if err := encode(buf, item); err != nil {
+				return err
+			}
+		}
+	case jsontree.Object:
+		encodeHead(buf, majorMap, uint64(len(t)))
+		for _, member := range t {
+			encodeHead(buf, majorText, uint64(len(member.Key)))
+			buf.WriteString(member.Key)
+			if err := encode(buf, member.Value); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cbor: unsupported value %T", v)
+	}
+	return nil
+}
+
+// encodeHead writes the initial byte and argument of a data item.
+func encodeHead(buf *bytes.Buffer, major byte, arg uint64) {
+	major <<= 5
+	switch {
+	case arg < 24:
+		buf.WriteByte(major | byte(arg))
+	case arg <= math.MaxUint8:
+		buf.WriteByte(major | 24)
+		buf.WriteByte(byte(arg))
+	case arg <= math.MaxUint16:
+		buf.WriteByte(major | 25)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(arg)))
+	case arg <= math.MaxUint32:
+		buf.WriteByte(major | 26)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(arg)))
+	default:
+		buf.WriteByte(major | 27)
+		buf.Write(binary.BigEndian.AppendUint64(nil, arg))
+	}
+}
+
+// encodeFloat writes a single precision float if the value
+// is exact, otherwise a double precision float.
+func encodeFloat(buf *bytes.Buffer, f float64) {
+	if f32 := float32(f); float64(f32) == f {
+		buf.WriteByte(majorSimple<<5 | 26)
+		buf.Write(binary.BigEndian.AppendUint32(nil, math.Float32bits(f32)))
+	} else {
+		buf.WriteByte(majorSimple<<5 | 27)
+		buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(f)))
+	}
+}
+
+
+func (d *decoder) value(depth int) (any, error) {
+	if depth > jsontree.MaxDepth {
+		return nil, fmt.Errorf("cbor: %w", jsontree.ErrMaxDepth)
+	}
+	ib, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	major, info := ib>>5, ib&0x1f
+	if major == majorSimple {
+		return d.simple(info)
+	}
+	if info == indefinite {
+		return d.indefinite(major, depth)
+	}
+	arg, err := d.argument(info)
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case majorUint:
+		return arg, nil
+	case majorNegInt:
+		if arg > math.MaxInt64 {
+			return nil, errors.New("cbor: negative integer overflows int64")
+		}
+		return -1 - int64(arg), nil
+	case majorBytes:
+		b, err := d.next(arg)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.Clone(b), nil
+	case majorText:
+		b, err := d.next(arg)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case majorArray:
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, errShortData
+		}
+		items := make([]any, arg)
+		for i := range items {
+			if items[i], err = d.value(depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case majorMap:
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, errShortData
+		}
+		obj := make(jsontree.Object, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			if obj, err = d.member(obj, depth); err != nil {
+				return nil, err
+			}
+		}
+		return obj, nil
+	default:
+		return d.tag(arg, depth)
+	}
+}
+
+func (d *decoder) simple(info byte) (any, error) {
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		u, err := d.uint(2)
+		return float16(uint16(u)), err
+	case 26:
+		u, err := d.uint(4)
+		return math.Float32frombits(uint32(u)), err
+	case 27:
+		u, err := d.uint(8)
+		return math.Float64frombits(u), err
+	case indefinite:
+		return nil, errBreak
+	}
+	return nil, fmt.Errorf("cbor: unsupported simple value %d", info)
+}
+
+// indefinite decodes an indefinite length string, array or map.
+func (d *decoder) indefinite(major byte, depth int) (any, error) {
+	switch major {
+	case majorBytes, majorText:
+		var chunks []byte
+		for !d.isBreak() {
+			chunk, err := d.value(depth+1)
+			if err != nil {
+				return nil, err
+			}
+			switch c := chunk.(type) {
+			case []byte:
+				if major != majorBytes {
+					return nil, errors.New("cbor: invalid text chunk")
+				}
+				chunks = append(chunks, c...)
+			case string:
+				if major != majorText {
+					return nil, errors.New("cbor: invalid bytes chunk")
+				}
+				chunks = append(chunks, c...)
+			default:
+				return nil, errors.New("cbor: invalid string chunk")
+			}
+		}
+		if major == majorText {
+			return string(chunks), nil
+		}
+		if chunks == nil {
+			chunks = []byte{}
+		}
+		return chunks, nil
+	case majorArray:
+		items := make([]any, 0)
+		for !d.isBreak() {
+			item, err := d.value(depth+1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case majorMap:
+		var err error
+		obj := make(jsontree.Object, 0)
+		for !d.isBreak() {
+			if obj, err = d.member(obj, depth); err != nil {
+				return nil, err
+			}
+		}
+		return obj, nil
+	}
+	return nil, fmt.Errorf("cbor: invalid indefinite length for major type %d", major)
+}
+
+// tag decodes the content of a tagged data item.
+// Epoch times are decoded as RFC 3339 strings and
+// bignums are not supported.
+func (d *decoder) tag(tag uint64, depth int) (any, error) {
+	content, err := d.value(depth+1)
+	if err != nil {
+		return nil, err
+	}
+	switch tag {
+	case 1:
+		var ts time.Time
+		switch t := content.(type) {
+		case uint64:
+			ts = time.Unix(int64(t), 0)
+		case int64:
+			ts = time.Unix(t, 0)
+		case float32:
+			sec, frac := math.Modf(float64(t))
+			ts = time.Unix(int64(sec), int64(frac*1e9))
+		case float64:
+			sec, frac := math.Modf(t)
+			ts = time.Unix(int64(sec), int64(frac*1e9))
+		default:
+			return nil, errors.New("cbor: invalid epoch time")
+		}
+		return ts.UTC().Format(time.RFC3339Nano), nil
+	case 2, 3:
+		return nil, errors.New("cbor: bignums are not supported")
+	}
+	return content, nil
+}
+
+func (d *decoder) member(obj jsontree.Object, depth int) (jsontree.Object, error) {
+	key, err := d.value(depth+1)
+	if err != nil {
+		return nil, err
+	}
+	var member jsontree.Member
+	switch k := key.(type) {
+	case string:
+		member.Key = k
+	case int64:
+		member.Key = strconv.FormatInt(k, 10)
+	case uint64:
+		member.Key = strconv.FormatUint(k, 10)
+	default:
+		return nil, fmt.Errorf("cbor: unsupported map key %T", key)
+	}
+	if member.Value, err = d.value(depth+1); err != nil {
+		return nil, err
+	}
+	return append(obj, member), nil
+}
+
+// isBreak consumes the break code terminating an indefinite length item.
+func (d *decoder) isBreak() bool {
+	if d.pos < len(d.data) && d.data[d.pos] == 0xff {
+		d.pos++
+		return true
+	}
+	return false
+}
+
+func (d *decoder) argument(info byte) (uint64, error) {
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info <= 27:
+		return d.uint(1 << (info - 24))
+	}
+	return 0, fmt.Errorf("cbor: invalid additional information %d", info)
+}
+
+func (d *decoder) byte() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, errShortData
+	}
+	b := d.data[d.pos]
+	d.pos++
+	return b, nil
+}
+
+func (d *decoder) next(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, errShortData
+	}
+	b := d.data[d.pos:d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+func (d *decoder) uint(size uint64) (uint64, error) {
+	b, err := d.next(size)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+// float16 converts a half precision float.
+func float16(h uint16) float64 {
+	exp, mant := int(h>>10&0x1f), float64(h&0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
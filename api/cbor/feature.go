@@ -0,0 +1,35 @@
+package cbor
+
+import (
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/api/json/stdjson"
+)
+
+// Installer configure cbor support.
+type Installer struct {}
+
+func (i *Installer) DependsOn() []miruken.Feature {
+	return []miruken.Feature{
+		api.Feature(),
+		stdjson.Feature()}
+}
+
+func (i *Installer) Install(setup *miruken.SetupBuilder) error {
+	if setup.Tag(&featureTag) {
+		setup.Specs(&Mapper{})
+	}
+	return nil
+}
+
+func Feature(config ...func(*Installer)) miruken.Feature {
+	installer := &Installer{}
+	for _, configure := range config {
+		if configure != nil {
+			configure(installer)
+		}
+	}
+	return installer
+}
+
+var featureTag byte
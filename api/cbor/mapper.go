@@ -0,0 +1,48 @@
+package cbor
+
+import (
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/internal/transcode"
+	"github.com/miruken-go/miruken/maps"
+	"io"
+)
+
+// Mapper formats to and from cbor by transcoding json.
+// Values are encoded to and decoded from json using the
+// installed json mappers, so polymorphism, surrogates and
+// either values are represented identically.  Binary
+// values are encoded natively.
+type Mapper struct{}
+
+
+func (m *Mapper) ToCbor(
+	_*struct{
+		maps.Format `to:"application/cbor"`
+	  }, it *maps.It,
+	ctx miruken.HandleContext,
+) (any, error) {
+	return transcode.To(it, ctx.Composer, codec)
+}
+
+func (m *Mapper) FromBytes(
+	_*struct{
+		maps.Format `from:"application/cbor"`
+	  }, byt []byte,
+	it  *maps.It,
+	ctx miruken.HandleContext,
+) (any, error) {
+	return transcode.From(it, byt, ctx.Composer, codec)
+}
+
+func (m *Mapper) FromReader(
+	_*struct{
+		maps.Format `from:"application/cbor"`
+	  }, reader io.Reader,
+	it  *maps.It,
+	ctx miruken.HandleContext,
+) (any, error) {
+	return transcode.FromReader(it, reader, ctx.Composer, codec)
+}
+
+
+var codec = transcode.Codec{Name: "cbor", Encode: encode, Decode: decode}
@@ -0,0 +1,232 @@
+package test
+
+import (
+	"bytes"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/api/cbor"
+	"github.com/miruken-go/miruken/creates"
+	"github.com/miruken-go/miruken/maps"
+	"github.com/stretchr/testify/suite"
+	"io"
+	"testing"
+	"time"
+)
+
+type (
+	TypeIdMapper struct {}
+
+	PlayerData struct {
+		Id       int32
+		Name     string
+		Rating   float64
+		Active   bool
+		Joined   time.Time
+		Nickname *string
+	}
+
+	Shape interface {
+		Area() float64
+	}
+
+	Circle struct {
+		Radius float64
+	}
+
+	Square struct {
+		Side float64
+	}
+
+	Drawing struct {
+		Name   string
+		Shapes []Shape
+	}
+
+	Attachment struct {
+		Name string
+		Data []byte
+	}
+)
+
+func (c *Circle) Area() float64 { return 3 * c.Radius * c.Radius }
+func (s *Square) Area() float64 { return s.Side * s.Side }
+
+
+func (m *TypeIdMapper) CreateCircle(
+	_*struct{
+		creates.It `key:"test.Circle"`
+	  },
+) *Circle {
+	return new(Circle)
+}
+
+func (m *TypeIdMapper) CreateSquare(
+	_*struct{
+		creates.It `key:"test.Square"`
+	  },
+) *Square {
+	return new(Square)
+}
+
+func (m *TypeIdMapper) CreateDrawing(
+	_*struct{
+		creates.It `key:"test.Drawing"`
+	  },
+) *Drawing {
+	return new(Drawing)
+}
+
+
+type CborTestSuite struct {
+	suite.Suite
+}
+
+func (suite *CborTestSuite) Setup() miruken.Handler {
+	handler, _ := miruken.Setup(
+		TestFeature,
+		cbor.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Handler()
+	return handler
+}
+
+func (suite *CborTestSuite) TestCbor() {
+	suite.Run("ToCborBytes", func() {
+		handler := suite.Setup()
+		b, _, _, err := maps.Out[[]byte](handler, map[string]any{"Id": 1}, api.ToCbor)
+		suite.Nil(err)
+		suite.Equal([]byte{0xa1, 0x62, 'I', 'd', 0x01}, b)
+	})
+
+	suite.Run("ToCborPrimitives", func() {
+		handler := suite.Setup()
+		b, _, _, err := maps.Out[[]byte](handler, []any{nil, true, -1, 200, -200, 1.5, "ab"}, api.ToCbor)
+		suite.Nil(err)
+		suite.Equal([]byte{
+			0x87, 0xf6, 0xf5, 0x20,
+			0x18, 0xc8,
+			0x38, 0xc7,
+			0xfa, 0x3f, 0xc0, 0x00, 0x00,
+			0x62, 'a', 'b'}, b)
+	})
+
+	suite.Run("RoundTrip", func() {
+		handler  := suite.Setup()
+		nickname := "Sonny"
+		player   := PlayerData{
+			Id:       7,
+			Name:     "Son Heung-min",
+			Rating:   8.25,
+			Active:   true,
+			Joined:   time.Date(2015, 8, 28, 0, 0, 0, 0, time.UTC),
+			Nickname: &nickname,
+		}
+		b, _, _, err := maps.Out[[]byte](handler, player, api.ToCbor)
+		suite.Nil(err)
+		data, _, _, err := maps.Out[PlayerData](handler, b, api.FromCbor)
+		suite.Nil(err)
+		suite.Equal(player, data)
+	})
+
+	suite.Run("Writer", func() {
+		handler := suite.Setup()
+		var b bytes.Buffer
+		out := io.Writer(&b)
+		_, _, err := maps.Into(handler, PlayerData{Id: 3, Name: "Kane"}, &out, api.ToCbor)
+		suite.Nil(err)
+		data, _, _, err := maps.Out[PlayerData](handler, io.Reader(&b), api.FromCbor)
+		suite.Nil(err)
+		suite.Equal("Kane", data.Name)
+	})
+
+	suite.Run("Polymorphic", func() {
+		handler := miruken.BuildUp(suite.Setup(), api.PolymorphicAll)
+		drawing := &Drawing{
+			Name:   "Shapes",
+			Shapes: []Shape{&Circle{Radius: 2}, &Square{Side: 3}},
+		}
+		b, _, _, err := maps.Out[[]byte](handler, drawing, api.ToCbor)
+		suite.Nil(err)
+		late, _, _, err := maps.Out[api.Late](handler, b, api.FromCbor)
+		suite.Nil(err)
+		suite.Equal(drawing, late.Value)
+	})
+
+	suite.Run("Message", func() {
+		handler := miruken.BuildUp(suite.Setup(), api.Polymorphic)
+		var b bytes.Buffer
+		out := io.Writer(&b)
+		msg := api.Message{Payload: &Square{Side: 4}}
+		_, _, err := maps.Into(handler, msg, &out, api.ToCbor)
+		suite.Nil(err)
+		data, _, _, err := maps.Out[api.Message](handler, io.Reader(&b), api.FromCbor)
+		suite.Nil(err)
+		suite.Equal(&Square{Side: 4}, data.Payload)
+	})
+
+	suite.Run("Timestamp", func() {
+		handler := suite.Setup()
+		// {"Joined": 1(1440703488)}
+		b := []byte{0xa1, 0x66, 'J', 'o', 'i', 'n', 'e', 'd', 0xc1, 0x1a, 0x55, 0xdf, 0xa4, 0x00}
+		data, _, _, err := maps.Out[PlayerData](handler, b, api.FromCbor)
+		suite.Nil(err)
+		suite.Equal(time.Unix(0x55dfa400, 0).UTC(), data.Joined)
+	})
+
+	suite.Run("Binary", func() {
+		handler := suite.Setup()
+		b := []byte{0x43, 0x01, 0x02, 0x03}
+		data, _, _, err := maps.Out[[]byte](handler, b, api.FromCbor)
+		suite.Nil(err)
+		suite.Equal([]byte{1, 2, 3}, data)
+	})
+
+	suite.Run("ToBinary", func() {
+		handler    := suite.Setup()
+		attachment := Attachment{Name: "a", Data: []byte{1, 2, 3}}
+		b, _, _, err := maps.Out[[]byte](handler, attachment, api.ToCbor)
+		suite.Nil(err)
+		suite.Equal([]byte{0xa2,
+			0x64, 'N', 'a', 'm', 'e', 0x61, 'a',
+			0x64, 'D', 'a', 't', 'a', 0x43, 0x01, 0x02, 0x03}, b)
+		data, _, _, err := maps.Out[Attachment](handler, b, api.FromCbor)
+		suite.Nil(err)
+		suite.Equal(attachment, data)
+	})
+
+	suite.Run("Truncated", func() {
+		handler := suite.Setup()
+		_, _, _, err := maps.Out[PlayerData](handler, []byte{0xa1, 0x62, 'I'}, api.FromCbor)
+		suite.EqualError(err, "cbor: unexpected end of data")
+	})
+
+	suite.Run("Oversized", func() {
+		handler := suite.Setup()
+		_, _, _, err := maps.Out[[]any](handler, []byte{0x9a, 0xff, 0xff, 0xff, 0xff}, api.FromCbor)
+		suite.EqualError(err, "cbor: unexpected end of data")
+	})
+
+	suite.Run("Indefinite", func() {
+		handler := suite.Setup()
+		// {_ "Name": (_ "Ka", "ne"), "Rating": 1.0 half}
+		b := []byte{
+			0xbf,
+			0x64, 'N', 'a', 'm', 'e', 0x7f, 0x62, 'K', 'a', 0x62, 'n', 'e', 0xff,
+			0x66, 'R', 'a', 't', 'i', 'n', 'g', 0xf9, 0x3c, 0x00,
+			0xff}
+		data, _, _, err := maps.Out[PlayerData](handler, b, api.FromCbor)
+		suite.Nil(err)
+		suite.Equal("Kane", data.Name)
+		suite.Equal(1.0, data.Rating)
+	})
+
+	suite.Run("UnsupportedBignum", func() {
+		handler := suite.Setup()
+		_, _, _, err := maps.Out[any](handler, []byte{0xc2, 0x41, 0x01}, api.FromCbor)
+		suite.EqualError(err, "cbor: bignums are not supported")
+	})
+}
+
+func TestCborTestSuite(t *testing.T) {
+	suite.Run(t, new(CborTestSuite))
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"fmt"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/either"
+	"github.com/miruken-go/miruken/internal"
+	"github.com/miruken-go/miruken/promise"
+	"reflect"
+	"sync"
+)
+
+type (
+	// InsufficientAcksError reports a Published message that
+	// was acknowledged by fewer consumers than required.
+	InsufficientAcksError struct {
+		Required int
+		Received int
+		Errors   []error
+	}
+
+	// collector is a FilterProvider that records the response
+	// or error of each consumer of a published message.
+	collector struct {
+		callback miruken.Callback
+		lock     sync.Mutex
+		results  []either.Monad[error, any]
+		pending  []*promise.Promise[any]
+	}
+
+	// collectFilter records the outcome of a consumer.
+	collectFilter struct {}
+)
+
+
+func (e *InsufficientAcksError) Error() string {
+	return fmt.Sprintf("published message acknowledged by %d of %d required consumers",
+		e.Received, e.Required)
+}
+
+func (e *InsufficientAcksError) Unwrap() []error {
+	return e.Errors
+}
+
+
+// collector
+
+func (c *collector) Required() bool {
+	return false
+}
+
+func (c *collector) AppliesTo(
+	callback miruken.Callback,
+) bool {
+	return callback == c.callback
+}
+
+func (c *collector) Filters(
+	binding  miruken.Binding,
+	callback any,
+	composer miruken.Handler,
+) ([]miruken.Filter, error) {
+	return collectFilters, nil
+}
+
+// slot reserves the position of the next consumer so results
+// are reported in the order the consumers were invoked.
+func (c *collector) slot() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.results = append(c.results, nil)
+	return len(c.results) - 1
+}
+
+func (c *collector) record(
+	idx int,
+	out []any,
+	err error,
+) {
+	var result either.Monad[error, any]
+	if err != nil {
+		result = Failure(err)
+	} else {
+		var response any
+		for _, o := range out {
+			if hr, ok := o.(miruken.HandleResult); ok {
+				if hr.IsError() {
+					result = Failure(hr.Error())
+				} else if !hr.Handled() {
+					// consumer declined the message
+					return
+				}
+			} else if response == nil {
+				response = o
+			}
+		}
+		if result == nil {
+			result = Success(response)
+		}
+	}
+	c.lock.Lock()
+	c.results[idx] = result
+	c.lock.Unlock()
+}
+
+func (c *collector) track(p *promise.Promise[any]) {
+	c.lock.Lock()
+	c.pending = append(c.pending, p)
+	c.lock.Unlock()
+}
+
+func (c *collector) await() []either.Monad[error, any] {
+	c.lock.Lock()
+	pending := c.pending
+	c.lock.Unlock()
+	for _, p := range pending {
+		_, _ = p.Await()
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	results := make([]either.Monad[error, any], 0, len(c.results))
+	for _, result := range c.results {
+		if result != nil {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+
+// collectFilter
+
+func (f collectFilter) Order() int {
+	return miruken.FilterStage - 1
+}
+
+func (f collectFilter) Next(
+	self     miruken.Filter,
+	next     miruken.Next,
+	ctx      miruken.HandleContext,
+	provider miruken.FilterProvider,
+) ([]any, *promise.Promise[[]any], error) {
+	c, ok := provider.(*collector)
+	if !ok {
+		return next.Abort()
+	}
+	idx := c.slot()
+	out, pout, err := next.Pipe()
+	if err != nil || pout == nil {
+		c.record(idx, out, err)
+		return out, nil, nil
+	}
+	done := promise.New(func(resolve func([]any), _ func(error)) {
+		out, err := pout.Await()
+		c.record(idx, out, err)
+		resolve(out)
+	})
+	c.track(promise.Then(done, func([]any) any { return nil }))
+	return nil, done, nil
+}
+
+
+// PublishCollect sends a message to all recipients and collects
+// the response (or error) of each consumer in the order invoked.
+// A new Stash is created to manage any transit state.
+// A failing consumer does not prevent delivery to the others.
+func PublishCollect[T any](
+	handler miruken.Handler,
+	message any,
+) *promise.Promise[[]either.Monad[error, T]] {
+	if internal.IsNil(handler) {
+		panic("handler cannot be nil")
+	}
+	if internal.IsNil(message) {
+		panic("message cannot be nil")
+	}
+	var builder miruken.HandlesBuilder
+	callback := builder.WithCallback(message).New()
+	c := &collector{callback: callback}
+	stash := miruken.AddHandlers(handler, NewStash(false))
+	composer := miruken.BuildUp(stash, miruken.ProvideFilters(c))
+	if result := composer.Handle(callback, true, nil); result.IsError() {
+		return promise.Reject[[]either.Monad[error, T]](result.Error())
+	}
+	return promise.New(func(resolve func([]either.Monad[error, T]), _ func(error)) {
+		results := c.await()
+		collected := make([]either.Monad[error, T], len(results))
+		for i, result := range results {
+			collected[i] = either.Fold(result,
+				func(err error) either.Monad[error, T] {
+					return either.Left(err)
+				},
+				func(res any) either.Monad[error, T] {
+					if res == nil {
+						var t T
+						return either.Right(t)
+					} else if t, ok := res.(T); ok {
+						return either.Right(t)
+					}
+					var t T
+					return either.Left(fmt.Errorf(
+						"publish: unexpected response %T, expected %v",
+						res, reflect.TypeOf(&t).Elem()))
+				})
+		}
+		resolve(collected)
+	})
+}
+
+
+var collectFilters = []miruken.Filter{collectFilter{}}
@@ -0,0 +1,189 @@
+package deadletter
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/handles"
+	"github.com/miruken-go/miruken/internal"
+	"github.com/miruken-go/miruken/promise"
+	"net/textproto"
+	"reflect"
+	"time"
+)
+
+// Admin captures dead letters and handles the List,
+// Replay and Purge messages to manage them.
+type Admin struct {
+	store   Store
+	headers []string
+	logger  logr.Logger
+}
+
+
+// NoConstructor prevents Admin from being created implicitly.
+func (a *Admin) NoConstructor() {}
+
+// Store returns the Store persisting the dead letters.
+func (a *Admin) Store() Store {
+	return a.store
+}
+
+func (a *Admin) List(
+	_ *handles.It, list List,
+) ([]Letter, error) {
+	return a.find(list)
+}
+
+func (a *Admin) Replay(
+	_ *handles.It, replay Replay,
+	ctx miruken.HandleContext,
+) (ReplayResult, error) {
+	letters, err := a.find(List{Ids: replay.Ids})
+	if err != nil {
+		return ReplayResult{}, err
+	}
+	var result ReplayResult
+	composer := miruken.BuildUp(ctx.Composer, api.Polymorphic)
+	for _, letter := range letters {
+		if err := a.replay(composer, letter); err != nil {
+			result.Failed = append(result.Failed, letter.Id)
+			continue
+		}
+		// only remove the letter once delivered
+		if _, err := a.store.Remove(context.Background(), letter.Id); err != nil {
+			return result, err
+		}
+		result.Replayed = append(result.Replayed, letter.Id)
+	}
+	return result, nil
+}
+
+func (a *Admin) Purge(
+	_ *handles.It, purge Purge,
+) (PurgeResult, error) {
+	purged, err := a.store.Remove(context.Background(), purge.Ids...)
+	return PurgeResult{purged}, err
+}
+
+func (a *Admin) find(list List) ([]Letter, error) {
+	ctx := context.Background()
+	if len(list.Ids) == 0 {
+		return a.store.List(ctx, list.Limit)
+	}
+	letters := make([]Letter, 0, len(list.Ids))
+	for _, id := range list.Ids {
+		if letter, ok, err := a.store.Get(ctx, id); err != nil {
+			return nil, err
+		} else if ok {
+			letters = append(letters, letter)
+		}
+	}
+	return letters, nil
+}
+
+// replay delivers the letter again.  A failure captured during
+// delivery replaces the letter with an incremented attempt count.
+// A publish is only delivered to the consumer that failed.
+func (a *Admin) replay(
+	handler miruken.Handler,
+	letter  Letter,
+) error {
+	payload, err := api.DecodeMessage(handler, letter.Message)
+	if err != nil {
+		return fmt.Errorf("deadletter: %w", err)
+	}
+	if payload == nil {
+		return nil
+	}
+	payload = pointerTo(payload)
+	options := Options{
+		Attempts: letter.Attempts,
+		Replace:  letter.Id,
+		Message:  payload,
+	}
+	if len(letter.Route) > 0 {
+		payload = api.RouteTo(payload, letter.Route)
+	} else if letter.Publish {
+		options.Consumer = letter.Consumer
+	}
+	handler = miruken.BuildUp(handler, miruken.Options(options))
+	var pv *promise.Promise[any]
+	if letter.Publish {
+		pv, err = api.Publish(handler, payload)
+	} else {
+		pv, err = api.Post(handler, payload)
+	}
+	if err == nil && pv != nil {
+		_, err = pv.Await()
+	}
+	return err
+}
+
+func (a *Admin) add(
+	handler miruken.Handler,
+	message any,
+	letter  Letter,
+) error {
+	encoded, err := api.EncodeMessage(handler, message)
+	if err != nil {
+		return err
+	}
+	if len(letter.Id) == 0 {
+		letter.Id = uuid.NewString()
+	}
+	letter.Message  = encoded
+	letter.FailedAt = time.Now().UTC()
+	return a.store.Add(context.Background(), letter)
+}
+
+// recorded returns the allowed headers to retain with a dead letter.
+func (a *Admin) recorded(header textproto.MIMEHeader) map[string][]string {
+	var recorded map[string][]string
+	for _, names := range [][]string{recordedHeaders, a.headers} {
+		for _, name := range names {
+			key := textproto.CanonicalMIMEHeaderKey(name)
+			if values, ok := header[key]; ok && len(values) > 0 {
+				if recorded == nil {
+					recorded = make(map[string][]string)
+				}
+				recorded[key] = values
+			}
+		}
+	}
+	return recorded
+}
+
+
+// NewAdmin creates an Admin persisting dead letters in the store.
+// Without a logger, the logr.Logger provided by the handler
+// dispatching the failed message is used.
+func NewAdmin(
+	store  Store,
+	logger ...logr.Logger,
+) *Admin {
+	if internal.IsNil(store) {
+		panic("store cannot be nil")
+	}
+	admin := &Admin{store: store}
+	if len(logger) > 0 {
+		admin.logger = logger[0]
+	}
+	return admin
+}
+
+// pointerTo returns a pointer to the message so the replayed
+// delivery can be identified by the Capture filter.
+func pointerTo(message any) any {
+	v := reflect.ValueOf(message)
+	if v.Kind() == reflect.Ptr {
+		return message
+	}
+	ptr := reflect.New(v.Type())
+	ptr.Elem().Set(v)
+	return ptr.Interface()
+}
+
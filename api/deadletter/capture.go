@@ -0,0 +1,169 @@
+package deadletter
+
+import (
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/handles"
+	"github.com/miruken-go/miruken/internal"
+	"github.com/miruken-go/miruken/promise"
+	"github.com/miruken-go/miruken/provides"
+	"net/textproto"
+	"reflect"
+)
+
+type (
+	// Capture is a FilterProvider that captures the messages
+	// a consumer fails to handle during a publish or a routed
+	// delivery into the dead letter Store.
+	Capture struct {}
+
+	// filter captures failed deliveries.
+	filter struct {}
+)
+
+
+// Capture
+
+func (c *Capture) Required() bool {
+	return false
+}
+
+func (c *Capture) AppliesTo(
+	callback miruken.Callback,
+) bool {
+	h, ok := callback.(*handles.It)
+	if !ok || internal.IsNil(h.Source()) {
+		return false
+	}
+	switch h.Source().(type) {
+	case List, *List, Replay, *Replay, Purge, *Purge:
+		return false
+	}
+	return true
+}
+
+func (c *Capture) Filters(
+	binding  miruken.Binding,
+	callback any,
+	composer miruken.Handler,
+) ([]miruken.Filter, error) {
+	return filters, nil
+}
+
+
+// filter
+
+func (f filter) Order() int {
+	return miruken.FilterStage
+}
+
+func (f filter) Next(
+	self     miruken.Filter,
+	next     miruken.Next,
+	ctx      miruken.HandleContext,
+	provider miruken.FilterProvider,
+) (out []any, pout *promise.Promise[[]any], err error) {
+	if _, ok := provider.(*Capture); !ok {
+		return next.Abort()
+	}
+	source  := ctx.Callback.Source()
+	message := source
+	routed, isRouted := source.(api.Routed)
+	if isRouted {
+		message = routed.Message
+	}
+	options, _ := miruken.GetOptions[Options](ctx.Composer)
+	if !options.replays(message) {
+		options = Options{}
+	} else if consumer := options.Consumer; len(consumer) > 0 && consumerOf(ctx.Handler) != consumer {
+		// a replayed publish is only delivered to the consumer that failed
+		return next.Abort()
+	}
+	if !ctx.Greedy && !isRouted {
+		return next.Pipe()
+	}
+	if out, pout, err = next.Pipe(); err != nil {
+		if !declined(err) {
+			f.capture(ctx, message, routed, isRouted, options, err)
+		}
+		return
+	} else if pout == nil {
+		return
+	}
+	return nil, promise.Catch(pout, func(err error) error {
+		if !declined(err) {
+			f.capture(ctx, message, routed, isRouted, options, err)
+		}
+		return err
+	}), nil
+}
+
+func (f filter) capture(
+	ctx      miruken.HandleContext,
+	message  any,
+	routed   api.Routed,
+	isRouted bool,
+	options  Options,
+	cause    error,
+) {
+	admin, _, err := provides.Type[*Admin](ctx.Composer)
+	if err != nil || admin == nil {
+		return
+	}
+	letter := Letter{
+		Id:       options.Replace,
+		Publish:  ctx.Greedy,
+		Consumer: consumerOf(ctx.Handler),
+		Errors:   errorChain(cause),
+		Attempts: options.Attempts + 1,
+	}
+	if header, _, err := provides.Type[textproto.MIMEHeader](ctx.Composer); err == nil && len(header) > 0 {
+		letter.Headers = admin.recorded(header)
+	}
+	if isRouted {
+		letter.Route = routed.Route
+	}
+	composer := miruken.BuildUp(ctx.Composer, api.Polymorphic)
+	if err := admin.add(composer, message, letter); err != nil {
+		logger := admin.logger
+		if logger.GetSink() == nil {
+			logger, _, _ = provides.Type[logr.Logger](ctx.Composer)
+		}
+		logger.Error(err, "unable to capture dead letter",
+			"consumer", letter.Consumer, "cause", cause.Error())
+	}
+}
+
+
+// declined returns true if the error reports the message was
+// not accepted rather than failed by the consumer.
+func declined(err error) bool {
+	switch err.(type) {
+	case *miruken.RejectedError, *miruken.NotHandledError:
+		return true
+	}
+	return false
+}
+
+// recordedHeaders are the request headers safe to retain with
+// a dead letter.  Credentials and propagated Stash values are
+// never recorded since dead letters can be listed remotely.
+var recordedHeaders = []string{
+	"Accept",
+	"Content-Type",
+	"Traceparent",
+	"Tracestate",
+	"User-Agent",
+	"X-Correlation-Id",
+	"X-Request-Id",
+}
+
+// consumerOf returns the name recorded for the consumer.
+func consumerOf(handler any) string {
+	return fmt.Sprintf("%v", reflect.TypeOf(handler))
+}
+
+
+var filters = []miruken.Filter{filter{}}
@@ -0,0 +1,63 @@
+package deadletter
+
+import (
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/internal"
+)
+
+// Installer configures dead letter support.
+type Installer struct {
+	store   Store
+	headers []string
+}
+
+func (i *Installer) DependsOn() []miruken.Feature {
+	return []miruken.Feature{api.Feature()}
+}
+
+func (i *Installer) Install(setup *miruken.SetupBuilder) error {
+	if setup.Tag(&featureTag) {
+		if internal.IsNil(i.store) {
+			i.store = NewMemoryStore()
+		}
+		admin := NewAdmin(i.store)
+		admin.headers = i.headers
+		setup.Specs(&Admin{}).
+			  Handlers(admin).
+			  Filters(&Capture{})
+	}
+	return nil
+}
+
+// WithStore sets the Store persisting the dead letters.
+func WithStore(store Store) func(*Installer) {
+	if internal.IsNil(store) {
+		panic("store cannot be nil")
+	}
+	return func(installer *Installer) {
+		installer.store = store
+	}
+}
+
+// WithHeaders records the additional request headers with the
+// dead letters.  Only safe headers are recorded by default.
+func WithHeaders(names ...string) func(*Installer) {
+	return func(installer *Installer) {
+		installer.headers = append(installer.headers, names...)
+	}
+}
+
+// Feature configures dead letter support.
+// If no Store is provided, a MemoryStore is used.
+func Feature(config ...func(*Installer)) miruken.Feature {
+	installer := &Installer{}
+	for _, configure := range config {
+		if configure != nil {
+			configure(installer)
+		}
+	}
+	return installer
+}
+
+var featureTag byte
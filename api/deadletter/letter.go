@@ -0,0 +1,117 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"time"
+)
+
+type (
+	// Letter is a message that could not be delivered.
+	Letter struct {
+		Id       string              `json:"id"`
+		Message  json.RawMessage     `json:"message"`
+		Route    string              `json:"route,omitempty"`
+		Publish  bool                `json:"publish,omitempty"`
+		Consumer string              `json:"consumer,omitempty"`
+		Errors   []string            `json:"errors"`
+		Attempts int                 `json:"attempts"`
+		Headers  map[string][]string `json:"headers,omitempty"`
+		FailedAt time.Time           `json:"failedAt"`
+	}
+
+	// Store persists dead letters until they are replayed or purged.
+	Store interface {
+		// Add saves the dead letter, replacing any
+		// dead letter with the same id.
+		Add(ctx context.Context, letter Letter) error
+
+		// Get returns the dead letter with the id.
+		Get(ctx context.Context, id string) (Letter, bool, error)
+
+		// List returns up to limit dead letters, oldest first.
+		List(ctx context.Context, limit int) ([]Letter, error)
+
+		// Remove deletes the dead letters with the ids and
+		// returns the number removed.  All the dead letters
+		// are removed if no ids are provided.
+		Remove(ctx context.Context, ids ...string) (int, error)
+	}
+
+	// List requests the dead letters.
+	// If Ids is empty, up to Limit letters are returned.
+	List struct {
+		Ids   []string
+		Limit int
+	}
+
+	// Replay requests the dead letters be delivered again.
+	// If Ids is empty, all the letters are replayed.
+	Replay struct {
+		Ids []string
+	}
+
+	// Purge requests the dead letters be discarded.
+	// If Ids is empty, all the letters are purged.
+	Purge struct {
+		Ids []string
+	}
+
+	// ReplayResult reports the outcome of a Replay.
+	// Letters that fail again remain with an incremented
+	// attempt count.
+	ReplayResult struct {
+		Replayed []string
+		Failed   []string
+	}
+
+	// PurgeResult reports the outcome of a Purge.
+	PurgeResult struct {
+		Purged int
+	}
+
+	// Options control the capture of dead letters.
+	// Consumer, Replace and Message describe a replay and only
+	// apply to the delivery of the replayed Message.
+	Options struct {
+		Attempts int
+		Consumer string
+		Replace  string
+		Message  any
+	}
+)
+
+
+// replays returns true if the message is the one being replayed.
+func (o *Options) replays(message any) bool {
+	if o.Message == nil || message == nil {
+		return false
+	}
+	a, b := reflect.ValueOf(o.Message), reflect.ValueOf(message)
+	return a.Kind() == reflect.Ptr && a.Type() == b.Type() && a.Pointer() == b.Pointer()
+}
+
+// errorChain returns the messages of the error and all
+// the errors it wraps.
+func errorChain(err error) []string {
+	var chain []string
+	var walk func(error)
+	walk = func(err error) {
+		for err != nil {
+			chain = append(chain, err.Error())
+			switch e := err.(type) {
+			case interface{ Unwrap() []error }:
+				for _, inner := range e.Unwrap() {
+					walk(inner)
+				}
+				return
+			default:
+				err = errors.Unwrap(err)
+			}
+		}
+	}
+	walk(err)
+	return chain
+}
@@ -0,0 +1,85 @@
+package deadletter
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// MemoryStore is a Store that keeps dead letters in memory.
+// It is intended for tests and single process deployments
+// that do not require durability.
+type MemoryStore struct {
+	lock    sync.Mutex
+	letters map[string]Letter
+}
+
+
+func (m *MemoryStore) Add(
+	_      context.Context,
+	letter Letter,
+) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.letters == nil {
+		m.letters = make(map[string]Letter)
+	}
+	m.letters[letter.Id] = letter
+	return nil
+}
+
+func (m *MemoryStore) Get(
+	_  context.Context,
+	id string,
+) (Letter, bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	letter, ok := m.letters[id]
+	return letter, ok, nil
+}
+
+func (m *MemoryStore) List(
+	_     context.Context,
+	limit int,
+) ([]Letter, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	letters := make([]Letter, 0, len(m.letters))
+	for _, letter := range m.letters {
+		letters = append(letters, letter)
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i].FailedAt.Before(letters[j].FailedAt)
+	})
+	if limit > 0 && len(letters) > limit {
+		letters = letters[:limit]
+	}
+	return letters, nil
+}
+
+func (m *MemoryStore) Remove(
+	_   context.Context,
+	ids ...string,
+) (int, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if len(ids) == 0 {
+		removed := len(m.letters)
+		m.letters = make(map[string]Letter)
+		return removed, nil
+	}
+	removed := 0
+	for _, id := range ids {
+		if _, ok := m.letters[id]; ok {
+			delete(m.letters, id)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{letters: make(map[string]Letter)}
+}
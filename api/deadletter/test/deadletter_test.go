@@ -0,0 +1,326 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/api/deadletter"
+	"github.com/miruken-go/miruken/api/json/stdjson"
+	"github.com/miruken-go/miruken/creates"
+	"github.com/miruken-go/miruken/handles"
+	"github.com/miruken-go/miruken/promise"
+	"github.com/miruken-go/miruken/provides"
+	"github.com/stretchr/testify/suite"
+	"net/textproto"
+	"sync/atomic"
+	"testing"
+)
+
+//go:generate $GOPATH/bin/miruken -tests
+
+type (
+	PlaceOrder struct {
+		Id int
+	}
+
+	OrderPlaced struct {
+		Id int
+	}
+
+	OrderHandler struct {
+		failing  atomic.Bool
+		received atomic.Int32
+	}
+
+	FailingRouter struct {}
+
+	Audit struct {
+		received atomic.Int32
+	}
+
+	AuditHandler struct {
+		audit *Audit
+	}
+
+	Billing struct {
+		failing  atomic.Bool
+		received atomic.Int32
+	}
+
+	BillingHandler struct {
+		billing *Billing
+	}
+)
+
+
+var ErrUnavailable = errors.New("inventory unavailable")
+
+
+// OrderHandler
+
+func (o *OrderHandler) Place(
+	_ *handles.It, place PlaceOrder,
+) error {
+	if o.failing.Load() {
+		return fmt.Errorf("place order %d: %w", place.Id, ErrUnavailable)
+	}
+	return nil
+}
+
+func (o *OrderHandler) Placed(
+	_ *handles.It, placed OrderPlaced,
+) error {
+	if o.failing.Load() {
+		return fmt.Errorf("order placed %d: %w", placed.Id, ErrUnavailable)
+	}
+	o.received.Add(1)
+	return nil
+}
+
+func (o *OrderHandler) New(
+	_*struct{
+		_ creates.It `key:"test.PlaceOrder"`
+		_ creates.It `key:"test.OrderPlaced"`
+	  }, create *creates.It,
+) any {
+	switch create.Key() {
+	case "test.PlaceOrder":
+		return new(PlaceOrder)
+	case "test.OrderPlaced":
+		return new(OrderPlaced)
+	}
+	return nil
+}
+
+
+// AuditHandler
+
+func (a *AuditHandler) Constructor(audit *Audit) {
+	a.audit = audit
+}
+
+func (a *AuditHandler) Placed(
+	_ *handles.It, _ OrderPlaced,
+) {
+	a.audit.received.Add(1)
+}
+
+
+// BillingHandler
+
+func (b *BillingHandler) Constructor(billing *Billing) {
+	b.billing = billing
+}
+
+func (b *BillingHandler) Placed(
+	_ *handles.It, placed OrderPlaced,
+) error {
+	if b.billing.failing.Load() {
+		return fmt.Errorf("bill order %d: %w", placed.Id, ErrUnavailable)
+	}
+	b.billing.received.Add(1)
+	return nil
+}
+
+
+// FailingRouter
+
+func (f *FailingRouter) Route(
+	_*struct{
+		handles.It
+		api.Routes `scheme:"fail"`
+	  }, routed api.Routed,
+) *promise.Promise[any] {
+	return promise.Reject[any](ErrUnavailable)
+}
+
+
+type DeadLetterTestSuite struct {
+	suite.Suite
+}
+
+func (suite *DeadLetterTestSuite) Setup(
+	orders *OrderHandler,
+	values ...any,
+) (miruken.Handler, *deadletter.Admin) {
+	handler, _ := miruken.Setup(
+		deadletter.Feature(), TestFeature, stdjson.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Handlers(orders).
+		With(values...).
+		Handler()
+	admin, _, _ := provides.Type[*deadletter.Admin](handler)
+	return handler, admin
+}
+
+func (suite *DeadLetterTestSuite) TestDeadLetter() {
+	suite.Run("Publish", func() {
+		orders := &OrderHandler{}
+		orders.failing.Store(true)
+		handler, _ := suite.Setup(orders)
+		suite.ErrorIs(await(api.Publish(handler, OrderPlaced{1})), ErrUnavailable)
+		letters := suite.list(handler)
+		suite.Len(letters, 1)
+		letter := letters[0]
+		suite.True(letter.Publish)
+		suite.Equal(1, letter.Attempts)
+		suite.Equal("*test.OrderHandler", letter.Consumer)
+		suite.Equal([]string{"order placed 1: inventory unavailable", "inventory unavailable"}, letter.Errors)
+		suite.False(letter.FailedAt.IsZero())
+	})
+
+	suite.Run("Routed", func() {
+		handler, _ := suite.Setup(&OrderHandler{})
+		err := await(api.Post(handler, api.RouteTo(PlaceOrder{2}, "fail://orders")))
+		suite.ErrorIs(err, ErrUnavailable)
+		letters := suite.list(handler)
+		suite.Len(letters, 1)
+		suite.Equal("fail://orders", letters[0].Route)
+		suite.False(letters[0].Publish)
+	})
+
+	suite.Run("Headers", func() {
+		orders := &OrderHandler{}
+		orders.failing.Store(true)
+		handler, err := miruken.Setup(
+			deadletter.Feature(deadletter.WithHeaders("X-Tenant")),
+			TestFeature, stdjson.Feature()).
+			Specs(&api.GoPolymorphism{}).
+			Handlers(orders).
+			Handler()
+		suite.Nil(err)
+		header := textproto.MIMEHeader{}
+		header.Set("Authorization", "Bearer secret")
+		header.Set("Cookie", "session=secret")
+		header.Set(api.StashHeaderPrefix+"Token", "secret")
+		header.Set("X-Request-Id", "42")
+		header.Set("X-Tenant", "acme")
+		suite.ErrorIs(await(api.Publish(
+			miruken.BuildUp(handler, provides.With(header)), OrderPlaced{1})), ErrUnavailable)
+		letters := suite.list(handler)
+		suite.Len(letters, 1)
+		suite.Equal(map[string][]string{
+			"X-Request-Id": {"42"},
+			"X-Tenant":     {"acme"},
+		}, letters[0].Headers)
+	})
+
+	suite.Run("Ignore Send", func() {
+		orders := &OrderHandler{}
+		orders.failing.Store(true)
+		handler, _ := suite.Setup(orders)
+		suite.ErrorIs(await(api.Post(handler, PlaceOrder{3})), ErrUnavailable)
+		suite.Empty(suite.list(handler))
+	})
+
+	suite.Run("Replay", func() {
+		orders := &OrderHandler{}
+		orders.failing.Store(true)
+		handler, _ := suite.Setup(orders)
+		suite.NotNil(await(api.Publish(handler, OrderPlaced{4})))
+		letters := suite.list(handler)
+		suite.Len(letters, 1)
+
+		orders.failing.Store(false)
+		result, _, err := api.Send[deadletter.ReplayResult](handler, deadletter.Replay{})
+		suite.Nil(err)
+		suite.Equal([]string{letters[0].Id}, result.Replayed)
+		suite.Empty(result.Failed)
+		suite.NotZero(orders.received.Load())
+		suite.Empty(suite.list(handler))
+	})
+
+	suite.Run("Replay Again", func() {
+		orders := &OrderHandler{}
+		orders.failing.Store(true)
+		handler, _ := suite.Setup(orders)
+		suite.NotNil(await(api.Publish(handler, OrderPlaced{5})))
+		letters := suite.list(handler)
+		suite.Len(letters, 1)
+
+		result, _, err := api.Send[deadletter.ReplayResult](handler,
+			deadletter.Replay{Ids: []string{letters[0].Id}})
+		suite.Nil(err)
+		suite.Equal([]string{letters[0].Id}, result.Failed)
+		letters = suite.list(handler)
+		suite.Len(letters, 1)
+		suite.Equal(2, letters[0].Attempts)
+	})
+
+	suite.Run("Replay Consumer", func() {
+		audit, billing := &Audit{}, &Billing{}
+		billing.failing.Store(true)
+		handler, _ := suite.Setup(&OrderHandler{}, audit, billing)
+		suite.NotNil(await(api.Publish(handler, OrderPlaced{8})))
+		suite.Equal(int32(1), audit.received.Load())
+		letters := suite.list(handler)
+		suite.Len(letters, 1)
+		suite.Equal("*test.BillingHandler", letters[0].Consumer)
+
+		billing.failing.Store(false)
+		result, _, err := api.Send[deadletter.ReplayResult](handler, deadletter.Replay{})
+		suite.Nil(err)
+		suite.Len(result.Replayed, 1)
+		suite.Equal(int32(1), billing.received.Load())
+		suite.Equal(int32(1), audit.received.Load())
+		suite.Empty(suite.list(handler))
+	})
+
+	suite.Run("Replay Not Handled", func() {
+		handler, admin := suite.Setup(&OrderHandler{})
+		suite.Nil(admin.Store().Add(context.Background(), deadletter.Letter{
+			Id:       "lost",
+			Message:  json.RawMessage(`{"payload":{"@type":"test.PlaceOrder","Id":9}}`),
+			Route:    "none://orders",
+			Attempts: 1,
+		}))
+		result, _, err := api.Send[deadletter.ReplayResult](handler, deadletter.Replay{})
+		suite.Nil(err)
+		suite.Equal([]string{"lost"}, result.Failed)
+		letters := suite.list(handler)
+		suite.Len(letters, 1)
+		suite.Equal("lost", letters[0].Id)
+		suite.Equal(1, letters[0].Attempts)
+	})
+
+	suite.Run("Purge", func() {
+		orders := &OrderHandler{}
+		orders.failing.Store(true)
+		handler, _ := suite.Setup(orders)
+		suite.NotNil(await(api.Publish(handler, OrderPlaced{6})))
+		suite.NotNil(await(api.Publish(handler, OrderPlaced{7})))
+		letters := suite.list(handler)
+		suite.Len(letters, 2)
+
+		result, _, err := api.Send[deadletter.PurgeResult](handler,
+			deadletter.Purge{Ids: []string{letters[0].Id}})
+		suite.Nil(err)
+		suite.Equal(1, result.Purged)
+		suite.Len(suite.list(handler), 1)
+
+		result, _, err = api.Send[deadletter.PurgeResult](handler, deadletter.Purge{})
+		suite.Nil(err)
+		suite.Equal(1, result.Purged)
+		suite.Empty(suite.list(handler))
+	})
+}
+
+func (suite *DeadLetterTestSuite) list(handler miruken.Handler) []deadletter.Letter {
+	letters, _, err := api.Send[[]deadletter.Letter](handler, deadletter.List{})
+	suite.Nil(err)
+	return letters
+}
+
+func await(pv *promise.Promise[any], err error) error {
+	if err == nil && pv != nil {
+		_, err = pv.Await()
+	}
+	return err
+}
+
+func TestDeadLetterTestSuite(t *testing.T) {
+	suite.Run(t, new(DeadLetterTestSuite))
+}
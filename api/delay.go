@@ -0,0 +1,48 @@
+package api
+
+import (
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/promise"
+	"time"
+)
+
+type (
+	// Delayed requests the delivery of a message at a later time.
+	Delayed struct {
+		Message any
+		At      time.Time
+	}
+
+	// Recurring requests the repeated delivery of a message
+	// according to a cron expression.  Posting a Recurring
+	// with the same Id replaces the existing schedule.
+	Recurring struct {
+		Id      string
+		Cron    string
+		Message any
+	}
+)
+
+
+// PostAt posts the message at the specified time.
+// The promise completes when the message is scheduled.
+func PostAt(
+	handler miruken.Handler,
+	message any,
+	at      time.Time,
+) (*promise.Promise[any], error) {
+	if message == nil {
+		panic("message cannot be nil")
+	}
+	return Post(handler, Delayed{Message: message, At: at})
+}
+
+// PostAfter posts the message after the specified duration.
+// The promise completes when the message is scheduled.
+func PostAfter(
+	handler miruken.Handler,
+	message any,
+	delay   time.Duration,
+) (*promise.Promise[any], error) {
+	return PostAt(handler, message, time.Now().Add(delay))
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+type (
+	// Exposed marks a message type as dispatchable by remote
+	// clients.  The `expose` tag optionally restricts the request
+	// path prefixes the type is exposed on.
+	//
+	//  type CreateOrder struct {
+	//      api.Exposed `expose:"/process,/publish"`
+	//      Sku string
+	//  }
+	Exposed struct{}
+
+	// Exposer is implemented by message types that determine the
+	// request path prefixes they are exposed on.  An empty result
+	// exposes the type on all paths.
+	Exposer interface {
+		ExposedPaths() []string
+	}
+
+	// exposure holds the path prefixes of an exposed type.
+	exposure struct {
+		exposed bool
+		paths   []string
+	}
+)
+
+
+// ExposedPaths returns the request path prefixes the type is exposed
+// on and true if the type is exposed.  An exposed type without path
+// prefixes is exposed on all paths.
+func ExposedPaths(typ reflect.Type) ([]string, bool) {
+	e := exposureOf(baseType(typ))
+	return e.paths, e.exposed
+}
+
+// IsExposed returns true if the type is exposed on the request path.
+func IsExposed(typ reflect.Type, path string) bool {
+	paths, ok := ExposedPaths(typ)
+	return ok && MatchPath(paths, path)
+}
+
+// MatchPath returns true if the path starts with one of the
+// prefixes on a segment boundary.  No prefixes match all paths.
+func MatchPath(prefixes []string, path string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if prefix = strings.TrimSuffix(prefix, "/"); len(prefix) == 0 {
+			return true
+		}
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+
+func exposureOf(typ reflect.Type) exposure {
+	if typ == nil {
+		return exposure{}
+	}
+	if e, ok := exposureCache.Load(typ); ok {
+		return e.(exposure)
+	}
+	var e exposure
+	if typ.Implements(exposerType) || reflect.PointerTo(typ).Implements(exposerType) {
+		v := reflect.New(typ).Interface()
+		e.exposed = true
+		e.paths   = v.(Exposer).ExposedPaths()
+	} else if typ.Kind() == reflect.Struct {
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			tag, ok := field.Tag.Lookup("expose")
+			if !ok && field.Type != exposedType {
+				continue
+			}
+			e.exposed = true
+			for _, path := range strings.Split(tag, ",") {
+				if path = strings.TrimSpace(path); len(path) > 0 {
+					e.paths = append(e.paths, path)
+				}
+			}
+			break
+		}
+	}
+	exposureCache.Store(typ, e)
+	return e
+}
+
+
+var (
+	exposureCache sync.Map
+	exposedType   = reflect.TypeOf(Exposed{})
+	exposerType   = reflect.TypeOf((*Exposer)(nil)).Elem()
+)
@@ -5,21 +5,54 @@ import (
 )
 
 // Installer enables core api support.
-type Installer struct {}
+type Installer struct {
+	types    []any
+	registry *TypeRegistry
+}
+
+// TypeRegistry returns the registry of stable type ids.
+func (v *Installer) TypeRegistry() *TypeRegistry {
+	return v.registry
+}
 
 func (v *Installer) Install(setup *miruken.SetupBuilder) error {
 	if setup.Tag(&featureTag) {
+		registry, err := NewTypeRegistry(v.types...)
+		v.registry = registry
 		setup.Specs(
 			&Stash{},
 			&Scheduler{},
 			&PassThroughRouter{},
 			&batchRouter{},
-			&MultipartMapper{}).
-			Handlers(NewStash(true))
+			&MultipartMapper{},
+			&TypeRegistry{}).
+			Handlers(NewStash(true), registry).
+			Observers(registry)
+		return err
+	}
+	return nil
+}
+
+func (v *Installer) AfterInstall(
+	_ *miruken.SetupBuilder,
+	_ miruken.Handler,
+) error {
+	if registry := v.registry; registry != nil {
+		return registry.Err()
 	}
 	return nil
 }
 
+// Types registers types declaring stable type ids.
+// Message types with stable ids handled by any binding are
+// registered automatically, but types only received in payloads
+// must be registered explicitly to be decoded.
+func Types(types ...any) func(*Installer) {
+	return func(installer *Installer) {
+		installer.types = append(installer.types, types...)
+	}
+}
+
 func Feature(config ...func(*Installer)) miruken.Feature {
 	installer := &Installer{}
 	for _, configure := range config {
@@ -30,4 +63,4 @@ func Feature(config ...func(*Installer)) miruken.Feature {
 	return installer
 }
 
-var featureTag byte
\ No newline at end of file
+var featureTag byte
@@ -0,0 +1,199 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"github.com/miruken-go/miruken"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type (
+	// CompressOptions configure compression of message bodies.
+	// Bodies smaller than MinSize are sent uncompressed.
+	CompressOptions struct {
+		Encoding string
+		MinSize  int
+	}
+
+	// UnsupportedEncodingError reports a content encoding
+	// that cannot be compressed or decompressed.
+	UnsupportedEncodingError struct {
+		Encoding string
+	}
+
+	// decodedBody closes the decompressor and the
+	// underlying body.
+	decodedBody struct {
+		io.ReadCloser
+		body io.ReadCloser
+	}
+)
+
+
+const (
+	EncodingGzip     = "gzip"
+	EncodingDeflate  = "deflate"
+	EncodingIdentity = "identity"
+
+	defaultCompressMinSize = 1024
+
+	// acceptEncoding advertises the supported response encodings.
+	acceptEncoding = EncodingGzip + ", " + EncodingDeflate
+)
+
+
+func (e *UnsupportedEncodingError) Error() string {
+	return fmt.Sprintf("unsupported content encoding %q", e.Encoding)
+}
+
+
+// CompressOptions
+
+func (c *CompressOptions) encoding() string {
+	if len(c.Encoding) > 0 {
+		return strings.ToLower(c.Encoding)
+	}
+	return EncodingGzip
+}
+
+// Threshold returns the minimum size of compressed bodies.
+func (c *CompressOptions) Threshold() int {
+	if c.MinSize > 0 {
+		return c.MinSize
+	}
+	return defaultCompressMinSize
+}
+
+// Negotiate selects the encoding of a response from the
+// Accept-Encoding header.  The configured encoding is
+// preferred when accepted with the same quality.
+func (c *CompressOptions) Negotiate(acceptEncoding string) string {
+	var best string
+	var quality float64
+	preferred := c.encoding()
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, q := parseCoding(part)
+		if q <= 0 {
+			continue
+		}
+		if coding == "*" {
+			coding = preferred
+		} else if !supportedEncoding(coding) {
+			continue
+		}
+		if q > quality || (q == quality && coding == preferred) {
+			best, quality = coding, q
+		}
+	}
+	return best
+}
+
+
+func (b *decodedBody) Close() error {
+	err := b.ReadCloser.Close()
+	if e := b.body.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+
+// NewEncoder returns a writer compressing to w using encoding.
+// The writer must be closed to flush the compressed data.
+func NewEncoder(w io.Writer, encoding string) (io.WriteCloser, error) {
+	switch strings.ToLower(encoding) {
+	case EncodingGzip:
+		return gzip.NewWriter(w), nil
+	case EncodingDeflate:
+		return zlib.NewWriter(w), nil
+	}
+	return nil, &UnsupportedEncodingError{encoding}
+}
+
+// NewDecoder returns a reader decompressing r using encoding.
+func NewDecoder(r io.Reader, encoding string) (io.ReadCloser, error) {
+	switch strings.ToLower(encoding) {
+	case EncodingGzip:
+		return gzip.NewReader(r)
+	case EncodingDeflate:
+		return zlib.NewReader(r)
+	case "", EncodingIdentity:
+		return io.NopCloser(r), nil
+	}
+	return nil, &UnsupportedEncodingError{encoding}
+}
+
+// Compress returns a miruken.Builder that compresses request bodies.
+func Compress(options CompressOptions) miruken.Builder {
+	return miruken.Options(Options{Compress: &options})
+}
+
+
+// compress replaces the buffered body with its compressed
+// content if it is large enough.
+func compress(
+	b       *bytes.Buffer,
+	options *CompressOptions,
+) (string, error) {
+	if options == nil || b.Len() < options.Threshold() {
+		return "", nil
+	}
+	var c bytes.Buffer
+	encoding := options.encoding()
+	enc, err := NewEncoder(&c, encoding)
+	if err != nil {
+		return "", err
+	}
+	if _, err = enc.Write(b.Bytes()); err != nil {
+		return "", err
+	}
+	if err = enc.Close(); err != nil {
+		return "", err
+	}
+	*b = c
+	return encoding, nil
+}
+
+// decompress replaces the response body with its
+// decompressed content.
+func decompress(res *http.Response) error {
+	encoding := res.Header.Get("Content-Encoding")
+	if len(encoding) == 0 || strings.EqualFold(encoding, EncodingIdentity) {
+		return nil
+	}
+	dec, err := NewDecoder(res.Body, encoding)
+	if err != nil {
+		return err
+	}
+	res.Body = &decodedBody{dec, res.Body}
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	res.Uncompressed  = true
+	return nil
+}
+
+// parseCoding parses a content coding and its quality.
+func parseCoding(part string) (string, float64) {
+	coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+	coding = strings.ToLower(strings.TrimSpace(coding))
+	q := 1.0
+	if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok &&
+		strings.EqualFold(strings.TrimSpace(name), "q") {
+		if v, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+			q = v
+		} else {
+			q = 0
+		}
+	}
+	return coding, q
+}
+
+func supportedEncoding(encoding string) bool {
+	return encoding == EncodingGzip || encoding == EncodingDeflate
+}
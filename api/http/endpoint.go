@@ -0,0 +1,375 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/config"
+	"github.com/miruken-go/miruken/handles"
+	"github.com/miruken-go/miruken/provides"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Endpoint is a physical address of a logical service.
+	// Endpoints with greater Weight receive more requests.
+	Endpoint struct {
+		Url    string
+		Weight int
+	}
+
+	// EjectOptions configure the ejection of unhealthy endpoints.
+	// An endpoint is ejected for Duration after Failures
+	// consecutive failed requests.
+	EjectOptions struct {
+		Failures int
+		Duration time.Duration
+	}
+
+	// ServiceOptions describe the endpoints of a logical service.
+	// Endpoints are combined from the static list, the DNS SRV
+	// records named by Srv and the json File of endpoints, which
+	// is reloaded when modified.
+	ServiceOptions struct {
+		Endpoints []Endpoint
+		Srv       string
+		Scheme    string
+		File      string
+		Balance   string
+		Eject     *EjectOptions
+	}
+
+	// ResolveEndpoints requests the endpoints of a logical service.
+	ResolveEndpoints struct {
+		Service string
+	}
+
+	// EndpointResolver resolves logical services from the
+	// configuration at "services.<name>".
+	EndpointResolver struct {
+		lock  sync.Mutex
+		srv   map[string]srvEntry
+		files map[string]fileEntry
+	}
+
+	// ServiceNotFoundError reports a logical service without endpoints.
+	ServiceNotFoundError struct {
+		Service string
+	}
+
+	// srvEntry caches the endpoints from DNS SRV records.
+	srvEntry struct {
+		endpoints []Endpoint
+		expires   time.Time
+	}
+
+	// fileEntry caches the endpoints from a file.
+	fileEntry struct {
+		endpoints []Endpoint
+		modified  time.Time
+	}
+
+	// balancer distributes requests to the endpoints of a service.
+	balancer struct {
+		lock   sync.Mutex
+		states map[string]*endpointState
+	}
+
+	// endpointState tracks the load and health of an endpoint.
+	endpointState struct {
+		current     int
+		outstanding int
+		failures    int
+		ejectUntil  time.Time
+	}
+
+	// lease is an endpoint selected for a request.
+	lease struct {
+		url      string
+		balancer *balancer
+		state    *endpointState
+		eject    *EjectOptions
+	}
+)
+
+
+const (
+	SchemeService = "svc"
+
+	BalanceRoundRobin       = "round-robin"
+	BalanceLeastOutstanding = "least-outstanding"
+
+	servicesPath           = "services"
+	defaultEjectFailures   = 3
+	defaultEjectDuration   = 30 * time.Second
+	srvTtl                 = 30 * time.Second
+)
+
+
+func (e *ServiceNotFoundError) Error() string {
+	return fmt.Sprintf("no endpoints found for service %q", e.Service)
+}
+
+
+// EndpointResolver
+
+func (e *EndpointResolver) Constructor(
+	_*struct{
+		provides.It
+		provides.Single
+	  },
+) {
+	e.srv   = make(map[string]srvEntry)
+	e.files = make(map[string]fileEntry)
+}
+
+func (e *EndpointResolver) Resolve(
+	_ *handles.It, resolve *ResolveEndpoints,
+	composer miruken.Handler,
+) (ServiceOptions, error) {
+	name := resolve.Service
+	services, _, err := provides.Type[map[string]ServiceOptions](
+		composer, &config.Load{Path: servicesPath})
+	if err != nil {
+		return ServiceOptions{}, err
+	}
+	service := services[name]
+	endpoints := slices.Clone(service.Endpoints)
+	if srv := service.Srv; len(srv) > 0 {
+		scheme := service.Scheme
+		if len(scheme) == 0 {
+			scheme = "http"
+		}
+		resolved, err := e.lookupSrv(srv, scheme)
+		if err != nil {
+			return ServiceOptions{}, err
+		}
+		endpoints = append(endpoints, resolved...)
+	}
+	if file := service.File; len(file) > 0 {
+		resolved, err := e.readFile(file)
+		if err != nil {
+			return ServiceOptions{}, err
+		}
+		endpoints = append(endpoints, resolved...)
+	}
+	if len(endpoints) == 0 {
+		return ServiceOptions{}, &ServiceNotFoundError{name}
+	}
+	service.Endpoints = endpoints
+	return service, nil
+}
+
+// lookupSrv resolves the endpoints from the DNS SRV records
+// with the lowest priority.
+func (e *EndpointResolver) lookupSrv(
+	name   string,
+	scheme string,
+) ([]Endpoint, error) {
+	e.lock.Lock()
+	entry, ok := e.srv[name]
+	e.lock.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.endpoints, nil
+	}
+	_, records, err := net.LookupSRV("", "", name)
+	if err != nil {
+		return nil, err
+	}
+	var endpoints []Endpoint
+	for _, record := range records {
+		if record.Priority != records[0].Priority {
+			break
+		}
+		host := strings.TrimSuffix(record.Target, ".")
+		endpoints = append(endpoints, Endpoint{
+			Url:    scheme + "://" + net.JoinHostPort(host, strconv.Itoa(int(record.Port))),
+			Weight: int(record.Weight),
+		})
+	}
+	e.lock.Lock()
+	e.srv[name] = srvEntry{endpoints, time.Now().Add(srvTtl)}
+	e.lock.Unlock()
+	return endpoints, nil
+}
+
+// readFile loads the endpoints from a json file if it
+// was modified since last read.
+func (e *EndpointResolver) readFile(name string) ([]Endpoint, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	e.lock.Lock()
+	entry, ok := e.files[name]
+	e.lock.Unlock()
+	if ok && entry.modified.Equal(info.ModTime()) {
+		return entry.endpoints, nil
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var endpoints []Endpoint
+	if err = json.Unmarshal(data, &endpoints); err != nil {
+		return nil, fmt.Errorf("endpoints file %q: %w", name, err)
+	}
+	e.lock.Lock()
+	e.files[name] = fileEntry{endpoints, info.ModTime()}
+	e.lock.Unlock()
+	return endpoints, nil
+}
+
+
+// EjectOptions
+
+func (o *EjectOptions) failures() int {
+	if o != nil && o.Failures > 0 {
+		return o.Failures
+	}
+	return defaultEjectFailures
+}
+
+func (o *EjectOptions) duration() time.Duration {
+	if o != nil && o.Duration > 0 {
+		return o.Duration
+	}
+	return defaultEjectDuration
+}
+
+
+// balancer
+
+// pick selects the endpoint to receive the next request.
+// Ejected endpoints are skipped unless all endpoints are ejected.
+func (b *balancer) pick(service *ServiceOptions) *lease {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	now    := time.Now()
+	states := make(map[string]*endpointState, len(service.Endpoints))
+	var healthy []Endpoint
+	for _, endpoint := range service.Endpoints {
+		state, ok := b.states[endpoint.Url]
+		if !ok {
+			state = new(endpointState)
+		}
+		states[endpoint.Url] = state
+		if now.After(state.ejectUntil) {
+			healthy = append(healthy, endpoint)
+		}
+	}
+	b.states = states
+	if len(healthy) == 0 {
+		healthy = service.Endpoints
+	}
+	var selected Endpoint
+	if strings.EqualFold(service.Balance, BalanceLeastOutstanding) {
+		selected = b.leastOutstanding(healthy)
+	} else {
+		selected = b.roundRobin(healthy)
+	}
+	state := b.states[selected.Url]
+	state.outstanding++
+	return &lease{selected.Url, b, state, service.Eject}
+}
+
+// roundRobin selects endpoints using smooth weighted round-robin.
+// https://github.com/phusion/nginx/commit/27e94984486058d73157038f7950a0a36ecc6e35
+func (b *balancer) roundRobin(endpoints []Endpoint) Endpoint {
+	var selected Endpoint
+	var best *endpointState
+	total := 0
+	for _, endpoint := range endpoints {
+		weight := max(endpoint.Weight, 1)
+		state  := b.states[endpoint.Url]
+		state.current += weight
+		total += weight
+		if best == nil || state.current > best.current {
+			selected, best = endpoint, state
+		}
+	}
+	best.current -= total
+	return selected
+}
+
+// leastOutstanding selects the endpoint with the fewest
+// outstanding requests relative to its weight.
+func (b *balancer) leastOutstanding(endpoints []Endpoint) Endpoint {
+	selected := endpoints[0]
+	best     := b.states[selected.Url]
+	for _, endpoint := range endpoints[1:] {
+		state := b.states[endpoint.Url]
+		if state.outstanding*max(selected.Weight, 1) <
+			best.outstanding*max(endpoint.Weight, 1) {
+			selected, best = endpoint, state
+		}
+	}
+	return selected
+}
+
+
+// lease
+
+// record records the outcome of the request and ejects
+// the endpoint after too many consecutive failures.
+func (l *lease) record(failed bool) {
+	b := l.balancer
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	state := l.state
+	if failed {
+		if state.failures++; state.failures >= l.eject.failures() {
+			state.failures   = 0
+			state.ejectUntil = time.Now().Add(l.eject.duration())
+		}
+	} else {
+		state.failures = 0
+	}
+}
+
+// release completes the request.
+func (l *lease) release() {
+	b := l.balancer
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	l.state.outstanding--
+}
+
+
+// logicalRoute returns the service and path of a logical route.
+// e.g. svc://orders/api
+func logicalRoute(route string) (service string, path string, ok bool) {
+	if u, err := url.Parse(route); err == nil &&
+		strings.EqualFold(u.Scheme, SchemeService) && len(u.Host) > 0 {
+		return u.Host, u.Path, true
+	}
+	return "", "", false
+}
+
+// resolve selects an endpoint of the logical service.
+func (r *Router) resolve(
+	service  string,
+	composer miruken.Handler,
+) (*lease, error) {
+	options, po, err := handles.Request[ServiceOptions](
+		composer, &ResolveEndpoints{service})
+	if err != nil {
+		return nil, err
+	} else if po != nil {
+		if options, err = po.Await(); err != nil {
+			return nil, err
+		}
+	}
+	if len(options.Endpoints) == 0 {
+		return nil, &ServiceNotFoundError{service}
+	}
+	b, _ := r.balancers.LoadOrStore(service, new(balancer))
+	return b.(*balancer).pick(&options), nil
+}
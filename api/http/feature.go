@@ -17,7 +17,7 @@ func (i *Installer) DependsOn() []miruken.Feature {
 
 func (i *Installer) Install(setup *miruken.SetupBuilder) error {
 	if setup.Tag(&featureTag) {
-		setup.Specs(&Router{})
+		setup.Specs(&Router{}, &EndpointResolver{})
 	}
 	return nil
 }
@@ -0,0 +1,342 @@
+package httpsrv
+
+import (
+	"container/heap"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/internal"
+	"github.com/miruken-go/miruken/internal/slices"
+	"github.com/miruken-go/miruken/promise"
+	"github.com/miruken-go/miruken/provides"
+	"github.com/miruken-go/miruken/security"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// AsyncOptions configure asynchronous processing of requests
+	// that prefer respond-async.  Completed operations are retained
+	// for Retention and polls wait at most MaxWait for completion.
+	// At most MaxOperations are tracked at any time.
+	AsyncOptions struct {
+		Retention     time.Duration
+		MaxWait       time.Duration
+		MaxOperations int
+	}
+
+	// Operations tracks the requests processed asynchronously.
+	Operations struct {
+		lock    sync.Mutex
+		ops     map[string]*operation
+		expires expiry
+	}
+
+	// operation is a request processed asynchronously.
+	operation struct {
+		id      string
+		owner   []security.Principal
+		done    chan struct{}
+		result  any
+		err     error
+		expires time.Time
+	}
+
+	// expiry orders the completed operations by expiration.
+	expiry []*operation
+)
+
+
+const (
+	operationsPrefix = "/operations/"
+
+	defaultRetention     = 10 * time.Minute
+	defaultMaxWait       = 30 * time.Second
+	defaultMaxOperations = 1000
+)
+
+
+var errTooManyOperations = errors.New("too many operations")
+
+
+// AsyncOptions
+
+func (a *AsyncOptions) retention() time.Duration {
+	if a.Retention > 0 {
+		return a.Retention
+	}
+	return defaultRetention
+}
+
+func (a *AsyncOptions) maxWait() time.Duration {
+	if a.MaxWait > 0 {
+		return a.MaxWait
+	}
+	return defaultMaxWait
+}
+
+func (a *AsyncOptions) maxOperations() int {
+	if a.MaxOperations > 0 {
+		return a.MaxOperations
+	}
+	return defaultMaxOperations
+}
+
+
+// Operations
+
+func (o *Operations) Constructor(
+	_*struct{
+		provides.It
+		provides.Single
+	  },
+) {
+	o.ops = make(map[string]*operation)
+}
+
+// start tracks the promise on behalf of the owner until it
+// completes and is retained for the retention period.
+// The oldest completed operation is evicted when full.
+func (o *Operations) start(
+	pr      *promise.Promise[any],
+	owner   []security.Principal,
+	options *AsyncOptions,
+) (*operation, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	op := &operation{
+		id:    hex.EncodeToString(id[:]),
+		owner: owner,
+		done:  make(chan struct{}),
+	}
+	o.lock.Lock()
+	o.expire(time.Now())
+	if len(o.ops) >= options.maxOperations() {
+		if len(o.expires) == 0 {
+			o.lock.Unlock()
+			return nil, errTooManyOperations
+		}
+		delete(o.ops, heap.Pop(&o.expires).(*operation).id)
+	}
+	o.ops[op.id] = op
+	o.lock.Unlock()
+	retention := options.retention()
+	go func() {
+		result, err := pr.Await()
+		o.lock.Lock()
+		op.result, op.err = result, err
+		op.expires = time.Now().Add(retention)
+		if _, ok := o.ops[op.id]; ok {
+			heap.Push(&o.expires, op)
+		}
+		o.lock.Unlock()
+		close(op.done)
+	}()
+	return op, nil
+}
+
+func (o *Operations) get(id string) (*operation, bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.expire(time.Now())
+	op, ok := o.ops[id]
+	return op, ok
+}
+
+// expire removes the completed operations past retention.
+func (o *Operations) expire(now time.Time) {
+	for len(o.expires) > 0 && now.After(o.expires[0].expires) {
+		delete(o.ops, heap.Pop(&o.expires).(*operation).id)
+	}
+}
+
+
+// operation
+
+func (o *operation) completed() bool {
+	select {
+	case <-o.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// ownedBy returns true if the subject has all the principals
+// of the subject that started the operation.
+func (o *operation) ownedBy(subject security.Subject) bool {
+	if len(o.owner) == 0 {
+		return true
+	} else if internal.IsNil(subject) {
+		return false
+	}
+	principals := subject.Principals()
+	for _, p := range o.owner {
+		if !slices.Contains(principals, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// location returns the path of the operation relative
+// to the prefix the handler is mounted at.
+func (o *operation) location(r *http.Request) string {
+	return mountPrefix(r) + operationsPrefix + o.id
+}
+
+
+// expiry
+
+func (e expiry) Len() int           { return len(e) }
+func (e expiry) Less(i, j int) bool { return e[i].expires.Before(e[j].expires) }
+func (e expiry) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+
+func (e *expiry) Push(x any) {
+	*e = append(*e, x.(*operation))
+}
+
+func (e *expiry) Pop() any {
+	old := *e
+	n   := len(old)
+	op  := old[n-1]
+	old[n-1] = nil
+	*e = old[:n-1]
+	return op
+}
+
+
+// Async returns a miruken.Builder that processes requests
+// preferring respond-async in the background.
+func Async(options AsyncOptions) miruken.Builder {
+	return miruken.Options(Options{Async: &options})
+}
+
+
+// acceptAsync responds with 202 and the Location of the
+// operation to poll for the result.
+func (a *ApiHandler) acceptAsync(
+	pr      *promise.Promise[any],
+	w       http.ResponseWriter,
+	r       *http.Request,
+	h       miruken.Handler,
+	options *AsyncOptions,
+) {
+	ops, _, err := provides.Type[*Operations](h)
+	if err != nil {
+		a.encodeError(err, 0, w, h)
+		return
+	} else if ops == nil {
+		http.Error(w, "500 operations not available", http.StatusInternalServerError)
+		return
+	}
+	var owner []security.Principal
+	if subject, _, _ := provides.Type[security.Subject](h); !internal.IsNil(subject) {
+		owner = subject.Principals()
+	}
+	op, err := ops.start(pr, owner, options)
+	if errors.Is(err, errTooManyOperations) {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "503 "+err.Error(), http.StatusServiceUnavailable)
+		return
+	} else if err != nil {
+		a.encodeError(err, 0, w, h)
+		return
+	}
+	header := w.Header()
+	header.Set("Location", op.location(r))
+	header.Set("Preference-Applied", "respond-async")
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// serveOperation responds with the result of a completed
+// operation or 202 if still pending.  Clients can long-poll
+// using the wait preference.  e.g. Prefer: wait=10
+func (a *ApiHandler) serveOperation(
+	w       http.ResponseWriter,
+	r       *http.Request,
+	h       miruken.Handler,
+	options *Options,
+) {
+	ops, _, err := provides.Type[*Operations](h)
+	if err != nil || ops == nil {
+		http.Error(w, "404 not found", http.StatusNotFound)
+		return
+	}
+	// operations are only visible to the subject that started them
+	op, ok := ops.get(strings.TrimPrefix(r.URL.Path, operationsPrefix))
+	if ok {
+		subject, _, _ := provides.Type[security.Subject](h)
+		ok = op.ownedBy(subject)
+	}
+	if !ok {
+		http.Error(w, "404 operation not found", http.StatusNotFound)
+		return
+	}
+	if wait, ok := preference(r.Header, "wait"); ok {
+		if secs, err := strconv.Atoi(wait); err == nil && secs > 0 {
+			maxWait := defaultMaxWait
+			if async := options.Async; async != nil {
+				maxWait = async.maxWait()
+			}
+			timer := time.NewTimer(min(time.Duration(secs)*time.Second, maxWait))
+			defer timer.Stop()
+			select {
+			case <-op.done:
+			case <-timer.C:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+	if !op.completed() {
+		header := w.Header()
+		header.Set("Location", op.location(r))
+		header.Set("Retry-After", "1")
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if op.err != nil {
+		a.encodeError(op.err, 0, w, h)
+	} else {
+		a.encodeResult(op.result, r, w, h)
+	}
+}
+
+
+// mountPrefix returns the prefix stripped from the request path
+// when the handler is mounted using http.StripPrefix.
+func mountPrefix(r *http.Request) string {
+	path, _, _ := strings.Cut(r.RequestURI, "?")
+	if prefix, ok := strings.CutSuffix(path, r.URL.EscapedPath()); ok {
+		return prefix
+	}
+	return ""
+}
+
+// preferAsync returns true if the client prefers respond-async.
+func preferAsync(header http.Header) bool {
+	_, ok := preference(header, "respond-async")
+	return ok
+}
+
+// preference returns the value of the preference in the Prefer header.
+// https://www.rfc-editor.org/rfc/rfc7240
+func preference(header http.Header, name string) (string, bool) {
+	for _, prefer := range header.Values("Prefer") {
+		for _, token := range strings.Split(prefer, ",") {
+			pref, _, _ := strings.Cut(token, ";")
+			key, value, _ := strings.Cut(strings.TrimSpace(pref), "=")
+			if strings.EqualFold(strings.TrimSpace(key), name) {
+				return strings.Trim(strings.TrimSpace(value), `"`), true
+			}
+		}
+	}
+	return "", false
+}
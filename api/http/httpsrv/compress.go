@@ -0,0 +1,110 @@
+package httpsrv
+
+import (
+	"github.com/miruken-go/miruken"
+	http2 "github.com/miruken-go/miruken/api/http"
+	"io"
+	"net/http"
+)
+
+// compressWriter buffers the response until it is large enough
+// to compress or is completed.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+	status   int
+	buf      []byte
+	enc      io.WriteCloser
+	started  bool
+}
+
+
+func (c *compressWriter) WriteHeader(statusCode int) {
+	if c.started {
+		c.ResponseWriter.WriteHeader(statusCode)
+	} else if c.status == 0 {
+		c.status = statusCode
+	}
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if c.started {
+		if c.enc != nil {
+			return c.enc.Write(p)
+		}
+		return c.ResponseWriter.Write(p)
+	}
+	c.buf = append(c.buf, p...)
+	if len(c.buf) >= c.minSize {
+		if err := c.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close writes the buffered response and flushes the compressed data.
+func (c *compressWriter) Close() error {
+	if !c.started {
+		if err := c.start(false); err != nil {
+			return err
+		}
+	}
+	if c.enc != nil {
+		return c.enc.Close()
+	}
+	return nil
+}
+
+// start writes the header and the buffered response.
+func (c *compressWriter) start(compress bool) (err error) {
+	c.started = true
+	header := c.ResponseWriter.Header()
+	if compress && len(header.Get("Content-Encoding")) == 0 {
+		if c.enc, err = http2.NewEncoder(c.ResponseWriter, c.encoding); err != nil {
+			return err
+		}
+		header.Set("Content-Encoding", c.encoding)
+		header.Del("Content-Length")
+	}
+	if c.status != 0 {
+		c.ResponseWriter.WriteHeader(c.status)
+	}
+	buf := c.buf
+	c.buf = nil
+	if len(buf) > 0 {
+		_, err = c.Write(buf)
+	}
+	return err
+}
+
+
+// Compress returns a miruken.Builder that compresses responses
+// accepted by the client and at least options.MinSize.
+func Compress(options http2.CompressOptions) miruken.Builder {
+	return miruken.Options(Options{Compress: &options})
+}
+
+// compressResponse wraps the response in a compressWriter
+// if the client accepts a supported encoding.
+func compressResponse(
+	w       http.ResponseWriter,
+	r       *http.Request,
+	options *http2.CompressOptions,
+) (http.ResponseWriter, func()) {
+	if options == nil {
+		return w, func() {}
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	encoding := options.Negotiate(r.Header.Get("Accept-Encoding"))
+	if len(encoding) == 0 {
+		return w, func() {}
+	}
+	cw := &compressWriter{
+		ResponseWriter: w,
+		encoding:       encoding,
+		minSize:        options.Threshold(),
+	}
+	return cw, func() { _ = cw.Close() }
+}
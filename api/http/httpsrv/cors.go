@@ -0,0 +1,226 @@
+package httpsrv
+
+import (
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/args"
+	"github.com/miruken-go/miruken/config"
+	"github.com/miruken-go/miruken/provides"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// CorsOptions configure cross-origin resource sharing.
+	// Origins may contain * wildcards.  e.g. https://*.example.com
+	// Methods and Headers default to those used by api requests.
+	// Origins matching any origin are ignored with Credentials
+	// so credentialed requests are never allowed from any site.
+	CorsOptions struct {
+		Origins     []string
+		Methods     []string
+		Headers     []string
+		Expose      []string
+		Credentials bool
+		MaxAge      time.Duration
+	}
+
+	// Cors is Middleware that applies the CORS protocol.
+	// https://fetch.spec.whatwg.org/#http-cors-protocol
+	// Options are loaded from the "cors" configuration unless
+	// provided explicitly.
+	Cors struct {
+		Options CorsOptions
+	}
+)
+
+
+// CorsOptions
+
+func (c *CorsOptions) allowOrigin(origin string) bool {
+	for _, pattern := range c.Origins {
+		if c.Credentials && anyOrigin(pattern) {
+			continue
+		}
+		if matchOrigin(strings.ToLower(pattern), strings.ToLower(origin)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CorsOptions) methods() []string {
+	if len(c.Methods) > 0 {
+		return c.Methods
+	}
+	return defaultCorsMethods
+}
+
+func (c *CorsOptions) headers() []string {
+	if len(c.Headers) > 0 {
+		return c.Headers
+	}
+	return defaultCorsHeaders
+}
+
+func (c *CorsOptions) allowMethod(method string) bool {
+	for _, m := range c.methods() {
+		if m == "*" || strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CorsOptions) allowHeaders(requested string) bool {
+	allowed := c.headers()
+	for _, header := range strings.Split(requested, ",") {
+		if header = strings.TrimSpace(header); len(header) == 0 {
+			continue
+		}
+		found := false
+		for _, h := range allowed {
+			if h == "*" || strings.EqualFold(h, header) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+
+// Cors
+
+func (c *Cors) Constructor(
+	_*struct{
+		provides.It
+		provides.Single
+	  },
+	_*struct{
+		args.Optional
+		config.Load `path:"cors"`
+	  }, options CorsOptions,
+) {
+	c.Options = options
+}
+
+func (c *Cors) ServeHTTP(
+	w http.ResponseWriter,
+	r *http.Request,
+	m Middleware,
+	h miruken.Handler,
+	n func(miruken.Handler),
+) error {
+	// Explicit options override the configuration.
+	options := &c.Options
+	if mc, ok := m.(*Cors); ok && len(mc.Options.Origins) > 0 {
+		options = &mc.Options
+	}
+
+	origin := r.Header.Get("Origin")
+	if len(origin) == 0 {
+		n(h)
+		return nil
+	}
+
+	header := w.Header()
+	header.Add("Vary", "Origin")
+	preflight := r.Method == http.MethodOptions &&
+		len(r.Header.Get("Access-Control-Request-Method")) > 0
+	allowed := options.allowOrigin(origin)
+
+	if preflight {
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+		method    := r.Header.Get("Access-Control-Request-Method")
+		requested := r.Header.Get("Access-Control-Request-Headers")
+		if !allowed || !options.allowMethod(method) || !options.allowHeaders(requested) {
+			w.WriteHeader(http.StatusForbidden)
+			return nil
+		}
+		writeAllowOrigin(header, origin, options)
+		header.Set("Access-Control-Allow-Methods", strings.Join(options.methods(), ", "))
+		if len(requested) > 0 {
+			header.Set("Access-Control-Allow-Headers", requested)
+		}
+		if maxAge := options.MaxAge; maxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(int(maxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	if allowed {
+		writeAllowOrigin(header, origin, options)
+		if len(options.Expose) > 0 {
+			header.Set("Access-Control-Expose-Headers", strings.Join(options.Expose, ", "))
+		}
+	}
+	n(h)
+	return nil
+}
+
+
+// writeAllowOrigin writes the allowed origin which is only
+// the wildcard if any origin is allowed without credentials.
+func writeAllowOrigin(
+	header  http.Header,
+	origin  string,
+	options *CorsOptions,
+) {
+	if options.Credentials {
+		header.Set("Access-Control-Allow-Origin", origin)
+		header.Set("Access-Control-Allow-Credentials", "true")
+	} else if len(options.Origins) == 1 && options.Origins[0] == "*" {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+}
+
+// anyOrigin returns true if the pattern matches any origin.
+// e.g. * or https://*
+func anyOrigin(pattern string) bool {
+	if _, host, ok := strings.Cut(pattern, "://"); ok {
+		pattern = host
+	}
+	return len(pattern) > 0 && strings.Trim(pattern, "*") == ""
+}
+
+// matchOrigin returns true if the origin matches the pattern
+// where each * matches any sequence of characters.
+func matchOrigin(pattern, origin string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == origin
+	}
+	if !strings.HasPrefix(origin, parts[0]) {
+		return false
+	}
+	origin = origin[len(parts[0]):]
+	last  := len(parts) - 1
+	for _, part := range parts[1:last] {
+		i := strings.Index(origin, part)
+		if i < 0 {
+			return false
+		}
+		origin = origin[i+len(part):]
+	}
+	return strings.HasSuffix(origin, parts[last])
+}
+
+
+var (
+	defaultCorsMethods = []string{
+		http.MethodGet, http.MethodPost, http.MethodOptions,
+	}
+	defaultCorsHeaders = []string{
+		"Accept", "Accept-Encoding", "Authorization", "Content-Encoding",
+		"Content-Type", "Prefer", "If-None-Match",
+	}
+)
@@ -0,0 +1,170 @@
+package httpsrv
+
+import (
+	"encoding/json"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/api/deadletter"
+	"github.com/miruken-go/miruken/provides"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// DeadLetters returns a http.Handler for inspecting and managing
+// dead letters through a list of Middleware components.
+// The handler expects to be mounted using http.StripPrefix.
+//
+//   GET    /             lists the letters (?limit=n)
+//   GET    /{id}         returns the letter
+//   POST   /replay       replays all the letters
+//   POST   /{id}/replay  replays the letter
+//   DELETE /             purges all the letters
+//   DELETE /{id}         purges the letter
+func DeadLetters(
+	handler    miruken.Handler,
+	middleware ...Middleware,
+) http.Handler {
+	return pipeline(handler, serveDeadLetters, middleware)
+}
+
+func serveDeadLetters(
+	w http.ResponseWriter,
+	r *http.Request,
+	h miruken.Handler,
+) {
+	a, ok := resolveApiHandler(w, h)
+	if !ok {
+		return
+	}
+	h = miruken.BuildUp(h, provides.With(textproto.MIMEHeader(r.Header)))
+	var segments []string
+	if path := strings.Trim(r.URL.Path, "/"); len(path) > 0 {
+		segments = strings.Split(path, "/")
+	}
+	var ids []string
+	switch r.Method {
+	case http.MethodGet:
+		switch len(segments) {
+		case 0:
+			var limit int
+			if l := r.URL.Query().Get("limit"); len(l) > 0 {
+				var err error
+				if limit, err = strconv.Atoi(l); err != nil || limit < 0 {
+					http.Error(w, "400 invalid 'limit' parameter", http.StatusBadRequest)
+					return
+				}
+			}
+			dispatchDeadLetters[[]deadletter.Letter](a, w, h, deadletter.List{Limit: limit})
+		case 1:
+			letters, ok := sendDeadLetters[[]deadletter.Letter](a, w, h, deadletter.List{Ids: segments})
+			if !ok {
+				return
+			} else if len(letters) == 0 {
+				http.Error(w, "404 not found", http.StatusNotFound)
+				return
+			}
+			writeJson(w, letters[0])
+		default:
+			http.Error(w, "404 not found", http.StatusNotFound)
+		}
+	case http.MethodPost:
+		switch {
+		case len(segments) == 1 && segments[0] == "replay":
+		case len(segments) == 2 && segments[1] == "replay":
+			ids = segments[:1]
+		default:
+			http.Error(w, "404 not found", http.StatusNotFound)
+			return
+		}
+		if options, _ := miruken.GetOptions[Options](h); options.Expose != nil {
+			var ok bool
+			if ids, ok = exposedDeadLetters(a, w, h, ids, options.Expose); !ok {
+				return
+			}
+		}
+		dispatchDeadLetters[deadletter.ReplayResult](a, w, h, deadletter.Replay{Ids: ids})
+	case http.MethodDelete:
+		if len(segments) > 1 {
+			http.Error(w, "404 not found", http.StatusNotFound)
+			return
+		}
+		dispatchDeadLetters[deadletter.PurgeResult](a, w, h, deadletter.Purge{Ids: segments})
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// exposedDeadLetters returns the ids of the letters with
+// messages exposed for remote use.  Unexposed letters are
+// never replayed remotely.
+func exposedDeadLetters(
+	a      *ApiHandler,
+	w      http.ResponseWriter,
+	h      miruken.Handler,
+	ids    []string,
+	expose *ExposeOptions,
+) ([]string, bool) {
+	letters, ok := sendDeadLetters[[]deadletter.Letter](a, w, h, deadletter.List{Ids: ids})
+	if !ok {
+		return nil, false
+	}
+	var exposed []string
+	composer := miruken.BuildUp(h, api.Polymorphic)
+	for _, letter := range letters {
+		path := "/process"
+		if letter.Publish {
+			path = "/publish"
+		}
+		if payload, err := api.DecodeMessage(composer, letter.Message);
+			err == nil && payload != nil && expose.exposes(payload, path) {
+			exposed = append(exposed, letter.Id)
+		}
+	}
+	if len(exposed) > 0 {
+		return exposed, true
+	}
+	// an empty replay would replay all the letters
+	if len(ids) > 0 {
+		http.Error(w, "404 not found", http.StatusNotFound)
+	} else {
+		writeJson(w, deadletter.ReplayResult{})
+	}
+	return nil, false
+}
+
+func dispatchDeadLetters[T any](
+	a       *ApiHandler,
+	w       http.ResponseWriter,
+	h       miruken.Handler,
+	request any,
+) {
+	if result, ok := sendDeadLetters[T](a, w, h, request); ok {
+		writeJson(w, result)
+	}
+}
+
+func sendDeadLetters[T any](
+	a       *ApiHandler,
+	w       http.ResponseWriter,
+	h       miruken.Handler,
+	request any,
+) (T, bool) {
+	result, pr, err := api.Send[T](h, request)
+	if err == nil && pr != nil {
+		result, err = pr.Await()
+	}
+	if err != nil {
+		// dead letters are not enabled if not handled
+		a.encodeError(err, http.StatusNotImplemented, w, h)
+		return result, false
+	}
+	return result, true
+}
+
+func writeJson(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(value)
+}
@@ -34,6 +34,15 @@ func (s *StatusCodeMapper) UnknownTypeId(
 	return http.StatusBadRequest
 }
 
+func (s *StatusCodeMapper) Upcast(
+	_*struct{
+		maps.It
+		maps.Format `to:"http:status-code"`
+	  }, _ *api.UpcastError,
+) int {
+	return http.StatusBadRequest
+}
+
 func (s *StatusCodeMapper) Validation(
 	_*struct{
 		maps.It
@@ -56,6 +65,33 @@ func (s *StatusCodeMapper) AccessDenied(
 	return http.StatusForbidden
 }
 
+func (s *StatusCodeMapper) LimitExceeded(
+	_*struct{
+		maps.It
+		maps.Format `to:"http:status-code"`
+	  }, _ *api.LimitExceededError,
+) int {
+	return http.StatusRequestEntityTooLarge
+}
+
+func (s *StatusCodeMapper) MaxBytes(
+	_*struct{
+		maps.It
+		maps.Format `to:"http:status-code"`
+	  }, _ *http.MaxBytesError,
+) int {
+	return http.StatusRequestEntityTooLarge
+}
+
+func (s *StatusCodeMapper) ProcessTimeout(
+	_*struct{
+		maps.It
+		maps.Format `to:"http:status-code"`
+	  }, _ *ProcessTimeoutError,
+) int {
+	return http.StatusServiceUnavailable
+}
+
 func (s *StatusCodeMapper) JsonSyntax(
 	_*struct{
 		maps.It
@@ -0,0 +1,100 @@
+package httpsrv
+
+import (
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"reflect"
+	"strings"
+)
+
+type (
+	// ExposeOptions restrict the payloads dispatched remotely to
+	// the types marked with api.Exposed.  Types exposes additional
+	// types that cannot be marked, such as those of other modules.
+	// The requests of a batch must all be exposed.
+	ExposeOptions struct {
+		Types []ExposedType
+	}
+
+	// ExposedType exposes a message type on the request path prefixes.
+	// Type matches the type id or go type name of the message and
+	// no Paths expose the type on all paths.
+	ExposedType struct {
+		Type  string
+		Paths []string
+	}
+)
+
+
+// ExposeOptions
+
+// Exposes returns true if the type can be dispatched on the request path.
+func (e *ExposeOptions) Exposes(typ reflect.Type, path string) bool {
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == nil {
+		return false
+	}
+	if api.IsExposed(typ, path) {
+		return true
+	}
+	var et *ExposedType
+	if id, ok := api.TypeIdOf(typ); ok {
+		et = e.exposedType(id)
+	}
+	if et == nil {
+		et = e.exposedType(typ.String())
+	}
+	return et != nil && api.MatchPath(et.Paths, path)
+}
+
+// exposedType returns the ExposedType matching the type name.
+func (e *ExposeOptions) exposedType(name string) *ExposedType {
+	for i := range e.Types {
+		if strings.EqualFold(e.Types[i].Type, name) {
+			return &e.Types[i]
+		}
+	}
+	return nil
+}
+
+// exposes returns true if the payload can be dispatched on the
+// request path.  Every remote dispatch is checked here and all
+// payloads are exposed without ExposeOptions.  Published messages
+// are checked directly and batches if all their requests are.
+func (e *ExposeOptions) exposes(payload any, path string) bool {
+	if e == nil {
+		return true
+	}
+	var requests []any
+	switch batch := payload.(type) {
+	case api.Published:
+		return e.exposes(batch.Message, path)
+	case *api.Published:
+		return e.exposes(batch.Message, path)
+	case api.ConcurrentBatch:
+		requests = batch.Requests
+	case *api.ConcurrentBatch:
+		requests = batch.Requests
+	case api.SequentialBatch:
+		requests = batch.Requests
+	case *api.SequentialBatch:
+		requests = batch.Requests
+	default:
+		return e.Exposes(reflect.TypeOf(payload), path)
+	}
+	for _, request := range requests {
+		if !e.exposes(request, path) {
+			return false
+		}
+	}
+	return true
+}
+
+
+// Expose returns a miruken.Builder that only dispatches
+// payloads exposed for remote use.
+func Expose(options ExposeOptions) miruken.Builder {
+	return miruken.Options(Options{Expose: &options})
+}
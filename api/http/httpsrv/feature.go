@@ -3,20 +3,26 @@ package httpsrv
 import (
 	"github.com/miruken-go/miruken"
 	"github.com/miruken-go/miruken/api/http"
+	"github.com/miruken-go/miruken/api/http/ws"
 )
 
 // Installer configures http server support
 type Installer struct {}
 
 func (i *Installer) DependsOn() []miruken.Feature {
-	return []miruken.Feature{http.Feature()}
+	return []miruken.Feature{http.Feature(), ws.Feature()}
 }
 
 func (i *Installer) Install(setup *miruken.SetupBuilder) error {
 	if setup.Tag(&featureTag) {
 		setup.Specs(
 			&ApiHandler{},
-			&StatusCodeMapper{})
+			&SocketHandler{},
+			&SocketHub{},
+			&StatusCodeMapper{},
+			&QueryMapper{},
+			&Operations{},
+			&Cors{})
 	}
 	return nil
 }
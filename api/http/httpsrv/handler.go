@@ -2,11 +2,13 @@ package httpsrv
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/go-logr/logr"
 	"github.com/miruken-go/miruken"
 	"github.com/miruken-go/miruken/api"
+	http2 "github.com/miruken-go/miruken/api/http"
 	"github.com/miruken-go/miruken/args"
 	"github.com/miruken-go/miruken/internal"
 	"github.com/miruken-go/miruken/internal/slices"
@@ -17,13 +19,28 @@ import (
 	"net/http"
 	"net/textproto"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 )
 
-// ApiHandler is an http.Handler for processing api requests over http.
-type ApiHandler struct {
-	logger logr.Logger
-}
+type (
+	// Options customize the processing of api requests.
+	Options struct {
+		Compress *http2.CompressOptions
+		Queries  []QueryRoute
+		Async    *AsyncOptions
+		Limits   *LimitOptions
+		Expose   *ExposeOptions
+		Socket   *SocketOptions
+		Health   *HealthOptions
+	}
+
+	// ApiHandler is an http.Handler for processing api requests over http.
+	ApiHandler struct {
+		logger logr.Logger
+	}
+)
 
 
 func (a *ApiHandler) Constructor(
@@ -43,15 +60,98 @@ func (a *ApiHandler) ServeHTTP(
 ) {
 	defer a.handlePanic(w)
 
-	accepted, from, publish := a.acceptRequest(w, r)
-	if !accepted {
+	if r.Method == http.MethodOptions {
+		a.serveOptions(w, r)
+		return
+	}
+
+	var from *maps.Format
+	var publish bool
+	get       := r.Method == http.MethodGet
+	query     := get && strings.HasPrefix(r.URL.Path, queryPrefix)
+	operation := get && strings.HasPrefix(r.URL.Path, operationsPrefix)
+	if get && strings.HasPrefix(r.URL.Path, healthPrefix) {
+		a.serveHealth(w, r, h)
+		return
+	}
+	if !query && !operation {
+		var accepted bool
+		if accepted, from, publish = a.acceptRequest(w, r); !accepted {
+			return
+		}
+	}
+
+	options, _ := miruken.GetOptions[Options](h)
+	maxBodySize, ok := limitRequest(w, r, options.Limits)
+	if !ok {
+		return
+	}
+
+	w, done := compressResponse(w, r, options.Compress)
+	defer done()
+
+	if encoding := r.Header.Get("Content-Encoding"); len(encoding) > 0 {
+		body, err := http2.NewDecoder(r.Body, encoding)
+		if err != nil {
+			var ue *http2.UnsupportedEncodingError
+			if errors.As(err, &ue) {
+				http.Error(w, "415 unsupported 'Content-Encoding' header", http.StatusUnsupportedMediaType)
+			} else {
+				http.Error(w, "400 "+err.Error(), http.StatusBadRequest)
+			}
+			return
+		}
+		defer func() { _ = body.Close() }()
+		r.Body = body
+	}
+
+	// limit the decompressed body to guard against expansion
+	if maxBodySize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	}
+	var body *countReader
+	if options.Limits != nil {
+		body   = &countReader{ReadCloser: r.Body}
+		r.Body = body
+	}
+
+	// async requests continue after the response is sent
+	ctx   := r.Context()
+	async := !publish && options.Async != nil && preferAsync(r.Header)
+	if async {
+		ctx = context.WithoutCancel(ctx)
+	}
+
+	h = miruken.BuildUp(h,
+		api.Polymorphic,
+		provides.With(ctx),
+		provides.With(textproto.MIMEHeader(r.Header)))
+
+	if limits := options.Limits; limits != nil && (limits.MaxParts > 0 || limits.MaxPartSize > 0) {
+		h = miruken.BuildUp(h, api.MultipartLimits(limits.MaxParts, limits.MaxPartSize))
+	}
+
+	// restore the Stash entries propagated by the caller
+	h = miruken.AddHandlers(h, api.NewStash(false))
+	if err := api.StashFromHeader(h, textproto.MIMEHeader(r.Header)); err != nil {
+		http.Error(w, "400 "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	h = miruken.BuildUp(h, api.Polymorphic, provides.With(r.Context()))
+	if query {
+		a.serveQuery(w, r, h, &options)
+		return
+	} else if operation {
+		a.serveOperation(w, r, h, &options)
+		return
+	}
 
 	msg, _, _, err := maps.Out[api.Message](h, r.Body, from)
 	if err != nil {
+		if sc := limitStatusCode(err); sc != 0 {
+			http.Error(w, strconv.Itoa(sc)+" "+err.Error(), sc)
+			return
+		}
 		a.encodeError(err, http.StatusUnsupportedMediaType, w, h)
 		return
 	}
@@ -70,12 +170,40 @@ func (a *ApiHandler) ServeHTTP(
 		h = miruken.BuildUp(h, provides.With(c))
 	}
 
+	// only payloads exposed for remote use are dispatched
+	if !options.Expose.exposes(payload, r.URL.Path) {
+		http.Error(w, "404 not found", http.StatusNotFound)
+		return
+	}
+
+	// bodies are bounded by the limits of the payload type
+	if !limitPayload(w, body, payload, options.Limits) {
+		return
+	}
+
+	// older message versions are upcast before dispatch
+	if payload, err = api.Upcast(h, payload); err != nil {
+		a.encodeError(err, 0, w, h)
+		return
+	}
+
+	// synchronous requests are bounded by the processing timeout
+	var timeout time.Duration
+	if limits := options.Limits; limits != nil && !async {
+		if timeout = limits.processTimeout(payload); timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+			h = miruken.BuildUp(h, provides.With(ctx))
+		}
+	}
+
 	if publish {
 		if pv, err := api.Publish(h, payload); err != nil {
 			a.encodeError(err, 0, w, h)
 		} else if pv == nil {
 			a.encodeResult(nil, r, w, h)
-		} else if _, err = pv.Await(); err == nil {
+		} else if _, err = awaitWithin(ctx, pv, timeout); err == nil {
 			a.encodeResult(nil, r, w, h)
 		} else {
 			a.encodeError(err, 0, w, h)
@@ -85,7 +213,9 @@ func (a *ApiHandler) ServeHTTP(
 			a.encodeError(err, 0, w, h)
 		} else if pr == nil {
 			a.encodeResult(res, r, w, h)
-		} else if res, err = pr.Await(); err == nil {
+		} else if async {
+			a.acceptAsync(pr, w, r, h, options.Async)
+		} else if res, err = awaitWithin(ctx, pr, timeout); err == nil {
 			a.encodeResult(res, r, w, h)
 		} else {
 			a.encodeError(err, 0, w, h)
@@ -98,7 +228,7 @@ func (a *ApiHandler) acceptRequest(
 	r *http.Request,
 ) (accepted bool, format *maps.Format, publish bool) {
 	if r.Method != "POST" {
-		w.Header().Set("Allow", "POST")
+		w.Header().Set("Allow", "OPTIONS, POST")
 		http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
@@ -112,7 +242,7 @@ func (a *ApiHandler) acceptRequest(
 		http.Error(w, "415 invalid 'Content-Type' header", http.StatusUnsupportedMediaType)
 		return
 	}
-	path := r.RequestURI
+	path := r.URL.Path
 	if path == "/process" || strings.HasPrefix(path, "/process/") {
 		accepted = true
 		publish  = false
@@ -125,6 +255,27 @@ func (a *ApiHandler) acceptRequest(
 	return
 }
 
+// serveOptions responds with the methods allowed for the path.
+// CORS preflight requests are answered by the Cors Middleware.
+func (a *ApiHandler) serveOptions(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	path := r.URL.Path
+	switch {
+	case path == "/process" || strings.HasPrefix(path, "/process/"),
+		path == "/publish" || strings.HasPrefix(path, "/publish/"):
+		w.Header().Set("Allow", "OPTIONS, POST")
+	case strings.HasPrefix(path, queryPrefix), strings.HasPrefix(path, operationsPrefix),
+		strings.HasPrefix(path, healthPrefix):
+		w.Header().Set("Allow", "GET, OPTIONS")
+	default:
+		http.Error(w, "404 not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (a *ApiHandler) encodeResult(
 	result  any,
 	r       *http.Request,
@@ -147,7 +298,11 @@ func (a *ApiHandler) encodeResult(
 		}
 		api.MergeHeader(textproto.MIMEHeader(header), content.Metadata())
 	} else if hdr := r.Header.Get("Accept"); hdr != "" {
-		if fs := accept.Parse(hdr); len(fs) > 0 {
+		// problem details only apply to errors
+		fs := slices.Filter(accept.Parse(hdr), func(a accept.Accept) bool {
+			return !isProblem(a)
+		})
+		if len(fs) > 0 {
 			formats = slices.Map[accept.Accept, *maps.Format](fs, formatAccept)
 		}
 	}
@@ -195,19 +350,28 @@ func (a *ApiHandler) encodeError(
 	w                    http.ResponseWriter,
 	handler              miruken.Handler,
 ) {
+	problem := acceptsProblem(handler)
 	if notHandledStatusCode > 0 {
 		var nh *miruken.NotHandledError
 		if errors.As(err, &nh) {
-			w.WriteHeader(notHandledStatusCode)
+			if problem {
+				a.encodeProblem(err, notHandledStatusCode, w)
+			} else {
+				w.WriteHeader(notHandledStatusCode)
+			}
 			return
 		}
 	}
-	w.Header().Set("Content-Type", api.ToJson.Name())
 	statusCode := http.StatusInternalServerError
 	handler = miruken.BuildUp(handler, miruken.BestEffort)
 	if sc, _, _, e := maps.Out[int](handler, err, toStatusCode); sc != 0 && e == nil {
 		statusCode = sc
 	}
+	if problem {
+		a.encodeProblem(err, statusCode, w)
+		return
+	}
+	w.Header().Set("Content-Type", api.ToJson.Name())
 	w.WriteHeader(statusCode)
 	out := io.Writer(w)
 	msg := api.Message{Payload: err}
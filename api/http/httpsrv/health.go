@@ -0,0 +1,78 @@
+package httpsrv
+
+import (
+	"encoding/json"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/health"
+	"github.com/miruken-go/miruken/provides"
+	"net/http"
+)
+
+// HealthOptions control the health reports exposed over http.
+// Only the status is reported unless Details are enabled since
+// check results can reveal internal failures.
+type HealthOptions struct {
+	Details bool
+}
+
+
+const healthPrefix = "/health/"
+
+
+// serveHealth responds with the liveness or readiness of the
+// application.  Degraded applications are still available
+// and respond with 200, otherwise 503.
+func (a *ApiHandler) serveHealth(
+	w http.ResponseWriter,
+	r *http.Request,
+	h miruken.Handler,
+) {
+	monitor, _, err := provides.Type[*health.Monitor](h)
+	if err != nil || monitor == nil {
+		http.Error(w, "404 not found", http.StatusNotFound)
+		return
+	}
+
+	var report *health.Report
+	switch r.URL.Path {
+	case healthPrefix + "live":
+		report, err = monitor.Live(r.Context(), h)
+	case healthPrefix + "ready":
+		report, err = monitor.Ready(r.Context(), h)
+	default:
+		http.Error(w, "404 not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		a.encodeError(err, 0, w, h)
+		return
+	}
+
+	if options, _ := miruken.GetOptions[Options](h); !options.Health.details() {
+		report = &health.Report{Status: report.Status, Checked: report.Checked}
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "application/json")
+	header.Set("Cache-Control", "no-store")
+	if report.Status == health.StatusDown {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		a.logger.Error(err, "unable to write health report")
+	}
+}
+
+
+// HealthOptions
+
+func (o *HealthOptions) details() bool {
+	return o != nil && o.Details
+}
+
+
+// Health returns a miruken.Builder that controls the
+// health reports exposed over http.
+func Health(options HealthOptions) miruken.Builder {
+	return miruken.Options(Options{Health: &options})
+}
@@ -0,0 +1,254 @@
+package httpsrv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/promise"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// LimitOptions bound the resources consumed by a request.
+	// Bodies larger than MaxBodySize fail with 413 before decoding.
+	// ReadTimeout bounds reading the request and ProcessTimeout
+	// bounds handling the message.  Types override the limits
+	// for specific message types and are checked again once
+	// the payload is decoded.
+	LimitOptions struct {
+		MaxBodySize    int64
+		MaxParts       int
+		MaxPartSize    int64
+		ReadTimeout    time.Duration
+		ProcessTimeout time.Duration
+		Types          []TypeLimit
+	}
+
+	// TypeLimit overrides the limits for a message type.
+	// Type matches the type id or go type name of the message.
+	TypeLimit struct {
+		Type           string
+		MaxBodySize    int64
+		ProcessTimeout time.Duration
+	}
+
+	// countReader counts the bytes read from a request body.
+	countReader struct {
+		io.ReadCloser
+		n int64
+	}
+
+	// ProcessTimeoutError reports a message that could not
+	// be handled within the processing timeout.
+	ProcessTimeoutError struct {
+		Timeout time.Duration
+	}
+)
+
+
+func (e *ProcessTimeoutError) Error() string {
+	return fmt.Sprintf("processing exceeded timeout of %v", e.Timeout)
+}
+
+func (e *ProcessTimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+
+// LimitOptions
+
+// typeLimit returns the TypeLimit matching the type name.
+func (l *LimitOptions) typeLimit(name string) *TypeLimit {
+	if len(name) == 0 {
+		return nil
+	}
+	for i := range l.Types {
+		if strings.EqualFold(l.Types[i].Type, name) {
+			return &l.Types[i]
+		}
+	}
+	return nil
+}
+
+// maxBodySize returns the body limit for requests to
+// /process/{type} or /publish/{type}.
+func (l *LimitOptions) maxBodySize(path string) int64 {
+	if tl := l.typeLimit(pathType(path)); tl != nil && tl.MaxBodySize > 0 {
+		return tl.MaxBodySize
+	}
+	return l.MaxBodySize
+}
+
+// payloadLimit returns the TypeLimit matching the payload type.
+func (l *LimitOptions) payloadLimit(payload any) *TypeLimit {
+	typ := reflect.TypeOf(payload)
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	var tl *TypeLimit
+	if id, ok := api.TypeIdOf(typ); ok {
+		tl = l.typeLimit(id)
+	}
+	if tl == nil {
+		tl = l.typeLimit(typ.String())
+	}
+	return tl
+}
+
+// payloadSize returns the body limit for the payload.
+func (l *LimitOptions) payloadSize(payload any) int64 {
+	if tl := l.payloadLimit(payload); tl != nil && tl.MaxBodySize > 0 {
+		return tl.MaxBodySize
+	}
+	return l.MaxBodySize
+}
+
+// frameSize returns the largest body limit of any type or 0
+// if a type is unbounded.  The type of a websocket frame is
+// unknown until decoded so it is checked by payloadSize.
+func (l *LimitOptions) frameSize() int64 {
+	max := l.MaxBodySize
+	if max <= 0 {
+		return 0
+	}
+	for _, tl := range l.Types {
+		if tl.MaxBodySize > max {
+			max = tl.MaxBodySize
+		}
+	}
+	return max
+}
+
+// processTimeout returns the processing timeout for the payload.
+func (l *LimitOptions) processTimeout(payload any) time.Duration {
+	if tl := l.payloadLimit(payload); tl != nil && tl.ProcessTimeout > 0 {
+		return tl.ProcessTimeout
+	}
+	return l.ProcessTimeout
+}
+
+
+// Limits returns a miruken.Builder that limits the size
+// and duration of requests.
+func Limits(options LimitOptions) miruken.Builder {
+	return miruken.Options(Options{Limits: &options})
+}
+
+
+// limitRequest enforces the read deadline and returns the body
+// limit.  Requests declaring a body larger than the limit are
+// rejected with 413 before any of it is read.
+func limitRequest(
+	w       http.ResponseWriter,
+	r       *http.Request,
+	options *LimitOptions,
+) (max int64, ok bool) {
+	if options == nil {
+		return 0, true
+	}
+	if timeout := options.ReadTimeout; timeout > 0 {
+		_ = http.NewResponseController(w).SetReadDeadline(time.Now().Add(timeout))
+	}
+	if max = options.maxBodySize(r.URL.Path); max > 0 && r.ContentLength > max {
+		w.Header().Set("Connection", "close")
+		bodyTooLarge(w, max)
+		return max, false
+	}
+	return max, true
+}
+
+// limitPayload rejects bodies larger than the limit of the
+// decoded payload.  The type of a request to /process or
+// /publish is unknown until decoded so it is checked here.
+func limitPayload(
+	w       http.ResponseWriter,
+	body    *countReader,
+	payload any,
+	options *LimitOptions,
+) bool {
+	if options == nil || body == nil {
+		return true
+	}
+	if max := options.payloadSize(payload); max > 0 && body.n > max {
+		bodyTooLarge(w, max)
+		return false
+	}
+	return true
+}
+
+func bodyTooLarge(w http.ResponseWriter, max int64) {
+	http.Error(w, "413 request body exceeds limit of "+
+		strconv.FormatInt(max, 10)+" bytes", http.StatusRequestEntityTooLarge)
+}
+
+// limitStatusCode returns the status code for errors caused
+// by exceeding a limit or 0 if not.
+func limitStatusCode(err error) int {
+	var mb *http.MaxBytesError
+	var le *api.LimitExceededError
+	var ne net.Error
+	switch {
+	case errors.As(err, &mb), errors.As(err, &le):
+		return http.StatusRequestEntityTooLarge
+	case errors.As(err, &ne) && ne.Timeout():
+		return http.StatusRequestTimeout
+	}
+	return 0
+}
+
+// awaitWithin waits for the promise to complete or the context
+// deadline to expire.
+func awaitWithin[T any](
+	ctx     context.Context,
+	pr      *promise.Promise[T],
+	timeout time.Duration,
+) (T, error) {
+	if timeout <= 0 {
+		return pr.Await()
+	}
+	type result struct {
+		res T
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		res, err := pr.Await()
+		done <- result{res, err}
+	}()
+	select {
+	case r := <-done:
+		return r.res, r.err
+	case <-ctx.Done():
+		var zero T
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return zero, &ProcessTimeoutError{timeout}
+		}
+		return zero, ctx.Err()
+	}
+}
+
+// pathType returns the message type in /process/{type}
+// or /publish/{type} paths.
+func pathType(path string) string {
+	for _, prefix := range []string{"/process/", "/publish/"} {
+		if typ, ok := strings.CutPrefix(path, prefix); ok {
+			return strings.Trim(typ, "/")
+		}
+	}
+	return ""
+}
@@ -30,6 +30,7 @@ type (
 		policy          miruken.Policy
 		extraComponents []any
 		surrogates      map[reflect.Type]any
+		expose          *httpsrv.ExposeOptions
 		apiProfiles     map[string]*apiProfile
 		apiDocs         map[string]*openapi3.T
 		modules         []*debug.Module
@@ -165,6 +166,9 @@ func (i *Installer) BindingCreated(
 		if inType.Kind() == reflect.Ptr {
 			inType = inType.Elem()
 		}
+		if expose := i.expose; expose != nil && !expose.Exposes(inType, "/process") {
+			return
+		}
 		spec := handlerInfo.Spec()
 		ap   := i.apiProfile(spec.PkgPath())
 		if schema, inputName, created := i.generateTypeSchema(ap, inType, false); created {
@@ -419,6 +423,9 @@ func (i *Installer) generateComponentSchema(
 		component = sur
 	}
 	name := typ.Name()
+	if id, ok := api.TypeIdOf(typ); ok {
+		name = id
+	}
 	kind := typ.Kind()
 	list := kind == reflect.Slice || kind == reflect.Array
 	var elemTyp reflect.Type
@@ -431,6 +438,9 @@ func (i *Installer) generateComponentSchema(
 	if len(name) == 0 {
 		if list {
 			if name = elemTyp.Name(); len(name) > 0 {
+				if id, ok := api.TypeIdOf(elemTyp); ok {
+					name = id
+				}
 				name = name + "Array"
 			}
 		}
@@ -536,6 +546,14 @@ func Surrogates(surrogates map[reflect.Type]any) func(*Installer) {
 	}
 }
 
+// ExposedOnly documents only the message types exposed for
+// remote use as described by httpsrv.ExposeOptions.
+func ExposedOnly(options httpsrv.ExposeOptions) func(*Installer) {
+	return func(installer *Installer) {
+		installer.expose = &options
+	}
+}
+
 // Feature configures http server support
 func Feature(
 	base   openapi3.T,
@@ -555,9 +573,15 @@ func Feature(
 			json2.Error{
 				Message: "Something bad happened.",
 			},
+			api.ConcurrentBatch{},
 		},
 		surrogates: map[reflect.Type]any{
-			internal.TypeOf[api.ConcurrentBatch](): json2.Concurrent{},
+			internal.TypeOf[api.ConcurrentBatch](): stdjson.ConcurrentBatch{
+				Requests:    []json.RawMessage{},
+				MaxParallel: 4,
+				FailFast:    true,
+				Timeout:     "5s",
+			},
 			internal.TypeOf[api.SequentialBatch](): json2.Sequential{},
 			internal.TypeOf[api.ScheduledResult](): stdjson.ScheduledResult{
 				stdjson.Either[error, any]{
@@ -38,6 +38,7 @@ type (
 	}
 
 	CreatePlayer struct {
+		api.Exposed
 		Name      string
 		BirthDate time.Time
 		Address   Address
@@ -50,6 +51,11 @@ type (
 		Address   Address
 	}
 
+	RetirePlayer struct {
+		_  struct{} `typeid:"players.Retire"`
+		Id int32
+	}
+
 	PlayerResult struct {
 		Id      int32
 		Version int32
@@ -92,6 +98,18 @@ func (p *PlayerHandler) UpdatePlayer(
 	}
 }
 
+func (p *PlayerHandler) RetirePlayer(
+	_ *handles.It, retire RetirePlayer,
+) *promise.Promise[PlayerResult] {
+	if player, ok := p.store[retire.Id]; !ok {
+		nf := fmt.Errorf("player with id %v not found", retire.Id)
+		return promise.Reject[PlayerResult](nf)
+	} else {
+		delete(p.store, retire.Id)
+		return promise.Resolve(PlayerResult{player.Id, player.Version})
+	}
+}
+
 type OpenApiTestSuite struct {
 	suite.Suite
 	openapi *openapi.Installer
@@ -144,6 +162,46 @@ func (suite *OpenApiTestSuite) TestOpenApi() {
 		docs := suite.openapi.Docs()
 		suite.Len(docs, 1)
 	})
+
+	suite.Run("Documents Concurrent Batch Options", func() {
+		for _, doc := range suite.openapi.Docs() {
+			schema := doc.Components.Schemas["ConcurrentBatch"]
+			suite.NotNil(schema)
+			for _, prop := range []string{"requests", "maxParallel", "failFast", "timeout"} {
+				suite.Contains(schema.Value.Properties, prop)
+			}
+			example := fmt.Sprint(schema.Value.Example)
+			suite.Contains(example, `"requests":[]`)
+			suite.NotContains(example, "GetQuote")
+		}
+	})
+
+	suite.Run("Names Requests By Type Id", func() {
+		for _, doc := range suite.openapi.Docs() {
+			suite.Contains(doc.Components.RequestBodies, "players.RetireRequest")
+			suite.NotContains(doc.Components.RequestBodies, "RetirePlayerRequest")
+			suite.Contains(doc.Paths, "/process/players.retire")
+		}
+	})
+
+	suite.Run("Documents Exposed Only", func() {
+		installer := openapi.Feature(openapi3.T{}, openapi.ExposedOnly(httpsrv.ExposeOptions{
+			Types: []httpsrv.ExposedType{{Type: "players.Retire"}},
+		}))
+		_, err := miruken.Setup(TestFeature, stdjson.Feature(), installer).
+			Specs(&api.GoPolymorphism{}).
+			Handler()
+		suite.Nil(err)
+		suite.Len(installer.Docs(), 1)
+		for _, doc := range installer.Docs() {
+			suite.Contains(doc.Paths, "/process/createplayer")
+			suite.Contains(doc.Paths, "/process/players.retire")
+			suite.NotContains(doc.Paths, "/process/updateplayer")
+			suite.NotContains(doc.Components.RequestBodies, "UpdatePlayerRequest")
+			schema := doc.Components.RequestBodies["CreatePlayerRequest"].Value.Content.Get("application/json").Schema
+			suite.NotContains(schema.Value.Properties["payload"].Value.Properties, "exposed")
+		}
+	})
 }
 
 func TestOpenApiTestSuite(t *testing.T) {
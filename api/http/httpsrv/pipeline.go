@@ -125,6 +125,16 @@ func getServeHTTPCaller(typ reflect.Type) (miruken.CallerFunc, error) {
 func Pipeline(
 	handler    miruken.Handler,
 	middleware ...Middleware,
+) http.Handler {
+	return pipeline(handler, serveApi, middleware)
+}
+
+// pipeline returns a http.Handler that runs the Middleware
+// components before invoking the terminal serve function.
+func pipeline(
+	handler    miruken.Handler,
+	serve      func(http.ResponseWriter, *http.Request, miruken.Handler),
+	middleware []Middleware,
 ) http.Handler {
 	ctx, ok := handler.(*context.Context)
 	if !ok {
@@ -163,17 +173,7 @@ func Pipeline(
 					return
 				}
 			} else {
-				a, cp, err := provides.Type[*ApiHandler](h)
-				if a == nil || err != nil {
-					w.WriteHeader(http.StatusInternalServerError)
-					return
-				} else if cp != nil {
-					if a, err = cp.Await(); err != nil {
-						w.WriteHeader(http.StatusInternalServerError)
-						return
-					}
-				}
-				a.ServeHTTP(w, r, h)
+				serve(w, r, h)
 			}
 		}
 
@@ -181,6 +181,34 @@ func Pipeline(
 	})
 }
 
+func serveApi(
+	w http.ResponseWriter,
+	r *http.Request,
+	h miruken.Handler,
+) {
+	if a, ok := resolveApiHandler(w, h); ok {
+		a.ServeHTTP(w, r, h)
+	}
+}
+
+// resolveApiHandler resolves the ApiHandler or fails the request.
+func resolveApiHandler(
+	w http.ResponseWriter,
+	h miruken.Handler,
+) (*ApiHandler, bool) {
+	a, cp, err := provides.Type[*ApiHandler](h)
+	if a == nil || err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, false
+	} else if cp != nil {
+		if a, err = cp.Await(); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return nil, false
+		}
+	}
+	return a, true
+}
+
 func handlePanic(w http.ResponseWriter, r *http.Request) {
 	if rc := recover(); rc != nil {
 		buf := make([]byte, 2048)
@@ -0,0 +1,50 @@
+package httpsrv
+
+import (
+	"encoding/json"
+	"github.com/miruken-go/miruken"
+	http2 "github.com/miruken-go/miruken/api/http"
+	"github.com/miruken-go/miruken/provides"
+	"github.com/timewasted/go-accept-headers"
+	"net/http"
+	"net/textproto"
+)
+
+// acceptsProblem returns true if the request prefers errors
+// as problem details.  e.g. Accept: application/problem+json
+// Problem details must be explicitly accepted with a quality
+// at least that of any other accepted media type.
+func acceptsProblem(handler miruken.Handler) bool {
+	header, _, err := provides.Type[textproto.MIMEHeader](handler)
+	if err != nil || header == nil {
+		return false
+	}
+	var problem, other float64
+	for _, a := range accept.Parse(header.Get("Accept")) {
+		if isProblem(a) {
+			problem = max(problem, a.Q)
+		} else {
+			other = max(other, a.Q)
+		}
+	}
+	return problem > 0 && problem >= other
+}
+
+// isProblem returns true if the accepted media type is problem details.
+func isProblem(a accept.Accept) bool {
+	return a.Type + "/" + a.Subtype == http2.ProblemJson
+}
+
+// encodeProblem writes the error as problem details.
+func (a *ApiHandler) encodeProblem(
+	err        error,
+	statusCode int,
+	w          http.ResponseWriter,
+) {
+	problem := http2.NewProblem(statusCode, err)
+	w.Header().Set("Content-Type", http2.ProblemJson)
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(problem); err != nil {
+		a.logger.Error(err, "unable to write problem")
+	}
+}
@@ -0,0 +1,362 @@
+package httpsrv
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"fmt"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/creates"
+	"github.com/miruken-go/miruken/internal"
+	"github.com/miruken-go/miruken/maps"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// QueryRoute exposes a message type for GET requests to
+	// /query/{Path} where Path defaults to the Type id.
+	// Path segments named {field} and query parameters are
+	// bound to the fields of the message.
+	QueryRoute struct {
+		Path   string
+		Type   string
+		MaxAge time.Duration
+	}
+
+	// QueryMapper binds query parameters to messages.
+	QueryMapper struct {}
+
+	// QueryBindError reports a query parameter that could
+	// not be bound to the message.
+	QueryBindError struct {
+		Field  string
+		Reason error
+	}
+
+	// bufferedResponse captures a response so it can be
+	// inspected before it is written.
+	bufferedResponse struct {
+		header http.Header
+		status int
+		body   bytes.Buffer
+	}
+)
+
+
+const queryPrefix = "/query/"
+
+
+func (e *QueryBindError) Error() string {
+	return fmt.Sprintf("query parameter %q: %s", e.Field, e.Reason.Error())
+}
+
+func (e *QueryBindError) Unwrap() error {
+	return e.Reason
+}
+
+
+// QueryRoute
+
+// match returns the path variables if the request path matches.
+func (q *QueryRoute) match(path string) (url.Values, bool) {
+	template := q.Path
+	if len(template) == 0 {
+		template = q.Type
+	}
+	expected := strings.Split(strings.Trim(template, "/"), "/")
+	actual   := strings.Split(strings.Trim(path, "/"), "/")
+	if len(expected) != len(actual) {
+		return nil, false
+	}
+	var vars url.Values
+	for i, segment := range expected {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			value, err := url.PathUnescape(actual[i])
+			if err != nil || len(value) == 0 {
+				return nil, false
+			}
+			if vars == nil {
+				vars = make(url.Values)
+			}
+			vars.Set(segment[1:len(segment)-1], value)
+		} else if segment != actual[i] {
+			return nil, false
+		}
+	}
+	return vars, true
+}
+
+
+// QueryMapper
+
+func (m *QueryMapper) FromQuery(
+	_*struct{
+		maps.Format `from:"http:query"`
+	  }, values url.Values,
+	it *maps.It,
+) (any, error) {
+	target := it.TargetForWrite()
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("query parameters cannot be bound to %T", target)
+	}
+	keys := make(map[string]string, len(values))
+	for key := range values {
+		keys[strings.ToLower(key)] = key
+	}
+	return target, bindQuery(v.Elem(), values, keys)
+}
+
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) WriteHeader(statusCode int) {
+	if b.status == 0 {
+		b.status = statusCode
+	}
+}
+
+
+// Query returns a miruken.Builder that exposes the message
+// type with the id for GET requests.
+func Query(routes ...QueryRoute) miruken.Builder {
+	return miruken.Options(Options{Queries: routes})
+}
+
+// QueryType returns a QueryRoute for the message type T
+// which must declare a stable type id.
+func QueryType[T any](path string) QueryRoute {
+	typ := internal.TypeOf[T]()
+	id, ok := api.TypeIdOf(typ)
+	if !ok {
+		panic(fmt.Sprintf("query type %v has no type id", typ))
+	}
+	return QueryRoute{Path: path, Type: id}
+}
+
+
+// serveQuery dispatches a message bound from the request
+// to a QueryRoute.  Responses include an ETag so unchanged
+// results can be validated with If-None-Match.
+func (a *ApiHandler) serveQuery(
+	w       http.ResponseWriter,
+	r       *http.Request,
+	h       miruken.Handler,
+	options *Options,
+) {
+	path := strings.TrimPrefix(r.URL.Path, queryPrefix)
+	var route *QueryRoute
+	var vars  url.Values
+	for i := range options.Queries {
+		if v, ok := options.Queries[i].match(path); ok {
+			route, vars = &options.Queries[i], v
+			break
+		}
+	}
+	if route == nil {
+		http.Error(w, "404 not found", http.StatusNotFound)
+		return
+	}
+
+	msg, _, err := creates.Key[any](h, route.Type)
+	if err != nil || internal.IsNil(msg) {
+		http.Error(w, "404 unknown query type", http.StatusNotFound)
+		return
+	} else if !options.Expose.exposes(msg, r.URL.Path) {
+		http.Error(w, "404 not found", http.StatusNotFound)
+		return
+	}
+
+	values := r.URL.Query()
+	for key, value := range vars {
+		values[key] = value
+	}
+	if _, _, err = maps.Into(h, values, &msg, fromQuery); err != nil {
+		http.Error(w, "400 "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var res bufferedResponse
+	res.header = w.Header()
+	if result, pr, err := api.Send[any](h, msg); err != nil {
+		a.encodeError(err, http.StatusNotFound, &res, h)
+	} else if pr == nil {
+		a.encodeResult(result, r, &res, h)
+	} else if result, err = pr.Await(); err == nil {
+		a.encodeResult(result, r, &res, h)
+	} else {
+		a.encodeError(err, http.StatusNotFound, &res, h)
+	}
+
+	status := res.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if status == http.StatusOK {
+		sum  := sha256.Sum256(res.body.Bytes())
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		res.header.Set("ETag", etag)
+		// the representation depends on the negotiated format
+		res.header.Add("Vary", "Accept")
+		if route.MaxAge > 0 {
+			res.header.Set("Cache-Control",
+				"max-age="+strconv.Itoa(int(route.MaxAge.Seconds())))
+		}
+		if etagMatch(r.Header.Get("If-None-Match"), etag) {
+			res.header.Del("Content-Type")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	w.WriteHeader(status)
+	if _, err := w.Write(res.body.Bytes()); err != nil {
+		a.logger.Error(err, "unable to write response")
+	}
+}
+
+
+// bindQuery assigns the query parameters to the matching
+// fields of the struct.  Fields are matched case-insensitively
+// by the name in the `query` or `json` tag or the field name.
+func bindQuery(
+	v      reflect.Value,
+	values url.Values,
+	keys   map[string]string,
+) error {
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := bindQuery(v.Field(i), values, keys); err != nil {
+				return err
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("query"); ok {
+			if tag = strings.Split(tag, ",")[0]; tag == "-" {
+				continue
+			} else if len(tag) > 0 {
+				name = tag
+			}
+		} else if tag, ok := field.Tag.Lookup("json"); ok {
+			if tag = strings.Split(tag, ",")[0]; tag == "-" {
+				continue
+			} else if len(tag) > 0 {
+				name = tag
+			}
+		}
+		key, ok := keys[strings.ToLower(name)]
+		if !ok {
+			continue
+		}
+		if err := setQueryValue(v.Field(i), values[key]); err != nil {
+			return &QueryBindError{key, err}
+		}
+	}
+	return nil
+}
+
+func setQueryValue(v reflect.Value, values []string) error {
+	if len(values) == 0 {
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		elem := reflect.New(v.Type().Elem())
+		if err := setQueryValue(elem.Elem(), values); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(values[0]))
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(values[0])
+		if err == nil {
+			v.SetInt(int64(d))
+		}
+		return err
+	}
+	value := values[0]
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		// repeated parameters or a comma separated list
+		if len(values) == 1 {
+			values = strings.Split(value, ",")
+		}
+		slice := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setQueryValue(slice.Index(i), []string{value}); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	default:
+		return fmt.Errorf("unsupported type %v", v.Type())
+	}
+	return nil
+}
+
+// etagMatch returns true if the If-None-Match header matches the etag.
+func etagMatch(header, etag string) bool {
+	if len(header) == 0 {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+
+var (
+	fromQuery    = maps.From("http:query", nil)
+	durationType = internal.TypeOf[time.Duration]()
+)
@@ -0,0 +1,485 @@
+package httpsrv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/api/http/ws"
+	"github.com/miruken-go/miruken/args"
+	"github.com/miruken-go/miruken/handles"
+	"github.com/miruken-go/miruken/maps"
+	"github.com/miruken-go/miruken/provides"
+	"golang.org/x/net/websocket"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// SocketOptions customize websocket connections.  Browsers
+	// can only connect from the same host or one of the Origins,
+	// which may contain * wildcards.  MaxConcurrent bounds the
+	// frames handled concurrently by each connection.
+	SocketOptions struct {
+		Origins       []string
+		MaxConcurrent int
+	}
+
+	// SocketHandler processes api messages multiplexed over
+	// a websocket connection.
+	SocketHandler struct {
+		hub    *SocketHub
+		logger logr.Logger
+	}
+
+	// SocketHub tracks the open websocket sessions and pushes
+	// published messages to subscribed clients.
+	SocketHub struct {
+		lock     sync.RWMutex
+		sessions map[*socketSession]struct{}
+	}
+
+	// socketSession represents a single websocket connection.
+	socketSession struct {
+		conn      *websocket.Conn
+		writeLock sync.Mutex
+		lock      sync.RWMutex
+		topics    map[string]struct{}
+	}
+)
+
+
+// Subscribers is the route used to push messages to
+// all websocket clients subscribed to them.
+const Subscribers = "subscribers"
+
+const defaultMaxConcurrent = 32
+
+
+// SocketOptions
+
+// checkOrigin accepts connections without an Origin, such as those
+// from non-browser clients, and those from an allowed origin.
+func (s *SocketOptions) checkOrigin(
+	config *websocket.Config,
+	r      *http.Request,
+) (err error) {
+	if config.Origin, err = websocket.Origin(config, r); err != nil || config.Origin == nil {
+		return err
+	}
+	if strings.EqualFold(config.Origin.Host, r.Host) {
+		return nil
+	}
+	if s != nil {
+		origin := strings.ToLower(config.Origin.String())
+		for _, pattern := range s.Origins {
+			if matchOrigin(strings.ToLower(pattern), origin) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("origin %q not allowed", config.Origin)
+}
+
+func (s *SocketOptions) maxConcurrent() int {
+	if s != nil && s.MaxConcurrent > 0 {
+		return s.MaxConcurrent
+	}
+	return defaultMaxConcurrent
+}
+
+
+// SocketHandler
+
+func (s *SocketHandler) Constructor(
+	hub *SocketHub,
+	_*struct{args.Optional}, logger logr.Logger,
+) {
+	s.hub = hub
+	if logger == s.logger {
+		s.logger = logr.Discard()
+	} else {
+		s.logger = logger
+	}
+}
+
+func (s *SocketHandler) ServeHTTP(
+	w http.ResponseWriter,
+	r *http.Request,
+	h miruken.Handler,
+) {
+	options, _ := miruken.GetOptions[Options](h)
+	server := websocket.Server{
+		Handshake: options.Socket.checkOrigin,
+		Handler: func(conn *websocket.Conn) {
+			s.serve(conn, r, h, &options)
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+func (s *SocketHandler) serve(
+	conn    *websocket.Conn,
+	r       *http.Request,
+	h       miruken.Handler,
+	options *Options,
+) {
+	session := &socketSession{conn: conn}
+	s.hub.add(session)
+	defer s.hub.remove(session)
+
+	header := textproto.MIMEHeader(r.Header)
+	h = miruken.BuildUp(h,
+		api.Polymorphic,
+		provides.With(r.Context()),
+		provides.With(header))
+
+	limits := options.Limits
+	if limits != nil {
+		if max := limits.frameSize(); max > 0 {
+			conn.MaxPayloadBytes = int(max)
+		}
+		if limits.MaxParts > 0 || limits.MaxPartSize > 0 {
+			h = miruken.BuildUp(h, api.MultipartLimits(limits.MaxParts, limits.MaxPartSize))
+		}
+	}
+
+	var waitGroup sync.WaitGroup
+	defer waitGroup.Wait()
+
+	// bound the frames handled concurrently
+	slots := make(chan struct{}, options.Socket.maxConcurrent())
+
+	for {
+		var frame ws.Frame
+		if err := websocket.JSON.Receive(conn, &frame); err != nil {
+			if errors.Is(err, websocket.ErrFrameTooLarge) {
+				err = &api.LimitExceededError{Limit: "frame", Max: int64(conn.MaxPayloadBytes)}
+				s.encodeError(session, frame, err, http.StatusRequestEntityTooLarge, h)
+				continue
+			}
+			if !errors.Is(err, io.EOF) {
+				s.logger.V(1).Info("websocket closed", "reason", err.Error())
+			}
+			return
+		}
+		slots <- struct{}{}
+		waitGroup.Add(1)
+		go func(frame ws.Frame) {
+			defer func() {
+				<-slots
+				waitGroup.Done()
+			}()
+			defer s.handlePanic(session, frame)
+			// restore the Stash entries propagated by the caller
+			h := miruken.AddHandlers(h, api.NewStash(false))
+			if err := api.StashFromHeader(h, header); err != nil {
+				s.encodeError(session, frame, err, http.StatusBadRequest, h)
+				return
+			}
+			s.dispatch(session, frame, r.Context(), h, options)
+		}(frame)
+	}
+}
+
+func (s *SocketHandler) dispatch(
+	session *socketSession,
+	frame   ws.Frame,
+	ctx     context.Context,
+	h       miruken.Handler,
+	options *Options,
+) {
+	switch frame.Kind {
+	case ws.KindProcess, ws.KindPublish:
+		payload, err := api.DecodeMessage(h, frame.Message)
+		if err != nil {
+			s.encodeError(session, frame, err, http.StatusUnsupportedMediaType, h)
+			return
+		} else if payload == nil {
+			s.encodeError(session, frame, errors.New("missing payload"), http.StatusBadRequest, h)
+			return
+		}
+		// only payloads exposed for remote use are dispatched
+		path := "/process"
+		if frame.Kind == ws.KindPublish {
+			path = "/publish"
+		}
+		if !options.Expose.exposes(payload, path) {
+			s.encodeError(session, frame, errors.New("not found"), http.StatusNotFound, h)
+			return
+		}
+		// frames are bounded by the limits of the payload type
+		var timeout time.Duration
+		if limits := options.Limits; limits != nil {
+			if max := limits.payloadSize(payload); max > 0 && int64(len(frame.Message)) > max {
+				err = &api.LimitExceededError{Limit: "frame", Max: max}
+				s.encodeError(session, frame, err, http.StatusRequestEntityTooLarge, h)
+				return
+			}
+			if timeout = limits.processTimeout(payload); timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+				h = miruken.BuildUp(h, provides.With(ctx))
+			}
+		}
+		if frame.Kind == ws.KindPublish {
+			if pv, err := api.Publish(h, payload); err != nil {
+				s.encodeError(session, frame, err, 0, h)
+				return
+			} else if pv != nil {
+				if _, err = awaitWithin(ctx, pv, timeout); err != nil {
+					s.encodeError(session, frame, err, 0, h)
+					return
+				}
+			}
+			if err := s.hub.broadcast(payload, session, h); err != nil {
+				s.logger.Error(err, "unable to broadcast message")
+			}
+			s.encodeResult(session, frame, nil, h)
+		} else {
+			if res, pr, err := api.Send[any](h, payload); err != nil {
+				s.encodeError(session, frame, err, 0, h)
+			} else if pr == nil {
+				s.encodeResult(session, frame, res, h)
+			} else if res, err = awaitWithin(ctx, pr, timeout); err == nil {
+				s.encodeResult(session, frame, res, h)
+			} else {
+				s.encodeError(session, frame, err, 0, h)
+			}
+		}
+	case ws.KindSubscribe:
+		session.subscribe(frame.Topics)
+		s.encodeResult(session, frame, nil, h)
+	case ws.KindUnsubscribe:
+		session.unsubscribe(frame.Topics)
+		s.encodeResult(session, frame, nil, h)
+	default:
+		err := fmt.Errorf("unrecognized frame kind %q", frame.Kind)
+		s.encodeError(session, frame, err, http.StatusBadRequest, h)
+	}
+}
+
+func (s *SocketHandler) encodeResult(
+	session *socketSession,
+	frame   ws.Frame,
+	result  any,
+	h       miruken.Handler,
+) {
+	reply := ws.Frame{Id: frame.Id, Kind: ws.KindResponse}
+	if result != nil {
+		msg, err := api.EncodeMessage(h, result)
+		if err != nil {
+			s.encodeError(session, frame, err, http.StatusNotAcceptable, h)
+			return
+		}
+		reply.Message = msg
+	}
+	if err := session.write(reply); err != nil {
+		s.logger.Error(err, "unable to write response")
+	}
+}
+
+func (s *SocketHandler) encodeError(
+	session    *socketSession,
+	frame      ws.Frame,
+	err        error,
+	statusCode int,
+	h          miruken.Handler,
+) {
+	if statusCode == 0 {
+		statusCode = http.StatusInternalServerError
+		h := miruken.BuildUp(h, miruken.BestEffort)
+		if sc, _, _, e := maps.Out[int](h, err, toStatusCode); sc != 0 && e == nil {
+			statusCode = sc
+		}
+	}
+	reply := ws.Frame{Id: frame.Id, Kind: ws.KindError, Status: statusCode}
+	if msg, e := api.EncodeMessage(h, err); e == nil {
+		reply.Message = msg
+	}
+	if err := session.write(reply); err != nil {
+		s.logger.Error(err, "unable to write error")
+	}
+}
+
+func (s *SocketHandler) handlePanic(
+	session *socketSession,
+	frame   ws.Frame,
+) {
+	if r := recover(); r != nil {
+		err, ok := r.(error)
+		if !ok {
+			err = fmt.Errorf("%v", r)
+		}
+		s.logger.Error(err, "recovering from websocket panic")
+		_ = session.write(ws.Frame{
+			Id:     frame.Id,
+			Kind:   ws.KindError,
+			Status: http.StatusInternalServerError,
+		})
+	}
+}
+
+
+// SocketHub
+
+func (h *SocketHub) Constructor(
+	_*struct{
+		provides.It
+		provides.Single
+	  },
+) {
+	h.sessions = make(map[*socketSession]struct{})
+}
+
+func (h *SocketHub) Push(
+	_*struct{
+		handles.It
+		api.Routes `scheme:"subscribers"`
+	  }, routed api.Routed,
+	ctx miruken.HandleContext,
+) error {
+	return h.Broadcast(routed.Message, ctx.Composer)
+}
+
+// Broadcast pushes the message to all sessions subscribed to it.
+func (h *SocketHub) Broadcast(
+	message any,
+	handler miruken.Handler,
+) error {
+	return h.broadcast(message, nil, miruken.BuildUp(handler, api.Polymorphic))
+}
+
+func (h *SocketHub) broadcast(
+	message any,
+	except  *socketSession,
+	handler miruken.Handler,
+) error {
+	h.lock.RLock()
+	sessions := make([]*socketSession, 0, len(h.sessions))
+	for session := range h.sessions {
+		if session != except {
+			sessions = append(sessions, session)
+		}
+	}
+	h.lock.RUnlock()
+	if len(sessions) == 0 {
+		return nil
+	}
+
+	typeInfo, _, _, err := maps.Out[api.TypeFieldInfo](handler, message, api.ToTypeInfo)
+	if err != nil {
+		return err
+	}
+	msg, err := api.EncodeMessage(handler, message)
+	if err != nil {
+		return err
+	}
+	push := ws.Frame{Kind: ws.KindPush, Topics: []string{typeInfo.TypeValue}, Message: msg}
+	for _, session := range sessions {
+		if session.subscribed(typeInfo.TypeValue) {
+			_ = session.write(push)
+		}
+	}
+	return nil
+}
+
+func (h *SocketHub) add(session *socketSession) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.sessions == nil {
+		h.sessions = make(map[*socketSession]struct{})
+	}
+	h.sessions[session] = struct{}{}
+}
+
+func (h *SocketHub) remove(session *socketSession) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	delete(h.sessions, session)
+}
+
+
+// socketSession
+
+func (s *socketSession) write(frame ws.Frame) error {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	return websocket.JSON.Send(s.conn, frame)
+}
+
+func (s *socketSession) subscribe(topics []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.topics == nil {
+		s.topics = make(map[string]struct{})
+	}
+	for _, topic := range topics {
+		s.topics[topic] = struct{}{}
+	}
+}
+
+func (s *socketSession) unsubscribe(topics []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(topics) == 0 {
+		s.topics = nil
+		return
+	}
+	for _, topic := range topics {
+		delete(s.topics, topic)
+	}
+}
+
+func (s *socketSession) subscribed(topic string) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if _, ok := s.topics[ws.AllTopics]; ok {
+		return true
+	}
+	_, ok := s.topics[topic]
+	return ok
+}
+
+
+// Socket returns a miruken.Builder that customizes
+// websocket connections.
+func Socket(options SocketOptions) miruken.Builder {
+	return miruken.Options(Options{Socket: &options})
+}
+
+
+// WebSocket returns a http.Handler for processing api calls
+// over a websocket through a list of Middleware components.
+func WebSocket(
+	handler    miruken.Handler,
+	middleware ...Middleware,
+) http.Handler {
+	return pipeline(handler, serveSocket, middleware)
+}
+
+func serveSocket(
+	w http.ResponseWriter,
+	r *http.Request,
+	h miruken.Handler,
+) {
+	s, sp, err := provides.Type[*SocketHandler](h)
+	if s == nil || err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	} else if sp != nil {
+		if s, err = sp.Await(); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	s.ServeHTTP(w, r, h)
+}
+
@@ -0,0 +1,253 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/api/http/httpsrv"
+	"github.com/miruken-go/miruken/api/json/stdjson"
+	"github.com/miruken-go/miruken/handles"
+	"github.com/miruken-go/miruken/promise"
+	"github.com/miruken-go/miruken/provides"
+	"github.com/miruken-go/miruken/security"
+	"github.com/miruken-go/miruken/security/principal"
+	"github.com/stretchr/testify/suite"
+	"io"
+	http2 "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type (
+	GenerateReport struct {
+		_     struct{} `typeid:"reports.Generate"`
+		Name  string
+		Delay time.Duration
+		Fail  bool
+	}
+
+	Report struct {
+		_    struct{} `typeid:"reports.Report"`
+		Name string
+	}
+
+	ReportHandler struct {}
+)
+
+func (r *ReportHandler) Generate(
+	_ *handles.It, generate *GenerateReport,
+) *promise.Promise[*Report] {
+	return promise.New(func(resolve func(*Report), reject func(error)) {
+		time.Sleep(generate.Delay)
+		if generate.Fail {
+			reject(errors.New("report failed"))
+		} else {
+			resolve(&Report{Name: generate.Name})
+		}
+	})
+}
+
+type AsyncTestSuite struct {
+	suite.Suite
+	srv  *httptest.Server
+	user string
+}
+
+func (suite *AsyncTestSuite) SetupTest() {
+	suite.user = ""
+	suite.srv  = suite.server(httpsrv.AsyncOptions{MaxWait: 2 * time.Second}, "")
+}
+
+// server starts a server mounted at the prefix that provides
+// a Subject for the user named in the X-User header.
+func (suite *AsyncTestSuite) server(
+	options httpsrv.AsyncOptions,
+	prefix  string,
+) *httptest.Server {
+	handler, _ := miruken.Setup(
+		TestFeature, httpsrv.Feature(), stdjson.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Builders(httpsrv.Async(options)).
+		Handler()
+	user := httpsrv.MiddlewareFunc(func(
+		w http2.ResponseWriter,
+		r *http2.Request,
+		m httpsrv.Middleware,
+		h miruken.Handler,
+		n func(miruken.Handler),
+	) error {
+		subject := security.NewSubject()
+		if name := r.Header.Get("X-User"); len(name) > 0 {
+			subject.AddPrincipals(principal.User(name))
+		}
+		n(miruken.BuildUp(h, provides.With(subject)))
+		return nil
+	})
+	var pipeline http2.Handler = httpsrv.Pipeline(handler, user)
+	if len(prefix) > 0 {
+		mux := http2.NewServeMux()
+		mux.Handle(prefix+"/", http2.StripPrefix(prefix, pipeline))
+		pipeline = mux
+	}
+	return httptest.NewServer(pipeline)
+}
+
+func (suite *AsyncTestSuite) TearDownTest() {
+	suite.srv.Close()
+}
+
+func (suite *AsyncTestSuite) do(
+	method string,
+	path   string,
+	body   string,
+	prefer string,
+) (*http2.Response, string) {
+	req, err := http2.NewRequest(method, suite.srv.URL+path, strings.NewReader(body))
+	suite.Nil(err)
+	if len(body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if len(prefer) > 0 {
+		req.Header.Set("Prefer", prefer)
+	}
+	if len(suite.user) > 0 {
+		req.Header.Set("X-User", suite.user)
+	}
+	res, err := http2.DefaultClient.Do(req)
+	suite.Nil(err)
+	defer func() { _ = res.Body.Close() }()
+	content, err := io.ReadAll(res.Body)
+	suite.Nil(err)
+	return res, string(content)
+}
+
+func (suite *AsyncTestSuite) generate(
+	delay  time.Duration,
+	fail   bool,
+	prefer string,
+) (*http2.Response, string) {
+	body := fmt.Sprintf(
+		`{"payload":{"@type":"reports.Generate","Name":"sales","Delay":%d,"Fail":%t}}`,
+		delay, fail)
+	return suite.do(http2.MethodPost, "/process", body, prefer)
+}
+
+func (suite *AsyncTestSuite) TestAsync() {
+	suite.Run("Accepted", func() {
+		res, body := suite.generate(200*time.Millisecond, false, "respond-async")
+		suite.Equal(http2.StatusAccepted, res.StatusCode)
+		suite.Equal("respond-async", res.Header.Get("Preference-Applied"))
+		suite.Empty(body)
+		location := res.Header.Get("Location")
+		suite.True(strings.HasPrefix(location, "/operations/"))
+
+		res, _ = suite.do(http2.MethodGet, location, "", "")
+		suite.Equal(http2.StatusAccepted, res.StatusCode)
+		suite.Equal("1", res.Header.Get("Retry-After"))
+		suite.Equal(location, res.Header.Get("Location"))
+
+		time.Sleep(300 * time.Millisecond)
+		res, body = suite.do(http2.MethodGet, location, "", "")
+		suite.Equal(http2.StatusOK, res.StatusCode)
+		suite.JSONEq(`{"payload":{"@type":"reports.Report","Name":"sales"}}`, body)
+	})
+
+	suite.Run("Long Poll", func() {
+		res, _ := suite.generate(200*time.Millisecond, false, "respond-async, wait=10")
+		suite.Equal(http2.StatusAccepted, res.StatusCode)
+		start := time.Now()
+		res, body := suite.do(http2.MethodGet, res.Header.Get("Location"), "", "wait=10")
+		suite.Equal(http2.StatusOK, res.StatusCode)
+		suite.JSONEq(`{"payload":{"@type":"reports.Report","Name":"sales"}}`, body)
+		suite.Less(time.Since(start), 2*time.Second)
+	})
+
+	suite.Run("Max Wait", func() {
+		res, _ := suite.generate(5*time.Second, false, "respond-async")
+		start := time.Now()
+		res, _ = suite.do(http2.MethodGet, res.Header.Get("Location"), "", "wait=60")
+		suite.Equal(http2.StatusAccepted, res.StatusCode)
+		suite.Less(time.Since(start), 3*time.Second)
+	})
+
+	suite.Run("Error", func() {
+		res, _ := suite.generate(0, true, "respond-async")
+		suite.Equal(http2.StatusAccepted, res.StatusCode)
+		res, body := suite.do(http2.MethodGet, res.Header.Get("Location"), "", "wait=1")
+		suite.Equal(http2.StatusInternalServerError, res.StatusCode)
+		suite.Contains(body, "report failed")
+	})
+
+	suite.Run("Synchronous", func() {
+		res, body := suite.generate(0, false, "")
+		suite.Equal(http2.StatusOK, res.StatusCode)
+		suite.Empty(res.Header.Get("Preference-Applied"))
+		suite.JSONEq(`{"payload":{"@type":"reports.Report","Name":"sales"}}`, body)
+	})
+
+	suite.Run("Owner", func() {
+		suite.user = "alice"
+		res, _ := suite.generate(0, false, "respond-async")
+		suite.Equal(http2.StatusAccepted, res.StatusCode)
+		location := res.Header.Get("Location")
+
+		suite.user = "bob"
+		res, _ = suite.do(http2.MethodGet, location, "", "wait=1")
+		suite.Equal(http2.StatusNotFound, res.StatusCode)
+
+		suite.user = ""
+		res, _ = suite.do(http2.MethodGet, location, "", "wait=1")
+		suite.Equal(http2.StatusNotFound, res.StatusCode)
+
+		suite.user = "alice"
+		res, body := suite.do(http2.MethodGet, location, "", "wait=1")
+		suite.Equal(http2.StatusOK, res.StatusCode)
+		suite.JSONEq(`{"payload":{"@type":"reports.Report","Name":"sales"}}`, body)
+		suite.user = ""
+	})
+
+	suite.Run("Mount Prefix", func() {
+		suite.srv.Close()
+		suite.srv = suite.server(httpsrv.AsyncOptions{}, "/api")
+		res, _ := suite.do(http2.MethodPost, "/api/process",
+			`{"payload":{"@type":"reports.Generate","Name":"sales"}}`, "respond-async")
+		suite.Equal(http2.StatusAccepted, res.StatusCode)
+		location := res.Header.Get("Location")
+		suite.True(strings.HasPrefix(location, "/api/operations/"))
+		res, body := suite.do(http2.MethodGet, location, "", "wait=1")
+		suite.Equal(http2.StatusOK, res.StatusCode)
+		suite.JSONEq(`{"payload":{"@type":"reports.Report","Name":"sales"}}`, body)
+	})
+
+	suite.Run("Max Operations", func() {
+		suite.srv.Close()
+		suite.srv = suite.server(httpsrv.AsyncOptions{MaxOperations: 1}, "")
+		res, _ := suite.generate(500*time.Millisecond, false, "respond-async")
+		suite.Equal(http2.StatusAccepted, res.StatusCode)
+		location := res.Header.Get("Location")
+
+		res, _ = suite.generate(0, false, "respond-async")
+		suite.Equal(http2.StatusServiceUnavailable, res.StatusCode)
+		suite.Equal("1", res.Header.Get("Retry-After"))
+
+		// completed operations are evicted when full
+		res, _ = suite.do(http2.MethodGet, location, "", "wait=2")
+		suite.Equal(http2.StatusOK, res.StatusCode)
+		res, _ = suite.generate(0, false, "respond-async")
+		suite.Equal(http2.StatusAccepted, res.StatusCode)
+		res, _ = suite.do(http2.MethodGet, location, "", "")
+		suite.Equal(http2.StatusNotFound, res.StatusCode)
+	})
+
+	suite.Run("Unknown Operation", func() {
+		res, _ := suite.do(http2.MethodGet, "/operations/missing", "", "")
+		suite.Equal(http2.StatusNotFound, res.StatusCode)
+	})
+}
+
+func TestAsyncTestSuite(t *testing.T) {
+	suite.Run(t, new(AsyncTestSuite))
+}
@@ -0,0 +1,120 @@
+package test
+
+import (
+	"bytes"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/api/cbor"
+	"github.com/miruken-go/miruken/api/http"
+	"github.com/miruken-go/miruken/api/http/httpsrv"
+	"github.com/miruken-go/miruken/api/json/stdjson"
+	"github.com/miruken-go/miruken/api/msgpack"
+	"github.com/miruken-go/miruken/either"
+	"github.com/miruken-go/miruken/maps"
+	"github.com/stretchr/testify/suite"
+	"io"
+	http2 "net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type BinaryTestSuite struct {
+	suite.Suite
+	srv *httptest.Server
+}
+
+func (suite *BinaryTestSuite) SetupTest() {
+	handler, _ := miruken.Setup(
+		TestFeature, httpsrv.Feature(), msgpack.Feature(), cbor.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Handler()
+	suite.srv = httptest.NewServer(httpsrv.Pipeline(handler))
+}
+
+func (suite *BinaryTestSuite) TearDownTest() {
+	suite.srv.Close()
+}
+
+func (suite *BinaryTestSuite) Client(format string) miruken.Handler {
+	handler, _ := miruken.Setup(
+		TestFeature, http.Feature(), msgpack.Feature(), cbor.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Handler()
+	return miruken.BuildUp(handler, http.Format(format))
+}
+
+func (suite *BinaryTestSuite) TestBinary() {
+	formats := []*maps.Format{api.ToMsgpack, api.ToCbor}
+	for _, format := range formats {
+		format := format
+		suite.Run(format.Name(), func() {
+			suite.Run("Send", func() {
+				handler := suite.Client(format.Name())
+				create  := api.RouteTo(CreateTeam{Name: "Chelsea"}, suite.srv.URL)
+				_, pp, err := api.Send[*TeamData](handler, create)
+				suite.Nil(err)
+				team, err := pp.Await()
+				suite.Nil(err)
+				suite.Equal("Chelsea", team.Name)
+				suite.True(team.Id > 0)
+			})
+
+			suite.Run("Batch", func() {
+				handler := suite.Client(format.Name())
+				batch   := api.RouteTo(api.ConcurrentBatch{
+					Requests: []any{&CreateTeam{Name: "Everton"}},
+				}, suite.srv.URL)
+				_, pr, err := api.Send[api.ScheduledResult](handler, batch)
+				suite.Nil(err)
+				r, err := pr.Await()
+				suite.Nil(err)
+				suite.Len(r.Responses, 1)
+				either.Match(r.Responses[0], func(err error) {
+					suite.Fail("unexpected error", err)
+				}, func(res any) {
+					suite.Equal("Everton", res.(*TeamData).Name)
+				})
+			})
+
+			suite.Run("Accept", func() {
+				handler, _ := miruken.Setup(msgpack.Feature(), cbor.Feature()).
+					Specs(&api.GoPolymorphism{}).
+					Handler()
+				var b bytes.Buffer
+				out := io.Writer(&b)
+				msg := api.Message{Payload: &CreateTeam{Name: "Fulham"}}
+				_, _, err := maps.Into(miruken.BuildUp(handler, api.Polymorphic), msg, &out, format)
+				suite.Nil(err)
+				suite.NotEqual(byte('{'), b.Bytes()[0])
+
+				req, err := http2.NewRequest(http2.MethodPost, suite.srv.URL+"/process", &b)
+				suite.Nil(err)
+				req.Header.Set("Content-Type", format.Name())
+				req.Header.Set("Accept", format.Name())
+				res, err := http2.DefaultClient.Do(req)
+				suite.Nil(err)
+				defer func() { _ = res.Body.Close() }()
+				suite.Equal(http2.StatusOK, res.StatusCode)
+				suite.Equal(format.Name(), res.Header.Get("Content-Type"))
+			})
+		})
+	}
+
+	suite.Run("Not Installed", func() {
+		handler, _ := miruken.Setup(
+			TestFeature, httpsrv.Feature(), stdjson.Feature()).
+			Specs(&api.GoPolymorphism{}).
+			Handler()
+		srv := httptest.NewServer(httpsrv.Pipeline(handler))
+		defer srv.Close()
+		create  := api.RouteTo(CreateTeam{Name: "Brentford"}, srv.URL)
+		_, pp, err := api.Send[*TeamData](suite.Client("application/msgpack"), create)
+		suite.Nil(err)
+		_, err = pp.Await()
+		suite.ErrorContains(err, "415 Unsupported Media Type")
+	})
+}
+
+func TestBinaryTestSuite(t *testing.T) {
+	suite.Run(t, new(BinaryTestSuite))
+}
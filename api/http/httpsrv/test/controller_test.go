@@ -43,12 +43,26 @@ type (
 		Players []PlayerData
 	}
 
+	// CreateTeamV1 is the original version of CreateTeam
+	CreateTeamV1 struct {
+		Title string
+	}
+
 	TeamCreated struct {
 		Team TeamData
 	}
 
 	GetTeamNotifications struct {}
 
+	// Tenant is request-scoped baggage propagated in headers.
+	Tenant string
+
+	GetTenant struct {}
+
+	TenantInfo struct {
+		Tenant Tenant
+	}
+
 	TeamApiHandler struct {
 		nextId int32
 	}
@@ -82,23 +96,52 @@ func (t *TeamApiHandler) CreateTeam(
 	return promise.Resolve(team)
 }
 
+func (t *TeamApiHandler) GetTenant(
+	_ *handles.It, _ *GetTenant,
+	ctx miruken.HandleContext,
+) *TenantInfo {
+	tenant, _ := api.StashGet[Tenant](ctx)
+	return &TenantInfo{tenant}
+}
+
+func (t *TeamApiHandler) UpcastCreateTeam(
+	_*struct{
+		maps.It
+		maps.Format `to:"api:upcast"`
+	  }, v1 *CreateTeamV1,
+) *CreateTeam {
+	return &CreateTeam{Name: v1.Title}
+}
+
 func (t *TeamApiHandler) New(
 	_*struct{
 		_ creates.It `key:"test.CreateTeam"`
+		_ creates.It `key:"test.CreateTeamV1"`
 		_ creates.It `key:"test.TeamCreated"`
 	    _ creates.It `key:"test.GetTeamNotifications"`
+		_ creates.It `key:"test.GetTenant"`
+		_ creates.It `key:"test.TenantInfo"`
 		_ creates.It `key:"test.TeamData"`
+		_ creates.It `key:"test.TeamDisbanded"`
 	  }, create *creates.It,
 ) any {
 	switch create.Key() {
 	case "test.CreateTeam":
 		return new(CreateTeam)
+	case "test.CreateTeamV1":
+		return new(CreateTeamV1)
 	case "test.TeamCreated":
 		return new(TeamCreated)
 	case "test.GetTeamNotifications":
 		return new(GetTeamNotifications)
+	case "test.GetTenant":
+		return new(GetTenant)
+	case "test.TenantInfo":
+		return new(TenantInfo)
 	case "test.TeamData":
 		return new(TeamData)
+	case "test.TeamDisbanded":
+		return new(TeamDisbanded)
 	}
 	return nil
 }
@@ -132,6 +175,8 @@ func (f *BadFormatter) Bad(
 	return nil, nil
 }
 
+var tenantKey = api.PropagateType[Tenant]("Tenant")
+
 type ControllerTestSuite struct {
 	suite.Suite
 	srv *httptest.Server
@@ -150,6 +195,7 @@ func (suite *ControllerTestSuite) SetupTest() {
 	handler, _ := miruken.Setup(
 		TestFeature, httpsrv.Feature(), stdjson.Feature()).
 		Specs(&api.GoPolymorphism{}).
+		Builders(api.Propagate(tenantKey)).
 		Handler()
 	suite.srv = httptest.NewServer(httpsrv.Pipeline(handler))
 }
@@ -182,6 +228,17 @@ func (suite *ControllerTestSuite) TestController() {
 			suite.Contains(events, created)
 		})
 
+		suite.Run("Upcast", func() {
+			handler := suite.Setup()
+			create := api.RouteTo(&CreateTeamV1{Title: "Aston Villa"}, suite.srv.URL)
+			_, pp, err := api.Send[*TeamData](handler, create)
+			suite.Nil(err)
+			suite.NotNil(pp)
+			team, err := pp.Await()
+			suite.Nil(err)
+			suite.Equal("Aston Villa", team.Name)
+		})
+
 		suite.Run("Publish", func() {
 			handler := suite.Setup()
 			created := &TeamCreated{TeamData{8, "Liverpool", nil}}
@@ -317,6 +374,64 @@ func (suite *ControllerTestSuite) TestController() {
 			suite.Equal(3, count)
 		})
 
+		suite.Run("ConcurrentFailFast", func() {
+			handler := suite.Setup()
+			batch   := api.RouteTo(api.ConcurrentBatch{
+				Requests: []any{
+					&CreateTeam{Name: "Everton"},
+					&CreateTeam{Name: ""},
+					&CreateTeam{Name: "Fulham"},
+				},
+				MaxParallel: 1,
+				FailFast:    true,
+			}, suite.srv.URL)
+			r, pr, err := api.Send[api.ScheduledResult](handler, batch)
+			suite.Nil(err)
+			suite.NotNil(pr)
+			r, err = pr.Await()
+			suite.Nil(err)
+			suite.Len(r.Responses, 3)
+			either.Match(r.Responses[0], func(err error) {
+				suite.Fail("unexpected error", err)
+			}, func(res any) {
+				suite.Equal("Everton", res.(*TeamData).Name)
+			})
+			either.Match(r.Responses[1], func(err error) {
+				suite.IsType(&validates.Outcome{}, err)
+			}, func(res any) {
+				suite.Fail("expected validation error")
+			})
+			either.Match(r.Responses[2], func(err error) {
+				suite.Contains(err.Error(), api.ErrBatchCanceled.Error())
+			}, func(res any) {
+				suite.Fail("expected cancellation")
+			})
+		})
+
+		suite.Run("PropagateStash", func() {
+			handler := miruken.BuildUp(suite.Setup(), api.Propagate(tenantKey))
+			suite.Nil(api.StashPut(handler, Tenant("Spurs")))
+			get := api.RouteTo(GetTenant{}, suite.srv.URL)
+			_, pt, err := api.Send[*TenantInfo](handler, get)
+			suite.Nil(err)
+			suite.NotNil(pt)
+			info, err := pt.Await()
+			suite.Nil(err)
+			suite.Equal(Tenant("Spurs"), info.Tenant)
+		})
+
+		suite.Run("PropagateStashNotDeclared", func() {
+			handler := suite.Setup()
+			suite.Nil(api.StashPut(handler, Tenant("Spurs")))
+			get := api.RouteTo(GetTenant{}, suite.srv.URL)
+			_, pt, err := api.Send[*TenantInfo](handler, get)
+			suite.Nil(err)
+			suite.NotNil(pt)
+			info, err := pt.Await()
+			suite.Nil(err)
+			suite.Empty(info.Tenant)
+		})
+
 		suite.Run("Pipeline", func() {
 			handler := miruken.BuildUp(
 				suite.Setup(),
@@ -0,0 +1,214 @@
+package test
+
+import (
+	"github.com/knadh/koanf"
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/api/http/httpsrv"
+	"github.com/miruken-go/miruken/api/json/stdjson"
+	"github.com/miruken-go/miruken/config"
+	koanfp "github.com/miruken-go/miruken/config/koanf"
+	"github.com/stretchr/testify/suite"
+	"io"
+	http2 "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type CorsTestSuite struct {
+	suite.Suite
+}
+
+func (suite *CorsTestSuite) Server(
+	cors    map[string]any,
+	options *httpsrv.CorsOptions,
+) string {
+	k := koanf.New(".")
+	if cors != nil {
+		err := k.Load(confmap.Provider(map[string]any{"cors": cors}, "."), nil)
+		suite.Nil(err)
+	}
+	handler, _ := miruken.Setup(
+		TestFeature, httpsrv.Feature(), stdjson.Feature(),
+		config.Feature(koanfp.P(k))).
+		Specs(&api.GoPolymorphism{}).
+		Handler()
+	mw := &httpsrv.Cors{}
+	if options != nil {
+		mw.Options = *options
+	}
+	srv := httptest.NewServer(httpsrv.Pipeline(handler, mw))
+	suite.T().Cleanup(srv.Close)
+	return srv.URL
+}
+
+func (suite *CorsTestSuite) do(
+	method string,
+	url    string,
+	header ...string,
+) (*http2.Response, string) {
+	var body io.Reader
+	if method == http2.MethodPost {
+		body = strings.NewReader(`{"payload":{"@type":"reports.Generate","Name":"sales"}}`)
+	}
+	req, err := http2.NewRequest(method, url, body)
+	suite.Nil(err)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	res, err := http2.DefaultClient.Do(req)
+	suite.Nil(err)
+	defer func() { _ = res.Body.Close() }()
+	content, err := io.ReadAll(res.Body)
+	suite.Nil(err)
+	return res, string(content)
+}
+
+func (suite *CorsTestSuite) TestCors() {
+	suite.Run("Preflight", func() {
+		url := suite.Server(map[string]any{
+			"origins": []string{"https://*.example.com"},
+			"maxAge":  "10m",
+		}, nil)
+		res, _ := suite.do(http2.MethodOptions, url+"/process",
+			"Origin", "https://app.example.com",
+			"Access-Control-Request-Method", "POST",
+			"Access-Control-Request-Headers", "content-type, prefer")
+		suite.Equal(http2.StatusNoContent, res.StatusCode)
+		suite.Equal("https://app.example.com", res.Header.Get("Access-Control-Allow-Origin"))
+		suite.Equal("GET, POST, OPTIONS", res.Header.Get("Access-Control-Allow-Methods"))
+		suite.Equal("content-type, prefer", res.Header.Get("Access-Control-Allow-Headers"))
+		suite.Equal("600", res.Header.Get("Access-Control-Max-Age"))
+		suite.Empty(res.Header.Get("Access-Control-Allow-Credentials"))
+		suite.Contains(res.Header.Values("Vary"), "Origin")
+	})
+
+	suite.Run("Preflight Rejected", func() {
+		url := suite.Server(map[string]any{
+			"origins": []string{"https://*.example.com"},
+		}, nil)
+		res, _ := suite.do(http2.MethodOptions, url+"/process",
+			"Origin", "https://example.org",
+			"Access-Control-Request-Method", "POST")
+		suite.Equal(http2.StatusForbidden, res.StatusCode)
+		suite.Empty(res.Header.Get("Access-Control-Allow-Origin"))
+
+		res, _ = suite.do(http2.MethodOptions, url+"/process",
+			"Origin", "https://app.example.com",
+			"Access-Control-Request-Method", "DELETE")
+		suite.Equal(http2.StatusForbidden, res.StatusCode)
+
+		res, _ = suite.do(http2.MethodOptions, url+"/process",
+			"Origin", "https://app.example.com",
+			"Access-Control-Request-Method", "POST",
+			"Access-Control-Request-Headers", "X-Custom")
+		suite.Equal(http2.StatusForbidden, res.StatusCode)
+	})
+
+	suite.Run("Simple Request", func() {
+		url := suite.Server(map[string]any{
+			"origins":     []string{"https://app.example.com"},
+			"expose":      []string{"Location", "ETag"},
+			"credentials": true,
+		}, nil)
+		res, body := suite.do(http2.MethodPost, url+"/process",
+			"Origin", "https://app.example.com")
+		suite.Equal(http2.StatusOK, res.StatusCode)
+		suite.JSONEq(`{"payload":{"@type":"reports.Report","Name":"sales"}}`, body)
+		suite.Equal("https://app.example.com", res.Header.Get("Access-Control-Allow-Origin"))
+		suite.Equal("true", res.Header.Get("Access-Control-Allow-Credentials"))
+		suite.Equal("Location, ETag", res.Header.Get("Access-Control-Expose-Headers"))
+	})
+
+	suite.Run("Disallowed Origin", func() {
+		url := suite.Server(map[string]any{
+			"origins": []string{"https://app.example.com"},
+		}, nil)
+		res, _ := suite.do(http2.MethodPost, url+"/process",
+			"Origin", "https://evil.example.com")
+		suite.Equal(http2.StatusOK, res.StatusCode)
+		suite.Empty(res.Header.Get("Access-Control-Allow-Origin"))
+	})
+
+	suite.Run("Any Origin", func() {
+		url := suite.Server(nil, &httpsrv.CorsOptions{
+			Origins: []string{"*"},
+			Headers: []string{"*"},
+			MaxAge:  time.Hour,
+		})
+		res, _ := suite.do(http2.MethodOptions, url+"/process",
+			"Origin", "https://anywhere.com",
+			"Access-Control-Request-Method", "POST",
+			"Access-Control-Request-Headers", "X-Custom")
+		suite.Equal(http2.StatusNoContent, res.StatusCode)
+		suite.Equal("*", res.Header.Get("Access-Control-Allow-Origin"))
+		suite.Equal("X-Custom", res.Header.Get("Access-Control-Allow-Headers"))
+		suite.Equal("3600", res.Header.Get("Access-Control-Max-Age"))
+	})
+
+	suite.Run("Any Origin With Credentials", func() {
+		url := suite.Server(map[string]any{
+			"origins":     []string{"*", "https://*.example.com"},
+			"credentials": true,
+		}, nil)
+		res, _ := suite.do(http2.MethodPost, url+"/process",
+			"Origin", "https://evil.com")
+		suite.Equal(http2.StatusOK, res.StatusCode)
+		suite.Empty(res.Header.Get("Access-Control-Allow-Origin"))
+		suite.Empty(res.Header.Get("Access-Control-Allow-Credentials"))
+
+		res, _ = suite.do(http2.MethodOptions, url+"/process",
+			"Origin", "https://evil.com",
+			"Access-Control-Request-Method", "POST")
+		suite.Equal(http2.StatusForbidden, res.StatusCode)
+
+		res, _ = suite.do(http2.MethodPost, url+"/process",
+			"Origin", "https://app.example.com")
+		suite.Equal("https://app.example.com", res.Header.Get("Access-Control-Allow-Origin"))
+		suite.Equal("true", res.Header.Get("Access-Control-Allow-Credentials"))
+	})
+
+	suite.Run("Explicit Overrides Config", func() {
+		url := suite.Server(map[string]any{
+			"origins": []string{"https://app.example.com"},
+		}, &httpsrv.CorsOptions{Origins: []string{"https://other.com"}})
+		res, _ := suite.do(http2.MethodPost, url+"/process",
+			"Origin", "https://app.example.com")
+		suite.Empty(res.Header.Get("Access-Control-Allow-Origin"))
+		res, _ = suite.do(http2.MethodPost, url+"/process",
+			"Origin", "https://other.com")
+		suite.Equal("https://other.com", res.Header.Get("Access-Control-Allow-Origin"))
+	})
+
+	suite.Run("No Origin", func() {
+		url := suite.Server(map[string]any{
+			"origins": []string{"*"},
+		}, nil)
+		res, _ := suite.do(http2.MethodPost, url+"/process")
+		suite.Equal(http2.StatusOK, res.StatusCode)
+		suite.Empty(res.Header.Get("Access-Control-Allow-Origin"))
+	})
+
+	suite.Run("Options Without Preflight", func() {
+		url := suite.Server(nil, nil)
+		res, _ := suite.do(http2.MethodOptions, url+"/process")
+		suite.Equal(http2.StatusNoContent, res.StatusCode)
+		suite.Equal("OPTIONS, POST", res.Header.Get("Allow"))
+		res, _ = suite.do(http2.MethodOptions, url+"/query/teams.Find")
+		suite.Equal(http2.StatusNoContent, res.StatusCode)
+		suite.Equal("GET, OPTIONS", res.Header.Get("Allow"))
+		res, _ = suite.do(http2.MethodPut, url+"/process")
+		suite.Equal(http2.StatusMethodNotAllowed, res.StatusCode)
+		suite.Equal("OPTIONS, POST", res.Header.Get("Allow"))
+	})
+}
+
+func TestCorsTestSuite(t *testing.T) {
+	suite.Run(t, new(CorsTestSuite))
+}
@@ -0,0 +1,150 @@
+package test
+
+import (
+	json2 "encoding/json"
+	"errors"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/api/deadletter"
+	"github.com/miruken-go/miruken/api/http/httpsrv"
+	"github.com/miruken-go/miruken/api/json/stdjson"
+	"github.com/miruken-go/miruken/handles"
+	"github.com/stretchr/testify/suite"
+	http2 "net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type (
+	TeamDisbanded struct {
+		Team TeamData
+	}
+
+	TeamDisbandedConsumer struct {}
+)
+
+
+// TeamDisbandedConsumer
+
+func (t *TeamDisbandedConsumer) Disbanded(
+	_ *handles.It, _ *TeamDisbanded,
+) error {
+	return errors.New("league office closed")
+}
+
+
+type DeadLetterTestSuite struct {
+	suite.Suite
+	srv     *httptest.Server
+	handler miruken.Handler
+}
+
+func (suite *DeadLetterTestSuite) SetupTest() {
+	suite.handler, _ = miruken.Setup(
+		TestFeature, httpsrv.Feature(), deadletter.Feature(), stdjson.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Handler()
+	mux := http2.NewServeMux()
+	mux.Handle("/deadletters/", http2.StripPrefix("/deadletters",
+		httpsrv.DeadLetters(suite.handler)))
+	exposed := miruken.BuildUp(suite.handler, httpsrv.Expose(httpsrv.ExposeOptions{}))
+	mux.Handle("/exposed/", http2.StripPrefix("/exposed",
+		httpsrv.DeadLetters(exposed)))
+	suite.srv = httptest.NewServer(mux)
+}
+
+func (suite *DeadLetterTestSuite) TearDownTest() {
+	suite.srv.CloseClientConnections()
+	suite.srv.Close()
+}
+
+func (suite *DeadLetterTestSuite) TestDeadLetters() {
+	suite.Run("List", func() {
+		suite.disband(1)
+		var letters []deadletter.Letter
+		suite.Equal(http2.StatusOK, suite.do(http2.MethodGet, "/deadletters/", &letters))
+		suite.Len(letters, 1)
+		suite.Equal([]string{"league office closed"}, letters[0].Errors)
+		suite.Equal("*test.TeamDisbandedConsumer", letters[0].Consumer)
+
+		var letter deadletter.Letter
+		suite.Equal(http2.StatusOK, suite.do(http2.MethodGet, "/deadletters/"+letters[0].Id, &letter))
+		suite.Equal(letters[0].Id, letter.Id)
+
+		suite.Equal(http2.StatusNotFound, suite.do(http2.MethodGet, "/deadletters/missing", nil))
+	})
+
+	suite.Run("Replay", func() {
+		var purged deadletter.PurgeResult
+		suite.Equal(http2.StatusOK, suite.do(http2.MethodDelete, "/deadletters/", &purged))
+		suite.disband(2)
+		var letters []deadletter.Letter
+		suite.Equal(http2.StatusOK, suite.do(http2.MethodGet, "/deadletters/?limit=10", &letters))
+		suite.Len(letters, 1)
+
+		var result deadletter.ReplayResult
+		suite.Equal(http2.StatusOK, suite.do(http2.MethodPost,
+			"/deadletters/"+letters[0].Id+"/replay", &result))
+		suite.Equal([]string{letters[0].Id}, result.Failed)
+
+		suite.Equal(http2.StatusOK, suite.do(http2.MethodGet, "/deadletters/", &letters))
+		suite.Len(letters, 1)
+		suite.Equal(2, letters[0].Attempts)
+	})
+
+	suite.Run("Purge", func() {
+		suite.disband(3)
+		var result deadletter.PurgeResult
+		suite.Equal(http2.StatusOK, suite.do(http2.MethodDelete, "/deadletters/", &result))
+		suite.NotZero(result.Purged)
+		var letters []deadletter.Letter
+		suite.Equal(http2.StatusOK, suite.do(http2.MethodGet, "/deadletters/", &letters))
+		suite.Empty(letters)
+	})
+
+	suite.Run("Replay Not Exposed", func() {
+		suite.disband(4)
+		var letters []deadletter.Letter
+		suite.Equal(http2.StatusOK, suite.do(http2.MethodGet, "/deadletters/", &letters))
+		suite.Len(letters, 1)
+
+		var result deadletter.ReplayResult
+		suite.Equal(http2.StatusOK, suite.do(http2.MethodPost, "/exposed/replay", &result))
+		suite.Empty(result.Replayed)
+		suite.Empty(result.Failed)
+		suite.Equal(http2.StatusNotFound, suite.do(http2.MethodPost,
+			"/exposed/"+letters[0].Id+"/replay", nil))
+
+		suite.Equal(http2.StatusOK, suite.do(http2.MethodGet, "/deadletters/", &letters))
+		suite.Len(letters, 1)
+		suite.Equal(1, letters[0].Attempts)
+	})
+
+	suite.Run("Method Not Allowed", func() {
+		suite.Equal(http2.StatusMethodNotAllowed, suite.do(http2.MethodPut, "/deadletters/", nil))
+	})
+}
+
+func (suite *DeadLetterTestSuite) disband(id int32) {
+	pv, err := api.Publish(suite.handler, &TeamDisbanded{TeamData{Id: id, Name: "Wimbledon"}})
+	if err == nil && pv != nil {
+		_, err = pv.Await()
+	}
+	suite.NotNil(err)
+}
+
+func (suite *DeadLetterTestSuite) do(method, path string, result any) int {
+	req, err := http2.NewRequest(method, suite.srv.URL+path, nil)
+	suite.Nil(err)
+	resp, err := http2.DefaultClient.Do(req)
+	suite.Nil(err)
+	defer func() { _ = resp.Body.Close() }()
+	if result != nil && resp.StatusCode == http2.StatusOK {
+		suite.Nil(json2.NewDecoder(resp.Body).Decode(result))
+	}
+	return resp.StatusCode
+}
+
+func TestDeadLetterTestSuite(t *testing.T) {
+	suite.Run(t, new(DeadLetterTestSuite))
+}
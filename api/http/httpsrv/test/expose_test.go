@@ -0,0 +1,180 @@
+package test
+
+import (
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/api/http"
+	"github.com/miruken-go/miruken/api/http/httpsrv"
+	"github.com/miruken-go/miruken/api/http/ws"
+	"github.com/miruken-go/miruken/api/json/stdjson"
+	"github.com/miruken-go/miruken/handles"
+	"github.com/stretchr/testify/suite"
+	http2 "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type (
+	RenameLeague struct {
+		api.Exposed `expose:"/process"`
+		_    struct{} `typeid:"league.Rename"`
+		Name string
+	}
+
+	ResetLeague struct {
+		_ struct{} `typeid:"league.Reset"`
+	}
+
+	LeagueHandler struct {}
+)
+
+
+func (l *LeagueHandler) Rename(
+	_ *handles.It, rename *RenameLeague,
+) *RenameLeague {
+	return rename
+}
+
+func (l *LeagueHandler) Reset(
+	_ *handles.It, _ *ResetLeague,
+) {
+}
+
+
+type ExposeTestSuite struct {
+	suite.Suite
+}
+
+func (suite *ExposeTestSuite) Server(builders ...miruken.Builder) string {
+	handler, _ := miruken.Setup(
+		TestFeature, httpsrv.Feature(), stdjson.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Builders(builders...).
+		Handler()
+	srv := httptest.NewServer(httpsrv.Pipeline(handler))
+	suite.T().Cleanup(srv.Close)
+	return srv.URL
+}
+
+func (suite *ExposeTestSuite) Socket(builders ...miruken.Builder) string {
+	handler, _ := miruken.Setup(
+		TestFeature, httpsrv.Feature(), stdjson.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Builders(builders...).
+		Handler()
+	srv := httptest.NewServer(httpsrv.WebSocket(handler))
+	suite.T().Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func (suite *ExposeTestSuite) get(url string) *http2.Response {
+	res, err := http2.Get(url)
+	suite.Nil(err)
+	_ = res.Body.Close()
+	return res
+}
+
+func (suite *ExposeTestSuite) post(url, body string) *http2.Response {
+	res, err := http2.Post(url, "application/json", strings.NewReader(body))
+	suite.Nil(err)
+	_ = res.Body.Close()
+	return res
+}
+
+func (suite *ExposeTestSuite) Client() miruken.Handler {
+	handler, _ := miruken.Setup(
+		TestFeature, http.Feature(), ws.Feature(), stdjson.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Handler()
+	return handler
+}
+
+func (suite *ExposeTestSuite) TestExpose() {
+	rename := `{"payload":{"@type":"league.Rename","Name":"Premier"}}`
+	reset  := `{"payload":{"@type":"league.Reset"}}`
+
+	suite.Run("Not Restricted", func() {
+		url := suite.Server()
+		suite.Equal(http2.StatusOK, suite.post(url+"/process", reset).StatusCode)
+	})
+
+	suite.Run("Exposed", func() {
+		url := suite.Server(httpsrv.Expose(httpsrv.ExposeOptions{}))
+		suite.Equal(http2.StatusOK, suite.post(url+"/process", rename).StatusCode)
+		suite.Equal(http2.StatusOK, suite.post(url+"/process/league.rename", rename).StatusCode)
+	})
+
+	suite.Run("Not Exposed", func() {
+		url := suite.Server(httpsrv.Expose(httpsrv.ExposeOptions{}))
+		suite.Equal(http2.StatusNotFound, suite.post(url+"/process", reset).StatusCode)
+	})
+
+	suite.Run("Not Exposed On Path", func() {
+		url := suite.Server(httpsrv.Expose(httpsrv.ExposeOptions{}))
+		suite.Equal(http2.StatusNotFound, suite.post(url+"/publish", rename).StatusCode)
+	})
+
+	suite.Run("Exposed Type", func() {
+		url := suite.Server(httpsrv.Expose(httpsrv.ExposeOptions{
+			Types: []httpsrv.ExposedType{{Type: "league.Reset", Paths: []string{"/publish"}}},
+		}))
+		suite.Equal(http2.StatusOK, suite.post(url+"/publish", reset).StatusCode)
+		suite.Equal(http2.StatusNotFound, suite.post(url+"/process", reset).StatusCode)
+	})
+
+	suite.Run("Published", func() {
+		url := suite.Server(httpsrv.Expose(httpsrv.ExposeOptions{}))
+		published := `{"payload":{"@type":"api.Published","Message":{"@type":"league.Reset"}}}`
+		suite.Equal(http2.StatusNotFound, suite.post(url+"/process", published).StatusCode)
+	})
+
+	suite.Run("Query", func() {
+		query := httpsrv.Query(httpsrv.QueryRoute{Path: "leagues/reset", Type: "league.Reset"})
+		url   := suite.Server(query)
+		suite.NotEqual(http2.StatusNotFound, suite.get(url+"/query/leagues/reset").StatusCode)
+		url = suite.Server(query, httpsrv.Expose(httpsrv.ExposeOptions{}))
+		suite.Equal(http2.StatusNotFound, suite.get(url+"/query/leagues/reset").StatusCode)
+	})
+
+	suite.Run("Socket", func() {
+		route := suite.Socket(httpsrv.Expose(httpsrv.ExposeOptions{}))
+		renamed, pr, err := api.Send[*RenameLeague](suite.Client(),
+			api.RouteTo(&RenameLeague{Name: "Serie A"}, route))
+		suite.Nil(err)
+		if pr != nil {
+			renamed, err = pr.Await()
+			suite.Nil(err)
+		}
+		suite.Equal("Serie A", renamed.Name)
+		_, pa, err := api.Send[any](suite.Client(), api.RouteTo(&ResetLeague{}, route))
+		if err == nil && pa != nil {
+			_, err = pa.Await()
+		}
+		suite.ErrorContains(err, "not found")
+	})
+
+	suite.Run("Batch", func() {
+		url   := suite.Server(httpsrv.Expose(httpsrv.ExposeOptions{}))
+		batch := api.RouteTo(api.ConcurrentBatch{
+			Requests: []any{&RenameLeague{Name: "Championship"}},
+		}, url)
+		_, pr, err := api.Send[api.ScheduledResult](suite.Client(), batch)
+		suite.Nil(err)
+		r, err := pr.Await()
+		suite.Nil(err)
+		suite.Len(r.Responses, 1)
+
+		batch = api.RouteTo(api.ConcurrentBatch{
+			Requests: []any{&RenameLeague{Name: "Championship"}, &ResetLeague{}},
+		}, url)
+		_, pr, err = api.Send[api.ScheduledResult](suite.Client(), batch)
+		suite.Nil(err)
+		_, err = pr.Await()
+		suite.ErrorContains(err, "404")
+	})
+}
+
+func TestExposeTestSuite(t *testing.T) {
+	suite.Run(t, new(ExposeTestSuite))
+}
@@ -6,8 +6,13 @@ import "github.com/miruken-go/miruken"
 
 var TestFeature miruken.Feature = miruken.FeatureFunc(func(setup *miruken.SetupBuilder) error {
 	setup.Specs(
+		&LeagueHandler{},
+		&ReportHandler{},
 		&TeamApiConsumer{},
 		&TeamApiHandler{},
+		&TeamDisbandedConsumer{},
+		&TeamPushConsumer{},
+		&TeamQueryHandler{},
 	)
 	return nil
 })
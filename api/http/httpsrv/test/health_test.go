@@ -0,0 +1,140 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/api/http/httpsrv"
+	"github.com/miruken-go/miruken/api/json/stdjson"
+	"github.com/miruken-go/miruken/health"
+	"github.com/miruken-go/miruken/provides"
+	"github.com/stretchr/testify/suite"
+	http2 "net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type (
+	Inventory struct {
+		err      error
+		optional bool
+	}
+
+	InventoryCheck struct {
+		inventory *Inventory
+	}
+)
+
+
+func (i *InventoryCheck) Constructor(inventory *Inventory) {
+	i.inventory = inventory
+}
+
+func (i *InventoryCheck) Health(
+	_*struct{provides.It},
+) health.Check {
+	inventory := i.inventory
+	return health.Check{
+		Name:     "inventory",
+		Optional: inventory.optional,
+		Probe: func(context.Context) error {
+			return inventory.err
+		},
+	}
+}
+
+
+type HealthTestSuite struct {
+	suite.Suite
+}
+
+func (suite *HealthTestSuite) Server(
+	details  bool,
+	features ...miruken.Feature,
+) (*Inventory, string) {
+	inventory := &Inventory{}
+	handler, _ := miruken.Setup(
+		append(features, TestFeature, httpsrv.Feature(), stdjson.Feature())...).
+		Specs(&api.GoPolymorphism{}, &InventoryCheck{}).
+		Builders(httpsrv.Health(httpsrv.HealthOptions{Details: details})).
+		With(inventory).
+		Handler()
+	srv := httptest.NewServer(httpsrv.Pipeline(handler))
+	suite.T().Cleanup(srv.Close)
+	return inventory, srv.URL
+}
+
+func (suite *HealthTestSuite) get(url string) (*http2.Response, *health.Report) {
+	res, err := http2.Get(url)
+	suite.Nil(err)
+	defer func() { _ = res.Body.Close() }()
+	var report health.Report
+	if res.StatusCode != http2.StatusNotFound {
+		suite.Nil(json.NewDecoder(res.Body).Decode(&report))
+	}
+	return res, &report
+}
+
+func (suite *HealthTestSuite) TestHealth() {
+	suite.Run("Ready", func() {
+		_, url := suite.Server(true, health.Feature())
+		res, report := suite.get(url + "/health/ready")
+		suite.Equal(http2.StatusOK, res.StatusCode)
+		suite.Equal("application/json", res.Header.Get("Content-Type"))
+		suite.Equal("no-store", res.Header.Get("Cache-Control"))
+		suite.Equal(health.StatusUp, report.Status)
+		suite.Len(report.Checks, 2)
+		suite.Equal("inventory", report.Checks[0].Name)
+		suite.Equal("setup", report.Checks[1].Name)
+	})
+
+	suite.Run("Not Ready", func() {
+		inventory, url := suite.Server(true, health.Feature())
+		inventory.err = errors.New("inventory offline")
+		res, report := suite.get(url + "/health/ready")
+		suite.Equal(http2.StatusServiceUnavailable, res.StatusCode)
+		suite.Equal(health.StatusDown, report.Status)
+		suite.Equal("inventory offline", report.Checks[0].Error)
+
+		res, report = suite.get(url + "/health/live")
+		suite.Equal(http2.StatusOK, res.StatusCode)
+		suite.Equal(health.StatusUp, report.Status)
+		suite.Empty(report.Checks)
+	})
+
+	suite.Run("Status Only", func() {
+		inventory, url := suite.Server(false, health.Feature())
+		inventory.err = errors.New("inventory offline")
+		res, report := suite.get(url + "/health/ready")
+		suite.Equal(http2.StatusServiceUnavailable, res.StatusCode)
+		suite.Equal(health.StatusDown, report.Status)
+		suite.Empty(report.Checks)
+		suite.False(report.Checked.IsZero())
+	})
+
+	suite.Run("Degraded", func() {
+		inventory, url := suite.Server(false, health.Feature())
+		inventory.err, inventory.optional = errors.New("slow"), true
+		res, report := suite.get(url + "/health/ready")
+		suite.Equal(http2.StatusOK, res.StatusCode)
+		suite.Equal(health.StatusDegraded, report.Status)
+	})
+
+	suite.Run("Not Installed", func() {
+		_, url := suite.Server(false)
+		res, _ := suite.get(url + "/health/ready")
+		suite.Equal(http2.StatusNotFound, res.StatusCode)
+	})
+
+	suite.Run("Unknown Probe", func() {
+		_, url := suite.Server(false, health.Feature())
+		res, _ := suite.get(url + "/health/other")
+		suite.Equal(http2.StatusNotFound, res.StatusCode)
+	})
+}
+
+func TestHealthTestSuite(t *testing.T) {
+	suite.Run(t, new(HealthTestSuite))
+}
@@ -0,0 +1,183 @@
+package test
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/api/http/httpsrv"
+	"github.com/miruken-go/miruken/api/json/stdjson"
+	"github.com/stretchr/testify/suite"
+	"io"
+	"mime/multipart"
+	"net"
+	http2 "net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+type LimitTestSuite struct {
+	suite.Suite
+	srv *httptest.Server
+}
+
+func (suite *LimitTestSuite) SetupTest() {
+	handler, _ := miruken.Setup(
+		TestFeature, httpsrv.Feature(), stdjson.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Builders(httpsrv.Limits(httpsrv.LimitOptions{
+			MaxBodySize:    1024,
+			MaxParts:       2,
+			MaxPartSize:    64,
+			ReadTimeout:    200 * time.Millisecond,
+			ProcessTimeout: 300 * time.Millisecond,
+			Types: []httpsrv.TypeLimit{
+				{Type: "reports.Generate", MaxBodySize: 128},
+			},
+		})).
+		Handler()
+	suite.srv = httptest.NewServer(httpsrv.Pipeline(handler))
+}
+
+func (suite *LimitTestSuite) TearDownTest() {
+	suite.srv.Close()
+}
+
+func (suite *LimitTestSuite) post(
+	path        string,
+	contentType string,
+	body        io.Reader,
+) (*http2.Response, string) {
+	req, err := http2.NewRequest(http2.MethodPost, suite.srv.URL+path, body)
+	suite.Nil(err)
+	req.Header.Set("Content-Type", contentType)
+	res, err := http2.DefaultClient.Do(req)
+	suite.Nil(err)
+	defer func() { _ = res.Body.Close() }()
+	content, err := io.ReadAll(res.Body)
+	suite.Nil(err)
+	return res, string(content)
+}
+
+func (suite *LimitTestSuite) generate(
+	path  string,
+	name  string,
+	delay time.Duration,
+) (*http2.Response, string) {
+	body := fmt.Sprintf(
+		`{"payload":{"@type":"reports.Generate","Name":%q,"Delay":%d}}`, name, delay)
+	return suite.post(path, "application/json", strings.NewReader(body))
+}
+
+func (suite *LimitTestSuite) TestLimits() {
+	suite.Run("Within Limits", func() {
+		res, body := suite.generate("/process", "sales", 0)
+		suite.Equal(http2.StatusOK, res.StatusCode)
+		suite.JSONEq(`{"payload":{"@type":"reports.Report","Name":"sales"}}`, body)
+	})
+
+	suite.Run("Content Length Exceeds Limit", func() {
+		res, body := suite.generate("/process", strings.Repeat("x", 1100), 0)
+		suite.Equal(http2.StatusRequestEntityTooLarge, res.StatusCode)
+		suite.Contains(body, "1024 bytes")
+	})
+
+	suite.Run("Streamed Body Exceeds Limit", func() {
+		body := fmt.Sprintf(
+			`{"payload":{"@type":"reports.Generate","Name":%q}}`, strings.Repeat("x", 1100))
+		// hide the length so the body is sent chunked
+		res, _ := suite.post("/process", "application/json",
+			io.MultiReader(strings.NewReader(body)))
+		suite.Equal(http2.StatusRequestEntityTooLarge, res.StatusCode)
+	})
+
+	suite.Run("Type Exceeds Limit", func() {
+		name := strings.Repeat("x", 100)
+		res, body := suite.generate("/process/reports.Generate", name, 0)
+		suite.Equal(http2.StatusRequestEntityTooLarge, res.StatusCode)
+		suite.Contains(body, "128 bytes")
+	})
+
+	suite.Run("Payload Exceeds Type Limit", func() {
+		name := strings.Repeat("x", 100)
+		res, body := suite.generate("/process", name, 0)
+		suite.Equal(http2.StatusRequestEntityTooLarge, res.StatusCode)
+		suite.Contains(body, "128 bytes")
+		// the path type cannot raise the limit of the payload
+		res, body = suite.generate("/process/reports.Other", name, 0)
+		suite.Equal(http2.StatusRequestEntityTooLarge, res.StatusCode)
+		suite.Contains(body, "128 bytes")
+	})
+
+	suite.Run("Process Timeout", func() {
+		res, body := suite.generate("/process", "sales", 100*time.Millisecond)
+		suite.Equal(http2.StatusOK, res.StatusCode)
+		suite.JSONEq(`{"payload":{"@type":"reports.Report","Name":"sales"}}`, body)
+
+		start := time.Now()
+		res, body = suite.generate("/process", "sales", 2*time.Second)
+		suite.Equal(http2.StatusServiceUnavailable, res.StatusCode)
+		suite.Contains(body, "processing exceeded timeout of 300ms")
+		suite.Less(time.Since(start), time.Second)
+	})
+
+	suite.Run("Read Timeout", func() {
+		conn, err := net.Dial("tcp", strings.TrimPrefix(suite.srv.URL, "http://"))
+		suite.Nil(err)
+		defer func() { _ = conn.Close() }()
+		_, err = fmt.Fprint(conn, "POST /process HTTP/1.1\r\n"+
+			"Host: localhost\r\n"+
+			"Content-Type: application/json\r\n"+
+			"Content-Length: 100\r\n\r\n"+
+			`{"payload":`)
+		suite.Nil(err)
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		res, err := http2.ReadResponse(bufio.NewReader(conn), nil)
+		suite.Nil(err)
+		suite.Equal(http2.StatusRequestTimeout, res.StatusCode)
+	})
+
+	suite.Run("Too Many Parts", func() {
+		res, body := suite.multipart("a", "b")
+		suite.Equal(http2.StatusRequestEntityTooLarge, res.StatusCode)
+		suite.Contains(body, "multipart parts exceeds limit of 2")
+	})
+
+	suite.Run("Part Too Large", func() {
+		res, body := suite.multipart(strings.Repeat("a", 100))
+		suite.Equal(http2.StatusRequestEntityTooLarge, res.StatusCode)
+		suite.Contains(body, "multipart part size exceeds limit of 64")
+	})
+}
+
+func (suite *LimitTestSuite) multipart(
+	parts ...string,
+) (*http2.Response, string) {
+	var sb strings.Builder
+	mw := multipart.NewWriter(&sb)
+	main, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":        {"application/json"},
+		"Content-Disposition": {`form-data; name="main"`},
+	})
+	suite.Nil(err)
+	_, err = io.WriteString(main, `{"@type":"reports.Generate"}`)
+	suite.Nil(err)
+	for i, part := range parts {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":        {"text/plain"},
+			"Content-Disposition": {fmt.Sprintf(`form-data; name="part%d"`, i)},
+		})
+		suite.Nil(err)
+		_, err = io.WriteString(w, part)
+		suite.Nil(err)
+	}
+	suite.Nil(mw.Close())
+	return suite.post("/process", mw.FormDataContentType(), strings.NewReader(sb.String()))
+}
+
+func TestLimitTestSuite(t *testing.T) {
+	suite.Run(t, new(LimitTestSuite))
+}
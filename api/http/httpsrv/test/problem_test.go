@@ -0,0 +1,189 @@
+package test
+
+import (
+	"errors"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/api/http"
+	"github.com/miruken-go/miruken/api/http/httpsrv"
+	"github.com/miruken-go/miruken/api/json/stdjson"
+	"github.com/miruken-go/miruken/validates"
+	"github.com/stretchr/testify/suite"
+	"io"
+	http2 "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type ProblemTestSuite struct {
+	suite.Suite
+	srv *httptest.Server
+}
+
+func (suite *ProblemTestSuite) SetupTest() {
+	handler, _ := miruken.Setup(
+		TestFeature, httpsrv.Feature(), stdjson.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Handler()
+	suite.srv = httptest.NewServer(httpsrv.Pipeline(handler))
+}
+
+func (suite *ProblemTestSuite) TearDownTest() {
+	suite.srv.Close()
+}
+
+func (suite *ProblemTestSuite) post(
+	body   string,
+	accept string,
+) (*http2.Response, string) {
+	req, err := http2.NewRequest(http2.MethodPost, suite.srv.URL+"/process", strings.NewReader(body))
+	suite.Nil(err)
+	req.Header.Set("Content-Type", "application/json")
+	if len(accept) > 0 {
+		req.Header.Set("Accept", accept)
+	}
+	res, err := http2.DefaultClient.Do(req)
+	suite.Nil(err)
+	defer func() { _ = res.Body.Close() }()
+	content, err := io.ReadAll(res.Body)
+	suite.Nil(err)
+	return res, string(content)
+}
+
+func (suite *ProblemTestSuite) Client() miruken.Handler {
+	client, _ := miruken.Setup(
+		TestFeature, http.Feature(), stdjson.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Handler()
+	return miruken.BuildUp(client, http.Pipeline(func(
+		req      *http2.Request,
+		composer miruken.Handler,
+		next     func() (*http2.Response, error),
+	) (*http2.Response, error) {
+		req.Header.Set("Accept", "application/json, application/problem+json")
+		return next()
+	}))
+}
+
+func (suite *ProblemTestSuite) TestProblem() {
+	suite.Run("Validation", func() {
+		res, body := suite.post(`{"payload":{"@type":"test.CreateTeam"}}`,
+			"application/json, application/problem+json")
+		suite.Equal(http2.StatusUnprocessableEntity, res.StatusCode)
+		suite.Equal(http.ProblemJson, res.Header.Get("Content-Type"))
+		suite.JSONEq(`{
+			"type":   "about:blank",
+			"title":  "Unprocessable Entity",
+			"status": 422,
+			"detail": "Name: \"Name\" is required",
+			"errors": {"Name": ["\"Name\" is required"]}
+		}`, body)
+	})
+
+	suite.Run("Error", func() {
+		res, body := suite.post(`{"payload":{"@type":"test.Unknown"}}`,
+			"application/problem+json")
+		suite.Equal(http2.StatusUnsupportedMediaType, res.StatusCode)
+		suite.Equal(http.ProblemJson, res.Header.Get("Content-Type"))
+		suite.Contains(body, `"status":415`)
+		suite.Contains(body, `"title":"Unsupported Media Type"`)
+		suite.Contains(body, `test.Unknown`)
+	})
+
+	suite.Run("Opt In", func() {
+		res, body := suite.post(`{"payload":{"@type":"test.CreateTeam"}}`, "")
+		suite.Equal(http2.StatusUnprocessableEntity, res.StatusCode)
+		suite.Equal("application/json", res.Header.Get("Content-Type"))
+		suite.NotContains(body, `"status"`)
+	})
+
+	suite.Run("Lower Quality", func() {
+		res, body := suite.post(`{"payload":{"@type":"test.CreateTeam"}}`,
+			"application/json, application/problem+json;q=0.1")
+		suite.Equal(http2.StatusUnprocessableEntity, res.StatusCode)
+		suite.Equal("application/json", res.Header.Get("Content-Type"))
+		suite.NotContains(body, `"status"`)
+	})
+
+	suite.Run("Higher Quality", func() {
+		res, _ := suite.post(`{"payload":{"@type":"test.CreateTeam"}}`,
+			"application/json;q=0.5, application/problem+json")
+		suite.Equal(http2.StatusUnprocessableEntity, res.StatusCode)
+		suite.Equal(http.ProblemJson, res.Header.Get("Content-Type"))
+	})
+
+	suite.Run("Server Error", func() {
+		res, body := suite.post(
+			`{"payload":{"@type":"reports.Generate","Name":"sales","Fail":true}}`,
+			"application/problem+json")
+		suite.Equal(http2.StatusInternalServerError, res.StatusCode)
+		suite.Equal(http.ProblemJson, res.Header.Get("Content-Type"))
+		suite.NotContains(body, "report failed")
+		suite.NotContains(body, `"detail"`)
+	})
+
+	suite.Run("Success", func() {
+		res, body := suite.post(`{"payload":{"@type":"test.CreateTeam","Name":"Liverpool"}}`,
+			"application/json, application/problem+json")
+		suite.Equal(http2.StatusOK, res.StatusCode)
+		suite.Equal("application/json", res.Header.Get("Content-Type"))
+		suite.Contains(body, `"Name":"Liverpool"`)
+	})
+
+	suite.Run("Decode", func() {
+		suite.Run("Outcome", func() {
+			_, pr, err := api.Send[*TeamData](suite.Client(),
+				api.RouteTo(&CreateTeam{}, suite.srv.URL))
+			suite.Nil(err)
+			_, err = pr.Await()
+			var outcome *validates.Outcome
+			suite.True(errors.As(err, &outcome))
+			suite.Equal([]error{errors.New(`"Name" is required`)}, outcome.FieldErrors("Name"))
+		})
+
+		suite.Run("Problem", func() {
+			_, pr, err := api.Send[any](suite.Client(),
+				api.RouteTo(&GenerateReport{Name: "sales", Fail: true}, suite.srv.URL))
+			suite.Nil(err)
+			_, err = pr.Await()
+			var problem *http.Problem
+			suite.Require().True(errors.As(err, &problem))
+			suite.Equal(http2.StatusInternalServerError, problem.Status)
+			suite.Empty(problem.Detail)
+			suite.Equal("Internal Server Error", problem.Error())
+		})
+	})
+}
+
+func (suite *ProblemTestSuite) TestProblemJson() {
+	suite.Run("Nested Outcome", func() {
+		outcome := &validates.Outcome{}
+		outcome.AddError("Name", errors.New("required"))
+		outcome.AddError("Address.City", errors.New("unknown"))
+		outcome.AddError("Address.City", errors.New("too long"))
+		problem := http.NewProblem(http2.StatusUnprocessableEntity, outcome)
+		problem.Instance = "/teams/1"
+		js, err := problem.MarshalJSON()
+		suite.Nil(err)
+
+		var decoded http.Problem
+		suite.Nil(decoded.UnmarshalJSON(js))
+		suite.Equal("/teams/1", decoded.Instance)
+		suite.Equal(422, decoded.Status)
+		result, ok := decoded.Outcome()
+		suite.True(ok)
+		suite.Equal(outcome.Error(), result.Error())
+	})
+
+	suite.Run("No Outcome", func() {
+		problem := http.NewProblem(http2.StatusConflict, errors.New("duplicate"))
+		_, ok := problem.Outcome()
+		suite.False(ok)
+		suite.Equal("Conflict: duplicate", problem.Error())
+	})
+}
+
+func TestProblemTestSuite(t *testing.T) {
+	suite.Run(t, new(ProblemTestSuite))
+}
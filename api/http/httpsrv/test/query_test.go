@@ -0,0 +1,155 @@
+package test
+
+import (
+	"fmt"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/api/http/httpsrv"
+	"github.com/miruken-go/miruken/api/json/stdjson"
+	"github.com/miruken-go/miruken/handles"
+	"github.com/stretchr/testify/suite"
+	"io"
+	http2 "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type (
+	FindTeams struct {
+		_       struct{} `typeid:"teams.Find"`
+		League  string
+		Season  int      `query:"year"`
+		Tags    []string
+		Active  *bool
+		Timeout time.Duration
+	}
+
+	TeamQueryHandler struct {}
+)
+
+func (t *TeamQueryHandler) FindTeams(
+	_ *handles.It, find *FindTeams,
+) ([]string, error) {
+	if find.League == "none" {
+		return nil, fmt.Errorf("league %q not found", find.League)
+	}
+	active := "any"
+	if find.Active != nil {
+		active = fmt.Sprint(*find.Active)
+	}
+	return []string{
+		find.League,
+		fmt.Sprint(find.Season),
+		strings.Join(find.Tags, "+"),
+		active,
+		find.Timeout.String(),
+	}, nil
+}
+
+type QueryTestSuite struct {
+	suite.Suite
+	srv *httptest.Server
+}
+
+func (suite *QueryTestSuite) SetupTest() {
+	handler, _ := miruken.Setup(
+		TestFeature, httpsrv.Feature(), stdjson.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Builders(httpsrv.Query(
+			httpsrv.QueryType[FindTeams](""),
+			httpsrv.QueryRoute{
+				Path:   "leagues/{league}/teams",
+				Type:   "teams.Find",
+				MaxAge: time.Minute,
+			})).
+		Handler()
+	suite.srv = httptest.NewServer(httpsrv.Pipeline(handler))
+}
+
+func (suite *QueryTestSuite) TearDownTest() {
+	suite.srv.Close()
+}
+
+func (suite *QueryTestSuite) get(
+	path   string,
+	header ...string,
+) (*http2.Response, string) {
+	req, err := http2.NewRequest(http2.MethodGet, suite.srv.URL+path, nil)
+	suite.Nil(err)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	res, err := http2.DefaultClient.Do(req)
+	suite.Nil(err)
+	defer func() { _ = res.Body.Close() }()
+	body, err := io.ReadAll(res.Body)
+	suite.Nil(err)
+	return res, string(body)
+}
+
+func (suite *QueryTestSuite) TestQuery() {
+	suite.Run("Binds Parameters", func() {
+		res, body := suite.get(
+			"/query/teams.Find?league=EPL&year=2023&tags=a,b&active=true&timeout=5s")
+		suite.Equal(http2.StatusOK, res.StatusCode)
+		suite.Equal("application/json", res.Header.Get("Content-Type"))
+		suite.JSONEq(`{"payload":{"@type":"[]string","@values":["EPL","2023","a+b","true","5s"]}}`, body)
+		suite.NotEmpty(res.Header.Get("ETag"))
+		suite.Contains(res.Header.Values("Vary"), "Accept")
+		suite.Empty(res.Header.Get("Cache-Control"))
+	})
+
+	suite.Run("Binds Repeated Parameters", func() {
+		res, body := suite.get("/query/teams.Find?tags=x&tags=y")
+		suite.Equal(http2.StatusOK, res.StatusCode)
+		suite.JSONEq(`{"payload":{"@type":"[]string","@values":["","0","x+y","any","0s"]}}`, body)
+	})
+
+	suite.Run("Binds Path Segments", func() {
+		res, body := suite.get("/query/leagues/La%20Liga/teams?year=2022")
+		suite.Equal(http2.StatusOK, res.StatusCode)
+		suite.JSONEq(`{"payload":{"@type":"[]string","@values":["La Liga","2022","","any","0s"]}}`, body)
+		suite.Equal("max-age=60", res.Header.Get("Cache-Control"))
+	})
+
+	suite.Run("Not Modified", func() {
+		res, _ := suite.get("/query/teams.Find?league=EPL")
+		etag := res.Header.Get("ETag")
+		suite.NotEmpty(etag)
+		res, body := suite.get("/query/teams.Find?league=EPL", "If-None-Match", etag)
+		suite.Equal(http2.StatusNotModified, res.StatusCode)
+		suite.Empty(body)
+		res, _ = suite.get("/query/teams.Find?league=MLS", "If-None-Match", etag)
+		suite.Equal(http2.StatusOK, res.StatusCode)
+		suite.NotEqual(etag, res.Header.Get("ETag"))
+	})
+
+	suite.Run("Invalid Parameter", func() {
+		res, body := suite.get("/query/teams.Find?year=abc")
+		suite.Equal(http2.StatusBadRequest, res.StatusCode)
+		suite.Contains(body, `"year"`)
+	})
+
+	suite.Run("Not Found", func() {
+		res, _ := suite.get("/query/teams.Unknown")
+		suite.Equal(http2.StatusNotFound, res.StatusCode)
+	})
+
+	suite.Run("Error", func() {
+		res, body := suite.get("/query/teams.Find?league=none")
+		suite.Equal(http2.StatusInternalServerError, res.StatusCode)
+		suite.Contains(body, `league \"none\" not found`)
+		suite.Empty(res.Header.Get("ETag"))
+	})
+
+	suite.Run("Rejects Other Methods", func() {
+		res, _ := suite.get("/process")
+		suite.Equal(http2.StatusMethodNotAllowed, res.StatusCode)
+	})
+}
+
+func TestQueryTestSuite(t *testing.T) {
+	suite.Run(t, new(QueryTestSuite))
+}
@@ -0,0 +1,268 @@
+package test
+
+import (
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/api/http/httpsrv"
+	"github.com/miruken-go/miruken/api/http/ws"
+	"github.com/miruken-go/miruken/api/json/stdjson"
+	"github.com/miruken-go/miruken/handles"
+	"github.com/miruken-go/miruken/validates"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/websocket"
+	http2 "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type (
+	TeamPushConsumer struct {
+		created chan *TeamCreated
+	}
+)
+
+
+// TeamPushConsumer
+
+func (t *TeamPushConsumer) TeamCreated(
+	_ *handles.It, created *TeamCreated,
+) {
+	if t.created != nil {
+		t.created <- created
+	}
+}
+
+
+type SocketTestSuite struct {
+	suite.Suite
+	srv     *httptest.Server
+	handler miruken.Handler
+	route   string
+}
+
+func (suite *SocketTestSuite) Setup(specs ...any) miruken.Handler {
+	handler, _ := miruken.Setup(
+		TestFeature, ws.Feature(), stdjson.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Handlers(specs...).
+		Handler()
+	return handler
+}
+
+func (suite *SocketTestSuite) SetupTest() {
+	suite.handler, _ = miruken.Setup(
+		TestFeature, httpsrv.Feature(), stdjson.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Handler()
+	mux := http2.NewServeMux()
+	mux.Handle("/ws", httpsrv.WebSocket(suite.handler))
+	suite.srv   = httptest.NewServer(mux)
+	suite.route = "ws" + strings.TrimPrefix(suite.srv.URL, "http")
+}
+
+func (suite *SocketTestSuite) Server(builders ...miruken.Builder) string {
+	handler, _ := miruken.Setup(
+		TestFeature, httpsrv.Feature(), stdjson.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Builders(builders...).
+		Handler()
+	srv := httptest.NewServer(httpsrv.WebSocket(handler))
+	suite.T().Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func (suite *SocketTestSuite) TearDownTest() {
+	suite.srv.CloseClientConnections()
+	suite.srv.Close()
+}
+
+func (suite *SocketTestSuite) TestSocket() {
+	suite.Run("Send", func() {
+		handler := suite.Setup()
+		create := api.RouteTo(CreateTeam{Name: "Arsenal"}, suite.route)
+		_, pp, err := api.Send[*TeamData](handler, create)
+		suite.Nil(err)
+		suite.NotNil(pp)
+		team, err := pp.Await()
+		suite.Nil(err)
+		suite.Equal("Arsenal", team.Name)
+		suite.True(team.Id > 0)
+	})
+
+	suite.Run("Concurrent", func() {
+		handler := suite.Setup()
+		names := []string{"Arsenal", "Everton", "Fulham", "Brentford"}
+		pending := make([]func() (*TeamData, error), len(names))
+		for i, name := range names {
+			_, pp, err := api.Send[*TeamData](handler,
+				api.RouteTo(CreateTeam{Name: name}, suite.route))
+			suite.Nil(err)
+			pending[i] = pp.Await
+		}
+		for i, await := range pending {
+			team, err := await()
+			suite.Nil(err)
+			suite.Equal(names[i], team.Name)
+		}
+	})
+
+	suite.Run("ValidationError", func() {
+		handler := suite.Setup()
+		create := api.RouteTo(CreateTeam{}, suite.route)
+		_, pp, err := api.Send[*TeamData](handler, create)
+		suite.Nil(err)
+		suite.NotNil(pp)
+		_, err = pp.Await()
+		var outcome *validates.Outcome
+		suite.ErrorAs(err, &outcome)
+		suite.Equal(`Name: "Name" is required`, outcome.Error())
+	})
+
+	suite.Run("Publish", func() {
+		created  := make(chan *TeamCreated, 1)
+		listener := suite.Setup(&TeamPushConsumer{created})
+		pv, err := api.Post(listener, api.RouteTo(
+			ws.Subscribe{Topics: []string{"test.TeamCreated"}}, suite.route))
+		suite.Nil(err)
+		_, err = pv.Await()
+		suite.Nil(err)
+
+		publisher := suite.Setup()
+		notify := api.RouteTo(&TeamCreated{TeamData{9, "Everton", nil}}, suite.route)
+		pv, err = api.Publish(publisher, notify)
+		suite.Nil(err)
+		suite.NotNil(pv)
+		_, err = pv.Await()
+		suite.Nil(err)
+
+		select {
+		case ev := <-created:
+			suite.Equal(&TeamCreated{TeamData{9, "Everton", nil}}, ev)
+		case <-time.After(5 * time.Second):
+			suite.Fail("expected pushed message")
+		}
+	})
+
+	suite.Run("Push", func() {
+		created  := make(chan *TeamCreated, 1)
+		listener := suite.Setup(&TeamPushConsumer{created})
+		pv, err := api.Post(listener, api.RouteTo(
+			ws.Subscribe{Topics: []string{ws.AllTopics}}, suite.route))
+		suite.Nil(err)
+		_, err = pv.Await()
+		suite.Nil(err)
+
+		push := api.RouteTo(&TeamCreated{TeamData{3, "Fulham", nil}}, httpsrv.Subscribers)
+		pv, err = api.Publish(suite.handler, push)
+		suite.Nil(err)
+		if pv != nil {
+			_, err = pv.Await()
+			suite.Nil(err)
+		}
+
+		select {
+		case ev := <-created:
+			suite.Equal(&TeamCreated{TeamData{3, "Fulham", nil}}, ev)
+		case <-time.After(5 * time.Second):
+			suite.Fail("expected pushed message")
+		}
+	})
+
+	suite.Run("Push Order", func() {
+		created  := make(chan *TeamCreated, 20)
+		listener := suite.Setup(&TeamPushConsumer{created})
+		pv, err := api.Post(listener, api.RouteTo(
+			ws.Subscribe{Topics: []string{"test.TeamCreated"}}, suite.route))
+		suite.Nil(err)
+		_, err = pv.Await()
+		suite.Nil(err)
+
+		for id := 1; id <= cap(created); id++ {
+			push := api.RouteTo(&TeamCreated{TeamData{int32(id), "Team", nil}}, httpsrv.Subscribers)
+			pv, err = api.Publish(suite.handler, push)
+			suite.Nil(err)
+			if pv != nil {
+				_, err = pv.Await()
+				suite.Nil(err)
+			}
+		}
+
+		// the listener may observe each push more than once
+		for last := int32(0); last < int32(cap(created)); {
+			select {
+			case ev := <-created:
+				if id := ev.Team.Id; id != last {
+					suite.Equal(last+1, id)
+					last = id
+				}
+			case <-time.After(5 * time.Second):
+				suite.Fail("expected pushed message")
+				return
+			}
+		}
+	})
+
+	suite.Run("Subscribers", func() {
+		arsenal  := make(chan *TeamCreated, 1)
+		everton  := make(chan *TeamCreated, 1)
+		listener := suite.Setup()
+		for _, created := range []chan *TeamCreated{arsenal, everton} {
+			consumer := miruken.AddHandlers(listener, &TeamPushConsumer{created})
+			pv, err := api.Post(consumer, api.RouteTo(
+				ws.Subscribe{Topics: []string{"test.TeamCreated"}}, suite.route))
+			suite.Nil(err)
+			_, err = pv.Await()
+			suite.Nil(err)
+		}
+
+		push := api.RouteTo(&TeamCreated{TeamData{5, "Brentford", nil}}, httpsrv.Subscribers)
+		pv, err := api.Publish(suite.handler, push)
+		suite.Nil(err)
+		if pv != nil {
+			_, err = pv.Await()
+			suite.Nil(err)
+		}
+
+		for _, created := range []chan *TeamCreated{arsenal, everton} {
+			select {
+			case ev := <-created:
+				suite.Equal(&TeamCreated{TeamData{5, "Brentford", nil}}, ev)
+			case <-time.After(5 * time.Second):
+				suite.Fail("expected pushed message")
+			}
+		}
+	})
+
+	suite.Run("Origin", func() {
+		route := suite.Server()
+		conn, err := websocket.Dial(route, "", "http://evil.example.com")
+		suite.NotNil(err)
+		suite.Nil(conn)
+
+		route = suite.Server(httpsrv.Socket(httpsrv.SocketOptions{
+			Origins: []string{"http://*.example.com"},
+		}))
+		conn, err = websocket.Dial(route, "", "http://app.example.com")
+		suite.Nil(err)
+		_ = conn.Close()
+	})
+
+	suite.Run("Limits", func() {
+		route := suite.Server(httpsrv.Limits(httpsrv.LimitOptions{
+			MaxBodySize: 1 << 10,
+			Types:       []httpsrv.TypeLimit{{Type: "test.CreateTeam", MaxBodySize: 32}},
+		}))
+		handler := suite.Setup()
+		create  := api.RouteTo(CreateTeam{Name: "Wolverhampton Wanderers"}, route)
+		_, pp, err := api.Send[*TeamData](handler, create)
+		suite.Nil(err)
+		_, err = pp.Await()
+		suite.ErrorContains(err, "413")
+	})
+}
+
+func TestSocketTestSuite(t *testing.T) {
+	suite.Run(t, new(SocketTestSuite))
+}
@@ -0,0 +1,238 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/internal"
+	"github.com/miruken-go/miruken/security/login"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Token is an access token used to authorize requests.
+	// A zero Expiry means the token does not expire.
+	Token struct {
+		AccessToken string
+		TokenType   string
+		Expiry      time.Time
+	}
+
+	// TokenSource acquires access tokens.
+	TokenSource interface {
+		Token(ctx context.Context, composer miruken.Handler) (Token, error)
+	}
+
+	// ClientCredentials acquires access tokens using the
+	// OAuth2 client credentials grant.
+	// https://www.rfc-editor.org/rfc/rfc6749#section-4.4
+	ClientCredentials struct {
+		TokenUrl     string
+		ClientId     string
+		ClientSecret string
+		Scopes       []string
+		Audience     string
+	}
+
+	// LoginFlow acquires access tokens by running the login.Flow
+	// configured at Flow.  The first Token credential added to
+	// the authenticated subject is used.
+	LoginFlow struct {
+		Flow string
+	}
+
+	// TokenError reports a failed token request.
+	TokenError struct {
+		StatusCode  int
+		Code        string
+		Description string
+	}
+
+	// tokenCache caches a token until shortly before it expires.
+	tokenCache struct {
+		lock   sync.Mutex
+		source TokenSource
+		token  Token
+	}
+)
+
+
+// expiryDelta is how early tokens are refreshed before they expire.
+const expiryDelta = 10 * time.Second
+
+
+var ErrMissingToken = errors.New("login flow did not provide a token")
+
+
+func (e *TokenError) Error() string {
+	if len(e.Code) == 0 {
+		return fmt.Sprintf("token request failed (%d)", e.StatusCode)
+	}
+	if len(e.Description) == 0 {
+		return fmt.Sprintf("token request failed (%d): %s", e.StatusCode, e.Code)
+	}
+	return fmt.Sprintf("token request failed (%d): %s: %s",
+		e.StatusCode, e.Code, e.Description)
+}
+
+
+// Token
+
+// Valid returns true if the token is present and not about to expire.
+func (t Token) Valid() bool {
+	return len(t.AccessToken) > 0 &&
+		(t.Expiry.IsZero() || time.Now().Add(expiryDelta).Before(t.Expiry))
+}
+
+// Authorization returns the value of the Authorization header.
+func (t Token) Authorization() string {
+	typ := t.TokenType
+	if len(typ) == 0 || strings.EqualFold(typ, "bearer") {
+		typ = "Bearer"
+	}
+	return typ + " " + t.AccessToken
+}
+
+
+// ClientCredentials
+
+func (c *ClientCredentials) Token(
+	ctx context.Context,
+	_   miruken.Handler,
+) (Token, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.Scopes, " "))
+	}
+	if len(c.Audience) > 0 {
+		form.Set("audience", c.Audience)
+	}
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		c.TokenUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(c.ClientId), url.QueryEscape(c.ClientSecret))
+
+	res, err := defaultHttpClient.Do(req)
+	if err != nil {
+		return Token{}, err
+	}
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(res.Body)
+
+	var body struct {
+		AccessToken      string `json:"access_token"`
+		TokenType        string `json:"token_type"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	decodeErr := json.NewDecoder(res.Body).Decode(&body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 || len(body.Error) > 0 {
+		return Token{}, &TokenError{res.StatusCode, body.Error, body.ErrorDescription}
+	} else if decodeErr != nil {
+		return Token{}, decodeErr
+	} else if len(body.AccessToken) == 0 {
+		return Token{}, &TokenError{res.StatusCode, "missing access_token", ""}
+	}
+	token := Token{AccessToken: body.AccessToken, TokenType: body.TokenType}
+	if body.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+
+// LoginFlow
+
+func (l *LoginFlow) Token(
+	_        context.Context,
+	composer miruken.Handler,
+) (Token, error) {
+	subject, err := login.New(l.Flow).Login(composer).Await()
+	if err != nil {
+		return Token{}, err
+	}
+	for _, credential := range subject.Credentials() {
+		switch t := credential.(type) {
+		case Token:
+			return t, nil
+		case *Token:
+			return *t, nil
+		}
+	}
+	return Token{}, ErrMissingToken
+}
+
+
+// tokenCache
+
+func (c *tokenCache) get(
+	ctx      context.Context,
+	composer miruken.Handler,
+	stale    Token,
+) (Token, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	// another request may have already refreshed the token
+	if c.token.Valid() && c.token != stale {
+		return c.token, nil
+	}
+	token, err := c.source.Token(ctx, composer)
+	if err != nil {
+		return Token{}, err
+	}
+	c.token = token
+	return token, nil
+}
+
+
+// Bearer returns a Policy that authorizes requests with access
+// tokens acquired from the source.  Tokens are cached until they
+// expire and refreshed once if the request is rejected with 401.
+func Bearer(source TokenSource) Policy {
+	if internal.IsNil(source) {
+		panic("source cannot be nil")
+	}
+	cache := &tokenCache{source: source}
+	return func(
+		req      *http.Request,
+		composer miruken.Handler,
+		next     func() (*http.Response, error),
+	) (*http.Response, error) {
+		token, err := cache.get(req.Context(), composer, Token{})
+		if err != nil {
+			return nil, fmt.Errorf("bearer: %w", err)
+		}
+		req.Header.Set("Authorization", token.Authorization())
+		res, err := next()
+		if err != nil || res.StatusCode != http.StatusUnauthorized || req.GetBody == nil {
+			return res, err
+		}
+		// the token may have been revoked so refresh and try again
+		if token, err = cache.get(req.Context(), composer, token); err != nil {
+			return res, nil
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return res, nil
+		}
+		discard(res)
+		req.Body = body
+		req.Header.Set("Authorization", token.Authorization())
+		return next()
+	}
+}
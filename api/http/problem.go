@@ -0,0 +1,184 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/miruken-go/miruken/validates"
+	"net/http"
+	"sort"
+)
+
+type (
+	// Problem details an error in an http response.
+	// https://www.rfc-editor.org/rfc/rfc7807
+	// Extensions are additional members of the problem
+	// such as the field errors of a validates.Outcome.
+	Problem struct {
+		Type       string
+		Title      string
+		Status     int
+		Detail     string
+		Instance   string
+		Extensions map[string]any
+	}
+)
+
+
+const (
+	// ProblemJson is the media type of problem details.
+	ProblemJson = "application/problem+json"
+
+	// ProblemErrors is the extension member containing the
+	// field errors of a validates.Outcome keyed by path.
+	ProblemErrors = "errors"
+)
+
+
+// NewProblem creates a Problem for the error and status code.
+// The field errors of a validates.Outcome are included in the
+// ProblemErrors extension.  Server errors omit the detail to
+// avoid disclosing internal failures.
+func NewProblem(status int, err error) *Problem {
+	problem := &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+	}
+	if err != nil {
+		if status < http.StatusInternalServerError {
+			problem.Detail = err.Error()
+		}
+		var outcome *validates.Outcome
+		if errors.As(err, &outcome) {
+			problem.Extensions = map[string]any{
+				ProblemErrors: outcomeErrors(outcome, "", nil),
+			}
+		}
+	}
+	return problem
+}
+
+func (p *Problem) Error() string {
+	if len(p.Detail) == 0 {
+		return p.Title
+	} else if len(p.Title) == 0 {
+		return p.Detail
+	}
+	return p.Title + ": " + p.Detail
+}
+
+// Outcome returns the validates.Outcome described by the
+// ProblemErrors extension if present.
+func (p *Problem) Outcome() (*validates.Outcome, bool) {
+	fields, ok := p.Extensions[ProblemErrors].(map[string]any)
+	if !ok || len(fields) == 0 {
+		return nil, false
+	}
+	paths := make([]string, 0, len(fields))
+	for path := range fields {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	outcome := &validates.Outcome{}
+	for _, path := range paths {
+		switch messages := fields[path].(type) {
+		case []any:
+			for _, msg := range messages {
+				if s, ok := msg.(string); ok {
+					outcome.AddError(path, errors.New(s))
+				}
+			}
+		case []string:
+			for _, msg := range messages {
+				outcome.AddError(path, errors.New(msg))
+			}
+		case string:
+			outcome.AddError(path, errors.New(messages))
+		}
+	}
+	return outcome, !outcome.Valid()
+}
+
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	members := make(map[string]any, len(p.Extensions)+5)
+	for key, value := range p.Extensions {
+		members[key] = value
+	}
+	if len(p.Type) > 0 {
+		members["type"] = p.Type
+	}
+	if len(p.Title) > 0 {
+		members["title"] = p.Title
+	}
+	if p.Status > 0 {
+		members["status"] = p.Status
+	}
+	if len(p.Detail) > 0 {
+		members["detail"] = p.Detail
+	}
+	if len(p.Instance) > 0 {
+		members["instance"] = p.Instance
+	}
+	return json.Marshal(members)
+}
+
+func (p *Problem) UnmarshalJSON(data []byte) error {
+	var members map[string]any
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+	*p = Problem{}
+	for key, value := range members {
+		switch key {
+		case "type":
+			p.Type, _ = value.(string)
+		case "title":
+			p.Title, _ = value.(string)
+		case "status":
+			if status, ok := value.(float64); ok {
+				p.Status = int(status)
+			}
+		case "detail":
+			p.Detail, _ = value.(string)
+		case "instance":
+			p.Instance, _ = value.(string)
+		default:
+			if p.Extensions == nil {
+				p.Extensions = make(map[string]any)
+			}
+			p.Extensions[key] = value
+		}
+	}
+	return nil
+}
+
+
+// outcomeErrors flattens the field errors of the outcome
+// into messages keyed by the dotted path of the field.
+func outcomeErrors(
+	outcome *validates.Outcome,
+	prefix  string,
+	fields  map[string]any,
+) map[string]any {
+	if fields == nil {
+		fields = make(map[string]any)
+	}
+	for _, field := range outcome.Fields() {
+		path := field
+		if len(prefix) > 0 {
+			path = prefix + "." + field
+		}
+		var messages []string
+		for _, err := range outcome.FieldErrors(field) {
+			if child, ok := err.(*validates.Outcome); ok {
+				outcomeErrors(child, path, fields)
+			} else {
+				messages = append(messages, err.Error())
+			}
+		}
+		if len(messages) > 0 {
+			fields[path] = messages
+		}
+	}
+	return fields
+}
@@ -0,0 +1,355 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/miruken-go/miruken"
+	http2 "github.com/miruken-go/miruken/api/http"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+type (
+	// Mode determines if exchanges are recorded or replayed.
+	Mode uint8
+
+	// Match determines how requests are matched to recorded exchanges.
+	Match uint8
+
+	// Exchange is a recorded request and its response or error.
+	// Json bodies are stored verbatim and other bodies as bytes.
+	Exchange struct {
+		Path          string          `json:"path"`
+		Type          string          `json:"type,omitempty"`
+		ContentType   string          `json:"contentType,omitempty"`
+		Request       json.RawMessage `json:"request,omitempty"`
+		RequestBytes  []byte          `json:"requestBytes,omitempty"`
+		Status        int             `json:"status,omitempty"`
+		ResponseType  string          `json:"responseType,omitempty"`
+		Response      json.RawMessage `json:"response,omitempty"`
+		ResponseBytes []byte          `json:"responseBytes,omitempty"`
+		Error         string          `json:"error,omitempty"`
+	}
+
+	// Recorder records the exchanges of routed messages to a
+	// golden file and replays them without a network.
+	Recorder struct {
+		file      string
+		mode      Mode
+		match     Match
+		lock      sync.Mutex
+		exchanges []Exchange
+		replayed  []bool
+	}
+
+	// NoExchangeError reports a request without a recorded exchange.
+	NoExchangeError struct {
+		Type string
+		Body string
+	}
+)
+
+
+const (
+	// Auto replays the golden file if it exists or records it otherwise.
+	Auto Mode = iota
+	// Record sends requests and records the exchanges.
+	Record
+	// Replay responds to requests with the recorded exchanges.
+	Replay
+)
+
+const (
+	// MatchBody matches requests by message type and body.
+	MatchBody Match = iota
+	// MatchType matches requests by message type only.
+	MatchType
+)
+
+// ModeEnv is the environment variable overriding the Mode.
+// e.g. MIRUKEN_REPLAY=record go test ./...
+const ModeEnv = "MIRUKEN_REPLAY"
+
+
+func (e *NoExchangeError) Error() string {
+	return fmt.Sprintf("replay: no recorded exchange for %q: %s", e.Type, e.Body)
+}
+
+
+// Mode returns the effective mode of the recorder.
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// Exchanges returns the recorded exchanges.
+func (r *Recorder) Exchanges() []Exchange {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]Exchange(nil), r.exchanges...)
+}
+
+// Policy returns the http.Policy recording or replaying exchanges.
+// It should be the last Policy in the pipeline.
+func (r *Recorder) Policy() http2.Policy {
+	return func(
+		req      *http.Request,
+		_        miruken.Handler,
+		next     func() (*http.Response, error),
+	) (*http.Response, error) {
+		body, err := requestBody(req)
+		if err != nil {
+			return nil, err
+		}
+		if r.mode == Replay {
+			return r.replay(req, body)
+		}
+		return r.record(req, body, next)
+	}
+}
+
+// Save writes the recorded exchanges to the golden file.
+// Nothing is written when replaying.
+func (r *Recorder) Save() error {
+	if r.mode == Replay {
+		return nil
+	}
+	r.lock.Lock()
+	data, err := json.MarshalIndent(r.exchanges, "", "  ")
+	r.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(r.file), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(r.file, append(data, '\n'), 0644)
+}
+
+func (r *Recorder) record(
+	req  *http.Request,
+	body []byte,
+	next func() (*http.Response, error),
+) (*http.Response, error) {
+	exchange := Exchange{Path: req.URL.Path, ContentType: req.Header.Get("Content-Type")}
+	exchange.Type = messageType(body)
+	exchange.Request, exchange.RequestBytes = store(body)
+	res, err := next()
+	if err != nil {
+		exchange.Error = err.Error()
+		r.add(exchange)
+		return nil, err
+	}
+	content, err := responseBody(res)
+	if err != nil {
+		return nil, err
+	}
+	exchange.Status       = res.StatusCode
+	exchange.ResponseType = res.Header.Get("Content-Type")
+	exchange.Response, exchange.ResponseBytes = store(content)
+	r.add(exchange)
+	return res, nil
+}
+
+func (r *Recorder) replay(
+	req  *http.Request,
+	body []byte,
+) (*http.Response, error) {
+	typ := messageType(body)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	// prefer exchanges not replayed yet to preserve the recorded order
+	found := -1
+	for i := range r.exchanges {
+		if r.matches(&r.exchanges[i], req.URL.Path, typ, body) {
+			if !r.replayed[i] {
+				found = i
+				break
+			} else if found < 0 {
+				found = i
+			}
+		}
+	}
+	if found < 0 {
+		return nil, &NoExchangeError{typ, string(body)}
+	}
+	r.replayed[found] = true
+	exchange := r.exchanges[found]
+	if len(exchange.Error) > 0 {
+		return nil, errors.New(exchange.Error)
+	}
+	content := []byte(exchange.Response)
+	if exchange.ResponseBytes != nil {
+		content = exchange.ResponseBytes
+	}
+	header := make(http.Header)
+	if ct := exchange.ResponseType; len(ct) > 0 {
+		header.Set("Content-Type", ct)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", exchange.Status, http.StatusText(exchange.Status)),
+		StatusCode:    exchange.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(content)),
+		ContentLength: int64(len(content)),
+		Request:       req,
+	}, nil
+}
+
+func (r *Recorder) matches(
+	exchange *Exchange,
+	path     string,
+	typ      string,
+	body     []byte,
+) bool {
+	if exchange.Path != path || exchange.Type != typ {
+		return false
+	}
+	if r.match == MatchType {
+		return true
+	}
+	if exchange.RequestBytes != nil {
+		return bytes.Equal(exchange.RequestBytes, body)
+	}
+	return equalJson(exchange.Request, body)
+}
+
+func (r *Recorder) add(exchange Exchange) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.exchanges = append(r.exchanges, exchange)
+}
+
+
+// New creates a Recorder for the golden file.
+// The mode can be overridden with the MIRUKEN_REPLAY
+// environment variable set to record or replay.
+func New(file string, mode Mode, match ...Match) (*Recorder, error) {
+	if len(file) == 0 {
+		panic("file cannot be empty")
+	}
+	switch strings.ToLower(os.Getenv(ModeEnv)) {
+	case "record":
+		mode = Record
+	case "replay":
+		mode = Replay
+	}
+	r := &Recorder{file: file, mode: mode}
+	if len(match) > 0 {
+		r.match = match[0]
+	}
+	if mode == Auto {
+		if _, err := os.Stat(file); err == nil {
+			r.mode = Replay
+		} else if errors.Is(err, os.ErrNotExist) {
+			r.mode = Record
+		} else {
+			return nil, err
+		}
+	}
+	if r.mode == Replay {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("replay: %w", err)
+		}
+		if err = json.Unmarshal(data, &r.exchanges); err != nil {
+			return nil, fmt.Errorf("replay: %q: %w", file, err)
+		}
+		r.replayed = make([]bool, len(r.exchanges))
+	}
+	return r, nil
+}
+
+
+// requestBody reads the uncompressed request body
+// leaving the request unchanged.
+func requestBody(req *http.Request) ([]byte, error) {
+	var body io.ReadCloser
+	if req.GetBody != nil {
+		var err error
+		if body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	} else if req.Body != nil {
+		data, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(data))
+		body     = io.NopCloser(bytes.NewReader(data))
+	} else {
+		return nil, nil
+	}
+	defer func() { _ = body.Close() }()
+	dec, err := http2.NewDecoder(body, req.Header.Get("Content-Encoding"))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = dec.Close() }()
+	return io.ReadAll(dec)
+}
+
+// responseBody reads the uncompressed response body and
+// replaces it so it can be read again.
+func responseBody(res *http.Response) ([]byte, error) {
+	defer func() { _ = res.Body.Close() }()
+	dec, err := http2.NewDecoder(res.Body, res.Header.Get("Content-Encoding"))
+	if err != nil {
+		return nil, err
+	}
+	content, err := io.ReadAll(dec)
+	if err != nil {
+		return nil, err
+	}
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+	res.ContentLength = int64(len(content))
+	res.Body = io.NopCloser(bytes.NewReader(content))
+	return content, nil
+}
+
+// messageType returns the type discriminator of a json payload.
+func messageType(body []byte) string {
+	var msg struct {
+		Payload struct {
+			Type string `json:"@type"`
+		} `json:"payload"`
+	}
+	if json.Unmarshal(body, &msg) == nil {
+		return msg.Payload.Type
+	}
+	return ""
+}
+
+// store returns json bodies verbatim and others as bytes.
+func store(body []byte) (json.RawMessage, []byte) {
+	if len(body) == 0 {
+		return nil, nil
+	}
+	if json.Valid(body) {
+		var compact bytes.Buffer
+		if json.Compact(&compact, body) == nil {
+			return compact.Bytes(), nil
+		}
+	}
+	return nil, body
+}
+
+// equalJson compares json documents ignoring formatting and key order.
+func equalJson(a, b []byte) bool {
+	var va, vb any
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return bytes.Equal(a, b)
+	}
+	ca, _ := json.Marshal(va)
+	cb, _ := json.Marshal(vb)
+	return bytes.Equal(ca, cb)
+}
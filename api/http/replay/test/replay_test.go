@@ -0,0 +1,214 @@
+package test
+
+import (
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/api/http"
+	"github.com/miruken-go/miruken/api/http/httpsrv"
+	"github.com/miruken-go/miruken/api/http/replay"
+	"github.com/miruken-go/miruken/api/json/stdjson"
+	"github.com/miruken-go/miruken/creates"
+	"github.com/miruken-go/miruken/handles"
+	"github.com/stretchr/testify/suite"
+	http2 "net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+//go:generate $GOPATH/bin/miruken -tests
+
+type (
+	Ping struct {
+		Count int
+	}
+
+	Pong struct {
+		Count int
+	}
+
+	PingHandler struct {}
+
+	// counter counts the requests forwarded to the api server.
+	counter struct {
+		hits    int32
+		handler http2.Handler
+	}
+)
+
+func (p *PingHandler) Ping(
+	_ *handles.It, ping *Ping,
+) *Pong {
+	return &Pong{ping.Count}
+}
+
+func (p *PingHandler) New(
+	_*struct{
+		_ creates.It `key:"test.Ping"`
+		_ creates.It `key:"test.Pong"`
+	  }, create *creates.It,
+) any {
+	switch create.Key() {
+	case "test.Ping":
+		return new(Ping)
+	case "test.Pong":
+		return new(Pong)
+	}
+	return nil
+}
+
+func (c *counter) ServeHTTP(w http2.ResponseWriter, r *http2.Request) {
+	atomic.AddInt32(&c.hits, 1)
+	c.handler.ServeHTTP(w, r)
+}
+
+type ReplayTestSuite struct {
+	suite.Suite
+	golden string
+}
+
+func (suite *ReplayTestSuite) SetupSubTest() {
+	suite.golden = filepath.Join(suite.T().TempDir(), "testdata", "ping.json")
+}
+
+func (suite *ReplayTestSuite) Setup(
+	recorder *replay.Recorder,
+) miruken.Handler {
+	client, _ := miruken.Setup(
+		TestFeature, http.Feature(), stdjson.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Handler()
+	return miruken.BuildUp(client, http.Pipeline(recorder.Policy()))
+}
+
+func (suite *ReplayTestSuite) Server() (*counter, string) {
+	server, _ := miruken.Setup(
+		TestFeature, httpsrv.Feature(), stdjson.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Handler()
+	c   := &counter{handler: httpsrv.Pipeline(server)}
+	srv := httptest.NewServer(c)
+	suite.T().Cleanup(srv.Close)
+	return c, srv.URL
+}
+
+func (suite *ReplayTestSuite) ping(
+	handler miruken.Handler,
+	route   string,
+	count   int,
+) (*Pong, error) {
+	_, pp, err := api.Send[*Pong](handler, api.RouteTo(&Ping{count}, route))
+	if err != nil {
+		return nil, err
+	}
+	return pp.Await()
+}
+
+// record pings the server and saves the exchanges.
+func (suite *ReplayTestSuite) record(counts ...int) *counter {
+	c, url := suite.Server()
+	recorder, err := replay.New(suite.golden, replay.Record)
+	suite.Nil(err)
+	handler := suite.Setup(recorder)
+	for _, count := range counts {
+		pong, err := suite.ping(handler, url, count)
+		suite.Nil(err)
+		suite.Equal(&Pong{count}, pong)
+	}
+	suite.Nil(recorder.Save())
+	return c
+}
+
+func (suite *ReplayTestSuite) TestReplay() {
+	suite.Run("Record", func() {
+		c := suite.record(1, 2)
+		suite.Equal(int32(2), c.hits)
+		recorder, err := replay.New(suite.golden, replay.Replay)
+		suite.Nil(err)
+		exchanges := recorder.Exchanges()
+		suite.Len(exchanges, 2)
+		suite.Equal("/process", exchanges[0].Path)
+		suite.Equal("test.Ping", exchanges[0].Type)
+		suite.Equal(200, exchanges[0].Status)
+		suite.JSONEq(`{"payload":{"@type":"test.Ping","Count":1}}`,
+			string(exchanges[0].Request))
+		suite.JSONEq(`{"payload":{"@type":"test.Pong","Count":1}}`,
+			string(exchanges[0].Response))
+	})
+
+	suite.Run("Replay", func() {
+		c := suite.record(1, 2)
+		recorder, err := replay.New(suite.golden, replay.Replay)
+		suite.Nil(err)
+		handler := suite.Setup(recorder)
+		for _, count := range []int{2, 1, 2} {
+			pong, err := suite.ping(handler, "http://localhost:1", count)
+			suite.Nil(err)
+			suite.Equal(&Pong{count}, pong)
+		}
+		suite.Equal(int32(2), c.hits)
+	})
+
+	suite.Run("No Exchange", func() {
+		suite.record(1)
+		recorder, err := replay.New(suite.golden, replay.Replay)
+		suite.Nil(err)
+		handler := suite.Setup(recorder)
+		_, err = suite.ping(handler, "http://localhost:1", 3)
+		var ne *replay.NoExchangeError
+		suite.ErrorAs(err, &ne)
+		suite.Equal("test.Ping", ne.Type)
+	})
+
+	suite.Run("Match Type", func() {
+		suite.record(1)
+		recorder, err := replay.New(suite.golden, replay.Replay, replay.MatchType)
+		suite.Nil(err)
+		handler := suite.Setup(recorder)
+		pong, err := suite.ping(handler, "http://localhost:1", 3)
+		suite.Nil(err)
+		suite.Equal(&Pong{1}, pong)
+	})
+
+	suite.Run("Error", func() {
+		recorder, err := replay.New(suite.golden, replay.Record)
+		suite.Nil(err)
+		_, err = suite.ping(suite.Setup(recorder), "http://localhost:1", 1)
+		suite.NotNil(err)
+		suite.Nil(recorder.Save())
+
+		recorder, err = replay.New(suite.golden, replay.Replay)
+		suite.Nil(err)
+		_, err = suite.ping(suite.Setup(recorder), "http://localhost:1", 1)
+		suite.ErrorContains(err, "connection refused")
+	})
+
+	suite.Run("Auto", func() {
+		recorder, err := replay.New(suite.golden, replay.Auto)
+		suite.Nil(err)
+		suite.Equal(replay.Record, recorder.Mode())
+		suite.record(1)
+		recorder, err = replay.New(suite.golden, replay.Auto)
+		suite.Nil(err)
+		suite.Equal(replay.Replay, recorder.Mode())
+	})
+
+	suite.Run("Env", func() {
+		suite.record(1)
+		suite.T().Setenv(replay.ModeEnv, "record")
+		recorder, err := replay.New(suite.golden, replay.Replay)
+		suite.Nil(err)
+		suite.Equal(replay.Record, recorder.Mode())
+	})
+
+	suite.Run("Missing Golden", func() {
+		_, err := replay.New(filepath.Join(suite.T().TempDir(), "none.json"), replay.Replay)
+		suite.ErrorIs(err, os.ErrNotExist)
+	})
+}
+
+func TestReplayTestSuite(t *testing.T) {
+	suite.Run(t, new(ReplayTestSuite))
+}
@@ -0,0 +1,526 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/miruken-go/miruken"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// RetryOptions configure retrying failed requests with
+	// jittered exponential backoff.  A Retry-After header in
+	// the response takes precedence over the computed delay.
+	// Api requests are not idempotent so only those failing to
+	// connect are retried unless TransportErrors is set, which
+	// retries requests the server may have already received.
+	RetryOptions struct {
+		MaxAttempts     int
+		BaseDelay       time.Duration
+		MaxDelay        time.Duration
+		StatusCodes     []int
+		TransportErrors bool
+	}
+
+	// HedgeOptions configure hedged requests.  Another request
+	// is sent if no response is received within Delay and the
+	// first successful response wins.  Hedged requests may all
+	// be processed so only routes marked Idempotent are hedged.
+	HedgeOptions struct {
+		Delay       time.Duration
+		MaxAttempts int
+	}
+
+	// BreakerOptions configure circuit breaking.  The circuit opens
+	// after FailureThreshold consecutive failures and rejects requests
+	// until OpenTimeout elapses and a trial request succeeds.
+	BreakerOptions struct {
+		FailureThreshold int
+		OpenTimeout      time.Duration
+	}
+
+	// RouteOptions override the resilience policies of a route.
+	// Idempotent routes can safely process duplicate requests.
+	RouteOptions struct {
+		Route      string
+		Timeout    time.Duration
+		Retry      *RetryOptions
+		Hedge      *HedgeOptions
+		Breaker    *BreakerOptions
+		Idempotent bool
+	}
+
+	// CircuitOpenError reports a request rejected by an open circuit.
+	CircuitOpenError struct {
+		Route   string
+		RetryAt time.Time
+	}
+
+	// resilience holds the effective policies of a route.
+	resilience struct {
+		timeout    time.Duration
+		retry      *RetryOptions
+		hedge      *HedgeOptions
+		breaker    *BreakerOptions
+		idempotent bool
+	}
+
+	// circuit tracks the health of a route.
+	circuit struct {
+		lock     sync.Mutex
+		state    circuitState
+		failures int
+		openedAt time.Time
+	}
+
+	circuitState uint8
+
+	// attempt is the outcome of a single request.
+	attempt struct {
+		index int
+		res   *http.Response
+		err   error
+	}
+
+	// cancelBody releases the request context when the
+	// response body is closed.
+	cancelBody struct {
+		io.ReadCloser
+		cancel context.CancelFunc
+	}
+)
+
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+const (
+	defaultMaxAttempts      = 3
+	defaultBaseDelay        = 100 * time.Millisecond
+	defaultMaxDelay         = 10 * time.Second
+	defaultHedgeAttempts    = 2
+	defaultFailureThreshold = 5
+	defaultOpenTimeout      = 30 * time.Second
+)
+
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit open for %q until %s",
+		e.Route, e.RetryAt.Format(time.RFC3339))
+}
+
+
+// RetryOptions
+
+func (r *RetryOptions) maxAttempts() int {
+	if r.MaxAttempts > 0 {
+		return r.MaxAttempts
+	}
+	return defaultMaxAttempts
+}
+
+func (r *RetryOptions) retryable(
+	req *http.Request,
+	res *http.Response,
+	err error,
+) bool {
+	if err != nil {
+		var open *CircuitOpenError
+		if req.Context().Err() != nil || errors.As(err, &open) {
+			return false
+		}
+		// the request never reached the server
+		var op *net.OpError
+		if errors.As(err, &op) && op.Op == "dial" {
+			return true
+		}
+		return r.TransportErrors
+	}
+	return slices.Contains(r.statusCodes(), res.StatusCode)
+}
+
+func (r *RetryOptions) statusCodes() []int {
+	if r != nil && len(r.StatusCodes) > 0 {
+		return r.StatusCodes
+	}
+	return defaultRetryStatusCodes
+}
+
+// delay returns the time to wait before the next attempt using
+// full jitter unless the response includes a Retry-After.
+func (r *RetryOptions) delay(
+	attempt int,
+	res     *http.Response,
+) time.Duration {
+	maxDelay := r.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultMaxDelay
+	}
+	if res != nil {
+		if after, ok := retryAfter(res.Header.Get("Retry-After")); ok {
+			return min(after, maxDelay)
+		}
+	}
+	backoff := r.BaseDelay
+	if backoff <= 0 {
+		backoff = defaultBaseDelay
+	}
+	for i := 1; i < attempt && backoff < maxDelay; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, maxDelay)
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
+
+
+// HedgeOptions
+
+func (h *HedgeOptions) maxAttempts() int {
+	if h.MaxAttempts > 0 {
+		return h.MaxAttempts
+	}
+	return defaultHedgeAttempts
+}
+
+
+// BreakerOptions
+
+func (b *BreakerOptions) failureThreshold() int {
+	if b.FailureThreshold > 0 {
+		return b.FailureThreshold
+	}
+	return defaultFailureThreshold
+}
+
+func (b *BreakerOptions) openTimeout() time.Duration {
+	if b.OpenTimeout > 0 {
+		return b.OpenTimeout
+	}
+	return defaultOpenTimeout
+}
+
+
+// circuit
+
+// allow rejects the request if the circuit is open.
+// A single trial request is allowed once the circuit
+// has been open longer than the timeout.
+func (c *circuit) allow(
+	route   string,
+	options *BreakerOptions,
+) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	switch c.state {
+	case circuitOpen:
+		retryAt := c.openedAt.Add(options.openTimeout())
+		if time.Now().Before(retryAt) {
+			return &CircuitOpenError{route, retryAt}
+		}
+		c.state = circuitHalfOpen
+	case circuitHalfOpen:
+		return &CircuitOpenError{route, c.openedAt.Add(options.openTimeout())}
+	}
+	return nil
+}
+
+func (c *circuit) record(
+	failed  bool,
+	options *BreakerOptions,
+) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if failed {
+		c.failures++
+		if c.state == circuitHalfOpen || c.failures >= options.failureThreshold() {
+			c.state    = circuitOpen
+			c.openedAt = time.Now()
+		}
+	} else {
+		c.state    = circuitClosed
+		c.failures = 0
+	}
+}
+
+
+func (b *cancelBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+
+// failed returns true if the request did not reach a healthy
+// server.  Failures are classified as they are for retries so
+// errors reported by the application are not failures.
+func (r *resilience) failed(
+	res *http.Response,
+	err error,
+) bool {
+	return err != nil || slices.Contains(r.retry.statusCodes(), res.StatusCode)
+}
+
+
+// resilience returns the policies for the route.
+func (o *Options) resilience(route string) resilience {
+	policies := resilience{o.Timeout, o.Retry, o.Hedge, o.Breaker, false}
+	for _, ro := range o.Routes {
+		if strings.TrimSuffix(ro.Route, "/") == strings.TrimSuffix(route, "/") {
+			if ro.Timeout > 0 {
+				policies.timeout = ro.Timeout
+			}
+			if ro.Retry != nil {
+				policies.retry = ro.Retry
+			}
+			if ro.Hedge != nil {
+				policies.hedge = ro.Hedge
+			}
+			if ro.Breaker != nil {
+				policies.breaker = ro.Breaker
+			}
+			policies.idempotent = ro.Idempotent
+			break
+		}
+	}
+	if policies.timeout <= 0 {
+		policies.timeout = defaultTimeout
+	}
+	return policies
+}
+
+
+// send executes the request applying the resilience policies
+// configured for the route.
+func (r *Router) send(
+	req      *http.Request,
+	route    string,
+	composer miruken.Handler,
+	options  *Options,
+) (*http.Response, error) {
+	policies := options.resilience(route)
+	var circ *circuit
+	if policies.breaker != nil {
+		c, _ := r.circuits.LoadOrStore(route, new(circuit))
+		circ = c.(*circuit)
+	}
+	attempts := 1
+	if retry := policies.retry; retry != nil {
+		attempts = retry.maxAttempts()
+	}
+	for i := 1; ; i++ {
+		if circ != nil {
+			if err := circ.allow(route, policies.breaker); err != nil {
+				return nil, err
+			}
+		}
+		res, err := r.hedge(req, composer, options.Pipeline, &policies)
+		if circ != nil {
+			circ.record(policies.failed(res, err), policies.breaker)
+		}
+		if i >= attempts || !policies.retry.retryable(req, res, err) {
+			return res, err
+		}
+		delay := policies.retry.delay(i, res)
+		discard(res)
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// hedge sends additional requests if a response is not received
+// within the hedge delay and returns the first successful one.
+// Only idempotent routes are hedged.
+func (r *Router) hedge(
+	req      *http.Request,
+	composer miruken.Handler,
+	pipeline []Policy,
+	policies *resilience,
+) (*http.Response, error) {
+	hedge := policies.hedge
+	if hedge == nil || hedge.Delay <= 0 || !policies.idempotent {
+		return r.attempt(req.Context(), req, composer, pipeline, policies)
+	}
+	maxAttempts := hedge.maxAttempts()
+	results     := make(chan attempt, maxAttempts)
+	cancels     := make([]context.CancelFunc, 0, maxAttempts)
+	launch := func() {
+		ctx, cancel := context.WithCancel(req.Context())
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			res, err := r.attempt(ctx, req, composer, pipeline, policies)
+			results <- attempt{index, res, err}
+		}()
+	}
+	// keep releases the context of the chosen attempt with its body
+	// and cancels all the others
+	keep := func(a attempt) (*http.Response, error) {
+		for i, cancel := range cancels {
+			if i != a.index || a.res == nil {
+				cancel()
+			}
+		}
+		if a.res != nil {
+			a.res.Body = &cancelBody{a.res.Body, cancels[a.index]}
+		}
+		return a.res, a.err
+	}
+	launch()
+	timer := time.NewTimer(hedge.Delay)
+	defer timer.Stop()
+	var last attempt
+	for received := 0; ; {
+		select {
+		case a := <-results:
+			received++
+			if !policies.failed(a.res, a.err) {
+				// drain the outstanding requests
+				go func(pending int) {
+					for ; pending > 0; pending-- {
+						discard((<-results).res)
+					}
+				}(len(cancels) - received)
+				return keep(a)
+			}
+			discard(last.res)
+			last = a
+			if received == len(cancels) {
+				if len(cancels) == maxAttempts {
+					return keep(last)
+				}
+				launch()
+				timer.Reset(hedge.Delay)
+			}
+		case <-timer.C:
+			if len(cancels) < maxAttempts {
+				launch()
+				timer.Reset(hedge.Delay)
+			}
+		}
+	}
+}
+
+// attempt sends a copy of the request through the pipeline
+// bounded by the route timeout.  Logical routes lease an endpoint of
+// the service for each attempt so retries and hedges avoid
+// ejected endpoints.
+func (r *Router) attempt(
+	parent   context.Context,
+	req      *http.Request,
+	composer miruken.Handler,
+	pipeline []Policy,
+	policies *resilience,
+) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(parent, policies.timeout)
+	areq := req.Clone(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		areq.Body = body
+	}
+	var endpoint *lease
+	if service, path, ok := logicalRoute(req.URL.String()); ok {
+		var err error
+		if endpoint, err = r.resolve(service, composer); err != nil {
+			cancel()
+			return nil, err
+		}
+		// the endpoint is released with the response
+		release := cancel
+		cancel = func() {
+			release()
+			endpoint.release()
+		}
+		if areq.URL, err = url.Parse(endpoint.url + path); err != nil {
+			cancel()
+			return nil, err
+		}
+		areq.Host = ""
+	}
+	res, err := r.invoke(areq, composer, pipeline)
+	if endpoint != nil {
+		endpoint.record(policies.failed(res, err))
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	res.Body = &cancelBody{res.Body, cancel}
+	return res, nil
+}
+
+
+// Timeout returns a miruken.Builder that bounds each request attempt.
+func Timeout(timeout time.Duration) miruken.Builder {
+	return miruken.Options(Options{Timeout: timeout})
+}
+
+// Retry returns a miruken.Builder that retries failed requests.
+func Retry(options RetryOptions) miruken.Builder {
+	return miruken.Options(Options{Retry: &options})
+}
+
+// Hedge returns a miruken.Builder that sends hedged requests.
+func Hedge(options HedgeOptions) miruken.Builder {
+	return miruken.Options(Options{Hedge: &options})
+}
+
+// Breaker returns a miruken.Builder that applies circuit breaking.
+func Breaker(options BreakerOptions) miruken.Builder {
+	return miruken.Options(Options{Breaker: &options})
+}
+
+// Routes returns a miruken.Builder that overrides resilience by route.
+func Routes(routes ...RouteOptions) miruken.Builder {
+	return miruken.Options(Options{Routes: routes})
+}
+
+
+// retryAfter parses the Retry-After header in seconds or http date.
+func retryAfter(header string) (time.Duration, bool) {
+	if len(header) == 0 {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(header); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
+
+// discard drains and closes the response body.
+func discard(res *http.Response) {
+	if res != nil && res.Body != nil {
+		_, _ = io.Copy(io.Discard, res.Body)
+		_ = res.Body.Close()
+	}
+}
+
+
+var defaultRetryStatusCodes = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
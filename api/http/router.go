@@ -2,6 +2,7 @@ package http
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/miruken-go/miruken"
@@ -10,9 +11,12 @@ import (
 	"github.com/miruken-go/miruken/handles"
 	"github.com/miruken-go/miruken/maps"
 	"github.com/miruken-go/miruken/promise"
+	"github.com/miruken-go/miruken/provides"
 	"io"
 	"net/http"
+	"net/textproto"
 	"net/url"
+	"sync"
 	"time"
 )
 
@@ -24,15 +28,28 @@ type (
 	) (*http.Response, error)
 
 	// Options customize http operations.
+	// The resilience policies can be loaded from configuration
+	// and overridden for individual routes.
 	Options struct {
 		Format      string
 		ProcessPath string
 		PublishPath string
 		Pipeline    []Policy
+		Timeout     time.Duration
+		Retry       *RetryOptions
+		Hedge       *HedgeOptions
+		Breaker     *BreakerOptions
+		Routes      []RouteOptions
+		Compress    *CompressOptions
 	}
 
 	// Router routes messages over a http transport.
-	Router struct {}
+	// The circuits of the routes and the balancers of the
+	// logical services are tracked by the Router.
+	Router struct {
+		circuits  sync.Map
+		balancers sync.Map
+	}
 )
 
 const (
@@ -40,10 +57,18 @@ const (
 	defaultTimeout = 30 * time.Second
 )
 
+func (r *Router) Constructor(
+	_*struct{
+		provides.It
+		provides.Single
+	  },
+) {
+}
+
 func (r *Router) Route(
 	_*struct{
 		handles.It
-		api.Routes `scheme:"http,https"`
+		api.Routes `scheme:"http,https,svc"`
 	  }, routed api.Routed,
 	_*struct{
 		args.Optional
@@ -52,7 +77,8 @@ func (r *Router) Route(
 	ctx miruken.HandleContext,
 ) *promise.Promise[any] {
 	return promise.New(func(resolve func(any), reject func(error)) {
-		uri, err := r.resourceUri(routed, &options, &ctx)
+		route := routed.Route
+		uri, err := r.resourceUri(route, &options, &ctx)
 		if err != nil {
 			reject(fmt.Errorf("http router: %w", err))
 			return
@@ -77,19 +103,40 @@ func (r *Router) Route(
 			reject(fmt.Errorf("http router: %w", err))
 		}
 
+		encoding, err := compress(&b, options.Compress)
+		if err != nil {
+			reject(fmt.Errorf("http router: %w", err))
+			return
+		}
+
 		req, err  := http.NewRequest(http.MethodPost, uri, &b)
 		if err != nil {
 			reject(fmt.Errorf("http router: %w", err))
 			return
 		}
 		req.Header.Add("Content-Type", format)
+		if format != defaultFormat {
+			req.Header.Set("Accept", format)
+		}
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		if len(encoding) > 0 {
+			req.Header.Set("Content-Encoding", encoding)
+		}
+		if err = api.StashToHeader(composer, textproto.MIMEHeader(req.Header)); err != nil {
+			reject(fmt.Errorf("http router: %w", err))
+			return
+		}
 
-		res, err := r.invoke(req, composer, options.Pipeline)
-
+		res, err := r.send(req, route, composer, &options)
 		if err != nil {
 			reject(fmt.Errorf("http router: %w", err))
 			return
 		}
+		if err = decompress(res); err != nil {
+			discard(res)
+			reject(fmt.Errorf("http router: %w", err))
+			return
+		}
 		defer func(body io.ReadCloser) {
 			_ = body.Close()
 		}(res.Body)
@@ -128,20 +175,21 @@ func (r *Router) invoke(
 	composer miruken.Handler,
 	pipeline []Policy,
 ) (*http.Response, error) {
-	index, length := 0, len(pipeline)
+	length := len(pipeline)
 	if length == 0 {
 		return defaultHttpClient.Do(req)
 	}
-	var next func() (*http.Response, error)
-	next = func() (*http.Response, error) {
+	// each policy receives its own next so it can be called again
+	var call func(index int) (*http.Response, error)
+	call = func(index int) (*http.Response, error) {
 		if index < length {
-			policy := pipeline[index]
-			index++
-			return policy(req, composer, next)
+			return pipeline[index](req, composer, func() (*http.Response, error) {
+				return call(index+1)
+			})
 		}
 		return defaultHttpClient.Do(req)
 	}
-	return next()
+	return call(0)
 }
 
 func (r *Router) decodeError(
@@ -157,6 +205,16 @@ func (r *Router) decodeError(
 	if err != nil {
 		return err
 	}
+	if from.Name() == ProblemJson {
+		var problem Problem
+		if err := json.NewDecoder(res.Body).Decode(&problem); err != nil {
+			return err
+		}
+		if outcome, ok := problem.Outcome(); ok {
+			return outcome
+		}
+		return &problem
+	}
 	msg, _, _, err := maps.Out[api.Message](composer, res.Body, from)
 	if err == nil {
 		if payload := msg.Payload; payload != nil {
@@ -171,7 +229,7 @@ func (r *Router) decodeError(
 }
 
 func (r *Router) resourceUri(
-	routed  api.Routed,
+	route   string,
 	options *Options,
 	ctx     *miruken.HandleContext,
 ) (string, error) {
@@ -183,7 +241,7 @@ func (r *Router) resourceUri(
 	} else if path = options.ProcessPath; len(path) == 0 {
 		path = "process"
 	}
-	return url.JoinPath(routed.Route, path)
+	return url.JoinPath(route, path)
 }
 
 
@@ -219,10 +277,8 @@ func newDefaultHttpClient() *http.Client {
 	t.MaxConnsPerHost     = 100
 	t.MaxIdleConnsPerHost = 100
 
-	return &http.Client{
-		Timeout:   defaultTimeout,
-		Transport: t,
-	}
+	// the Router bounds each attempt by the route timeout
+	return &http.Client{Transport: t}
 }
 
 
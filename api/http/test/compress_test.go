@@ -0,0 +1,188 @@
+package test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/api/http"
+	"github.com/miruken-go/miruken/api/http/httpsrv"
+	"github.com/miruken-go/miruken/api/json/stdjson"
+	"github.com/miruken-go/miruken/either"
+	"github.com/stretchr/testify/suite"
+	"io"
+	http2 "net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// encodings records the content encodings of requests and responses.
+type encodings struct {
+	lock     sync.Mutex
+	request  []string
+	response []string
+}
+
+func (e *encodings) record(
+	req  *http2.Request,
+	_    miruken.Handler,
+	next func() (*http2.Response, error),
+) (*http2.Response, error) {
+	res, err := next()
+	if err == nil {
+		e.lock.Lock()
+		defer e.lock.Unlock()
+		e.request  = append(e.request, req.Header.Get("Content-Encoding"))
+		e.response = append(e.response, res.Header.Get("Content-Encoding"))
+	}
+	return res, err
+}
+
+type CompressTestSuite struct {
+	suite.Suite
+}
+
+func (suite *CompressTestSuite) Setup(
+	builders ...miruken.Builder,
+) (miruken.Handler, *httptest.Server) {
+	server, _ := miruken.Setup(
+		TestFeature, httpsrv.Feature(), stdjson.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Builders(builders...).
+		Handler()
+	srv := httptest.NewServer(httpsrv.Pipeline(server))
+	suite.T().Cleanup(srv.Close)
+	client, _ := miruken.Setup(
+		TestFeature, http.Feature(), stdjson.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Handler()
+	return client, srv
+}
+
+func (suite *CompressTestSuite) batch(
+	handler miruken.Handler,
+	route   string,
+	count   int,
+) {
+	requests := make([]any, count)
+	for i := range requests {
+		requests[i] = &Ping{i}
+	}
+	batch := api.RouteTo(api.ConcurrentBatch{Requests: requests}, route)
+	_, pr, err := api.Send[api.ScheduledResult](handler, batch)
+	suite.Nil(err)
+	r, err := pr.Await()
+	suite.Nil(err)
+	suite.Len(r.Responses, count)
+	for i, res := range r.Responses {
+		either.Match(res, func(err error) {
+			suite.Fail("unexpected error", err)
+		}, func(pong any) {
+			suite.Equal(&Pong{i}, pong)
+		})
+	}
+}
+
+func (suite *CompressTestSuite) TestCompress() {
+	suite.Run("Gzip", func() {
+		var enc encodings
+		handler, srv := suite.Setup(httpsrv.Compress(http.CompressOptions{MinSize: 256}))
+		handler = miruken.BuildUp(handler,
+			http.Compress(http.CompressOptions{MinSize: 256}),
+			http.Pipeline(enc.record))
+		suite.batch(handler, srv.URL, 50)
+		suite.Equal([]string{"gzip"}, enc.request)
+		suite.Equal([]string{"gzip"}, enc.response)
+	})
+
+	suite.Run("Deflate", func() {
+		var enc encodings
+		handler, srv := suite.Setup(httpsrv.Compress(http.CompressOptions{
+			Encoding: "deflate",
+			MinSize:  256,
+		}))
+		handler = miruken.BuildUp(handler,
+			http.Compress(http.CompressOptions{Encoding: "deflate", MinSize: 256}),
+			http.Pipeline(enc.record))
+		suite.batch(handler, srv.URL, 50)
+		suite.Equal([]string{"deflate"}, enc.request)
+		suite.Equal([]string{"deflate"}, enc.response)
+	})
+
+	suite.Run("Threshold", func() {
+		var enc encodings
+		handler, srv := suite.Setup(httpsrv.Compress(http.CompressOptions{}))
+		handler = miruken.BuildUp(handler,
+			http.Compress(http.CompressOptions{}),
+			http.Pipeline(enc.record))
+		suite.batch(handler, srv.URL, 2)
+		suite.Equal([]string{""}, enc.request)
+		suite.Equal([]string{""}, enc.response)
+	})
+
+	suite.Run("Uncompressed", func() {
+		var enc encodings
+		handler, srv := suite.Setup()
+		handler = miruken.BuildUp(handler, http.Pipeline(enc.record))
+		suite.batch(handler, srv.URL, 50)
+		suite.Equal([]string{""}, enc.request)
+		suite.Equal([]string{""}, enc.response)
+	})
+
+	suite.Run("Negotiate", func() {
+		options := http.CompressOptions{Encoding: "deflate"}
+		suite.Equal("deflate", options.Negotiate("gzip, deflate"))
+		suite.Equal("gzip", options.Negotiate("gzip, deflate;q=0.5"))
+		suite.Equal("deflate", options.Negotiate("*"))
+		suite.Equal("", options.Negotiate("br, identity"))
+		suite.Equal("", options.Negotiate("gzip;q=0"))
+	})
+
+	suite.Run("Server", func() {
+		_, srv := suite.Setup()
+
+		suite.Run("Decompresses Request", func() {
+			var b bytes.Buffer
+			gz := gzip.NewWriter(&b)
+			_, _ = gz.Write([]byte(`{"payload":{"@type":"test.Ping","Count":3}}`))
+			_ = gz.Close()
+			req, _ := http2.NewRequest(http2.MethodPost, srv.URL+"/process", &b)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Content-Encoding", "gzip")
+			res, err := http2.DefaultClient.Do(req)
+			suite.Nil(err)
+			defer func() { _ = res.Body.Close() }()
+			suite.Equal(http2.StatusOK, res.StatusCode)
+			body, _ := io.ReadAll(res.Body)
+			suite.Contains(string(body), `"Count":3`)
+		})
+
+		suite.Run("Unsupported Encoding", func() {
+			req, _ := http2.NewRequest(http2.MethodPost, srv.URL+"/process",
+				strings.NewReader(`{}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Content-Encoding", "br")
+			res, err := http2.DefaultClient.Do(req)
+			suite.Nil(err)
+			_ = res.Body.Close()
+			suite.Equal(http2.StatusUnsupportedMediaType, res.StatusCode)
+		})
+
+		suite.Run("Corrupt Body", func() {
+			req, _ := http2.NewRequest(http2.MethodPost, srv.URL+"/process",
+				strings.NewReader(`{}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Content-Encoding", "gzip")
+			res, err := http2.DefaultClient.Do(req)
+			suite.Nil(err)
+			_ = res.Body.Close()
+			suite.Equal(http2.StatusBadRequest, res.StatusCode)
+		})
+	})
+}
+
+func TestCompressTestSuite(t *testing.T) {
+	suite.Run(t, new(CompressTestSuite))
+}
@@ -0,0 +1,223 @@
+package test
+
+import (
+	"encoding/json"
+	"github.com/knadh/koanf"
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/api/http"
+	"github.com/miruken-go/miruken/api/http/httpsrv"
+	"github.com/miruken-go/miruken/api/json/stdjson"
+	"github.com/miruken-go/miruken/config"
+	koanfp "github.com/miruken-go/miruken/config/koanf"
+	"github.com/miruken-go/miruken/promise"
+	"github.com/stretchr/testify/suite"
+	http2 "net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type EndpointTestSuite struct {
+	suite.Suite
+}
+
+func (suite *EndpointTestSuite) Server(
+	fail func(int32, http2.ResponseWriter, *http2.Request) bool,
+) (*flaky, string) {
+	server, _ := miruken.Setup(
+		TestFeature, httpsrv.Feature(), stdjson.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Handler()
+	f   := &flaky{fail: fail, handler: httpsrv.Pipeline(server)}
+	srv := httptest.NewServer(f)
+	suite.T().Cleanup(srv.Close)
+	return f, srv.URL
+}
+
+func (suite *EndpointTestSuite) Client(
+	services map[string]any,
+) miruken.Handler {
+	k := koanf.New(".")
+	err := k.Load(confmap.Provider(map[string]any{
+		"services": services,
+	}, "."), nil)
+	suite.Nil(err)
+	client, _ := miruken.Setup(
+		TestFeature, http.Feature(), stdjson.Feature(),
+		config.Feature(koanfp.P(k))).
+		Specs(&api.GoPolymorphism{}).
+		Handler()
+	return client
+}
+
+func (suite *EndpointTestSuite) ping(
+	handler miruken.Handler,
+	route   string,
+	count   int,
+) error {
+	for i := 0; i < count; i++ {
+		_, pp, err := api.Send[*Pong](handler, api.RouteTo(&Ping{i}, route))
+		if err != nil {
+			return err
+		}
+		pong, err := pp.Await()
+		if err != nil {
+			return err
+		}
+		suite.Equal(&Pong{i}, pong)
+	}
+	return nil
+}
+
+func (suite *EndpointTestSuite) TestEndpoints() {
+	suite.Run("RoundRobin", func() {
+		a, urlA := suite.Server(nil)
+		b, urlB := suite.Server(nil)
+		handler := suite.Client(map[string]any{
+			"orders": map[string]any{
+				"endpoints": []any{
+					map[string]any{"url": urlA},
+					map[string]any{"url": urlB},
+				},
+			},
+		})
+		suite.Nil(suite.ping(handler, "svc://orders", 4))
+		suite.Equal(int32(2), a.hits)
+		suite.Equal(int32(2), b.hits)
+	})
+
+	suite.Run("Services", func() {
+		a, urlA := suite.Server(nil)
+		b, urlB := suite.Server(nil)
+		handler := suite.Client(map[string]any{
+			"teams":   map[string]any{"endpoints": []any{map[string]any{"url": urlA}}},
+			"players": map[string]any{"endpoints": []any{map[string]any{"url": urlB}}},
+		})
+		suite.Nil(suite.ping(handler, "svc://teams", 1))
+		suite.Nil(suite.ping(handler, "svc://players", 2))
+		suite.Equal(int32(1), a.hits)
+		suite.Equal(int32(2), b.hits)
+	})
+
+	suite.Run("Weighted", func() {
+		a, urlA := suite.Server(nil)
+		b, urlB := suite.Server(nil)
+		handler := suite.Client(map[string]any{
+			"billing": map[string]any{
+				"endpoints": []any{
+					map[string]any{"url": urlA, "weight": 3},
+					map[string]any{"url": urlB, "weight": 1},
+				},
+			},
+		})
+		suite.Nil(suite.ping(handler, "svc://billing", 8))
+		suite.Equal(int32(6), a.hits)
+		suite.Equal(int32(2), b.hits)
+	})
+
+	suite.Run("LeastOutstanding", func() {
+		slow := func(int32, http2.ResponseWriter, *http2.Request) bool {
+			time.Sleep(100 * time.Millisecond)
+			return false
+		}
+		a, urlA := suite.Server(slow)
+		b, urlB := suite.Server(slow)
+		handler := suite.Client(map[string]any{
+			"shipping": map[string]any{
+				"balance": "least-outstanding",
+				"endpoints": []any{
+					map[string]any{"url": urlA},
+					map[string]any{"url": urlB},
+				},
+			},
+		})
+		var pongs []*promise.Promise[*Pong]
+		for i := 0; i < 2; i++ {
+			_, pp, err := api.Send[*Pong](handler, api.RouteTo(&Ping{i}, "svc://shipping"))
+			suite.Nil(err)
+			pongs = append(pongs, pp)
+		}
+		for _, pp := range pongs {
+			_, err := pp.Await()
+			suite.Nil(err)
+		}
+		suite.Equal(int32(1), atomic.LoadInt32(&a.hits))
+		suite.Equal(int32(1), atomic.LoadInt32(&b.hits))
+	})
+
+	suite.Run("Ejects", func() {
+		a, urlA := suite.Server(unavailable(100, ""))
+		b, urlB := suite.Server(nil)
+		handler := suite.Client(map[string]any{
+			"inventory": map[string]any{
+				"endpoints": []any{
+					map[string]any{"url": urlA},
+					map[string]any{"url": urlB},
+				},
+				"eject": map[string]any{"failures": 1, "duration": "1m"},
+			},
+		})
+		suite.ErrorContains(suite.ping(handler, "svc://inventory", 1), "503")
+		suite.Nil(suite.ping(handler, "svc://inventory", 3))
+		suite.Equal(int32(1), a.hits)
+		suite.Equal(int32(3), b.hits)
+	})
+
+	suite.Run("Retry Other Endpoint", func() {
+		a, urlA := suite.Server(unavailable(100, ""))
+		b, urlB := suite.Server(nil)
+		handler := suite.Client(map[string]any{
+			"shipping": map[string]any{
+				"endpoints": []any{
+					map[string]any{"url": urlA},
+					map[string]any{"url": urlB},
+				},
+				"eject": map[string]any{"failures": 1, "duration": "1m"},
+			},
+		})
+		handler = miruken.BuildUp(handler, http.Retry(http.RetryOptions{
+			MaxAttempts: 2,
+			BaseDelay:   time.Millisecond,
+		}))
+		suite.Nil(suite.ping(handler, "svc://shipping", 1))
+		suite.Equal(int32(1), a.hits)
+		suite.Equal(int32(1), b.hits)
+	})
+
+	suite.Run("File", func() {
+		a, urlA := suite.Server(nil)
+		b, urlB := suite.Server(nil)
+		file := filepath.Join(suite.T().TempDir(), "endpoints.json")
+		write := func(url string, modified time.Time) {
+			data, _ := json.Marshal([]http.Endpoint{{Url: url}})
+			suite.Nil(os.WriteFile(file, data, 0644))
+			suite.Nil(os.Chtimes(file, modified, modified))
+		}
+		write(urlA, time.Now().Add(-time.Minute))
+		handler := suite.Client(map[string]any{
+			"payments": map[string]any{"file": file},
+		})
+		suite.Nil(suite.ping(handler, "svc://payments", 2))
+		write(urlB, time.Now())
+		suite.Nil(suite.ping(handler, "svc://payments", 1))
+		suite.Equal(int32(2), a.hits)
+		suite.Equal(int32(1), b.hits)
+	})
+
+	suite.Run("NotFound", func() {
+		handler := suite.Client(map[string]any{})
+		err := suite.ping(handler, "svc://missing", 1)
+		var nf *http.ServiceNotFoundError
+		suite.ErrorAs(err, &nf)
+		suite.Equal("missing", nf.Service)
+	})
+}
+
+func TestEndpointTestSuite(t *testing.T) {
+	suite.Run(t, new(EndpointTestSuite))
+}
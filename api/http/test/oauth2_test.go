@@ -0,0 +1,242 @@
+package test
+
+import (
+	"fmt"
+	"github.com/knadh/koanf"
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/api/http"
+	"github.com/miruken-go/miruken/api/http/httpsrv"
+	"github.com/miruken-go/miruken/api/json/stdjson"
+	"github.com/miruken-go/miruken/config"
+	koanfp "github.com/miruken-go/miruken/config/koanf"
+	"github.com/miruken-go/miruken/creates"
+	"github.com/miruken-go/miruken/security"
+	"github.com/stretchr/testify/suite"
+	http2 "net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+type (
+	// TokenLoginModule authenticates a service with a static token.
+	TokenLoginModule struct {
+		token string
+	}
+
+	// tokenServer issues tokens using client credentials.
+	tokenServer struct {
+		issued    int32
+		expiresIn int
+		url       string
+	}
+
+	// countingTransport counts the requests sent by a http.Client.
+	countingTransport struct {
+		base     http2.RoundTripper
+		requests atomic.Int32
+	}
+)
+
+func (l *TokenLoginModule) Constructor(
+	_*struct{creates.It `key:"token"`},
+	opts map[string]any,
+) {
+	l.token, _ = opts["token"].(string)
+}
+
+func (l *TokenLoginModule) Login(
+	subject security.Subject,
+	_       miruken.Handler,
+) error {
+	subject.AddCredentials(http.Token{AccessToken: l.token})
+	return nil
+}
+
+func (l *TokenLoginModule) Logout(
+	_ security.Subject,
+	_ miruken.Handler,
+) error {
+	return nil
+}
+
+func (s *tokenServer) ServeHTTP(w http2.ResponseWriter, r *http2.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	id, secret, ok := r.BasicAuth()
+	if !ok || id != "orders" || secret != "secret" ||
+		r.FormValue("grant_type") != "client_credentials" {
+		w.WriteHeader(http2.StatusUnauthorized)
+		_, _ = fmt.Fprint(w, `{"error":"invalid_client","error_description":"unknown client"}`)
+		return
+	}
+	issued := atomic.AddInt32(&s.issued, 1)
+	_, _ = fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","expires_in":%d}`,
+		issued, s.expiresIn)
+}
+
+func (t *countingTransport) RoundTrip(r *http2.Request) (*http2.Response, error) {
+	t.requests.Add(1)
+	return t.base.RoundTrip(r)
+}
+
+// authorized only accepts requests with the bearer token.
+func authorized(token string) func(int32, http2.ResponseWriter, *http2.Request) bool {
+	return func(_ int32, w http2.ResponseWriter, r *http2.Request) bool {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http2.StatusUnauthorized)
+			return true
+		}
+		return false
+	}
+}
+
+type OAuth2TestSuite struct {
+	suite.Suite
+}
+
+func (suite *OAuth2TestSuite) issuer(expiresIn int) *tokenServer {
+	tokens := &tokenServer{expiresIn: expiresIn}
+	srv    := httptest.NewServer(tokens)
+	suite.T().Cleanup(srv.Close)
+	tokens.url = srv.URL
+	return tokens
+}
+
+func (suite *OAuth2TestSuite) Setup(
+	fail func(int32, http2.ResponseWriter, *http2.Request) bool,
+	features ...miruken.Feature,
+) (miruken.Handler, *flaky, *httptest.Server) {
+	server, _ := miruken.Setup(
+		TestFeature, httpsrv.Feature(), stdjson.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Handler()
+	f   := &flaky{fail: fail, handler: httpsrv.Pipeline(server)}
+	srv := httptest.NewServer(f)
+	suite.T().Cleanup(srv.Close)
+	features = append(features, TestFeature, http.Feature(), stdjson.Feature())
+	client, _ := miruken.Setup(features...).
+		Specs(&api.GoPolymorphism{}).
+		Handler()
+	return client, f, srv
+}
+
+func (suite *OAuth2TestSuite) credentials(
+	tokens *tokenServer,
+	secret string,
+) http.Policy {
+	return http.Bearer(&http.ClientCredentials{
+		TokenUrl:     tokens.url,
+		ClientId:     "orders",
+		ClientSecret: secret,
+		Scopes:       []string{"teams:read"},
+	})
+}
+
+func (suite *OAuth2TestSuite) ping(
+	handler miruken.Handler,
+	route   string,
+) (*Pong, error) {
+	_, pp, err := api.Send[*Pong](handler, api.RouteTo(&Ping{2}, route))
+	if err != nil {
+		return nil, err
+	}
+	return pp.Await()
+}
+
+func (suite *OAuth2TestSuite) TestOAuth2() {
+	suite.Run("ClientCredentials", func() {
+		suite.Run("Caches", func() {
+			tokens := suite.issuer(3600)
+			handler, f, srv := suite.Setup(authorized("token-1"))
+			handler = miruken.BuildUp(handler, http.Pipeline(suite.credentials(tokens, "secret")))
+			for i := 0; i < 2; i++ {
+				pong, err := suite.ping(handler, srv.URL)
+				suite.Nil(err)
+				suite.Equal(&Pong{2}, pong)
+			}
+			suite.Equal(int32(1), tokens.issued)
+			suite.Equal(int32(2), f.hits)
+		})
+
+		suite.Run("Expired", func() {
+			tokens := suite.issuer(5)
+			handler, _, srv := suite.Setup(nil)
+			handler = miruken.BuildUp(handler, http.Pipeline(suite.credentials(tokens, "secret")))
+			for i := 0; i < 2; i++ {
+				_, err := suite.ping(handler, srv.URL)
+				suite.Nil(err)
+			}
+			suite.Equal(int32(2), tokens.issued)
+		})
+
+		suite.Run("Refresh", func() {
+			tokens := suite.issuer(3600)
+			handler, f, srv := suite.Setup(authorized("token-2"))
+			handler = miruken.BuildUp(handler, http.Pipeline(suite.credentials(tokens, "secret")))
+			pong, err := suite.ping(handler, srv.URL)
+			suite.Nil(err)
+			suite.Equal(&Pong{2}, pong)
+			suite.Equal(int32(2), tokens.issued)
+			suite.Equal(int32(2), f.hits)
+		})
+
+		suite.Run("Refresh Client", func() {
+			tokens := suite.issuer(3600)
+			handler, f, srv := suite.Setup(authorized("token-2"))
+			counter := &countingTransport{base: http2.DefaultTransport}
+			client  := http.Client(&http2.Client{Transport: counter})
+			handler = miruken.BuildUp(handler, http.Pipeline(suite.credentials(tokens, "secret"), client))
+			pong, err := suite.ping(handler, srv.URL)
+			suite.Nil(err)
+			suite.Equal(&Pong{2}, pong)
+			suite.Equal(int32(2), f.hits)
+			suite.Equal(int32(2), counter.requests.Load())
+		})
+
+		suite.Run("Rejected", func() {
+			tokens := suite.issuer(3600)
+			handler, f, srv := suite.Setup(authorized("token-0"))
+			handler = miruken.BuildUp(handler, http.Pipeline(suite.credentials(tokens, "secret")))
+			_, err := suite.ping(handler, srv.URL)
+			suite.ErrorContains(err, "401")
+			suite.Equal(int32(2), f.hits)
+		})
+
+		suite.Run("InvalidClient", func() {
+			tokens := suite.issuer(3600)
+			handler, f, srv := suite.Setup(nil)
+			handler = miruken.BuildUp(handler, http.Pipeline(suite.credentials(tokens, "wrong")))
+			_, err := suite.ping(handler, srv.URL)
+			var te *http.TokenError
+			suite.ErrorAs(err, &te)
+			suite.Equal(http2.StatusUnauthorized, te.StatusCode)
+			suite.Equal("invalid_client", te.Code)
+			suite.Equal(int32(0), f.hits)
+		})
+	})
+
+	suite.Run("LoginFlow", func() {
+		k := koanf.New(".")
+		err := k.Load(confmap.Provider(map[string]any{
+			"login.service": []any{
+				map[string]any{
+					"module":  "token",
+					"options": map[string]any{"token": "service-token"},
+				},
+			},
+		}, "."), nil)
+		suite.Nil(err)
+		handler, _, srv := suite.Setup(authorized("service-token"), config.Feature(koanfp.P(k)))
+		handler = miruken.BuildUp(handler,
+			http.Pipeline(http.Bearer(&http.LoginFlow{Flow: "login.service"})))
+		pong, err := suite.ping(handler, srv.URL)
+		suite.Nil(err)
+		suite.Equal(&Pong{2}, pong)
+	})
+}
+
+func TestOAuth2TestSuite(t *testing.T) {
+	suite.Run(t, new(OAuth2TestSuite))
+}
@@ -0,0 +1,377 @@
+package test
+
+import (
+	"errors"
+	"github.com/knadh/koanf"
+	"github.com/knadh/koanf/providers/confmap"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/api/http"
+	"github.com/miruken-go/miruken/api/http/httpsrv"
+	"github.com/miruken-go/miruken/api/json/stdjson"
+	"github.com/miruken-go/miruken/config"
+	koanfp "github.com/miruken-go/miruken/config/koanf"
+	"github.com/miruken-go/miruken/creates"
+	"github.com/miruken-go/miruken/handles"
+	"github.com/miruken-go/miruken/provides"
+	"github.com/stretchr/testify/suite"
+	http2 "net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//go:generate $GOPATH/bin/miruken -tests
+
+type (
+	Ping struct {
+		Count int
+	}
+
+	Pong struct {
+		Count int
+	}
+
+	PingHandler struct {}
+
+	// flaky fails requests or delays responses before
+	// forwarding them to the api server.
+	flaky struct {
+		hits    int32
+		fail    func(hit int32, w http2.ResponseWriter, r *http2.Request) bool
+		handler http2.Handler
+	}
+)
+
+func (p *PingHandler) Ping(
+	_ *handles.It, ping *Ping,
+) *Pong {
+	return &Pong{ping.Count}
+}
+
+func (p *PingHandler) New(
+	_*struct{
+		_ creates.It `key:"test.Ping"`
+		_ creates.It `key:"test.Pong"`
+	  }, create *creates.It,
+) any {
+	switch create.Key() {
+	case "test.Ping":
+		return new(Ping)
+	case "test.Pong":
+		return new(Pong)
+	}
+	return nil
+}
+
+func (f *flaky) ServeHTTP(w http2.ResponseWriter, r *http2.Request) {
+	hit := atomic.AddInt32(&f.hits, 1)
+	if f.fail != nil && f.fail(hit, w, r) {
+		return
+	}
+	f.handler.ServeHTTP(w, r)
+}
+
+type ResilienceTestSuite struct {
+	suite.Suite
+}
+
+func (suite *ResilienceTestSuite) Setup(
+	fail func(hit int32, w http2.ResponseWriter, r *http2.Request) bool,
+) (miruken.Handler, *flaky, *httptest.Server) {
+	server, _ := miruken.Setup(
+		TestFeature, httpsrv.Feature(), stdjson.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Handler()
+	f   := &flaky{fail: fail, handler: httpsrv.Pipeline(server)}
+	srv := httptest.NewServer(f)
+	suite.T().Cleanup(srv.Close)
+	client, _ := miruken.Setup(
+		TestFeature, http.Feature(), stdjson.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Handler()
+	return client, f, srv
+}
+
+func (suite *ResilienceTestSuite) ping(
+	handler miruken.Handler,
+	route   string,
+) (*Pong, error) {
+	_, pp, err := api.Send[*Pong](handler, api.RouteTo(&Ping{1}, route))
+	if err != nil {
+		return nil, err
+	}
+	return pp.Await()
+}
+
+func unavailable(times int32, retryAfter string) func(int32, http2.ResponseWriter, *http2.Request) bool {
+	return func(hit int32, w http2.ResponseWriter, _ *http2.Request) bool {
+		if hit <= times {
+			if len(retryAfter) > 0 {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(http2.StatusServiceUnavailable)
+			return true
+		}
+		return false
+	}
+}
+
+// dropped closes the connection of the first requests
+// without a response.
+func dropped(times int32) func(int32, http2.ResponseWriter, *http2.Request) bool {
+	return func(hit int32, w http2.ResponseWriter, _ *http2.Request) bool {
+		if hit <= times {
+			if conn, _, err := w.(http2.Hijacker).Hijack(); err == nil {
+				_ = conn.Close()
+			}
+			return true
+		}
+		return false
+	}
+}
+
+func (suite *ResilienceTestSuite) TestResilience() {
+	suite.Run("Retry", func() {
+		suite.Run("Recovers", func() {
+			handler, f, srv := suite.Setup(unavailable(2, ""))
+			handler = miruken.BuildUp(handler, http.Retry(http.RetryOptions{
+				MaxAttempts: 3,
+				BaseDelay:   time.Millisecond,
+			}))
+			pong, err := suite.ping(handler, srv.URL)
+			suite.Nil(err)
+			suite.Equal(&Pong{1}, pong)
+			suite.Equal(int32(3), f.hits)
+		})
+
+		suite.Run("Exhausted", func() {
+			handler, f, srv := suite.Setup(unavailable(5, ""))
+			handler = miruken.BuildUp(handler, http.Retry(http.RetryOptions{
+				MaxAttempts: 2,
+				BaseDelay:   time.Millisecond,
+			}))
+			_, err := suite.ping(handler, srv.URL)
+			suite.ErrorContains(err, "503")
+			suite.Equal(int32(2), f.hits)
+		})
+
+		suite.Run("RetryAfter", func() {
+			handler, f, srv := suite.Setup(unavailable(1, "1"))
+			handler = miruken.BuildUp(handler, http.Retry(http.RetryOptions{
+				BaseDelay: time.Millisecond,
+			}))
+			start := time.Now()
+			pong, err := suite.ping(handler, srv.URL)
+			suite.Nil(err)
+			suite.Equal(&Pong{1}, pong)
+			suite.Equal(int32(2), f.hits)
+			suite.GreaterOrEqual(time.Since(start), time.Second)
+		})
+
+		suite.Run("Status", func() {
+			handler, f, srv := suite.Setup(func(hit int32, w http2.ResponseWriter, _ *http2.Request) bool {
+				w.WriteHeader(http2.StatusNotImplemented)
+				return true
+			})
+			handler = miruken.BuildUp(handler, http.Retry(http.RetryOptions{
+				BaseDelay: time.Millisecond,
+			}))
+			_, err := suite.ping(handler, srv.URL)
+			suite.ErrorContains(err, "501")
+			suite.Equal(int32(1), f.hits)
+		})
+
+		suite.Run("Transport Error", func() {
+			handler, f, srv := suite.Setup(dropped(1))
+			handler = miruken.BuildUp(handler, http.Retry(http.RetryOptions{
+				BaseDelay: time.Millisecond,
+			}))
+			_, err := suite.ping(handler, srv.URL)
+			suite.NotNil(err)
+			suite.Equal(int32(1), f.hits)
+		})
+
+		suite.Run("Transport Error Opt In", func() {
+			handler, f, srv := suite.Setup(dropped(1))
+			handler = miruken.BuildUp(handler, http.Retry(http.RetryOptions{
+				BaseDelay:       time.Millisecond,
+				TransportErrors: true,
+			}))
+			pong, err := suite.ping(handler, srv.URL)
+			suite.Nil(err)
+			suite.Equal(&Pong{1}, pong)
+			suite.Equal(int32(2), f.hits)
+		})
+	})
+
+	suite.Run("Timeout", func() {
+		slow := func(hit int32, w http2.ResponseWriter, _ *http2.Request) bool {
+			time.Sleep(200 * time.Millisecond)
+			return false
+		}
+
+		suite.Run("Route", func() {
+			handler, _, srv := suite.Setup(slow)
+			handler = miruken.BuildUp(handler, http.Routes(http.RouteOptions{
+				Route:   srv.URL,
+				Timeout: 50 * time.Millisecond,
+			}))
+			_, err := suite.ping(handler, srv.URL)
+			suite.ErrorContains(err, "deadline exceeded")
+		})
+
+		suite.Run("Other Route", func() {
+			handler, _, srv := suite.Setup(slow)
+			handler = miruken.BuildUp(handler, http.Routes(http.RouteOptions{
+				Route:   "http://localhost:1",
+				Timeout: 50 * time.Millisecond,
+			}))
+			pong, err := suite.ping(handler, srv.URL)
+			suite.Nil(err)
+			suite.Equal(&Pong{1}, pong)
+		})
+	})
+
+	suite.Run("Hedge", func() {
+		handler, f, srv := suite.Setup(func(hit int32, w http2.ResponseWriter, _ *http2.Request) bool {
+			if hit == 1 {
+				time.Sleep(time.Second)
+			}
+			return false
+		})
+		handler = miruken.BuildUp(handler,
+			http.Hedge(http.HedgeOptions{Delay: 20 * time.Millisecond}),
+			http.Routes(http.RouteOptions{Route: srv.URL, Idempotent: true}))
+		start := time.Now()
+		pong, err := suite.ping(handler, srv.URL)
+		suite.Nil(err)
+		suite.Equal(&Pong{1}, pong)
+		suite.Less(time.Since(start), 500*time.Millisecond)
+		suite.Equal(int32(2), atomic.LoadInt32(&f.hits))
+	})
+
+	suite.Run("Hedge Not Idempotent", func() {
+		handler, f, srv := suite.Setup(func(hit int32, w http2.ResponseWriter, _ *http2.Request) bool {
+			time.Sleep(100 * time.Millisecond)
+			return false
+		})
+		handler = miruken.BuildUp(handler, http.Hedge(http.HedgeOptions{
+			Delay: 20 * time.Millisecond,
+		}))
+		pong, err := suite.ping(handler, srv.URL)
+		suite.Nil(err)
+		suite.Equal(&Pong{1}, pong)
+		suite.Equal(int32(1), atomic.LoadInt32(&f.hits))
+	})
+
+	suite.Run("Breaker", func() {
+		suite.Run("Opens", func() {
+			handler, f, srv := suite.Setup(unavailable(100, ""))
+			handler = miruken.BuildUp(handler, http.Breaker(http.BreakerOptions{
+				FailureThreshold: 2,
+				OpenTimeout:      time.Minute,
+			}))
+			for i := 0; i < 2; i++ {
+				_, err := suite.ping(handler, srv.URL)
+				suite.ErrorContains(err, "503")
+			}
+			_, err := suite.ping(handler, srv.URL)
+			var open *http.CircuitOpenError
+			suite.True(errors.As(err, &open))
+			suite.Equal(srv.URL, open.Route)
+			suite.Equal(int32(2), f.hits)
+		})
+
+		suite.Run("Closes", func() {
+			handler, f, srv := suite.Setup(unavailable(1, ""))
+			handler = miruken.BuildUp(handler, http.Breaker(http.BreakerOptions{
+				FailureThreshold: 1,
+				OpenTimeout:      50 * time.Millisecond,
+			}))
+			_, err := suite.ping(handler, srv.URL)
+			suite.ErrorContains(err, "503")
+			_, err = suite.ping(handler, srv.URL)
+			var open *http.CircuitOpenError
+			suite.ErrorAs(err, &open)
+			time.Sleep(60 * time.Millisecond)
+			pong, err := suite.ping(handler, srv.URL)
+			suite.Nil(err)
+			suite.Equal(&Pong{1}, pong)
+			suite.Equal(int32(2), f.hits)
+		})
+
+		suite.Run("Application Error", func() {
+			handler, f, srv := suite.Setup(func(_ int32, w http2.ResponseWriter, _ *http2.Request) bool {
+				w.WriteHeader(http2.StatusInternalServerError)
+				return true
+			})
+			handler = miruken.BuildUp(handler, http.Breaker(http.BreakerOptions{
+				FailureThreshold: 1,
+				OpenTimeout:      time.Minute,
+			}))
+			for i := 0; i < 2; i++ {
+				_, err := suite.ping(handler, srv.URL)
+				var open *http.CircuitOpenError
+				suite.NotNil(err)
+				suite.False(errors.As(err, &open))
+			}
+			suite.Equal(int32(2), f.hits)
+		})
+
+		suite.Run("Router", func() {
+			breaker := http.Breaker(http.BreakerOptions{
+				FailureThreshold: 1,
+				OpenTimeout:      time.Minute,
+			})
+			handler, _, srv := suite.Setup(unavailable(1, ""))
+			_, err := suite.ping(miruken.BuildUp(handler, breaker), srv.URL)
+			suite.ErrorContains(err, "503")
+			_, err = suite.ping(miruken.BuildUp(handler, breaker), srv.URL)
+			var open *http.CircuitOpenError
+			suite.ErrorAs(err, &open)
+
+			// circuits are not shared by other routers
+			other, _ := miruken.Setup(
+				TestFeature, http.Feature(), stdjson.Feature()).
+				Specs(&api.GoPolymorphism{}).
+				Handler()
+			pong, err := suite.ping(miruken.BuildUp(other, breaker), srv.URL)
+			suite.Nil(err)
+			suite.Equal(&Pong{1}, pong)
+		})
+	})
+
+	suite.Run("Config", func() {
+		k := koanf.New(".")
+		err := k.Load(confmap.Provider(map[string]any{
+			"http.timeout":           "5s",
+			"http.retry.maxAttempts": 4,
+			"http.retry.baseDelay":   "50ms",
+			"http.retry.statusCodes": []int{503},
+			"http.hedge.delay":       "200ms",
+			"http.breaker.failureThreshold": 3,
+			"http.routes": []any{
+				map[string]any{"route": "http://orders", "timeout": "1s"},
+			},
+		}, "."), nil)
+		suite.Nil(err)
+		handler, _ := miruken.Setup(config.Feature(koanfp.P(k))).Handler()
+		options, _, err := provides.Type[http.Options](handler, &config.Load{Path: "http"})
+		suite.Nil(err)
+		suite.Equal(5*time.Second, options.Timeout)
+		suite.Equal(&http.RetryOptions{
+			MaxAttempts: 4,
+			BaseDelay:   50 * time.Millisecond,
+			StatusCodes: []int{503},
+		}, options.Retry)
+		suite.Equal(&http.HedgeOptions{Delay: 200 * time.Millisecond}, options.Hedge)
+		suite.Equal(&http.BreakerOptions{FailureThreshold: 3}, options.Breaker)
+		suite.Equal([]http.RouteOptions{{Route: "http://orders", Timeout: time.Second}}, options.Routes)
+	})
+}
+
+func TestResilienceTestSuite(t *testing.T) {
+	suite.Run(t, new(ResilienceTestSuite))
+}
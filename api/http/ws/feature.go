@@ -0,0 +1,33 @@
+package ws
+
+import (
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+)
+
+// Installer configures websocket client support.
+type Installer struct {}
+
+func (i *Installer) DependsOn() []miruken.Feature {
+	return []miruken.Feature{api.Feature()}
+}
+
+func (i *Installer) Install(setup *miruken.SetupBuilder) error {
+	if setup.Tag(&featureTag) {
+		setup.Specs(&Router{})
+	}
+	return nil
+}
+
+// Feature configures websocket client support
+func Feature(config ...func(*Installer)) miruken.Feature {
+	installer := &Installer{}
+	for _, configure := range config {
+		if configure != nil {
+			configure(installer)
+		}
+	}
+	return installer
+}
+
+var featureTag byte
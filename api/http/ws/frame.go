@@ -0,0 +1,46 @@
+package ws
+
+import (
+	"encoding/json"
+)
+
+type (
+	// Frame is the unit of exchange over a websocket connection.
+	// Frames are correlated using the Id assigned by the sender
+	// and carry an api.Message encoded as json.
+	Frame struct {
+		Id      string          `json:"id,omitempty"`
+		Kind    string          `json:"kind"`
+		Status  int             `json:"status,omitempty"`
+		Topics  []string        `json:"topics,omitempty"`
+		Message json.RawMessage `json:"message,omitempty"`
+	}
+
+	// Subscribe requests Published messages matching the
+	// topics (type ids) be pushed to the client.
+	// A topic of "*" matches all messages.
+	Subscribe struct {
+		Topics []string
+	}
+
+	// Unsubscribe cancels a previous Subscribe.
+	Unsubscribe struct {
+		Topics []string
+	}
+)
+
+
+const (
+	KindProcess     = "process"
+	KindPublish     = "publish"
+	KindSubscribe   = "subscribe"
+	KindUnsubscribe = "unsubscribe"
+	KindResponse    = "response"
+	KindError       = "error"
+	KindPush        = "push"
+
+	// AllTopics subscribes to every published message.
+	AllTopics = "*"
+)
+
+
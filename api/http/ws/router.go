@@ -0,0 +1,472 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/args"
+	"github.com/miruken-go/miruken/handles"
+	"github.com/miruken-go/miruken/promise"
+	"github.com/miruken-go/miruken/provides"
+	"golang.org/x/net/websocket"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Options customize websocket operations.
+	Options struct {
+		Path    string
+		Origin  string
+		Timeout time.Duration
+	}
+
+	// Router routes messages over a websocket transport.
+	// A single connection is shared by all messages sent to
+	// the same route and responses are correlated by id.
+	Router struct {
+		lock  sync.Mutex
+		conns map[string]*conn
+	}
+
+	// conn multiplexes requests over a websocket connection.
+	conn struct {
+		ws         *websocket.Conn
+		uri        string
+		router     *Router
+		nextId     atomic.Uint64
+		writeLock  sync.Mutex
+		lock       sync.Mutex
+		pending     map[string]*pending
+		subscribers []*subscriber
+		closed      bool
+	}
+
+	// subscriber receives the messages pushed for its topics.
+	// Pushes are queued and published in the order received.
+	subscriber struct {
+		composer miruken.Handler
+		topics   map[string]struct{}
+		pushes   chan json.RawMessage
+		done     chan struct{}
+	}
+
+	pending struct {
+		deferred promise.Deferred[any]
+		composer miruken.Handler
+		timer    *time.Timer
+		accepted func()
+	}
+)
+
+
+const (
+	defaultPath    = "ws"
+	defaultTimeout = 30 * time.Second
+	pushBuffer     = 64
+)
+
+
+var ErrConnectionClosed = errors.New("websocket connection closed")
+
+
+func (r *Router) Constructor(
+	_*struct{
+		provides.It
+		provides.Single
+	  },
+) {
+	r.conns = make(map[string]*conn)
+}
+
+func (r *Router) Route(
+	_*struct{
+		handles.It
+		api.Routes `scheme:"ws,wss"`
+	  }, routed api.Routed,
+	_*struct{
+		args.Optional
+		args.FromOptions
+	  }, options Options,
+	ctx miruken.HandleContext,
+) *promise.Promise[any] {
+	composer := miruken.BuildUp(ctx.Composer, api.Polymorphic)
+
+	c, err := r.connect(routed.Route, &options)
+	if err != nil {
+		return promise.Reject[any](fmt.Errorf("ws router: %w", err))
+	}
+
+	frame := Frame{}
+	var accepted func()
+	switch msg := routed.Message.(type) {
+	case Subscribe:
+		frame.Kind   = KindSubscribe
+		frame.Topics = msg.Topics
+		accepted     = func() { c.subscribe(composer, msg.Topics) }
+	case *Subscribe:
+		frame.Kind   = KindSubscribe
+		frame.Topics = msg.Topics
+		accepted     = func() { c.subscribe(composer, msg.Topics) }
+	case Unsubscribe:
+		frame.Kind   = KindUnsubscribe
+		frame.Topics = msg.Topics
+		c.unsubscribe(msg.Topics)
+	case *Unsubscribe:
+		frame.Kind   = KindUnsubscribe
+		frame.Topics = msg.Topics
+		c.unsubscribe(msg.Topics)
+	default:
+		if ctx.Greedy {
+			frame.Kind = KindPublish
+		} else {
+			frame.Kind = KindProcess
+		}
+		if frame.Message, err = api.EncodeMessage(composer, routed.Message); err != nil {
+			return promise.Reject[any](fmt.Errorf("ws router: %w", err))
+		}
+	}
+
+	timeout := options.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return c.send(frame, composer, timeout, accepted)
+}
+
+// Close closes all open websocket connections.
+func (r *Router) Close() {
+	r.lock.Lock()
+	conns := r.conns
+	r.conns = make(map[string]*conn)
+	r.lock.Unlock()
+	for _, c := range conns {
+		_ = c.ws.Close()
+	}
+}
+
+func (r *Router) connect(
+	route   string,
+	options *Options,
+) (*conn, error) {
+	r.lock.Lock()
+	c, ok := r.conns[route]
+	r.lock.Unlock()
+	if ok {
+		return c, nil
+	}
+
+	path := options.Path
+	if len(path) == 0 {
+		path = defaultPath
+	}
+	uri, err := url.JoinPath(route, path)
+	if err != nil {
+		return nil, err
+	}
+	origin := options.Origin
+	if len(origin) == 0 {
+		if origin, err = originOf(route); err != nil {
+			return nil, err
+		}
+	}
+	// dial without blocking the other routes
+	ws, err := websocket.Dial(uri, "", origin)
+	if err != nil {
+		return nil, err
+	}
+
+	r.lock.Lock()
+	if existing, ok := r.conns[route]; ok {
+		r.lock.Unlock()
+		_ = ws.Close()
+		return existing, nil
+	}
+	if r.conns == nil {
+		r.conns = make(map[string]*conn)
+	}
+	c = &conn{
+		ws:      ws,
+		uri:     route,
+		router:  r,
+		pending: make(map[string]*pending),
+	}
+	r.conns[route] = c
+	r.lock.Unlock()
+	go c.receive()
+	return c, nil
+}
+
+func (r *Router) remove(c *conn) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.conns[c.uri] == c {
+		delete(r.conns, c.uri)
+	}
+}
+
+
+// conn
+
+// send writes the frame and returns a promise for the response.
+// If provided, accepted is called before any later frame is
+// received once the frame is successfully acknowledged.
+func (c *conn) send(
+	frame    Frame,
+	composer miruken.Handler,
+	timeout  time.Duration,
+	accepted func(),
+) *promise.Promise[any] {
+	id := strconv.FormatUint(c.nextId.Add(1), 10)
+	frame.Id = id
+
+	p := &pending{
+		deferred: promise.Defer[any](),
+		composer: composer,
+		accepted: accepted,
+	}
+
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return promise.Reject[any](fmt.Errorf("ws router: %w", ErrConnectionClosed))
+	}
+	c.pending[id] = p
+	c.lock.Unlock()
+
+	p.timer = time.AfterFunc(timeout, func() {
+		if p := c.take(id); p != nil {
+			p.deferred.Reject(fmt.Errorf("ws router: request %s timed out after %v", id, timeout))
+		}
+	})
+
+	if err := c.write(frame); err != nil {
+		if p := c.take(id); p != nil {
+			p.timer.Stop()
+			p.deferred.Reject(fmt.Errorf("ws router: %w", err))
+		}
+	}
+	return p.deferred.Promise()
+}
+
+func (c *conn) write(frame Frame) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	return websocket.JSON.Send(c.ws, frame)
+}
+
+func (c *conn) take(id string) *pending {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if p, ok := c.pending[id]; ok {
+		delete(c.pending, id)
+		return p
+	}
+	return nil
+}
+
+func (c *conn) receive() {
+	defer c.close()
+	for {
+		var frame Frame
+		if err := websocket.JSON.Receive(c.ws, &frame); err != nil {
+			return
+		}
+		switch frame.Kind {
+		case KindResponse:
+			if p := c.take(frame.Id); p != nil {
+				p.timer.Stop()
+				if payload, err := api.DecodeMessage(p.composer, frame.Message); err != nil {
+					p.deferred.Reject(fmt.Errorf("ws router: %w", err))
+				} else {
+					if p.accepted != nil {
+						p.accepted()
+					}
+					p.deferred.Resolve(payload)
+				}
+			}
+		case KindError:
+			if p := c.take(frame.Id); p != nil {
+				p.timer.Stop()
+				p.deferred.Reject(decodeError(p.composer, frame))
+			}
+		case KindPush:
+			for _, subscriber := range c.subscribed(frame.Topics) {
+				subscriber.enqueue(frame.Message)
+			}
+		}
+	}
+}
+
+func (c *conn) subscribe(
+	composer miruken.Handler,
+	topics   []string,
+) {
+	s := &subscriber{
+		composer: composer,
+		topics:   make(map[string]struct{}),
+		pushes:   make(chan json.RawMessage, pushBuffer),
+		done:     make(chan struct{}),
+	}
+	for _, topic := range topics {
+		s.topics[topic] = struct{}{}
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return
+	}
+	c.subscribers = append(c.subscribers, s)
+	go s.run()
+}
+
+// unsubscribe removes the topics from all subscribers
+// or all subscribers if no topics.
+func (c *conn) unsubscribe(topics []string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if len(topics) == 0 {
+		for _, s := range c.subscribers {
+			s.stop()
+		}
+		c.subscribers = nil
+		return
+	}
+	subscribers := c.subscribers[:0]
+	for _, s := range c.subscribers {
+		for _, topic := range topics {
+			delete(s.topics, topic)
+		}
+		if len(s.topics) > 0 {
+			subscribers = append(subscribers, s)
+		} else {
+			s.stop()
+		}
+	}
+	c.subscribers = subscribers
+}
+
+// subscribed returns the subscribers to the topics.
+func (c *conn) subscribed(topics []string) []*subscriber {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var subscribers []*subscriber
+	for _, s := range c.subscribers {
+		if _, ok := s.topics[AllTopics]; ok {
+			subscribers = append(subscribers, s)
+			continue
+		}
+		for _, topic := range topics {
+			if _, ok := s.topics[topic]; ok {
+				subscribers = append(subscribers, s)
+				break
+			}
+		}
+	}
+	return subscribers
+}
+
+func (c *conn) close() {
+	c.router.remove(c)
+	c.lock.Lock()
+	c.closed = true
+	requests := c.pending
+	c.pending = make(map[string]*pending)
+	for _, s := range c.subscribers {
+		s.stop()
+	}
+	c.subscribers = nil
+	c.lock.Unlock()
+	for _, p := range requests {
+		p.timer.Stop()
+		p.deferred.Reject(fmt.Errorf("ws router: %w", ErrConnectionClosed))
+	}
+	_ = c.ws.Close()
+}
+
+
+// subscriber
+
+// enqueue queues the message for publishing.  The connection
+// waits while the queue is full to preserve the push order.
+func (s *subscriber) enqueue(message json.RawMessage) {
+	select {
+	case s.pushes <- message:
+	case <-s.done:
+	}
+}
+
+// run publishes the queued messages until stopped.
+func (s *subscriber) run() {
+	for {
+		select {
+		case message := <-s.pushes:
+			s.publish(message)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *subscriber) publish(message json.RawMessage) {
+	if payload, err := api.DecodeMessage(s.composer, message); err == nil && payload != nil {
+		if pv, err := api.Publish(s.composer, payload); err == nil && pv != nil {
+			_, _ = pv.Await()
+		}
+	}
+}
+
+// stop ends the delivery of pushes.
+// The connection lock must be held.
+func (s *subscriber) stop() {
+	close(s.done)
+}
+
+
+func decodeError(
+	composer miruken.Handler,
+	frame    Frame,
+) error {
+	payload, err := api.DecodeMessage(composer, frame.Message)
+	if err != nil {
+		return fmt.Errorf("ws router: %w", err)
+	}
+	if payload == nil {
+		return fmt.Errorf("ws router: request %s failed (%d)", frame.Id, frame.Status)
+	}
+	if err, ok := payload.(error); ok {
+		return fmt.Errorf("ws router: (%d) %w", frame.Status, err)
+	}
+	return fmt.Errorf("ws router: %w", &api.MalformedErrorError{Culprit: payload})
+}
+
+func originOf(route string) (string, error) {
+	u, err := url.Parse(route)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "wss":
+		u.Scheme = "https"
+	default:
+		u.Scheme = "http"
+	}
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host}).String(), nil
+}
+
+
+// Path returns a miruken.Builder requesting a specific socket path.
+func Path(path string) miruken.Builder {
+	return miruken.Options(Options{Path: path})
+}
+
+// Timeout returns a miruken.Builder that limits how long to
+// wait for a response.
+func Timeout(timeout time.Duration) miruken.Builder {
+	return miruken.Options(Options{Timeout: timeout})
+}
@@ -37,13 +37,20 @@ func (m *SurrogateMapper) ReplaceConcurrent(
 		maps.Format `to:"application/json"`
 	  }, batch api.ConcurrentBatch,
 	ctx miruken.HandleContext,
-) (byt []byte, err error) {
+) (byt []byte, hr miruken.HandleResult) {
+	// batches with scheduling options need a richer surrogate
+	if batch.MaxParallel > 0 || batch.FailFast || batch.Timeout > 0 {
+		return nil, miruken.NotHandled
+	}
 	sur := Concurrent(batch.Requests)
 	if sur == nil {
 		sur = make(Concurrent, 0)
 	}
-	byt, _, _, err = maps.Out[[]byte](ctx, sur, api.ToJson)
-	return
+	byt, _, _, err := maps.Out[[]byte](ctx, sur, api.ToJson)
+	if err != nil {
+		return nil, miruken.NotHandled.WithError(err)
+	}
+	return byt, miruken.Handled
 }
 
 func (m *SurrogateMapper) ReplaceSequential(
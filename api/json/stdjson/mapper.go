@@ -112,13 +112,8 @@ func marshal(
 ) ([]byte, error) {
 	src := it.Source()
 	it.TargetForWrite()
-	if apiOptions.Polymorphism == miruken.Set(api.PolymorphismRoot) {
-		src = &typeContainer{
-			v:        src,
-			typInfo:  apiOptions.TypeInfoFormat,
-			trans:    options.Transformers,
-			composer: composer,
-		}
+	if tc := polymorphic(src, options, apiOptions, composer); tc != nil {
+		src = tc
 	} else if trans := options.Transformers; len(trans) > 0 {
 		src = &transformer{src, trans}
 	}
@@ -139,13 +134,8 @@ func unmarshal(
 	composer   miruken.Handler,
 ) (target any, err error) {
 	target = maps.TargetForWrite()
-	if apiOptions.Polymorphism == miruken.Set(api.PolymorphismRoot) {
-		tc := typeContainer{
-			v:        target,
-			trans:    options.Transformers,
-			composer: composer,
-		}
-		err = json.Unmarshal(byt, &tc)
+	if tc := polymorphic(target, options, apiOptions, composer); tc != nil {
+		err = json.Unmarshal(byt, tc)
 	} else {
 		if trans := options.Transformers; len(trans) > 0 {
 			t := transformer{target, trans}
@@ -172,13 +162,8 @@ func encode(
 		enc.SetEscapeHTML(escapeHTML.Value())
 	}
 	src := it.Source()
-	if apiOptions.Polymorphism == miruken.Set(api.PolymorphismRoot) {
-		src = &typeContainer{
-			v:        src,
-			typInfo:  apiOptions.TypeInfoFormat,
-			trans:    options.Transformers,
-			composer: composer,
-		}
+	if tc := polymorphic(src, options, apiOptions, composer); tc != nil {
+		src = tc
 	} else if trans := options.Transformers; len(trans) > 0 {
 		src = &transformer{src, trans}
 	}
@@ -194,13 +179,8 @@ func decode(
 ) (target any, err error) {
 	target = it.TargetForWrite()
 	dec := json.NewDecoder(reader)
-	if apiOptions.Polymorphism == miruken.Set(api.PolymorphismRoot) {
-		tc := typeContainer{
-			v:        target,
-			trans:    options.Transformers,
-			composer: composer,
-		}
-		err = dec.Decode(&tc)
+	if tc := polymorphic(target, options, apiOptions, composer); tc != nil {
+		err = dec.Decode(tc)
 	} else {
 		if trans := options.Transformers; len(trans) > 0 {
 			t := transformer{target, trans}
@@ -211,6 +191,31 @@ func decode(
 	return
 }
 
+// polymorphic returns a typeContainer for the value if the
+// api options request type information, otherwise nil.
+func polymorphic(
+	v          any,
+	options    *Options,
+	apiOptions *api.Options,
+	composer   miruken.Handler,
+) *typeContainer {
+	var all bool
+	switch apiOptions.Polymorphism {
+	case miruken.Set(api.PolymorphismRoot):
+	case miruken.Set(api.PolymorphismAll):
+		all = true
+	default:
+		return nil
+	}
+	return &typeContainer{
+		v:        v,
+		typInfo:  apiOptions.TypeInfoFormat,
+		trans:    options.Transformers,
+		composer: composer,
+		all:      all,
+	}
+}
+
 
 // transformer applies transformations to json serialization.
 type transformer struct {
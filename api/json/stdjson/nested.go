@@ -0,0 +1,642 @@
+package stdjson
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"github.com/miruken-go/miruken/internal"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type (
+	// visit records a reference on the current marshal path
+	// to detect cyclic values.
+	visit struct {
+		ptr  uintptr
+		typ  reflect.Type
+		next *visit
+	}
+
+	// object is an ordered json object used to emit type
+	// discriminators for nested interface values.
+	object []member
+
+	// member is a single property of an object.
+	member struct {
+		name  string
+		value any
+	}
+
+	// field describes a json encoded struct field.
+	// Quoted fields are encoded inside a json string.
+	field struct {
+		name      string
+		index     []int
+		omitEmpty bool
+		quoted    bool
+	}
+)
+
+
+// push returns a new path including the reference.
+func (v *visit) push(ptr uintptr, typ reflect.Type) *visit {
+	return &visit{ptr, typ, v}
+}
+
+// contains reports if the reference is already on the path.
+func (v *visit) contains(ptr uintptr, typ reflect.Type) bool {
+	for ; v != nil; v = v.next {
+		if v.ptr == ptr && v.typ == typ {
+			return true
+		}
+	}
+	return false
+}
+
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, err := json.Marshal(m.name)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(name)
+		b.WriteByte(':')
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+
+// view returns a representation of the value that includes type
+// discriminators for all nested interface values.
+// Values without nested interfaces are returned unchanged.
+func (c *typeContainer) view(
+	v      reflect.Value,
+	visits *visit,
+) (any, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	typ := v.Type()
+	if typ.Kind() != reflect.Interface && !polymorphicType(typ) {
+		return v.Interface(), nil
+	}
+	switch typ.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return c.nest(v.Interface(), visits), nil
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if visits.contains(v.Pointer(), typ) {
+			return nil, cycleError(v)
+		}
+		return c.view(v.Elem(), visits.push(v.Pointer(), typ))
+	case reflect.Struct:
+		fields := jsonFields(typ)
+		obj    := make(object, 0, len(fields))
+		for _, f := range fields {
+			fv, ok := fieldByIndex(v, f.index, false)
+			if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+				continue
+			}
+			value, err := c.view(fv, visits)
+			if err != nil {
+				return nil, err
+			}
+			if f.quoted {
+				if value, err = quote(value); err != nil {
+					return nil, err
+				}
+			}
+			obj = append(obj, member{f.name, value})
+		}
+		return obj, nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if visits.contains(v.Pointer(), typ) {
+			return nil, cycleError(v)
+		}
+		visits = visits.push(v.Pointer(), typ)
+		fallthrough
+	case reflect.Array:
+		arr := make([]any, v.Len())
+		for i := range arr {
+			elem, err := c.view(v.Index(i), visits)
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = elem
+		}
+		return arr, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if visits.contains(v.Pointer(), typ) {
+			return nil, cycleError(v)
+		}
+		visits = visits.push(v.Pointer(), typ)
+		m := reflect.MakeMapWithSize(reflect.MapOf(typ.Key(), anyType), v.Len())
+		for it := v.MapRange(); it.Next(); {
+			value, err := c.view(it.Value(), visits)
+			if err != nil {
+				return nil, err
+			}
+			if value == nil {
+				m.SetMapIndex(it.Key(), reflect.Zero(anyType))
+			} else {
+				m.SetMapIndex(it.Key(), reflect.ValueOf(value))
+			}
+		}
+		return m.Interface(), nil
+	}
+	return v.Interface(), nil
+}
+
+// decode unmarshals the data into the value honoring type
+// discriminators for all nested interface values.
+func (c *typeContainer) decode(
+	data []byte,
+	v    reflect.Value,
+) error {
+	data = bytes.TrimSpace(data)
+	typ := v.Type()
+	if bytes.Equal(data, null) {
+		switch typ.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice:
+			v.Set(reflect.Zero(typ))
+		}
+		return nil
+	}
+	if typ.Kind() != reflect.Interface && !polymorphicType(typ) {
+		return c.unmarshal(data, v.Addr().Interface())
+	}
+	switch typ.Kind() {
+	case reflect.Interface:
+		if len(data) > 0 && data[0] == '{' {
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(data, &fields); err != nil {
+				return err
+			}
+			for _, tf := range KnownTypeFields {
+				if _, ok := fields[tf]; ok {
+					return json.Unmarshal(data, c.nest(v.Addr().Interface(), nil))
+				}
+			}
+			if typ.NumMethod() == 0 {
+				m := make(map[string]any, len(fields))
+				for name, raw := range fields {
+					var value any
+					if err := c.decode(raw, reflect.ValueOf(&value).Elem()); err != nil {
+						return err
+					}
+					m[name] = value
+				}
+				v.Set(reflect.ValueOf(m))
+				return nil
+			}
+		} else if len(data) > 0 && data[0] == '[' && typ.NumMethod() == 0 {
+			var arr []any
+			if err := c.decode(data, reflect.ValueOf(&arr).Elem()); err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(arr))
+			return nil
+		}
+		return json.Unmarshal(data, v.Addr().Interface())
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(typ.Elem()))
+		}
+		return c.decode(data, v.Elem())
+	case reflect.Struct:
+		members, err := objectMembers(data)
+		if err != nil {
+			return err
+		}
+		fields := jsonFields(typ)
+		for _, m := range members {
+			f, ok := lookupField(fields, m.name)
+			if !ok {
+				continue
+			}
+			value := m.value.(json.RawMessage)
+			if f.quoted {
+				if value, err = unquote(value); err != nil {
+					return fmt.Errorf("can't unmarshal field %q: %w", f.name, err)
+				}
+			}
+			if fv, ok := fieldByIndex(v, f.index, true); ok {
+				if err := c.decode(value, fv); err != nil {
+					return fmt.Errorf("can't unmarshal field %q: %w", f.name, err)
+				}
+			}
+		}
+		return nil
+	case reflect.Slice, reflect.Array:
+		var raw []json.RawMessage
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+		arr := v
+		if typ.Kind() == reflect.Slice {
+			arr = reflect.MakeSlice(typ, len(raw), len(raw))
+		}
+		for i, elem := range raw {
+			if i >= arr.Len() {
+				break
+			}
+			if err := c.decode(elem, arr.Index(i)); err != nil {
+				return fmt.Errorf("can't unmarshal array index %d: %w", i, err)
+			}
+		}
+		if typ.Kind() == reflect.Slice {
+			v.Set(arr)
+		}
+		return nil
+	case reflect.Map:
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(typ, len(raw)))
+		}
+		for name, elem := range raw {
+			key, err := mapKey(name, typ.Key())
+			if err != nil {
+				return err
+			}
+			value := reflect.New(typ.Elem()).Elem()
+			if err := c.decode(elem, value); err != nil {
+				return fmt.Errorf("can't unmarshal map key %q: %w", name, err)
+			}
+			v.SetMapIndex(key, value)
+		}
+		return nil
+	}
+	return c.unmarshal(data, v.Addr().Interface())
+}
+
+// unmarshal decodes values without nested interfaces.
+func (c *typeContainer) unmarshal(data []byte, v any) error {
+	if trans := c.trans; len(trans) > 0 {
+		v = &transformer{v, trans}
+	}
+	return json.Unmarshal(data, v)
+}
+
+
+// polymorphicType reports if values of the type can contain
+// nested interface values needing type discriminators.
+func polymorphicType(typ reflect.Type) bool {
+	if poly, ok := polyTypes.Load(typ); ok {
+		return poly.(bool)
+	}
+	poly := containsInterface(typ, make(map[reflect.Type]struct{}))
+	polyTypes.Store(typ, poly)
+	return poly
+}
+
+func containsInterface(
+	typ     reflect.Type,
+	visited map[reflect.Type]struct{},
+) bool {
+	if poly, ok := polyTypes.Load(typ); ok {
+		return poly.(bool)
+	}
+	if _, ok := visited[typ]; ok {
+		return false
+	}
+	visited[typ] = struct{}{}
+	if typ.Implements(marshalerType) || reflect.PointerTo(typ).Implements(marshalerType) ||
+		typ.Implements(textMarshalerType) || reflect.PointerTo(typ).Implements(textMarshalerType) {
+		return false
+	}
+	var poly bool
+	switch typ.Kind() {
+	case reflect.Interface:
+		poly = true
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		poly = containsInterface(typ.Elem(), visited)
+	case reflect.Map:
+		poly = containsInterface(typ.Elem(), visited)
+	case reflect.Struct:
+		for _, f := range jsonFields(typ) {
+			ft := typ.FieldByIndex(f.index).Type
+			if poly = containsInterface(ft, visited); poly {
+				break
+			}
+		}
+	}
+	if poly {
+		// a type reaching an interface is polymorphic regardless
+		// of the types still being inspected
+		polyTypes.Store(typ, true)
+	}
+	return poly
+}
+
+// jsonFields returns the fields encoded by encoding/json in order.
+// Like encoding/json, embedded structs are visited breadth first,
+// shallower or tagged fields hide the others with the same name
+// and ambiguous fields at the same depth are dropped.
+func jsonFields(typ reflect.Type) []field {
+	if fields, ok := structFields.Load(typ); ok {
+		return fields.([]field)
+	}
+	type (
+		level struct {
+			typ   reflect.Type
+			index []int
+		}
+		candidate struct {
+			field
+			tagged bool
+		}
+	)
+	var candidates []candidate
+	var current []level
+	next    := []level{{typ, nil}}
+	count   := map[reflect.Type]int{}
+	visited := map[reflect.Type]struct{}{}
+	for len(next) > 0 {
+		current, next = next, nil
+		nextCount    := map[reflect.Type]int{}
+		for _, l := range current {
+			if _, ok := visited[l.typ]; ok {
+				continue
+			}
+			visited[l.typ] = struct{}{}
+			for i := 0; i < l.typ.NumField(); i++ {
+				sf := l.typ.Field(i)
+				if sf.Anonymous {
+					t := sf.Type
+					if t.Kind() == reflect.Ptr {
+						t = t.Elem()
+					}
+					if !sf.IsExported() && t.Kind() != reflect.Struct {
+						continue
+					}
+				} else if !sf.IsExported() {
+					continue
+				}
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name, opts, _ := strings.Cut(tag, ",")
+				index := append(append([]int(nil), l.index...), i)
+				ft    := sf.Type
+				if ft.Name() == "" && ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				if len(name) > 0 || !sf.Anonymous || ft.Kind() != reflect.Struct {
+					tagged := len(name) > 0
+					if !tagged {
+						name = sf.Name
+					}
+					c := candidate{field{
+						name:      name,
+						index:     index,
+						omitEmpty: hasOption(opts, "omitempty"),
+						quoted:    hasOption(opts, "string") && quotable(ft),
+					}, tagged}
+					candidates = append(candidates, c)
+					if count[l.typ] > 1 {
+						// a type embedded more than once at the same
+						// depth makes its fields ambiguous
+						candidates = append(candidates, c)
+					}
+					continue
+				}
+				if nextCount[ft]++; nextCount[ft] == 1 {
+					next = append(next, level{ft, index})
+				}
+			}
+		}
+		count = nextCount
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		if len(a.index) != len(b.index) {
+			return len(a.index) < len(b.index)
+		}
+		if a.tagged != b.tagged {
+			return a.tagged
+		}
+		return lessIndex(a.index, b.index)
+	})
+	fields := make([]field, 0, len(candidates))
+	for i := 0; i < len(candidates); {
+		j := i + 1
+		for j < len(candidates) && candidates[j].name == candidates[i].name {
+			j++
+		}
+		// the dominant field is the shallowest and tagged
+		// unless another shares its depth and tagging
+		if first := candidates[i]; j-i == 1 || len(candidates[i+1].index) > len(first.index) ||
+			candidates[i+1].tagged != first.tagged {
+			fields = append(fields, first.field)
+		}
+		i = j
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return lessIndex(fields[i].index, fields[j].index)
+	})
+	structFields.Store(typ, fields)
+	return fields
+}
+
+// lookupField returns the field with the exact name or
+// the first field matching the name without case.
+func lookupField(fields []field, name string) (field, bool) {
+	for _, f := range fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.name, name) {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+func lessIndex(a, b []int) bool {
+	for k := 0; k < len(a) && k < len(b); k++ {
+		if a[k] != b[k] {
+			return a[k] < b[k]
+		}
+	}
+	return len(a) < len(b)
+}
+
+func hasOption(opts, option string) bool {
+	return strings.Contains(","+opts+",", ","+option+",")
+}
+
+// quotable reports if the ",string" option applies to the type.
+func quotable(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// quote encodes the value inside a json string.
+func quote(value any) (json.RawMessage, error) {
+	b, err := json.Marshal(value)
+	if err != nil || bytes.Equal(b, null) {
+		return b, err
+	}
+	return json.Marshal(string(b))
+}
+
+// unquote returns the json inside a json string.
+func unquote(data json.RawMessage) (json.RawMessage, error) {
+	if data = bytes.TrimSpace(data); bytes.Equal(data, null) {
+		return data, nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid use of ,string struct tag, trying to unmarshal %s", data)
+	}
+	return json.RawMessage(s), nil
+}
+
+// objectMembers returns the members of the json object in order.
+func objectMembers(data []byte) (object, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok != json.Delim('{') {
+		return nil, &json.UnmarshalTypeError{Value: "non-object", Type: reflect.TypeOf(object{})}
+	}
+	var members object
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		if err = dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		members = append(members, member{key.(string), value})
+	}
+	if _, err = dec.Token(); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// fieldByIndex returns the nested field, optionally allocating
+// embedded pointers.  It fails if an embedded pointer is nil.
+func fieldByIndex(
+	v        reflect.Value,
+	index    []int,
+	allocate bool,
+) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !allocate || !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return v.IsZero() && v.Kind() != reflect.Struct
+}
+
+func mapKey(name string, typ reflect.Type) (reflect.Value, error) {
+	if reflect.PointerTo(typ).Implements(textUnmarshalerType) {
+		key := reflect.New(typ)
+		err := key.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(name))
+		return key.Elem(), err
+	}
+	key := reflect.New(typ).Elem()
+	switch typ.Kind() {
+	case reflect.String:
+		key.SetString(name)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(name, 10, typ.Bits())
+		if err != nil {
+			return key, fmt.Errorf("invalid map key %q: %w", name, err)
+		}
+		key.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(name, 10, typ.Bits())
+		if err != nil {
+			return key, fmt.Errorf("invalid map key %q: %w", name, err)
+		}
+		key.SetUint(n)
+	default:
+		return key, fmt.Errorf("unsupported map key type %v", typ)
+	}
+	return key, nil
+}
+
+func cycleError(v reflect.Value) error {
+	return &json.UnsupportedValueError{
+		Value: v,
+		Str:   fmt.Sprintf("encountered a cycle via %s", v.Type()),
+	}
+}
+
+
+var (
+	null                = []byte("null")
+	anyType             = internal.TypeOf[any]()
+	marshalerType       = internal.TypeOf[json.Marshaler]()
+	textMarshalerType   = internal.TypeOf[encoding.TextMarshaler]()
+	textUnmarshalerType = internal.TypeOf[encoding.TextUnmarshaler]()
+	polyTypes           sync.Map
+	structFields        sync.Map
+)
@@ -3,6 +3,7 @@ package stdjson
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/Rican7/conjson/transform"
 	"github.com/miruken-go/miruken"
@@ -23,6 +24,8 @@ type (
 		typInfo  string
 		trans    []transform.Transformer
 		composer miruken.Handler
+		all      bool
+		visits   *visit
 	}
 )
 
@@ -37,6 +40,18 @@ var (
 )
 
 
+// nest returns a typeContainer for a value nested in this one.
+func (c *typeContainer) nest(v any, visits *visit) *typeContainer {
+	return &typeContainer{
+		v:        v,
+		typInfo:  c.typInfo,
+		trans:    c.trans,
+		composer: c.composer,
+		all:      c.all,
+		visits:   visits,
+	}
+}
+
 func (c *typeContainer) typeInfo() *maps.Format {
 	if typeInfo := c.typInfo; len(typeInfo) > 0 {
 		return maps.To(typeInfo, nil)
@@ -44,9 +59,29 @@ func (c *typeContainer) typeInfo() *maps.Format {
 	return api.ToTypeInfo
 }
 
+// typeFieldInfo returns the type information of the value.
+// Stable type ids are used if the type information is not mapped.
+func (c *typeContainer) typeFieldInfo(v any) (api.TypeFieldInfo, error) {
+	typeInfo, _, _, err := maps.Out[api.TypeFieldInfo](c.composer, v, c.typeInfo())
+	if err != nil && len(c.typInfo) == 0 {
+		var nh *miruken.NotHandledError
+		if errors.As(err, &nh) {
+			if id, ok := api.TypeIdOf(reflect.TypeOf(v)); ok {
+				return api.TypeFieldInfo{
+					TypeField:   "@type",
+					TypeValue:   id,
+					ValuesField: "@values",
+				}, nil
+			}
+		}
+	}
+	return typeInfo, err
+}
+
 func (c *typeContainer) MarshalJSON() ([]byte, error) {
 	v   := c.v
 	typ := reflect.TypeOf(v)
+	vm  := v
 	if typ != nil && typ.Kind() == reflect.Slice {
 		et  := typ.Elem()
 		s   := reflect.ValueOf(v)
@@ -57,11 +92,11 @@ func (c *typeContainer) MarshalJSON() ([]byte, error) {
 			enc    := json.NewEncoder(writer)
 			elem   := s.Index(i).Interface()
 			if internal.IsAny(et) || reflect.TypeOf(elem) != et {
-				elem = &typeContainer{
-					v:        elem,
-					typInfo:  c.typInfo,
-					trans:    c.trans,
-					composer: c.composer,
+				elem = c.nest(elem, c.visits)
+			} else if c.all {
+				var err error
+				if elem, err = c.view(s.Index(i), c.visits); err != nil {
+					return nil, err
 				}
 			}
 			if err := enc.Encode(elem); err != nil {
@@ -71,18 +106,22 @@ func (c *typeContainer) MarshalJSON() ([]byte, error) {
 				arr = append(arr, &raw)
 			}
 		}
-		v = arr
+		v, vm = arr, arr
+	} else if c.all {
+		var err error
+		if vm, err = c.view(reflect.ValueOf(v), c.visits); err != nil {
+			return nil, err
+		}
 	}
-	vm := v
 	if trans := c.trans; len(trans) > 0 {
-		vm = &transformer{v, trans}
+		vm = &transformer{vm, trans}
 	}
 	byt, err := json.Marshal(vm)
 	if err != nil || len(byt) == 0 {
 		return byt, err
 	}
 	if byt[0] == '{' {
-		typeInfo, _, _, err := maps.Out[api.TypeFieldInfo](c.composer, v, c.typeInfo())
+		typeInfo, err := c.typeFieldInfo(v)
 		if err != nil {
 			return nil, err
 		}
@@ -95,7 +134,7 @@ func (c *typeContainer) MarshalJSON() ([]byte, error) {
 		copy(byt[len(typeProperty)+1:], byt[1:])
 		copy(byt[1:], typeProperty)
 	} else if byt[0] == '[' {
-		typeInfo, _, _, err := maps.Out[api.TypeFieldInfo](c.composer, c.v, c.typeInfo())
+		typeInfo, err := c.typeFieldInfo(c.v)
 		if err != nil {
 			return nil, err
 		}
@@ -131,13 +170,8 @@ func (c *typeContainer) UnmarshalJSON(data []byte) error {
 					for i, elem := range raw {
 						r   := bytes.NewReader(*elem)
 						dec := json.NewDecoder(r)
-						tc  := typeContainer{
-							v:        arr.Index(i).Addr().Interface(),  // &arr[0]
-							typInfo:  c.typInfo,
-							trans:    c.trans,
-							composer: c.composer,
-						}
-						if err := dec.Decode(&tc); err != nil {
+						tc  := c.nest(arr.Index(i).Addr().Interface(), nil)  // &arr[0]
+						if err := dec.Decode(tc); err != nil {
 							return fmt.Errorf("can't unmarshal array index %d: %w", i, err)
 						}
 					}
@@ -160,11 +194,17 @@ func (c *typeContainer) UnmarshalJSON(data []byte) error {
 	}
 	if typeIdRaw == nil {
 		if late, ok := c.v.(*api.Late); ok {
-			if err := json.Unmarshal(data, &late.Value); err != nil {
+			if c.all {
+				return c.decode(data, reflect.ValueOf(&late.Value).Elem())
+			} else if err := json.Unmarshal(data, &late.Value); err != nil {
 				return err
 			} else {
 				return nil
 			}
+		} else if c.all {
+			if target := reflect.ValueOf(c.v); target.Kind() == reflect.Ptr && !target.IsNil() {
+				return c.decode(data, target.Elem())
+			}
 		}
 		return json.Unmarshal(data, c.v)
 	}
@@ -177,22 +217,27 @@ func (c *typeContainer) UnmarshalJSON(data []byte) error {
 		if v, _, err := creates.Key[any](c.composer, typeId); err != nil {
 			return &api.UnknownTypeIdError{TypeId: typeId, Cause: err}
 		} else {
-			vm := v
+			vm, nested := v, false
 			for _, field = range KnownValuesFields {
 				if values := fields[field]; values != nil {
-					data = *values
-					vm   = &typeContainer{
-						v:        v,
-						typInfo:  c.typInfo,
-						trans:    c.trans,
-						composer: c.composer,
-					}
+					data   = *values
+					vm     = c.nest(v, nil)
+					nested = true
 				}
 			}
-			if trans := c.trans; len(trans) > 0 {
-				vm = &transformer{vm, trans}
+			var err error
+			if val := reflect.ValueOf(v); !nested && c.all &&
+				val.Kind() == reflect.Ptr && polymorphicType(val.Type()) {
+				err = c.decode(data, val.Elem())
+			} else {
+				if trans := c.trans; len(trans) > 0 {
+					vm = &transformer{vm, trans}
+				}
+				err = json.Unmarshal(data, vm)
 			}
-			if err := json.Unmarshal(data, vm); err != nil {
+			if err != nil {
+				return err
+			} else if v, err = c.upcast(v); err != nil {
 				return err
 			} else {
 				if late, ok := c.v.(*api.Late); ok {
@@ -205,3 +250,21 @@ func (c *typeContainer) UnmarshalJSON(data []byte) error {
 	}
 	return nil
 }
+
+// upcast applies the registered upcasters to the decoded value
+// unless it already satisfies the expected type.  This allows an
+// older type id to be received in place of the current message.
+func (c *typeContainer) upcast(v any) (any, error) {
+	if _, late := c.v.(*api.Late); !late {
+		if target := reflect.TypeOf(c.v); target != nil && target.Kind() == reflect.Ptr {
+			if expected := target.Elem(); expected.Kind() != reflect.Interface {
+				typ := reflect.TypeOf(v)
+				if typ.AssignableTo(expected) ||
+					(typ.Kind() == reflect.Ptr && typ.Elem().AssignableTo(expected)) {
+					return v, nil
+				}
+			}
+		}
+	}
+	return api.Upcast(c.composer, v)
+}
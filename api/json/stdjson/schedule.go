@@ -1,18 +1,59 @@
 package stdjson
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/miruken-go/miruken"
 	"github.com/miruken-go/miruken/api"
 	"github.com/miruken-go/miruken/either"
 	"github.com/miruken-go/miruken/maps"
+	"time"
 )
 
 type (
+	// ConcurrentBatch is a surrogate for api.ConcurrentBatch with
+	// scheduling options over json.  Timeout is a duration string
+	// such as "500ms" or "2s".
+	ConcurrentBatch struct {
+		Requests    []json.RawMessage `json:"requests"`
+		MaxParallel int               `json:"maxParallel,omitempty"`
+		FailFast    bool              `json:"failFast,omitempty"`
+		Timeout     string            `json:"timeout,omitempty"`
+	}
+
 	// ScheduledResult is a surrogate for api.ScheduledResult over json.
 	ScheduledResult []Either[error, any]
 )
 
 
+func (c ConcurrentBatch) Original(composer miruken.Handler) (any, error) {
+	batch := api.ConcurrentBatch{
+		Requests:    make([]any, len(c.Requests)),
+		MaxParallel: c.MaxParallel,
+		FailFast:    c.FailFast,
+	}
+	if timeout := c.Timeout; len(timeout) > 0 {
+		var err error
+		if batch.Timeout, err = time.ParseDuration(timeout); err != nil {
+			return nil, fmt.Errorf("invalid concurrent batch timeout: %w", err)
+		}
+	}
+	for i, req := range c.Requests {
+		late, _, _, err := maps.Out[api.Late](composer, []byte(req), api.FromJson)
+		if err != nil {
+			return nil, fmt.Errorf("can't unmarshal request index %d: %w", i, err)
+		}
+		if sur, ok := late.Value.(api.Surrogate); ok {
+			if late.Value, err = sur.Original(composer); err != nil {
+				return nil, err
+			}
+		}
+		batch.Requests[i] = late.Value
+	}
+	return &batch, nil
+}
+
+
 func (s ScheduledResult) Original(composer miruken.Handler) (any, error) {
 	responses := make([]either.Monad[error, any], len(s))
 	for i, resp := range s {
@@ -28,6 +69,39 @@ func (s ScheduledResult) Original(composer miruken.Handler) (any, error) {
 
 // SurrogateMapper
 
+func (m *SurrogateMapper) ReplaceConcurrentBatch(
+	_*struct{
+		maps.It
+		maps.Format `to:"application/json"`
+	  }, batch api.ConcurrentBatch,
+	ctx miruken.HandleContext,
+) ([]byte, miruken.HandleResult) {
+	// batches without scheduling options use json.Concurrent
+	if batch.MaxParallel <= 0 && !batch.FailFast && batch.Timeout <= 0 {
+		return nil, miruken.NotHandled
+	}
+	sur := ConcurrentBatch{
+		Requests:    make([]json.RawMessage, len(batch.Requests)),
+		MaxParallel: batch.MaxParallel,
+		FailFast:    batch.FailFast,
+	}
+	if timeout := batch.Timeout; timeout > 0 {
+		sur.Timeout = timeout.String()
+	}
+	for i, req := range batch.Requests {
+		byt, _, _, err := maps.Out[[]byte](ctx, req, api.ToJson)
+		if err != nil {
+			return nil, miruken.NotHandled.WithError(err)
+		}
+		sur.Requests[i] = byt
+	}
+	byt, _, _, err := maps.Out[[]byte](ctx, sur, api.ToJson)
+	if err != nil {
+		return nil, miruken.NotHandled.WithError(err)
+	}
+	return byt, miruken.Handled
+}
+
 func (m *SurrogateMapper) ReplaceScheduledResult(
 	_*struct{
 		maps.It
@@ -8,10 +8,13 @@ type SurrogateMapper struct {}
 
 func (m *SurrogateMapper) New(
 	_*struct{
-		creates.It `key:"stdjson.ScheduledResult"`
+		_ creates.It `key:"stdjson.ConcurrentBatch"`
+		_ creates.It `key:"stdjson.ScheduledResult"`
 	  }, create *creates.It,
 ) any {
 	switch create.Key() {
+	case "stdjson.ConcurrentBatch":
+		return new(ConcurrentBatch)
 	case "stdjson.ScheduledResult":
 		return new(ScheduledResult)
 	}
@@ -2,17 +2,20 @@ package test
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"github.com/miruken-go/miruken"
 	"github.com/miruken-go/miruken/api"
 	"github.com/miruken-go/miruken/api/json/stdjson"
 	"github.com/miruken-go/miruken/creates"
 	"github.com/miruken-go/miruken/maps"
+	"github.com/miruken-go/miruken/provides"
 	"github.com/stretchr/testify/suite"
 	"io"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 //go:generate $GOPATH/bin/miruken -tests
@@ -32,8 +35,73 @@ type (
 	}
 
 	TypeIdMapper struct {}
+
+	CoachData struct {
+		_    struct{} `typeid:"teams.Coach,legacy.Coach"`
+		Name string
+	}
+
+	RefereeData struct {
+		_    struct{} `typeid:"teams.Referee"`
+		Name string
+	}
+
+	TeamDataV1 struct {
+		Id    int32
+		Title string
+	}
+
+	Shape interface {
+		Area() float64
+	}
+
+	Circle struct {
+		Radius float64
+	}
+
+	Square struct {
+		Side float64
+	}
+
+	Drawing struct {
+		Name   string
+		Main   Shape
+		Shapes []Shape
+		Layers map[string]any
+		Extra  any `json:",omitempty"`
+	}
+
+	Node struct {
+		Name string
+		Next any
+	}
+
+	Label struct {
+		Text  string
+		Color string
+	}
+
+	Caption struct {
+		Text string
+	}
+
+	Sketch struct {
+		Label
+		Caption
+		Main    Shape
+		Count   int      `json:",string"`
+		Scale   *float64 `json:",string"`
+		Title   string
+		Heading string   `json:"title"`
+	}
 )
 
+func (c *Circle) Area() float64 { return 3 * c.Radius * c.Radius }
+func (s *Square) Area() float64 { return s.Side * s.Side }
+
+func (t *TeamDataV1) SchemaVersion() int { return 1 }
+func (t *TeamData) SchemaVersion() int   { return 2 }
+
 // PlayerMapper
 
 func (m *PlayerMapper) ToPlayerJson(
@@ -63,6 +131,15 @@ func (m *TypeIdMapper) TeamDotNet(
 	return api.TypeFieldInfo{TypeField: "$type", TypeValue: "Team,TeamApi"}
 }
 
+func (m *TypeIdMapper) RefereeDotNet(
+	_*struct{
+		maps.It
+		maps.Format `to:"type:info"`
+	  }, _ *RefereeData,
+) api.TypeFieldInfo {
+	return api.TypeFieldInfo{TypeField: "$type", TypeValue: "Referee,TeamApi"}
+}
+
 func (m *TypeIdMapper) CreateTeam(
 	_*struct{
 		creates.It `key:"test.TeamData"`
@@ -71,6 +148,47 @@ func (m *TypeIdMapper) CreateTeam(
 	return new(TeamData)
 }
 
+func (m *TypeIdMapper) CreateTeamV1(
+	_*struct{
+		creates.It `key:"test.TeamDataV1"`
+	  },
+) *TeamDataV1 {
+	return new(TeamDataV1)
+}
+
+func (m *TypeIdMapper) CreateDrawing(
+	_*struct{
+		creates.It `key:"test.Drawing"`
+	  },
+) *Drawing {
+	return new(Drawing)
+}
+
+func (m *TypeIdMapper) CreateCircle(
+	_*struct{
+		creates.It `key:"test.Circle"`
+	  },
+) *Circle {
+	return new(Circle)
+}
+
+func (m *TypeIdMapper) CreateSquare(
+	_*struct{
+		creates.It `key:"test.Square"`
+	  },
+) *Square {
+	return new(Square)
+}
+
+func (m *TypeIdMapper) UpcastTeamV1(
+	_*struct{
+		maps.It
+		maps.Format `to:"api:upcast"`
+	  }, v1 *TeamDataV1,
+) *TeamData {
+	return &TeamData{Id: v1.Id, Name: v1.Title}
+}
+
 type StdJsonTestSuite struct {
 	suite.Suite
 }
@@ -98,6 +216,119 @@ func (suite *StdJsonTestSuite) TestJson() {
 			})
 		})
 
+		suite.Run("PolymorphismAll", func() {
+			drawing := &Drawing{
+				Name:   "Pitch",
+				Main:   &Circle{Radius: 2},
+				Shapes: []Shape{&Square{Side: 3}, &Circle{Radius: 1}},
+				Layers: map[string]any{"box": &Square{Side: 5}},
+			}
+
+			suite.Run("ToJson", func() {
+				byt, _, _, err := maps.Out[[]byte](
+					miruken.BuildUp(handler, api.PolymorphicAll),
+					drawing, api.ToJson)
+				suite.Nil(err)
+				suite.Equal("{\"@type\":\"test.Drawing\",\"Name\":\"Pitch\",\"Main\":{\"@type\":\"test.Circle\",\"Radius\":2},\"Shapes\":[{\"@type\":\"test.Square\",\"Side\":3},{\"@type\":\"test.Circle\",\"Radius\":1}],\"Layers\":{\"box\":{\"@type\":\"test.Square\",\"Side\":5}}}", string(byt))
+			})
+
+			suite.Run("ToJsonRoot", func() {
+				byt, _, _, err := maps.Out[[]byte](
+					miruken.BuildUp(handler, api.Polymorphic),
+					drawing, api.ToJson)
+				suite.Nil(err)
+				suite.Equal("{\"@type\":\"test.Drawing\",\"Name\":\"Pitch\",\"Main\":{\"Radius\":2},\"Shapes\":[{\"Side\":3},{\"Radius\":1}],\"Layers\":{\"box\":{\"Side\":5}}}", string(byt))
+			})
+
+			suite.Run("ToJsonCamelCase", func() {
+				byt, _, _, err := maps.Out[[]byte](
+					miruken.BuildUp(handler, api.PolymorphicAll, stdjson.CamelCase),
+					&Drawing{Name: "Pitch", Main: &Circle{Radius: 2}}, api.ToJson)
+				suite.Nil(err)
+				suite.Equal("{\"@type\":\"test.Drawing\",\"name\":\"Pitch\",\"main\":{\"@type\":\"test.Circle\",\"radius\":2},\"shapes\":null,\"layers\":null}", string(byt))
+			})
+
+			suite.Run("FromJson", func() {
+				byt, _, _, err := maps.Out[[]byte](
+					miruken.BuildUp(handler, api.PolymorphicAll),
+					drawing, api.ToJson)
+				suite.Nil(err)
+				late, _, _, err := maps.Out[api.Late](
+					miruken.BuildUp(handler, api.PolymorphicAll),
+					byt, api.FromJson)
+				suite.Nil(err)
+				suite.Equal(drawing, late.Value)
+			})
+
+			suite.Run("FromJsonTyped", func() {
+				j := "{\"Name\":\"Pitch\",\"Main\":{\"@type\":\"test.Square\",\"Side\":4},\"Extra\":{\"count\":2,\"shape\":{\"@type\":\"test.Circle\",\"Radius\":3}}}"
+				d, _, _, err := maps.Out[*Drawing](
+					miruken.BuildUp(handler, api.PolymorphicAll),
+					[]byte(j), api.FromJson)
+				suite.Nil(err)
+				suite.Equal(&Drawing{
+					Name:  "Pitch",
+					Main:  &Square{Side: 4},
+					Extra: map[string]any{"count": float64(2), "shape": &Circle{Radius: 3}},
+				}, d)
+			})
+
+			suite.Run("Fields", func() {
+				scale  := 1.5
+				sketch := &Sketch{
+					Label:   Label{Text: "label", Color: "red"},
+					Caption: Caption{Text: "caption"},
+					Main:    &Circle{Radius: 2},
+					Count:   3,
+					Scale:   &scale,
+					Title:   "Title",
+					Heading: "heading",
+				}
+				byt, _, _, err := maps.Out[[]byte](
+					miruken.BuildUp(handler, api.Polymorphic),
+					sketch, api.ToJson)
+				suite.Nil(err)
+				expected, err := json.Marshal(sketch)
+				suite.Nil(err)
+				suite.Equal(string(expected), strings.Replace(string(byt), "\"@type\":\"test.Sketch\",", "", 1))
+				suite.NotContains(string(byt), "label")
+
+				suite.Run("FromJson", func() {
+					j := "{\"Text\":\"ignored\",\"Color\":\"blue\",\"Main\":{\"@type\":\"test.Square\",\"Side\":4},\"Count\":\"7\",\"Scale\":\"2.5\",\"title\":\"heading\",\"TITLE\":\"Title\"}"
+					s, _, _, err := maps.Out[*Sketch](
+						miruken.BuildUp(handler, api.PolymorphicAll),
+						[]byte(j), api.FromJson)
+					suite.Nil(err)
+					scale := 2.5
+					suite.Equal(&Sketch{
+						Label:   Label{Color: "blue"},
+						Main:    &Square{Side: 4},
+						Count:   7,
+						Scale:   &scale,
+						Title:   "Title",
+						Heading: "heading",
+					}, s)
+				})
+
+				suite.Run("FromJsonNotQuoted", func() {
+					_, _, _, err := maps.Out[*Sketch](
+						miruken.BuildUp(handler, api.PolymorphicAll),
+						[]byte("{\"Count\":7}"), api.FromJson)
+					suite.ErrorContains(err, "invalid use of ,string struct tag")
+				})
+			})
+
+			suite.Run("Cycle", func() {
+				node := &Node{Name: "loop"}
+				node.Next = node
+				_, _, _, err := maps.Out[[]byte](
+					miruken.BuildUp(handler, api.PolymorphicAll),
+					node, api.ToJson)
+				var unsupported *json.UnsupportedValueError
+				suite.ErrorAs(err, &unsupported)
+			})
+		})
+
 		suite.Run("Json", func() {
 			suite.Run("ToJsonBytesStruct", func() {
 				data := struct{
@@ -604,6 +835,146 @@ func (suite *StdJsonTestSuite) TestJson() {
 				suite.NotNil(err)
 			})
 		})
+
+		suite.Run("TypeId", func() {
+			registry, _, err := provides.Type[*api.TypeRegistry](handler)
+			suite.Nil(err)
+			suite.NotNil(registry)
+			suite.Nil(registry.Register(CoachData{}))
+
+			suite.Run("ToJson", func() {
+				byt, _, _, err := maps.Out[[]byte](
+					miruken.BuildUp(handler, api.Polymorphic),
+					&CoachData{Name: "Ange"}, api.ToJson)
+				suite.Nil(err)
+				suite.Equal("{\"@type\":\"teams.Coach\",\"Name\":\"Ange\"}", string(byt))
+			})
+
+			suite.Run("ToJsonMappedTypeInfo", func() {
+				byt, _, _, err := maps.Out[[]byte](
+					miruken.BuildUp(handler, api.Polymorphic),
+					&RefereeData{Name: "Howard"}, api.ToJson)
+				suite.Nil(err)
+				suite.Equal("{\"$type\":\"Referee,TeamApi\",\"Name\":\"Howard\"}", string(byt))
+			})
+
+			suite.Run("ToJsonArray", func() {
+				byt, _, _, err := maps.Out[[]byte](
+					miruken.BuildUp(handler, api.Polymorphic),
+					[]any{&CoachData{Name: "Pep"}}, api.ToJson)
+				suite.Nil(err)
+				suite.Equal("{\"@type\":\"[]interface {}\",\"@values\":[{\"@type\":\"teams.Coach\",\"Name\":\"Pep\"}]}", string(byt))
+			})
+
+			suite.Run("FromJson", func() {
+				j := "{\"@type\":\"teams.Coach\",\"Name\":\"Mikel\"}"
+				late, _, _, err := maps.Out[api.Late](
+					miruken.BuildUp(handler, api.Polymorphic),
+					[]byte(j), api.FromJson)
+				suite.Nil(err)
+				suite.Equal(&CoachData{Name: "Mikel"}, late.Value)
+			})
+
+			suite.Run("FromJsonAlias", func() {
+				j := "{\"@type\":\"legacy.Coach\",\"Name\":\"Jurgen\"}"
+				late, _, _, err := maps.Out[api.Late](
+					miruken.BuildUp(handler, api.Polymorphic),
+					[]byte(j), api.FromJson)
+				suite.Nil(err)
+				suite.Equal(&CoachData{Name: "Jurgen"}, late.Value)
+			})
+		})
+
+		suite.Run("Upcast", func() {
+			suite.Run("FromJsonLate", func() {
+				j := "{\"@type\":\"test.TeamDataV1\",\"Id\":7,\"Title\":\"Brentford\"}"
+				late, _, _, err := maps.Out[api.Late](
+					miruken.BuildUp(handler, api.Polymorphic),
+					[]byte(j), api.FromJson)
+				suite.Nil(err)
+				suite.Equal(&TeamData{Id: 7, Name: "Brentford"}, late.Value)
+			})
+
+			suite.Run("FromJsonTyped", func() {
+				j := "{\"@type\":\"test.TeamDataV1\",\"Id\":8,\"Title\":\"Burnley\"}"
+				data, _, _, err := maps.Out[*TeamData](
+					miruken.BuildUp(handler, api.Polymorphic),
+					[]byte(j), api.FromJson)
+				suite.Nil(err)
+				suite.Equal(&TeamData{Id: 8, Name: "Burnley"}, data)
+			})
+
+			suite.Run("FromJsonOlderTyped", func() {
+				j := "{\"@type\":\"test.TeamDataV1\",\"Id\":9,\"Title\":\"Luton\"}"
+				data, _, _, err := maps.Out[*TeamDataV1](
+					miruken.BuildUp(handler, api.Polymorphic),
+					[]byte(j), api.FromJson)
+				suite.Nil(err)
+				suite.Equal(&TeamDataV1{Id: 9, Title: "Luton"}, data)
+			})
+
+			suite.Run("FromJsonArray", func() {
+				j := "[{\"@type\":\"test.TeamDataV1\",\"Id\":1,\"Title\":\"Bournemouth\"},{\"@type\":\"test.TeamData\",\"Id\":2,\"Name\":\"Brighton\"}]"
+				data, _, _, err := maps.Out[[]any](
+					miruken.BuildUp(handler, api.Polymorphic),
+					[]byte(j), api.FromJson)
+				suite.Nil(err)
+				suite.Equal([]any{
+					&TeamData{Id: 1, Name: "Bournemouth"},
+					&TeamData{Id: 2, Name: "Brighton"},
+				}, data)
+			})
+		})
+
+		suite.Run("Schedule", func() {
+			suite.Run("ConcurrentBatch", func() {
+				composer := miruken.BuildUp(handler, api.Polymorphic)
+				var b bytes.Buffer
+				out := io.Writer(&b)
+				_, _, err := maps.Into(composer, api.Message{
+					Payload: api.ConcurrentBatch{
+						Requests:    []any{&TeamData{Id: 2, Name: "Arsenal"}},
+						MaxParallel: 4,
+						FailFast:    true,
+						Timeout:     1500 * time.Millisecond,
+					}}, &out, api.ToJson)
+				suite.Nil(err)
+				suite.Contains(b.String(), "\"maxParallel\":4")
+				suite.Contains(b.String(), "\"timeout\":\"1.5s\"")
+				msg, _, _, err := maps.Out[api.Message](composer, &b, api.FromJson)
+				suite.Nil(err)
+				suite.Equal(&api.ConcurrentBatch{
+					Requests:    []any{&TeamData{Id: 2, Name: "Arsenal"}},
+					MaxParallel: 4,
+					FailFast:    true,
+					Timeout:     1500 * time.Millisecond,
+				}, msg.Payload)
+			})
+
+			suite.Run("ConcurrentBatchNoOptions", func() {
+				composer := miruken.BuildUp(handler, api.Polymorphic)
+				var b bytes.Buffer
+				out := io.Writer(&b)
+				_, _, err := maps.Into(composer, api.Message{
+					Payload: api.ConcurrentBatch{
+						Requests: []any{&TeamData{Id: 3, Name: "Fulham"}},
+					}}, &out, api.ToJson)
+				suite.Nil(err)
+				suite.Contains(b.String(), "json.Concurrent")
+				msg, _, _, err := maps.Out[api.Message](composer, &b, api.FromJson)
+				suite.Nil(err)
+				suite.Equal(&api.ConcurrentBatch{
+					Requests: []any{&TeamData{Id: 3, Name: "Fulham"}},
+				}, msg.Payload)
+			})
+
+			suite.Run("ConcurrentBatchInvalidTimeout", func() {
+				composer := miruken.BuildUp(handler, api.Polymorphic)
+				j := "{\"payload\":{\"@type\":\"stdjson.ConcurrentBatch\",\"requests\":[],\"timeout\":\"soon\"}}"
+				_, _, _, err := maps.Out[api.Message](composer, strings.NewReader(j), api.FromJson)
+				suite.NotNil(err)
+			})
+		})
 	})
 }
 
@@ -1,11 +1,15 @@
 package api
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"github.com/miruken-go/miruken"
 	"github.com/miruken-go/miruken/handles"
 	"github.com/miruken-go/miruken/internal"
+	"github.com/miruken-go/miruken/maps"
 	"github.com/miruken-go/miruken/promise"
+	"io"
 )
 
 type (
@@ -24,6 +28,9 @@ type (
 		Polymorphism   miruken.Option[Polymorphism]
 		TypeInfoFormat string
 		TypeFieldValue string
+		Propagate      []StashKey
+		MaxParts       int
+		MaxPartSize    int64
 	}
 
 	// MalformedErrorError reports an invalid error payload.
@@ -122,3 +129,34 @@ func Publish(
 		return pv, err
 	}
 }
+
+// EncodeMessage encodes the payload into a json Message.
+// Used to store or transmit messages with their type information.
+func EncodeMessage(
+	handler miruken.Handler,
+	payload any,
+) (json.RawMessage, error) {
+	var b bytes.Buffer
+	out := io.Writer(&b)
+	msg := Message{Payload: payload}
+	if _, _, err := maps.Into(handler, msg, &out, ToJson); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(b.Bytes()), nil
+}
+
+// DecodeMessage decodes a json Message and returns the payload.
+// An empty message decodes to a nil payload.
+func DecodeMessage(
+	handler miruken.Handler,
+	message json.RawMessage,
+) (any, error) {
+	if len(message) == 0 {
+		return nil, nil
+	}
+	msg, _, _, err := maps.Out[Message](handler, bytes.NewReader(message), FromJson)
+	if err != nil {
+		return nil, err
+	}
+	return msg.Payload, nil
+}
@@ -23,6 +23,18 @@ var (
 
 	// FromJson decodes json into a corresponding model
 	FromJson = maps.From("application/json", nil)
+
+	// ToMsgpack encodes a model into msgpack format
+	ToMsgpack = maps.To("application/msgpack", nil)
+
+	// FromMsgpack decodes msgpack into a corresponding model
+	FromMsgpack = maps.From("application/msgpack", nil)
+
+	// ToCbor encodes a model into cbor format
+	ToCbor = maps.To("application/cbor", nil)
+
+	// FromCbor decodes cbor into a corresponding model
+	FromCbor = maps.From("application/cbor", nil)
 )
 
 
@@ -0,0 +1,379 @@
+package msgpack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/miruken-go/miruken/internal/jsontree"
+	"math"
+	"strconv"
+	"time"
+)
+
+// decoder reads a msgpack value into a json tree.
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+
+var errShortData = errors.New("msgpack: unexpected end of data")
+
+
+// decode reads a msgpack value into a json tree.
+func decode(data []byte) (any, error) {
+	dec := decoder{data: data}
+	tree, err := dec.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if dec.pos != len(data) {
+		return nil, errors.New("msgpack: unexpected data after top-level value")
+	}
+	return tree, nil
+}
+
+func encode(buf *bytes.Buffer, v any) error {
+	switch t := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if t {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case string:
+		encodeString(buf, t)
+	case []byte:
+		switch n := len(t); {
+		case n <= math.MaxUint8:
+			buf.WriteByte(0xc4)
+			buf.WriteByte(byte(n))
+		case n <= math.MaxUint16:
+			buf.WriteByte(0xc5)
+			buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+		default:
+			buf.WriteByte(0xc6)
+			buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+		}
+		buf.Write(t)
+	case json.Number:
+		n, err := jsontree.Number(t)
+		if err != nil {
+			return fmt.Errorf("msgpack: %w", err)
+		}
+		switch n := n.(type) {
+		case int64:
+			encodeInt(buf, n)
+		case uint64:
+			buf.WriteByte(0xcf)
+			buf.Write(binary.BigEndian.AppendUint64(nil, n))
+		case float64:
+			encodeFloat(buf, n)
+		}
+	case []any:
+		encodeLength(buf, len(t), 0x90, 0xdc)
+		for _, item := range t {
+			if err := encode(buf, item); err != nil {
+				return err
+			}
+		}
+	case jsontree.Object:
+		encodeLength(buf, len(t), 0x80, 0xde)
+		for _, member := range t {
+			encodeString(buf, member.Key)
+			if err := encode(buf, member.Value); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: unsupported value %T", v)
+	}
+	return nil
+}
+
+func encodeString(buf *bytes.Buffer, s string) {
+	switch n := len(s); {
+	case n < 32:
+		buf.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(0xd9)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(0xda)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	default:
+		buf.WriteByte(0xdb)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	}
+	buf.WriteString(s)
+}
+
+// encodeLength writes the length of an array or map using the
+// fix code for small lengths or the 16/32-bit codes otherwise.
+func encodeLength(buf *bytes.Buffer, n int, fix, code16 byte) {
+	switch {
+	case n < 16:
+		buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(code16)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	default:
+		buf.WriteByte(code16 + 1)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	}
+}
+
+func encodeInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0 && i <= math.MaxInt8:
+		buf.WriteByte(byte(i))
+	case i < 0 && i >= -32:
+		buf.WriteByte(byte(int8(i)))
+	case i >= 0 && i <= math.MaxUint8:
+		buf.WriteByte(0xcc)
+		buf.WriteByte(byte(i))
+	case i >= 0 && i <= math.MaxUint16:
+		buf.WriteByte(0xcd)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(i)))
+	case i >= 0 && i <= math.MaxUint32:
+		buf.WriteByte(0xce)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(i)))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte(byte(int8(i)))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		buf.WriteByte(0xd1)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(int16(i))))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		buf.WriteByte(0xd2)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(int32(i))))
+	default:
+		buf.WriteByte(0xd3)
+		buf.Write(binary.BigEndian.AppendUint64(nil, uint64(i)))
+	}
+}
+
+// encodeFloat writes a float32 if the value is exact, otherwise a float64.
+func encodeFloat(buf *bytes.Buffer, f float64) {
+	if f32 := float32(f); float64(f32) == f {
+		buf.WriteByte(0xca)
+		buf.Write(binary.BigEndian.AppendUint32(nil, math.Float32bits(f32)))
+	} else {
+		buf.WriteByte(0xcb)
+		buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(f)))
+	}
+}
+
+
+func (d *decoder) value(depth int) (any, error) {
+	if depth > jsontree.MaxDepth {
+		return nil, fmt.Errorf("msgpack: %w", jsontree.ErrMaxDepth)
+	}
+	code, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case code <= 0x7f:
+		return int64(code), nil
+	case code >= 0xe0:
+		return int64(int8(code)), nil
+	case code >= 0xa0 && code <= 0xbf:
+		return d.string(int(code & 0x1f))
+	case code >= 0x90 && code <= 0x9f:
+		return d.array(int(code & 0x0f), depth)
+	case code >= 0x80 && code <= 0x8f:
+		return d.object(int(code & 0x0f), depth)
+	}
+	switch code {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.uint(1 << (code - 0xcc))
+		return u, err
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (code - 0xd0)
+		u, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		shift := 64 - 8*size
+		return int64(u<<shift) >> shift, nil
+	case 0xca:
+		u, err := d.uint(4)
+		return math.Float32frombits(uint32(u)), err
+	case 0xcb:
+		u, err := d.uint(8)
+		return math.Float64frombits(u), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.length(1 << (code - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.string(n)
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.length(1 << (code - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return d.bytes(n)
+	case 0xdc, 0xdd:
+		n, err := d.length(2 << (code - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.array(n, depth)
+	case 0xde, 0xdf:
+		n, err := d.length(2 << (code - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.object(n, depth)
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.ext(1 << (code - 0xd4))
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.length(1 << (code - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.ext(n)
+	}
+	return nil, fmt.Errorf("msgpack: invalid code 0x%x", code)
+}
+
+func (d *decoder) byte() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, errShortData
+	}
+	b := d.data[d.pos]
+	d.pos++
+	return b, nil
+}
+
+func (d *decoder) next(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data)-d.pos {
+		return nil, errShortData
+	}
+	b := d.data[d.pos:d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *decoder) uint(size int) (uint64, error) {
+	b, err := d.next(size)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+func (d *decoder) length(size int) (int, error) {
+	u, err := d.uint(size)
+	if err != nil {
+		return 0, err
+	}
+	if u > uint64(len(d.data)-d.pos) {
+		return 0, errShortData
+	}
+	return int(u), nil
+}
+
+func (d *decoder) string(n int) (any, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *decoder) bytes(n int) (any, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Clone(b), nil
+}
+
+func (d *decoder) array(n int, depth int) (any, error) {
+	if n > len(d.data)-d.pos {
+		return nil, errShortData
+	}
+	items := make([]any, n)
+	for i := range items {
+		item, err := d.value(depth+1)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = item
+	}
+	return items, nil
+}
+
+func (d *decoder) object(n int, depth int) (any, error) {
+	if n > len(d.data)-d.pos {
+		return nil, errShortData
+	}
+	obj := make(jsontree.Object, n)
+	for i := range obj {
+		key, err := d.value(depth+1)
+		if err != nil {
+			return nil, err
+		}
+		switch k := key.(type) {
+		case string:
+			obj[i].Key = k
+		case int64:
+			obj[i].Key = strconv.FormatInt(k, 10)
+		case uint64:
+			obj[i].Key = strconv.FormatUint(k, 10)
+		default:
+			return nil, fmt.Errorf("msgpack: unsupported map key %T", key)
+		}
+		if obj[i].Value, err = d.value(depth+1); err != nil {
+			return nil, err
+		}
+	}
+	return obj, nil
+}
+
+// ext decodes an extension value.  Only the timestamp extension
+// is supported and is decoded as an RFC 3339 string.
+func (d *decoder) ext(n int) (any, error) {
+	typ, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	b, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(typ) != -1 {
+		return nil, fmt.Errorf("msgpack: unsupported extension type %d", int8(typ))
+	}
+	var ts time.Time
+	switch n {
+	case 4:
+		ts = time.Unix(int64(binary.BigEndian.Uint32(b)), 0)
+	case 8:
+		u := binary.BigEndian.Uint64(b)
+		ts = time.Unix(int64(u&0x3ffffffff), int64(u>>34))
+	case 12:
+		ts = time.Unix(int64(binary.BigEndian.Uint64(b[4:])),
+			int64(binary.BigEndian.Uint32(b)))
+	default:
+		return nil, fmt.Errorf("msgpack: invalid timestamp length %d", n)
+	}
+	return ts.UTC().Format(time.RFC3339Nano), nil
+}
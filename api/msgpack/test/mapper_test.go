@@ -0,0 +1,218 @@
+package test
+
+import (
+	"bytes"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/api/msgpack"
+	"github.com/miruken-go/miruken/creates"
+	"github.com/miruken-go/miruken/maps"
+	"github.com/stretchr/testify/suite"
+	"io"
+	"testing"
+	"time"
+)
+
+type (
+	TypeIdMapper struct {}
+
+	PlayerData struct {
+		Id       int32
+		Name     string
+		Rating   float64
+		Active   bool
+		Joined   time.Time
+		Nickname *string
+	}
+
+	Shape interface {
+		Area() float64
+	}
+
+	Circle struct {
+		Radius float64
+	}
+
+	Square struct {
+		Side float64
+	}
+
+	Drawing struct {
+		Name   string
+		Shapes []Shape
+	}
+
+	Attachment struct {
+		Name string
+		Data []byte
+	}
+)
+
+func (c *Circle) Area() float64 { return 3 * c.Radius * c.Radius }
+func (s *Square) Area() float64 { return s.Side * s.Side }
+
+
+func (m *TypeIdMapper) CreateCircle(
+	_*struct{
+		creates.It `key:"test.Circle"`
+	  },
+) *Circle {
+	return new(Circle)
+}
+
+func (m *TypeIdMapper) CreateSquare(
+	_*struct{
+		creates.It `key:"test.Square"`
+	  },
+) *Square {
+	return new(Square)
+}
+
+func (m *TypeIdMapper) CreateDrawing(
+	_*struct{
+		creates.It `key:"test.Drawing"`
+	  },
+) *Drawing {
+	return new(Drawing)
+}
+
+
+type MsgpackTestSuite struct {
+	suite.Suite
+}
+
+func (suite *MsgpackTestSuite) Setup() miruken.Handler {
+	handler, _ := miruken.Setup(
+		TestFeature,
+		msgpack.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Handler()
+	return handler
+}
+
+func (suite *MsgpackTestSuite) TestMsgpack() {
+	suite.Run("ToMsgpackBytes", func() {
+		handler := suite.Setup()
+		b, _, _, err := maps.Out[[]byte](handler, map[string]any{"Id": 1}, api.ToMsgpack)
+		suite.Nil(err)
+		suite.Equal([]byte{0x81, 0xa2, 'I', 'd', 0x01}, b)
+	})
+
+	suite.Run("ToMsgpackPrimitives", func() {
+		handler := suite.Setup()
+		b, _, _, err := maps.Out[[]byte](handler, []any{nil, true, -1, 200, -200, 1.5, "ab"}, api.ToMsgpack)
+		suite.Nil(err)
+		suite.Equal([]byte{
+			0x97, 0xc0, 0xc3, 0xff,
+			0xcc, 0xc8,
+			0xd1, 0xff, 0x38,
+			0xca, 0x3f, 0xc0, 0x00, 0x00,
+			0xa2, 'a', 'b'}, b)
+	})
+
+	suite.Run("RoundTrip", func() {
+		handler  := suite.Setup()
+		nickname := "Sonny"
+		player   := PlayerData{
+			Id:       7,
+			Name:     "Son Heung-min",
+			Rating:   8.25,
+			Active:   true,
+			Joined:   time.Date(2015, 8, 28, 0, 0, 0, 0, time.UTC),
+			Nickname: &nickname,
+		}
+		b, _, _, err := maps.Out[[]byte](handler, player, api.ToMsgpack)
+		suite.Nil(err)
+		data, _, _, err := maps.Out[PlayerData](handler, b, api.FromMsgpack)
+		suite.Nil(err)
+		suite.Equal(player, data)
+	})
+
+	suite.Run("Writer", func() {
+		handler := suite.Setup()
+		var b bytes.Buffer
+		out := io.Writer(&b)
+		_, _, err := maps.Into(handler, PlayerData{Id: 3, Name: "Kane"}, &out, api.ToMsgpack)
+		suite.Nil(err)
+		data, _, _, err := maps.Out[PlayerData](handler, io.Reader(&b), api.FromMsgpack)
+		suite.Nil(err)
+		suite.Equal("Kane", data.Name)
+	})
+
+	suite.Run("Polymorphic", func() {
+		handler := miruken.BuildUp(suite.Setup(), api.PolymorphicAll)
+		drawing := &Drawing{
+			Name:   "Shapes",
+			Shapes: []Shape{&Circle{Radius: 2}, &Square{Side: 3}},
+		}
+		b, _, _, err := maps.Out[[]byte](handler, drawing, api.ToMsgpack)
+		suite.Nil(err)
+		late, _, _, err := maps.Out[api.Late](handler, b, api.FromMsgpack)
+		suite.Nil(err)
+		suite.Equal(drawing, late.Value)
+	})
+
+	suite.Run("Message", func() {
+		handler := miruken.BuildUp(suite.Setup(), api.Polymorphic)
+		var b bytes.Buffer
+		out := io.Writer(&b)
+		msg := api.Message{Payload: &Square{Side: 4}}
+		_, _, err := maps.Into(handler, msg, &out, api.ToMsgpack)
+		suite.Nil(err)
+		data, _, _, err := maps.Out[api.Message](handler, io.Reader(&b), api.FromMsgpack)
+		suite.Nil(err)
+		suite.Equal(&Square{Side: 4}, data.Payload)
+	})
+
+	suite.Run("Timestamp", func() {
+		handler := suite.Setup()
+		// {"Joined": timestamp 32}
+		b := []byte{0x81, 0xa6, 'J', 'o', 'i', 'n', 'e', 'd', 0xd6, 0xff, 0x55, 0xdf, 0xa4, 0x00}
+		data, _, _, err := maps.Out[PlayerData](handler, b, api.FromMsgpack)
+		suite.Nil(err)
+		suite.Equal(time.Unix(0x55dfa400, 0).UTC(), data.Joined)
+	})
+
+	suite.Run("Binary", func() {
+		handler := suite.Setup()
+		b := []byte{0xc4, 0x03, 0x01, 0x02, 0x03}
+		data, _, _, err := maps.Out[[]byte](handler, b, api.FromMsgpack)
+		suite.Nil(err)
+		suite.Equal([]byte{1, 2, 3}, data)
+	})
+
+	suite.Run("ToBinary", func() {
+		handler    := suite.Setup()
+		attachment := Attachment{Name: "a", Data: []byte{1, 2, 3}}
+		b, _, _, err := maps.Out[[]byte](handler, attachment, api.ToMsgpack)
+		suite.Nil(err)
+		suite.Equal([]byte{0x82,
+			0xa4, 'N', 'a', 'm', 'e', 0xa1, 'a',
+			0xa4, 'D', 'a', 't', 'a', 0xc4, 0x03, 0x01, 0x02, 0x03}, b)
+		data, _, _, err := maps.Out[Attachment](handler, b, api.FromMsgpack)
+		suite.Nil(err)
+		suite.Equal(attachment, data)
+	})
+
+	suite.Run("Truncated", func() {
+		handler := suite.Setup()
+		_, _, _, err := maps.Out[PlayerData](handler, []byte{0x81, 0xa2, 'I'}, api.FromMsgpack)
+		suite.EqualError(err, "msgpack: unexpected end of data")
+	})
+
+	suite.Run("Oversized", func() {
+		handler := suite.Setup()
+		_, _, _, err := maps.Out[[]any](handler, []byte{0xdd, 0xff, 0xff, 0xff, 0xff}, api.FromMsgpack)
+		suite.EqualError(err, "msgpack: unexpected end of data")
+	})
+
+	suite.Run("UnsupportedExtension", func() {
+		handler := suite.Setup()
+		_, _, _, err := maps.Out[any](handler, []byte{0xd4, 0x05, 0x00}, api.FromMsgpack)
+		suite.EqualError(err, "msgpack: unsupported extension type 5")
+	})
+}
+
+func TestMsgpackTestSuite(t *testing.T) {
+	suite.Run(t, new(MsgpackTestSuite))
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/args"
 	"github.com/miruken-go/miruken/constraints"
 	"github.com/miruken-go/miruken/maps"
 	"io"
@@ -12,15 +13,33 @@ import (
 	"time"
 )
 
-// MultipartMapper reads and writes 'multipart/*'
-// mime messages from a PartContainer.
-type MultipartMapper struct{}
+type (
+	// MultipartMapper reads and writes 'multipart/*'
+	// mime messages from a PartContainer.
+	MultipartMapper struct{}
+
+	// LimitExceededError reports a message that exceeds
+	// a configured limit.
+	LimitExceededError struct {
+		Limit string
+		Max   int64
+	}
+)
+
+
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("%s exceeds limit of %d", e.Limit, e.Max)
+}
 
 
 func (m *MultipartMapper) Read(
 	_*struct{
 		maps.Format `from:"/multipart//"`
 	  }, reader io.Reader,
+	_*struct{
+		args.Optional
+		args.FromOptions
+	  }, options Options,
 	  it  *maps.It,
 	  ctx miruken.HandleContext,
 ) (Message, error) {
@@ -44,8 +63,11 @@ func (m *MultipartMapper) Read(
 		if err != nil {
 			return msg, err
 		}
+		if options.MaxParts > 0 && i >= options.MaxParts {
+			return msg, &LimitExceededError{"multipart parts", int64(options.MaxParts)}
+		}
 
-		body, err := io.ReadAll(p)
+		body, err := readPart(p, options.MaxPartSize)
 		if err != nil {
 			return msg, err
 		}
@@ -206,6 +228,18 @@ func addPart(
 	return err
 }
 
+// readPart reads the part body failing if it exceeds max bytes.
+func readPart(p *multipart.Part, max int64) ([]byte, error) {
+	if max <= 0 {
+		return io.ReadAll(p)
+	}
+	body, err := io.ReadAll(io.LimitReader(p, max+1))
+	if err == nil && int64(len(body)) > max {
+		err = &LimitExceededError{"multipart part size", max}
+	}
+	return body, err
+}
+
 func extractMultipartParams(
 	src miruken.ConstraintSource,
 ) (typ string, boundary string, start string) {
@@ -221,4 +255,12 @@ func extractMultipartParams(
 	return
 }
 
+
+// MultipartLimits returns a miruken.Builder that limits the
+// number of parts and size of each part in multipart messages.
+func MultipartLimits(maxParts int, maxPartSize int64) miruken.Builder {
+	return miruken.Options(Options{MaxParts: maxParts, MaxPartSize: maxPartSize})
+}
+
+
 var ErrMissingBoundary = errors.New(`multipart: missing "boundary" parameter`)
\ No newline at end of file
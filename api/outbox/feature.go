@@ -0,0 +1,73 @@
+package outbox
+
+import (
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/internal"
+)
+
+// Installer configures transactional outbox support.
+type Installer struct {
+	store  Store
+	config Config
+	relay  *Relay
+}
+
+func (i *Installer) DependsOn() []miruken.Feature {
+	return []miruken.Feature{api.Feature()}
+}
+
+func (i *Installer) Install(setup *miruken.SetupBuilder) error {
+	if setup.Tag(&featureTag) {
+		if internal.IsNil(i.store) {
+			i.store = NewMemoryStore()
+		}
+		i.relay = NewRelay(i.store, i.config)
+		setup.Specs(&Relay{}).
+			  Handlers(i.relay)
+	}
+	return nil
+}
+
+// AfterInstall starts the relay once the handler
+// is available to publish messages.
+func (i *Installer) AfterInstall(
+	_ *miruken.SetupBuilder,
+	handler miruken.Handler,
+) error {
+	if relay := i.relay; relay != nil {
+		relay.Start(handler)
+	}
+	return nil
+}
+
+// WithStore sets the Store the relay dispatches from.
+func WithStore(store Store) func(*Installer) {
+	if internal.IsNil(store) {
+		panic("store cannot be nil")
+	}
+	return func(installer *Installer) {
+		installer.store = store
+	}
+}
+
+// Configure customizes the relay.
+func Configure(config Config) func(*Installer) {
+	return func(installer *Installer) {
+		installer.config = config
+	}
+}
+
+// Feature configures transactional outbox support.
+// If no Store is provided, a MemoryStore is used.
+func Feature(config ...func(*Installer)) miruken.Feature {
+	installer := &Installer{}
+	for _, configure := range config {
+		if configure != nil {
+			configure(installer)
+		}
+	}
+	return installer
+}
+
+var featureTag byte
@@ -0,0 +1,109 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps entries in memory.
+// It is intended for tests and single process deployments
+// that do not require durability.  Dispatched entries are
+// removed so only the pending entries are retained.
+type MemoryStore struct {
+	lock     sync.Mutex
+	entries  map[string]*Entry
+	order    []*Entry
+	sequence int64
+}
+
+
+func (m *MemoryStore) Save(
+	_       context.Context,
+	entries ...Entry,
+) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.entries == nil {
+		m.entries = make(map[string]*Entry)
+	}
+	for _, entry := range entries {
+		e := entry
+		m.sequence++
+		e.Sequence = m.sequence
+		m.entries[e.Id] = &e
+		m.order = append(m.order, &e)
+	}
+	return nil
+}
+
+func (m *MemoryStore) Claim(
+	_     context.Context,
+	now   time.Time,
+	until time.Time,
+	limit int,
+) ([]Entry, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var claimed []Entry
+	for _, entry := range m.order {
+		if limit > 0 && len(claimed) >= limit {
+			break
+		}
+		if !entry.NextAttempt.After(now) {
+			entry.NextAttempt = until
+			claimed = append(claimed, *entry)
+		}
+	}
+	return claimed, nil
+}
+
+func (m *MemoryStore) Dispatched(
+	_  context.Context,
+	id string,
+	_  time.Time,
+) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if entry, ok := m.entries[id]; ok {
+		delete(m.entries, id)
+		for i, e := range m.order {
+			if e == entry {
+				m.order = append(m.order[:i], m.order[i+1:]...)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) Failed(
+	_     context.Context,
+	entry Entry,
+) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if e, ok := m.entries[entry.Id]; ok {
+		e.Attempts    = entry.Attempts
+		e.NextAttempt = entry.NextAttempt
+		e.LastError   = entry.LastError
+	}
+	return nil
+}
+
+// Entries returns a snapshot of the pending entries.
+func (m *MemoryStore) Entries() []Entry {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	entries := make([]Entry, len(m.order))
+	for i, entry := range m.order {
+		entries[i] = *entry
+	}
+	return entries
+}
+
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*Entry)}
+}
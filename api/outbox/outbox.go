@@ -0,0 +1,197 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/internal"
+	"github.com/miruken-go/miruken/provides"
+	"sync"
+	"time"
+)
+
+type (
+	// Entry is a message captured in the outbox.
+	// Sequence is assigned by the Store when saved and
+	// entries are relayed in Sequence order.
+	Entry struct {
+		Id           string
+		Sequence     int64
+		Message      json.RawMessage
+		Attempts     int
+		CreatedAt    time.Time
+		NextAttempt  time.Time
+		DispatchedAt time.Time
+		LastError    string
+	}
+
+	// Store persists outbox entries until they are dispatched.
+	Store interface {
+		// Save adds the entries to the outbox.
+		Save(ctx context.Context, entries ...Entry) error
+
+		// Claim returns up to limit undispatched entries due for
+		// an attempt at or before now and defers their next attempt
+		// until the claim expires so concurrent relays skip them.
+		Claim(ctx context.Context, now, until time.Time, limit int) ([]Entry, error)
+
+		// Dispatched marks the entry as dispatched or removes it.
+		Dispatched(ctx context.Context, id string, at time.Time) error
+
+		// Failed records an unsuccessful dispatch attempt.
+		Failed(ctx context.Context, entry Entry) error
+	}
+
+	// UnitOfWork captures messages published through it
+	// until the work is committed or rolled back.  Only
+	// api.Publish is captured and all other callbacks are
+	// handled normally.
+	// Published messages are only stored in the outbox on
+	// commit and are discarded on rollback.
+	UnitOfWork struct {
+		miruken.Handler
+		lock     sync.Mutex
+		messages []any
+		done     bool
+	}
+)
+
+
+var ErrCompleted = errors.New("outbox: the unit of work has already completed")
+
+
+// UnitOfWork
+
+func (u *UnitOfWork) NoConstructor() {}
+
+func (u *UnitOfWork) Handle(
+	callback any,
+	greedy   bool,
+	composer miruken.Handler,
+) miruken.HandleResult {
+	if callback == nil {
+		return miruken.NotHandled
+	}
+	if composer == nil {
+		composer = &miruken.CompositionScope{Handler: u}
+	}
+	cb := callback
+	if comp, ok := cb.(*miruken.Composition); ok {
+		cb = comp.Callback()
+	}
+	if h, ok := cb.(*miruken.Handles); ok && greedy && published(h) {
+		if source := h.Source(); !internal.IsNil(source) {
+			u.lock.Lock()
+			if !u.done {
+				u.messages = append(u.messages, source)
+				u.lock.Unlock()
+				return miruken.Handled
+			}
+			u.lock.Unlock()
+		}
+	}
+	return u.Handler.Handle(callback, greedy, composer)
+}
+
+// Messages returns the messages captured so far.
+func (u *UnitOfWork) Messages() []any {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	return append([]any(nil), u.messages...)
+}
+
+// Commit saves the captured messages in the store.
+// The store is usually bound to the same transaction as
+// the work so the messages are only visible if it commits.
+func (u *UnitOfWork) Commit(
+	ctx   context.Context,
+	store Store,
+) error {
+	if internal.IsNil(store) {
+		panic("store cannot be nil")
+	}
+	u.lock.Lock()
+	if u.done {
+		u.lock.Unlock()
+		return ErrCompleted
+	}
+	u.done = true
+	messages := u.messages
+	u.messages = nil
+	u.lock.Unlock()
+	if len(messages) == 0 {
+		return nil
+	}
+	handler := miruken.BuildUp(u.Handler, api.Polymorphic)
+	now     := time.Now().UTC()
+	entries := make([]Entry, len(messages))
+	for i, message := range messages {
+		encoded, err := api.EncodeMessage(handler, message)
+		if err != nil {
+			return fmt.Errorf("outbox: %w", err)
+		}
+		entries[i] = Entry{
+			Id:          uuid.NewString(),
+			Message:     encoded,
+			CreatedAt:   now,
+			NextAttempt: now,
+		}
+	}
+	return store.Save(ctx, entries...)
+}
+
+// Rollback discards the captured messages.
+func (u *UnitOfWork) Rollback() {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.done     = true
+	u.messages = nil
+}
+
+
+// published returns true if the callback was created by api.Publish,
+// which expects no results and has no constraints.
+func published(h *miruken.Handles) bool {
+	return h.Target() == nil && len(h.Constraints()) == 0
+}
+
+// Begin starts a new UnitOfWork capturing messages
+// published through the returned handler.
+func Begin(handler miruken.Handler) *UnitOfWork {
+	if internal.IsNil(handler) {
+		panic("handler cannot be nil")
+	}
+	return &UnitOfWork{Handler: handler}
+}
+
+// Run performs the work in a new UnitOfWork and commits the
+// captured messages to the store if the work succeeds.
+// The Relay, if available, is notified of the new entries.
+func Run(
+	ctx     context.Context,
+	handler miruken.Handler,
+	store   Store,
+	work    func(miruken.Handler) error,
+) error {
+	if work == nil {
+		panic("work cannot be nil")
+	}
+	uow := Begin(handler)
+	if err := work(uow); err != nil {
+		uow.Rollback()
+		return err
+	}
+	if err := uow.Commit(ctx, store); err != nil {
+		return err
+	}
+	if relay, _, err := provides.Type[*Relay](handler); err == nil && relay != nil {
+		relay.Notify()
+	}
+	return nil
+}
+
+
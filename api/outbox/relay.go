@@ -0,0 +1,217 @@
+package outbox
+
+import (
+	"context"
+	"github.com/go-logr/logr"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/internal"
+	"github.com/miruken-go/miruken/internal/worker"
+	"github.com/miruken-go/miruken/provides"
+	"time"
+)
+
+type (
+	// Config customizes the behavior of the Relay.
+	// Claimed entries are not dispatched by other relays
+	// until ClaimFor elapses.
+	Config struct {
+		PollInterval time.Duration
+		BatchSize    int
+		MaxAttempts  int
+		MinBackoff   time.Duration
+		MaxBackoff   time.Duration
+		ClaimFor     time.Duration
+	}
+
+	// Relay is a hosted worker that publishes the pending
+	// outbox entries.  Failed entries are retried with an
+	// exponential backoff until the maximum number of attempts
+	// is reached, after which they are abandoned and remain in
+	// the store for inspection.
+	Relay struct {
+		store  Store
+		config Config
+		logger logr.Logger
+		worker worker.Worker
+	}
+)
+
+
+const (
+	defaultPollInterval = time.Second
+	defaultBatchSize    = 100
+	defaultMaxAttempts  = 10
+	defaultMinBackoff   = time.Second
+	defaultMaxBackoff   = 5 * time.Minute
+	defaultClaimFor     = time.Minute
+)
+
+
+// Abandoned is the next attempt assigned to entries
+// that exceeded the maximum number of attempts.
+var Abandoned = time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+
+// NoConstructor prevents Relay from being created implicitly.
+func (r *Relay) NoConstructor() {}
+
+// Store returns the Store the Relay dispatches from.
+func (r *Relay) Store() Store {
+	return r.store
+}
+
+// Start starts the worker that publishes the pending
+// entries using the handler.
+func (r *Relay) Start(handler miruken.Handler) {
+	if internal.IsNil(handler) {
+		panic("handler cannot be nil")
+	}
+	if r.logger.GetSink() == nil {
+		r.logger, _, _ = provides.Type[logr.Logger](handler)
+	}
+	handler = miruken.BuildUp(handler, api.Polymorphic)
+	r.worker.Start(1, r.config.PollInterval, func(ctx context.Context) {
+		r.poll(ctx, handler)
+	})
+}
+
+// Notify wakes the worker to relay the pending entries
+// without waiting for the next poll.
+func (r *Relay) Notify() {
+	r.worker.Notify()
+}
+
+// Close stops the worker.
+func (r *Relay) Close() {
+	r.worker.Close()
+}
+
+// Relay publishes the pending entries once and returns
+// the number successfully dispatched.
+func (r *Relay) Relay(
+	ctx     context.Context,
+	handler miruken.Handler,
+) (int, error) {
+	now := time.Now().UTC()
+	pending, err := r.store.Claim(ctx, now, now.Add(r.config.ClaimFor), r.config.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	dispatched := 0
+	for _, entry := range pending {
+		if err := dispatch(entry, handler); err != nil {
+			if err := r.store.Failed(ctx, r.retry(entry, err)); err != nil {
+				return dispatched, err
+			}
+			continue
+		}
+		if err := r.store.Dispatched(ctx, entry.Id, time.Now().UTC()); err != nil {
+			return dispatched, err
+		}
+		dispatched++
+	}
+	return dispatched, nil
+}
+
+// poll relays the pending entries in batches until
+// fewer than a full batch remain.
+func (r *Relay) poll(
+	ctx     context.Context,
+	handler miruken.Handler,
+) {
+	for {
+		n, err := r.Relay(ctx, handler)
+		if err != nil && ctx.Err() == nil {
+			r.logger.Error(err, "unable to relay outbox entries")
+		}
+		if err != nil || n < r.config.BatchSize {
+			return
+		}
+	}
+}
+
+// retry computes the next attempt for a failed entry.
+func (r *Relay) retry(entry Entry, err error) Entry {
+	entry.Attempts++
+	entry.LastError = err.Error()
+	if entry.Attempts >= r.config.MaxAttempts {
+		entry.NextAttempt = Abandoned
+		r.logger.Error(err, "abandoned outbox entry", "id", entry.Id, "attempts", entry.Attempts)
+		return entry
+	}
+	backoff := r.config.MinBackoff << (entry.Attempts - 1)
+	if backoff <= 0 || backoff > r.config.MaxBackoff {
+		backoff = r.config.MaxBackoff
+	}
+	entry.NextAttempt = time.Now().UTC().Add(backoff)
+	return entry
+}
+
+
+// Config
+
+func (c Config) withDefaults() Config {
+	if c.PollInterval <= 0 {
+		c.PollInterval = defaultPollInterval
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = defaultBatchSize
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = defaultMaxAttempts
+	}
+	if c.MinBackoff <= 0 {
+		c.MinBackoff = defaultMinBackoff
+	}
+	if c.ClaimFor <= 0 {
+		c.ClaimFor = defaultClaimFor
+	}
+	if c.MaxBackoff < c.MinBackoff {
+		c.MaxBackoff = defaultMaxBackoff
+		if c.MaxBackoff < c.MinBackoff {
+			c.MaxBackoff = c.MinBackoff
+		}
+	}
+	return c
+}
+
+
+// NewRelay creates a Relay dispatching entries from the store.
+// Without a logger, the logr.Logger provided by the handler
+// starting the Relay is used.
+func NewRelay(
+	store  Store,
+	config Config,
+	logger ...logr.Logger,
+) *Relay {
+	if internal.IsNil(store) {
+		panic("store cannot be nil")
+	}
+	relay := &Relay{
+		store:  store,
+		config: config.withDefaults(),
+	}
+	if len(logger) > 0 {
+		relay.logger = logger[0]
+	}
+	return relay
+}
+
+func dispatch(
+	entry   Entry,
+	handler miruken.Handler,
+) error {
+	payload, err := api.DecodeMessage(handler, entry.Message)
+	if err != nil {
+		return err
+	}
+	if payload == nil {
+		return nil
+	}
+	pv, err := api.Publish(handler, payload)
+	if err == nil && pv != nil {
+		_, err = pv.Await()
+	}
+	return err
+}
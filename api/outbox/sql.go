@@ -0,0 +1,222 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// SqlStore is a Store backed by a database/sql table.
+	// Timestamps are stored as unix nanoseconds to remain
+	// portable across drivers.  The sequence is generated by the
+	// database to order the entries.  The table is expected to be
+	//
+	//   CREATE TABLE outbox (
+	//     id            VARCHAR(36) PRIMARY KEY,
+	//     sequence      BIGSERIAL   NOT NULL UNIQUE,
+	//     message       TEXT        NOT NULL,
+	//     attempts      INTEGER     NOT NULL,
+	//     created_at    BIGINT      NOT NULL,
+	//     next_attempt  BIGINT      NOT NULL,
+	//     dispatched_at BIGINT      NOT NULL,
+	//     last_error    TEXT        NOT NULL
+	//   )
+	//
+	// MySQL declares the sequence as BIGINT AUTO_INCREMENT UNIQUE.
+	// SQLite only generates values for the primary key, so the
+	// sequence is declared INTEGER PRIMARY KEY AUTOINCREMENT and
+	// the id as VARCHAR(36) NOT NULL UNIQUE.
+	//
+	// Entries are claimed by conditionally updating their next
+	// attempt so concurrent relays never dispatch the same entry
+	// unless its claim expires.
+	SqlStore struct {
+		db          Executor
+		table       string
+		placeholder func(int) string
+	}
+
+	// Executor is satisfied by *sql.DB, *sql.Conn and *sql.Tx.
+	Executor interface {
+		ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+		QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	}
+)
+
+
+const defaultTable = "outbox"
+
+
+func (s *SqlStore) Save(
+	ctx     context.Context,
+	entries ...Entry,
+) error {
+	query := fmt.Sprintf(
+		"INSERT INTO %s (id, message, attempts, created_at, next_attempt, dispatched_at, last_error) VALUES (%s)",
+		s.table, s.params(1, 7))
+	for _, e := range entries {
+		if _, err := s.db.ExecContext(ctx, query,
+			e.Id, string(e.Message), e.Attempts, nanos(e.CreatedAt),
+			nanos(e.NextAttempt), nanos(e.DispatchedAt), e.LastError,
+		); err != nil {
+			return fmt.Errorf("outbox: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *SqlStore) Claim(
+	ctx   context.Context,
+	now   time.Time,
+	until time.Time,
+	limit int,
+) ([]Entry, error) {
+	candidates, err := s.pending(ctx, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	// only the relay updating the next attempt it read owns the entry
+	query := fmt.Sprintf(
+		"UPDATE %s SET next_attempt = %s WHERE id = %s AND next_attempt = %s AND dispatched_at = 0",
+		s.table, s.placeholder(1), s.placeholder(2), s.placeholder(3))
+	claimed := candidates[:0]
+	for _, e := range candidates {
+		res, err := s.db.ExecContext(ctx, query, nanos(until), e.Id, nanos(e.NextAttempt))
+		if err != nil {
+			return nil, fmt.Errorf("outbox: %w", err)
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return nil, fmt.Errorf("outbox: %w", err)
+		} else if n == 1 {
+			e.NextAttempt = until
+			claimed = append(claimed, e)
+		}
+	}
+	return claimed, nil
+}
+
+// pending returns up to limit undispatched entries due for
+// an attempt at or before now.
+func (s *SqlStore) pending(
+	ctx   context.Context,
+	now   time.Time,
+	limit int,
+) ([]Entry, error) {
+	query := fmt.Sprintf(
+		"SELECT id, sequence, message, attempts, created_at, next_attempt, last_error FROM %s WHERE dispatched_at = 0 AND next_attempt <= %s ORDER BY sequence",
+		s.table, s.placeholder(1))
+	if limit > 0 {
+		query += " LIMIT " + strconv.Itoa(limit)
+	}
+	rows, err := s.db.QueryContext(ctx, query, nanos(now))
+	if err != nil {
+		return nil, fmt.Errorf("outbox: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	var pending []Entry
+	for rows.Next() {
+		var e Entry
+		var message string
+		var createdAt, nextAttempt int64
+		if err := rows.Scan(&e.Id, &e.Sequence, &message, &e.Attempts,
+			&createdAt, &nextAttempt, &e.LastError); err != nil {
+			return nil, fmt.Errorf("outbox: %w", err)
+		}
+		e.Message     = []byte(message)
+		e.CreatedAt   = time.Unix(0, createdAt).UTC()
+		e.NextAttempt = time.Unix(0, nextAttempt).UTC()
+		pending = append(pending, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("outbox: %w", err)
+	}
+	return pending, nil
+}
+
+func (s *SqlStore) Dispatched(
+	ctx context.Context,
+	id  string,
+	at  time.Time,
+) error {
+	query := fmt.Sprintf("UPDATE %s SET dispatched_at = %s WHERE id = %s",
+		s.table, s.placeholder(1), s.placeholder(2))
+	if _, err := s.db.ExecContext(ctx, query, nanos(at), id); err != nil {
+		return fmt.Errorf("outbox: %w", err)
+	}
+	return nil
+}
+
+func (s *SqlStore) Failed(
+	ctx   context.Context,
+	entry Entry,
+) error {
+	query := fmt.Sprintf(
+		"UPDATE %s SET attempts = %s, next_attempt = %s, last_error = %s WHERE id = %s",
+		s.table, s.placeholder(1), s.placeholder(2), s.placeholder(3), s.placeholder(4))
+	if _, err := s.db.ExecContext(ctx, query,
+		entry.Attempts, nanos(entry.NextAttempt), entry.LastError, entry.Id,
+	); err != nil {
+		return fmt.Errorf("outbox: %w", err)
+	}
+	return nil
+}
+
+// WithTx returns a SqlStore bound to the transaction.
+// Saving entries through it makes them part of the
+// transaction so they are only relayed if it commits.
+func (s *SqlStore) WithTx(tx *sql.Tx) *SqlStore {
+	if tx == nil {
+		panic("tx cannot be nil")
+	}
+	return &SqlStore{db: tx, table: s.table, placeholder: s.placeholder}
+}
+
+func (s *SqlStore) params(from, count int) string {
+	params := make([]string, count)
+	for i := range params {
+		params[i] = s.placeholder(from + i)
+	}
+	return strings.Join(params, ", ")
+}
+
+
+// NewSqlStore creates a SqlStore for the table.
+// If table is empty, "outbox" is used.
+func NewSqlStore(
+	db    Executor,
+	table string,
+	placeholder ...func(int) string,
+) *SqlStore {
+	if db == nil {
+		panic("db cannot be nil")
+	}
+	if len(table) == 0 {
+		table = defaultTable
+	}
+	store := &SqlStore{db: db, table: table, placeholder: QuestionPlaceholder}
+	if len(placeholder) > 0 && placeholder[0] != nil {
+		store.placeholder = placeholder[0]
+	}
+	return store
+}
+
+// QuestionPlaceholder formats positional parameters as ?.
+func QuestionPlaceholder(int) string {
+	return "?"
+}
+
+// DollarPlaceholder formats positional parameters as $n.
+func DollarPlaceholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+func nanos(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
@@ -0,0 +1,317 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/api/json/stdjson"
+	"github.com/miruken-go/miruken/api/outbox"
+	"github.com/miruken-go/miruken/cascade"
+	"github.com/miruken-go/miruken/creates"
+	"github.com/miruken-go/miruken/handles"
+	"github.com/miruken-go/miruken/provides"
+	"github.com/stretchr/testify/suite"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//go:generate $GOPATH/bin/miruken -tests
+
+type (
+	PlaceOrder struct {
+		Id int
+	}
+
+	ShipOrder struct {
+		Id int
+	}
+
+	OrderPlaced struct {
+		Id int
+	}
+
+	OrderShipped struct {
+		Id int
+	}
+
+	OrderHandler struct {
+		failures int32
+		attempts atomic.Int32
+		events   chan int
+	}
+
+	ShippingHandler struct {}
+)
+
+
+// OrderHandler
+
+func (o *OrderHandler) Place(
+	_ *handles.It, place PlaceOrder,
+	ctx miruken.HandleContext,
+) error {
+	if place.Id < 0 {
+		return errors.New("invalid order")
+	}
+	_, err := api.Publish(ctx.Composer, OrderPlaced{place.Id})
+	return err
+}
+
+func (o *OrderHandler) Placed(
+	_ *handles.It, placed OrderPlaced,
+) error {
+	if o.attempts.Add(1) <= o.failures {
+		return errors.New("notification service unavailable")
+	}
+	if o.events != nil {
+		o.events <- placed.Id
+	}
+	return nil
+}
+
+func (o *OrderHandler) Shipped(
+	_ *handles.It, shipped OrderShipped,
+) {
+	if o.events != nil {
+		o.events <- -shipped.Id
+	}
+}
+
+func (o *OrderHandler) New(
+	_*struct{
+		_ creates.It `key:"test.OrderPlaced"`
+		_ creates.It `key:"test.OrderShipped"`
+	  }, create *creates.It,
+) any {
+	switch create.Key() {
+	case "test.OrderPlaced":
+		return new(OrderPlaced)
+	case "test.OrderShipped":
+		return new(OrderShipped)
+	}
+	return nil
+}
+
+
+// ShippingHandler
+
+func (s *ShippingHandler) Ship(
+	_ *handles.It, ship ShipOrder,
+) *cascade.Messages {
+	return cascade.Publish(OrderShipped{ship.Id})
+}
+
+
+type OutboxTestSuite struct {
+	suite.Suite
+}
+
+func (suite *OutboxTestSuite) Setup(
+	orders *OrderHandler,
+	config ...func(*outbox.Installer),
+) (miruken.Handler, *outbox.Relay) {
+	handler, _ := miruken.Setup(
+		outbox.Feature(config...), TestFeature, stdjson.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Handlers(orders).
+		Handler()
+	relay, _, _ := provides.Type[*outbox.Relay](handler)
+	return handler, relay
+}
+
+func (suite *OutboxTestSuite) TestOutbox() {
+	ctx := context.Background()
+
+	suite.Run("Capture", func() {
+		orders := &OrderHandler{events: make(chan int, 1)}
+		handler, _ := suite.Setup(orders)
+		uow := outbox.Begin(handler)
+		suite.Nil(post(uow, PlaceOrder{1}))
+		suite.Equal([]any{OrderPlaced{1}}, uow.Messages())
+		select {
+		case <-orders.events:
+			suite.Fail("message should not be published before commit")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+
+	suite.Run("Commit", func() {
+		orders := &OrderHandler{events: make(chan int, 1)}
+		store  := outbox.NewMemoryStore()
+		handler, relay := suite.Setup(orders, outbox.WithStore(store))
+		defer relay.Close()
+		err := outbox.Run(ctx, handler, store, func(h miruken.Handler) error {
+			return post(h, PlaceOrder{2})
+		})
+		suite.Nil(err)
+		suite.Equal(2, suite.wait(orders.events))
+		suite.Eventually(func() bool {
+			return len(store.Entries()) == 0
+		}, 5*time.Second, 5*time.Millisecond)
+	})
+
+	suite.Run("Cascade", func() {
+		orders := &OrderHandler{events: make(chan int, 1)}
+		store  := outbox.NewMemoryStore()
+		handler, relay := suite.Setup(orders, outbox.WithStore(store))
+		defer relay.Close()
+		err := outbox.Run(ctx, handler, store, func(h miruken.Handler) error {
+			return post(h, ShipOrder{3})
+		})
+		suite.Nil(err)
+		suite.Equal(-3, suite.wait(orders.events))
+	})
+
+	suite.Run("Requests", func() {
+		orders := &OrderHandler{events: make(chan int, 2)}
+		handler, _ := suite.Setup(orders)
+		uow := outbox.Begin(handler)
+		_, _, err := handles.RequestAll[any](uow, OrderPlaced{4})
+		suite.Nil(err)
+		suite.Empty(uow.Messages())
+		suite.Equal(4, suite.wait(orders.events))
+	})
+
+	suite.Run("Sequence", func() {
+		orders := &OrderHandler{}
+		store  := outbox.NewMemoryStore()
+		handler, _ := suite.Setup(orders)
+		uow := outbox.Begin(handler)
+		for i := 1; i <= 5; i++ {
+			_, err := api.Publish(uow, OrderPlaced{i})
+			suite.Nil(err)
+		}
+		suite.Nil(uow.Commit(ctx, store))
+		now := time.Now()
+		pending, err := store.Claim(ctx, now, now.Add(time.Minute), 0)
+		suite.Nil(err)
+		suite.Len(pending, 5)
+		for i, entry := range pending {
+			suite.Equal(int64(i+1), entry.Sequence)
+			suite.Contains(string(entry.Message), fmt.Sprintf(`"Id":%d`, i+1))
+		}
+	})
+
+	suite.Run("Claim", func() {
+		store := outbox.NewMemoryStore()
+		now   := time.Now()
+		suite.Nil(store.Save(ctx,
+			outbox.Entry{Id: "1", NextAttempt: now},
+			outbox.Entry{Id: "2", NextAttempt: now}))
+		claimed, err := store.Claim(ctx, now, now.Add(time.Minute), 1)
+		suite.Nil(err)
+		suite.Len(claimed, 1)
+		suite.Equal("1", claimed[0].Id)
+		claimed, err = store.Claim(ctx, now, now.Add(time.Minute), 0)
+		suite.Nil(err)
+		suite.Len(claimed, 1)
+		suite.Equal("2", claimed[0].Id)
+		claimed, err = store.Claim(ctx, now, now.Add(time.Minute), 0)
+		suite.Nil(err)
+		suite.Empty(claimed)
+
+		// expired claims are claimed again
+		claimed, err = store.Claim(ctx, now.Add(2*time.Minute), now.Add(3*time.Minute), 0)
+		suite.Nil(err)
+		suite.Len(claimed, 2)
+
+		suite.Nil(store.Dispatched(ctx, "1", now))
+		entries := store.Entries()
+		suite.Len(entries, 1)
+		suite.Equal("2", entries[0].Id)
+	})
+
+	suite.Run("Rollback", func() {
+		orders := &OrderHandler{events: make(chan int, 1)}
+		store  := outbox.NewMemoryStore()
+		handler, relay := suite.Setup(orders, outbox.WithStore(store))
+		defer relay.Close()
+		err := outbox.Run(ctx, handler, store, func(h miruken.Handler) error {
+			if err := post(h, PlaceOrder{4}); err != nil {
+				return err
+			}
+			return errors.New("rollback")
+		})
+		suite.EqualError(err, "rollback")
+		suite.Empty(store.Entries())
+	})
+
+	suite.Run("Retry", func() {
+		orders := &OrderHandler{failures: 2, events: make(chan int, 1)}
+		store  := outbox.NewMemoryStore()
+		handler, relay := suite.Setup(orders,
+			outbox.WithStore(store),
+			outbox.Configure(outbox.Config{
+				PollInterval: 5 * time.Millisecond,
+				MinBackoff:   time.Millisecond,
+				MaxBackoff:   5 * time.Millisecond,
+			}))
+		defer relay.Close()
+		err := outbox.Run(ctx, handler, store, func(h miruken.Handler) error {
+			return post(h, PlaceOrder{5})
+		})
+		suite.Nil(err)
+		suite.Equal(5, suite.wait(orders.events))
+		suite.Eventually(func() bool {
+			return len(store.Entries()) == 0
+		}, 5*time.Second, 5*time.Millisecond)
+	})
+
+	suite.Run("Abandon", func() {
+		orders := &OrderHandler{failures: 100}
+		store  := outbox.NewMemoryStore()
+		handler, relay := suite.Setup(orders,
+			outbox.WithStore(store),
+			outbox.Configure(outbox.Config{
+				PollInterval: 5 * time.Millisecond,
+				MaxAttempts:  2,
+				MinBackoff:   time.Millisecond,
+				MaxBackoff:   time.Millisecond,
+			}))
+		defer relay.Close()
+		err := outbox.Run(ctx, handler, store, func(h miruken.Handler) error {
+			return post(h, PlaceOrder{6})
+		})
+		suite.Nil(err)
+		suite.Eventually(func() bool {
+			entries := store.Entries()
+			return len(entries) == 1 && entries[0].NextAttempt.Equal(outbox.Abandoned)
+		}, 5*time.Second, 5*time.Millisecond)
+		entry := store.Entries()[0]
+		suite.Equal(2, entry.Attempts)
+		suite.Equal("notification service unavailable", entry.LastError)
+		suite.True(entry.DispatchedAt.IsZero())
+	})
+
+	suite.Run("Completed", func() {
+		handler, _ := suite.Setup(&OrderHandler{})
+		uow := outbox.Begin(handler)
+		uow.Rollback()
+		suite.ErrorIs(uow.Commit(ctx, outbox.NewMemoryStore()), outbox.ErrCompleted)
+	})
+}
+
+func (suite *OutboxTestSuite) wait(events chan int) int {
+	select {
+	case id := <-events:
+		return id
+	case <-time.After(5 * time.Second):
+		suite.Fail("timed out waiting for delivery")
+		return 0
+	}
+}
+
+func post(handler miruken.Handler, message any) error {
+	pv, err := api.Post(handler, message)
+	if err == nil && pv != nil {
+		_, err = pv.Await()
+	}
+	return err
+}
+
+func TestOutboxTestSuite(t *testing.T) {
+	suite.Run(t, new(OutboxTestSuite))
+}
@@ -0,0 +1,270 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/miruken-go/miruken/api/outbox"
+	"github.com/stretchr/testify/suite"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type (
+	// statement is a query executed against the database.
+	statement struct {
+		query string
+		args  []any
+	}
+
+	// outcome is the result of a statement.
+	outcome struct {
+		columns  []string
+		rows     [][]driver.Value
+		affected int64
+	}
+
+	// database records the statements and answers
+	// them using the respond function.
+	database struct {
+		lock       sync.Mutex
+		statements []statement
+		respond    func(statement) (outcome, error)
+	}
+
+	fakeDriver struct{}
+
+	fakeConn struct {
+		db *database
+	}
+
+	fakeRows struct {
+		outcome
+		index int
+	}
+)
+
+
+var (
+	databases    sync.Map
+	databaseIds  int
+	databaseLock sync.Mutex
+)
+
+func init() {
+	sql.Register("outbox-fake", fakeDriver{})
+}
+
+
+// database
+
+func (d *database) exec(query string, args []driver.NamedValue) (outcome, error) {
+	stmt := statement{query: query}
+	for _, arg := range args {
+		stmt.args = append(stmt.args, arg.Value)
+	}
+	d.lock.Lock()
+	d.statements = append(d.statements, stmt)
+	d.lock.Unlock()
+	if d.respond == nil {
+		return outcome{affected: 1}, nil
+	}
+	return d.respond(stmt)
+}
+
+func (d *database) recorded() []statement {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return append([]statement(nil), d.statements...)
+}
+
+
+// fakeDriver
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	db, ok := databases.Load(name)
+	if !ok {
+		return nil, errors.New("unknown database " + name)
+	}
+	return &fakeConn{db.(*database)}, nil
+}
+
+
+// fakeConn
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepare not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions not supported")
+}
+
+func (c *fakeConn) ExecContext(
+	_     context.Context,
+	query string,
+	args  []driver.NamedValue,
+) (driver.Result, error) {
+	out, err := c.db.exec(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(out.affected), nil
+}
+
+func (c *fakeConn) QueryContext(
+	_     context.Context,
+	query string,
+	args  []driver.NamedValue,
+) (driver.Rows, error) {
+	out, err := c.db.exec(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{outcome: out}, nil
+}
+
+
+// fakeRows
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.index >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.index])
+	r.index++
+	return nil
+}
+
+
+type SqlStoreTestSuite struct {
+	suite.Suite
+}
+
+func (suite *SqlStoreTestSuite) Open(
+	respond func(statement) (outcome, error),
+) (*sql.DB, *database) {
+	databaseLock.Lock()
+	databaseIds++
+	name := "db" + strconv.Itoa(databaseIds)
+	databaseLock.Unlock()
+	db := &database{respond: respond}
+	databases.Store(name, db)
+	conn, err := sql.Open("outbox-fake", name)
+	suite.Require().Nil(err)
+	suite.T().Cleanup(func() { _ = conn.Close() })
+	return conn, db
+}
+
+func (suite *SqlStoreTestSuite) TestSqlStore() {
+	ctx     := context.Background()
+	now     := time.Unix(0, 1000).UTC()
+	until   := time.Unix(0, 5000).UTC()
+	columns := []string{"id", "sequence", "message", "attempts", "created_at", "next_attempt", "last_error"}
+
+	suite.Run("Save", func() {
+		conn, db := suite.Open(nil)
+		store := outbox.NewSqlStore(conn, "")
+		suite.Nil(store.Save(ctx, outbox.Entry{
+			Id:          "1",
+			Message:     []byte(`{"payload":1}`),
+			CreatedAt:   now,
+			NextAttempt: now,
+		}))
+		statements := db.recorded()
+		suite.Len(statements, 1)
+		suite.Equal("INSERT INTO outbox (id, message, attempts, created_at, next_attempt, dispatched_at, last_error) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			statements[0].query)
+		suite.Equal([]any{"1", `{"payload":1}`, int64(0), int64(1000), int64(1000), int64(0), ""},
+			statements[0].args)
+	})
+
+	suite.Run("Claim", func() {
+		conn, db := suite.Open(func(stmt statement) (outcome, error) {
+			if strings.HasPrefix(stmt.query, "SELECT") {
+				return outcome{columns: columns, rows: [][]driver.Value{
+					{"1", int64(1), `{"payload":1}`, int64(0), int64(1000), int64(1000), ""},
+					{"2", int64(2), `{"payload":2}`, int64(1), int64(1000), int64(900), "failed"},
+				}}, nil
+			}
+			// another relay claimed the second entry
+			if stmt.args[1] == "2" {
+				return outcome{}, nil
+			}
+			return outcome{affected: 1}, nil
+		})
+		store := outbox.NewSqlStore(conn, "messages", outbox.DollarPlaceholder)
+		claimed, err := store.Claim(ctx, now, until, 10)
+		suite.Nil(err)
+		suite.Len(claimed, 1)
+		suite.Equal("1", claimed[0].Id)
+		suite.Equal(int64(1), claimed[0].Sequence)
+		suite.Equal(`{"payload":1}`, string(claimed[0].Message))
+		suite.Equal(until, claimed[0].NextAttempt)
+		statements := db.recorded()
+		suite.Len(statements, 3)
+		suite.Equal("SELECT id, sequence, message, attempts, created_at, next_attempt, last_error FROM messages WHERE dispatched_at = 0 AND next_attempt <= $1 ORDER BY sequence LIMIT 10",
+			statements[0].query)
+		suite.Equal([]any{int64(1000)}, statements[0].args)
+		suite.Equal("UPDATE messages SET next_attempt = $1 WHERE id = $2 AND next_attempt = $3 AND dispatched_at = 0",
+			statements[1].query)
+		suite.Equal([]any{int64(5000), "1", int64(1000)}, statements[1].args)
+		suite.Equal([]any{int64(5000), "2", int64(900)}, statements[2].args)
+	})
+
+	suite.Run("Dispatched", func() {
+		conn, db := suite.Open(nil)
+		store := outbox.NewSqlStore(conn, "")
+		suite.Nil(store.Dispatched(ctx, "1", until))
+		statements := db.recorded()
+		suite.Len(statements, 1)
+		suite.Equal("UPDATE outbox SET dispatched_at = ? WHERE id = ?", statements[0].query)
+		suite.Equal([]any{int64(5000), "1"}, statements[0].args)
+	})
+
+	suite.Run("Failed", func() {
+		conn, db := suite.Open(nil)
+		store := outbox.NewSqlStore(conn, "")
+		suite.Nil(store.Failed(ctx, outbox.Entry{
+			Id:          "1",
+			Attempts:    2,
+			NextAttempt: until,
+			LastError:   "unavailable",
+		}))
+		statements := db.recorded()
+		suite.Len(statements, 1)
+		suite.Equal("UPDATE outbox SET attempts = ?, next_attempt = ?, last_error = ? WHERE id = ?",
+			statements[0].query)
+		suite.Equal([]any{int64(2), int64(5000), "unavailable", "1"}, statements[0].args)
+	})
+
+	suite.Run("Error", func() {
+		conn, _ := suite.Open(func(statement) (outcome, error) {
+			return outcome{}, errors.New("connection lost")
+		})
+		store := outbox.NewSqlStore(conn, "")
+		_, err := store.Claim(ctx, now, until, 0)
+		suite.EqualError(err, "outbox: connection lost")
+	})
+}
+
+func TestSqlStoreTestSuite(t *testing.T) {
+	suite.Run(t, new(SqlStoreTestSuite))
+}
@@ -45,6 +45,7 @@ type (
 const (
 	PolymorphismNone Polymorphism = 0
 	PolymorphismRoot Polymorphism = 1 << iota
+	PolymorphismAll
 )
 
 
@@ -54,6 +55,12 @@ var (
 		Polymorphism: miruken.Set(PolymorphismRoot),
 	})
 
+	// PolymorphicAll instructs type information to be included
+	// for the root and all nested interface values.
+	PolymorphicAll = miruken.Options(Options{
+		Polymorphism: miruken.Set(PolymorphismAll),
+	})
+
 	// NoPolymorphism instructs type information to be suppressed.
 	NoPolymorphism = miruken.Options(Options{
 		Polymorphism: miruken.Set(PolymorphismNone),
@@ -64,18 +71,28 @@ var (
 )
 
 // TypeInfo uses package and name to generate type metadata.
+// Types declaring a stable type id use it instead.
 func (m *GoPolymorphism) TypeInfo(
 	_*struct{
 		maps.Format `to:"type:info"`
 	  }, maps *maps.It,
 ) (TypeFieldInfo, error) {
-	val := reflect.TypeOf(maps.Source()).String()
+	typ := reflect.TypeOf(maps.Source())
+	val := typ.String()
 	if strings.HasPrefix(val, "*") {
 		val = val[1:]
 	}
 	if strings.HasPrefix(val, "[]*") {
 		val = "[]" + val[3:]
 	}
+	// prefer stable type ids over go type names
+	if id, ok := TypeIdOf(typ); ok {
+		val = id
+	} else if typ.Kind() == reflect.Slice {
+		if id, ok := TypeIdOf(typ.Elem()); ok {
+			val = "[]" + id
+		}
+	}
 	return TypeFieldInfo{
 		TypeField:   "@type",
 		TypeValue:   val,
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"encoding"
+	"fmt"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/internal"
+	"net/textproto"
+	"reflect"
+)
+
+type (
+	// StashKey declares a Stash entry that is propagated across
+	// process boundaries in message headers.
+	// The value must be a string or implement encoding.TextMarshaler
+	// and encoding.TextUnmarshaler (pointer receiver).
+	StashKey struct {
+		Name string
+		Key  any
+		Type reflect.Type
+	}
+
+	// StashHeaderError reports a propagated Stash value that
+	// could not be written to or read from a message header.
+	StashHeaderError struct {
+		Name   string
+		Reason error
+	}
+)
+
+
+// StashHeaderPrefix prefixes the headers carrying Stash values.
+const StashHeaderPrefix = "Miruken-Stash-"
+
+
+func (e *StashHeaderError) Error() string {
+	return fmt.Sprintf("stash header %q: %s", e.Name, e.Reason.Error())
+}
+
+func (e *StashHeaderError) Unwrap() error {
+	return e.Reason
+}
+
+
+// Header returns the canonical name of the header carrying the value.
+func (k StashKey) Header() string {
+	return textproto.CanonicalMIMEHeaderKey(StashHeaderPrefix + k.Name)
+}
+
+func (k StashKey) encode(val any) (string, error) {
+	if m, ok := val.(encoding.TextMarshaler); ok {
+		text, err := m.MarshalText()
+		return string(text), err
+	}
+	if v := reflect.ValueOf(val); v.Kind() == reflect.String {
+		return v.String(), nil
+	}
+	return "", fmt.Errorf("%T is not serializable", val)
+}
+
+func (k StashKey) decode(text string) (any, error) {
+	val := reflect.New(k.Type)
+	if u, ok := val.Interface().(encoding.TextUnmarshaler); ok {
+		if err := u.UnmarshalText([]byte(text)); err != nil {
+			return nil, err
+		}
+	} else if k.Type.Kind() == reflect.String {
+		val.Elem().SetString(text)
+	} else {
+		return nil, fmt.Errorf("%v is not serializable", k.Type)
+	}
+	return val.Elem().Interface(), nil
+}
+
+
+// PropagateType declares the Stash entry keyed by type T serializable
+// so it is propagated in the named header.
+func PropagateType[T any](name string) StashKey {
+	typ := internal.TypeOf[T]()
+	return PropagateKey[T](typ, name)
+}
+
+// PropagateKey declares the Stash entry with key serializable
+// so it is propagated in the named header.
+func PropagateKey[T any](key any, name string) StashKey {
+	if internal.IsNil(key) {
+		panic("key cannot be nil")
+	}
+	if len(name) == 0 {
+		panic("name cannot be empty")
+	}
+	typ := internal.TypeOf[T]()
+	if typ.Kind() != reflect.String && !(typ.Implements(textMarshalerType) &&
+		reflect.PointerTo(typ).Implements(textUnmarshalerType)) {
+		panic(fmt.Sprintf("stash value %v is not serializable", typ))
+	}
+	return StashKey{Name: name, Key: key, Type: typ}
+}
+
+// Propagate returns a miruken.Builder that propagates the Stash
+// entries across process boundaries.
+func Propagate(keys ...StashKey) miruken.Builder {
+	return miruken.Options(Options{Propagate: keys})
+}
+
+// StashToHeader writes the propagated Stash entries to the header.
+// Entries not in the Stash are skipped.
+func StashToHeader(
+	handler miruken.Handler,
+	header  textproto.MIMEHeader,
+) error {
+	if internal.IsNil(handler) {
+		panic("handler cannot be nil")
+	}
+	if header == nil {
+		panic("header cannot be nil")
+	}
+	options, _ := miruken.GetOptions[Options](handler)
+	for _, key := range options.Propagate {
+		if val, ok := StashGetKey(handler, key.Key); ok && !internal.IsNil(val) {
+			text, err := key.encode(val)
+			if err != nil {
+				return &StashHeaderError{key.Name, err}
+			}
+			header.Set(key.Header(), text)
+		}
+	}
+	return nil
+}
+
+// StashFromHeader restores the propagated Stash entries from the header.
+// Entries missing from the header are skipped.
+func StashFromHeader(
+	handler miruken.Handler,
+	header  textproto.MIMEHeader,
+) error {
+	if internal.IsNil(handler) {
+		panic("handler cannot be nil")
+	}
+	options, _ := miruken.GetOptions[Options](handler)
+	for _, key := range options.Propagate {
+		if text := header.Get(key.Header()); len(text) > 0 {
+			val, err := key.decode(text)
+			if err != nil {
+				return &StashHeaderError{key.Name, err}
+			}
+			if err = StashPutKey(handler, key.Key, val); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+
+var (
+	textMarshalerType   = internal.TypeOf[encoding.TextMarshaler]()
+	textUnmarshalerType = internal.TypeOf[encoding.TextUnmarshaler]()
+)
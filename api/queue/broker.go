@@ -0,0 +1,220 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/handles"
+	"github.com/miruken-go/miruken/promise"
+	"github.com/miruken-go/miruken/provides"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Config customizes the behavior of a queue.
+	Config struct {
+		Concurrency       int
+		VisibilityTimeout time.Duration
+		MaxDeliveries     int
+		PollInterval      time.Duration
+	}
+
+	// Broker manages named local queues and routes
+	// messages into them.  Messages are dispatched by
+	// consumer workers using api.Send or api.Publish.
+	Broker struct {
+		dir     string
+		lock    sync.Mutex
+		configs map[string]Config
+		queues  map[string]*Queue
+		handler miruken.Handler
+		logger  logr.Logger
+		closed  bool
+	}
+)
+
+
+const (
+	defaultDirectory         = "queues"
+	defaultConcurrency       = 1
+	defaultVisibilityTimeout = 30 * time.Second
+	defaultMaxDeliveries     = 5
+	defaultPollInterval      = 100 * time.Millisecond
+)
+
+
+var (
+	ErrMissingQueueName = errors.New("queue: the route is missing the queue name")
+	ErrInvalidQueueName = errors.New("queue: the queue name is invalid")
+	ErrBrokerClosed     = errors.New("queue: the broker is closed")
+)
+
+
+// NoConstructor prevents Broker from being created implicitly.
+func (b *Broker) NoConstructor() {}
+
+func (b *Broker) Route(
+	_*struct{
+		handles.It
+		api.Routes `scheme:"queue"`
+	  }, routed api.Routed,
+	ctx miruken.HandleContext,
+) *promise.Promise[any] {
+	name, err := QueueName(routed.Route)
+	if err != nil {
+		return promise.Reject[any](err)
+	}
+	composer := miruken.BuildUp(ctx.Composer, api.Polymorphic)
+	encoded, err := api.EncodeMessage(composer, routed.Message)
+	if err != nil {
+		return promise.Reject[any](fmt.Errorf("queue: %w", err))
+	}
+	q, err := b.Queue(name)
+	if err != nil {
+		return promise.Reject[any](err)
+	}
+	if _, err := q.Enqueue(encoded, ctx.Greedy); err != nil {
+		return promise.Reject[any](err)
+	}
+	return promise.Resolve[any](nil)
+}
+
+// Queue returns the named queue, opening it if necessary.
+func (b *Broker) Queue(name string) (*Queue, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return nil, ErrBrokerClosed
+	}
+	if q, ok := b.queues[name]; ok {
+		return q, nil
+	}
+	config := b.configs[name]
+	path := filepath.Join(b.dir, name+".log")
+	q, err := openQueue(name, path, config.withDefaults(), b.logger)
+	if err != nil {
+		return nil, err
+	}
+	b.queues[name] = q
+	if handler := b.handler; handler != nil {
+		q.start(handler)
+	}
+	return q, nil
+}
+
+// Start opens the configured queues and starts the consumer
+// workers that dispatch messages using the handler.
+func (b *Broker) Start(handler miruken.Handler) error {
+	if handler == nil {
+		panic("handler cannot be nil")
+	}
+	b.lock.Lock()
+	if b.handler != nil {
+		b.lock.Unlock()
+		return nil
+	}
+	if b.logger.GetSink() == nil {
+		b.logger, _, _ = provides.Type[logr.Logger](handler)
+	}
+	b.handler = miruken.BuildUp(handler, api.Polymorphic)
+	for _, q := range b.queues {
+		q.start(b.handler)
+	}
+	names := make([]string, 0, len(b.configs))
+	for name := range b.configs {
+		names = append(names, name)
+	}
+	b.lock.Unlock()
+	for _, name := range names {
+		if _, err := b.Queue(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close stops all consumer workers and closes the queue logs.
+func (b *Broker) Close() error {
+	b.lock.Lock()
+	queues := b.queues
+	b.queues = make(map[string]*Queue)
+	b.closed = true
+	b.lock.Unlock()
+	var errs []error
+	for _, q := range queues {
+		if err := q.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+
+// Config
+
+func (c Config) withDefaults() Config {
+	if c.Concurrency <= 0 {
+		c.Concurrency = defaultConcurrency
+	}
+	if c.VisibilityTimeout <= 0 {
+		c.VisibilityTimeout = defaultVisibilityTimeout
+	}
+	if c.MaxDeliveries <= 0 {
+		c.MaxDeliveries = defaultMaxDeliveries
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = defaultPollInterval
+	}
+	return c
+}
+
+
+// QueueName extracts the queue name from a route.
+// Both "queue:name" and "queue://name" forms are accepted.
+// Names cannot contain path separators or "..".
+func QueueName(route string) (string, error) {
+	u, err := url.Parse(route)
+	if err != nil {
+		return "", fmt.Errorf("queue: %w", err)
+	}
+	name := u.Opaque
+	if len(name) == 0 {
+		name = u.Host + u.Path
+	}
+	if len(name) == 0 {
+		return "", ErrMissingQueueName
+	}
+	if err := validateName(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// validateName ensures the queue log stays in the queue directory.
+func validateName(name string) error {
+	if len(name) == 0 {
+		return ErrMissingQueueName
+	}
+	if strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") || !filepath.IsLocal(name) {
+		return fmt.Errorf("%w: %q", ErrInvalidQueueName, name)
+	}
+	return nil
+}
+
+// To returns a route to the named queue.
+func To(name string) string {
+	if len(name) == 0 {
+		panic("name cannot be empty")
+	}
+	return "queue:" + name
+}
+
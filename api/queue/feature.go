@@ -0,0 +1,69 @@
+package queue
+
+import (
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+)
+
+// Installer configures durable queue support.
+type Installer struct {
+	broker *Broker
+}
+
+func (i *Installer) DependsOn() []miruken.Feature {
+	return []miruken.Feature{api.Feature()}
+}
+
+func (i *Installer) Install(setup *miruken.SetupBuilder) error {
+	if setup.Tag(&featureTag) {
+		setup.Specs(&Broker{}).
+			  Handlers(i.broker)
+	}
+	return nil
+}
+
+// AfterInstall starts the consumer workers once the
+// handler is available to dispatch messages.
+func (i *Installer) AfterInstall(
+	_ *miruken.SetupBuilder,
+	handler miruken.Handler,
+) error {
+	return i.broker.Start(handler)
+}
+
+// Directory sets the directory the queue logs are persisted in.
+func Directory(dir string) func(*Installer) {
+	if len(dir) == 0 {
+		panic("dir cannot be empty")
+	}
+	return func(installer *Installer) {
+		installer.broker.dir = dir
+	}
+}
+
+// Configure customizes the named queue.
+func Configure(name string, config Config) func(*Installer) {
+	if len(name) == 0 {
+		panic("name cannot be empty")
+	}
+	return func(installer *Installer) {
+		installer.broker.configs[name] = config
+	}
+}
+
+// Feature configures durable queue support.
+func Feature(config ...func(*Installer)) miruken.Feature {
+	installer := &Installer{broker: &Broker{
+		dir:     defaultDirectory,
+		configs: make(map[string]Config),
+		queues:  make(map[string]*Queue),
+	}}
+	for _, configure := range config {
+		if configure != nil {
+			configure(installer)
+		}
+	}
+	return installer
+}
+
+var featureTag byte
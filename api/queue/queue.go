@@ -0,0 +1,392 @@
+package queue
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/internal/worker"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// Queue is a named local queue persisted to an append-only log.
+	// Messages remain in the log until acknowledged by a consumer.
+	// A message not acknowledged within the visibility timeout is
+	// redelivered until the maximum number of deliveries is reached.
+	// Undelivered messages are received from an offset in id order
+	// and delivered messages in the order their visibility expires.
+	Queue struct {
+		name      string
+		path      string
+		config    Config
+		logger    logr.Logger
+		lock      sync.Mutex
+		file      *os.File
+		nextId    uint64
+		items     map[uint64]*item
+		ready     []*item
+		offset    int
+		delivered []*item
+		acked     int
+		worker    worker.Worker
+		closed    bool
+	}
+
+	// item is a message waiting in the queue.
+	item struct {
+		id        uint64
+		message   json.RawMessage
+		publish   bool
+		attempts  int
+		invisible time.Time
+	}
+
+	// record is a single entry in the queue log.
+	record struct {
+		Op       string          `json:"op"`
+		Id       uint64          `json:"id"`
+		Attempts int             `json:"attempts,omitempty"`
+		Publish  bool            `json:"publish,omitempty"`
+		Message  json.RawMessage `json:"message,omitempty"`
+	}
+)
+
+
+const (
+	opEnqueue = "enqueue"
+	opAck     = "ack"
+	opNack    = "nack"
+	opDead    = "dead"
+
+	// compactThreshold is the number of acknowledged records
+	// after which the log is rewritten.
+	compactThreshold = 1000
+)
+
+
+// Name returns the name of the queue.
+func (q *Queue) Name() string {
+	return q.name
+}
+
+// Len returns the number of unacknowledged messages.
+func (q *Queue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.items)
+}
+
+// Enqueue durably appends the encoded message to the queue.
+// If publish is true, the message is delivered to all consumers.
+func (q *Queue) Enqueue(
+	message json.RawMessage,
+	publish bool,
+) (uint64, error) {
+	q.lock.Lock()
+	if q.closed {
+		q.lock.Unlock()
+		return 0, ErrBrokerClosed
+	}
+	q.nextId++
+	id := q.nextId
+	rec := record{Op: opEnqueue, Id: id, Message: message, Publish: publish}
+	if err := q.append(rec); err != nil {
+		q.lock.Unlock()
+		return 0, err
+	}
+	it := &item{id: id, message: message, publish: publish}
+	q.items[id] = it
+	q.ready = append(q.ready, it)
+	q.lock.Unlock()
+	q.worker.Notify()
+	return id, nil
+}
+
+// Close stops the consumer workers, waits for the deliveries
+// in progress to settle and closes the log.
+func (q *Queue) Close() error {
+	q.lock.Lock()
+	if q.closed {
+		q.lock.Unlock()
+		return nil
+	}
+	q.closed = true
+	q.lock.Unlock()
+	q.worker.Close()
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	err := q.file.Close()
+	q.file = nil
+	return err
+}
+
+func (q *Queue) start(handler miruken.Handler) {
+	q.worker.Start(q.config.Concurrency, q.config.PollInterval, func(context.Context) {
+		for it := q.receive(); it != nil; it = q.receive() {
+			q.deliver(it, handler)
+		}
+	})
+}
+
+// receive returns the next visible message and hides it
+// from other consumers for the visibility timeout.
+func (q *Queue) receive() *item {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.closed {
+		return nil
+	}
+	now := time.Now()
+	var next *item
+	// the visibility timeout is fixed so the delivered
+	// messages expire in the order they were delivered
+	for len(q.delivered) > 0 && next == nil {
+		it := q.delivered[0]
+		if q.items[it.id] != it {
+			q.delivered[0] = nil
+			q.delivered = q.delivered[1:]
+		} else if it.invisible.After(now) {
+			break
+		} else {
+			q.delivered[0] = nil
+			q.delivered = q.delivered[1:]
+			next = it
+		}
+	}
+	for q.offset < len(q.ready) && next == nil {
+		it := q.ready[q.offset]
+		q.ready[q.offset] = nil
+		if q.offset++; q.offset == len(q.ready) {
+			q.ready, q.offset = q.ready[:0], 0
+		}
+		if q.items[it.id] == it {
+			next = it
+		}
+	}
+	if next != nil {
+		next.attempts++
+		next.invisible = now.Add(q.config.VisibilityTimeout)
+		q.delivered = append(q.delivered, next)
+		cp := *next
+		return &cp
+	}
+	return nil
+}
+
+func (q *Queue) deliver(it *item, handler miruken.Handler) {
+	if err := dispatch(it.message, it.publish, handler); err == nil {
+		q.settle(it, opAck)
+	} else if it.attempts >= q.config.MaxDeliveries {
+		q.logger.Error(err, "discarding queued message after the maximum deliveries",
+			"queue", q.name, "id", it.id, "attempts", it.attempts, "message", string(it.message))
+		q.settle(it, opDead)
+	} else {
+		q.settle(it, opNack)
+	}
+}
+
+// settle records the outcome of a delivery.  Deliveries
+// in progress when the queue is closed are still settled.
+func (q *Queue) settle(it *item, op string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.file == nil {
+		return
+	}
+	if _, ok := q.items[it.id]; !ok {
+		return
+	}
+	_ = q.append(record{Op: op, Id: it.id, Attempts: it.attempts})
+	if op == opNack {
+		return
+	}
+	delete(q.items, it.id)
+	if q.acked++; q.acked >= compactThreshold {
+		_ = q.compact()
+	}
+}
+
+// append writes the record to the log and syncs it to disk.
+// The queue lock must be held.
+func (q *Queue) append(rec record) error {
+	byt, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("queue %q: %w", q.name, err)
+	}
+	byt = append(byt, '\n')
+	if _, err = q.file.Write(byt); err != nil {
+		return fmt.Errorf("queue %q: %w", q.name, err)
+	}
+	if err = q.file.Sync(); err != nil {
+		return fmt.Errorf("queue %q: %w", q.name, err)
+	}
+	return nil
+}
+
+// compact rewrites the log with only the unacknowledged messages.
+// The queue lock must be held.
+func (q *Queue) compact() error {
+	tmp := q.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("queue %q: %w", q.name, err)
+	}
+	ids := make([]uint64, 0, len(q.items))
+	for id := range q.items {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, id := range ids {
+		it := q.items[id]
+		rec := record{Op: opEnqueue, Id: id, Message: it.message, Publish: it.publish}
+		if err = enc.Encode(rec); err == nil {
+			if it.attempts > 0 {
+				err = enc.Encode(record{Op: opNack, Id: id, Attempts: it.attempts})
+			}
+		}
+		if err != nil {
+			_ = f.Close()
+			return fmt.Errorf("queue %q: %w", q.name, err)
+		}
+	}
+	if err = w.Flush(); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("queue %q: %w", q.name, err)
+	}
+	if err = os.Rename(tmp, q.path); err != nil {
+		return fmt.Errorf("queue %q: %w", q.name, err)
+	}
+	if q.file != nil {
+		_ = q.file.Close()
+	}
+	if q.file, err = os.OpenFile(q.path, os.O_APPEND|os.O_WRONLY, 0o644); err != nil {
+		return fmt.Errorf("queue %q: %w", q.name, err)
+	}
+	q.acked = 0
+	return nil
+}
+
+
+// openQueue opens the queue log, recovering any unacknowledged
+// messages, and compacts it.
+func openQueue(
+	name   string,
+	path   string,
+	config Config,
+	logger logr.Logger,
+) (*Queue, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("queue %q: %w", name, err)
+	}
+	q := &Queue{
+		name:   name,
+		path:   path,
+		config: config,
+		logger: logger,
+		items:  make(map[uint64]*item),
+	}
+	if f, err := os.Open(path); err == nil {
+		err = q.recover(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("queue %q: %w", name, err)
+	}
+	if err := q.compact(); err != nil {
+		return nil, err
+	}
+	q.ready = make([]*item, 0, len(q.items))
+	for _, it := range q.items {
+		q.ready = append(q.ready, it)
+	}
+	sort.Slice(q.ready, func(i, j int) bool { return q.ready[i].id < q.ready[j].id })
+	return q, nil
+}
+
+// recover replays the log skipping corrupt records.  A record
+// without a newline was torn by a crash while being appended and
+// is discarded when the log is compacted.
+func (q *Queue) recover(f *os.File) error {
+	reader := bufio.NewReader(f)
+	for lineNo := 1; ; lineNo++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("queue %q: %w", q.name, err)
+		}
+		torn := err != nil && len(line) > 0
+		if len(line) == 0 {
+			break
+		}
+		var rec record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			if torn {
+				q.logger.V(1).Info("discarding torn queue record", "queue", q.name, "line", lineNo)
+				break
+			}
+			q.logger.Error(err, "skipping corrupt queue record", "queue", q.name, "line", lineNo)
+			continue
+		}
+		if rec.Id > q.nextId {
+			q.nextId = rec.Id
+		}
+		switch rec.Op {
+		case opEnqueue:
+			q.items[rec.Id] = &item{id: rec.Id, message: rec.Message, publish: rec.Publish}
+		case opNack:
+			if it, ok := q.items[rec.Id]; ok {
+				it.attempts = rec.Attempts
+			}
+		case opAck, opDead:
+			delete(q.items, rec.Id)
+		}
+		if torn {
+			break
+		}
+	}
+	return nil
+}
+
+func dispatch(
+	message json.RawMessage,
+	publish bool,
+	handler miruken.Handler,
+) error {
+	payload, err := api.DecodeMessage(handler, message)
+	if err != nil {
+		return err
+	}
+	if payload == nil {
+		return nil
+	}
+	if publish {
+		pv, err := api.Publish(handler, payload)
+		if err == nil && pv != nil {
+			_, err = pv.Await()
+		}
+		return err
+	}
+	_, pr, err := api.Send[any](handler, payload)
+	if err == nil && pr != nil {
+		_, err = pr.Await()
+	}
+	return err
+}
@@ -0,0 +1,275 @@
+package test
+
+import (
+	"errors"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/api/json/stdjson"
+	"github.com/miruken-go/miruken/api/queue"
+	"github.com/miruken-go/miruken/creates"
+	"github.com/miruken-go/miruken/handles"
+	"github.com/miruken-go/miruken/provides"
+	"github.com/stretchr/testify/suite"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//go:generate $GOPATH/bin/miruken -tests
+
+type (
+	PlaceOrder struct {
+		Id int
+	}
+
+	OrderPlaced struct {
+		Id int
+	}
+
+	OrderHandler struct {
+		failures int32
+		attempts atomic.Int32
+		placed   chan int
+		release  chan struct{}
+	}
+)
+
+
+// OrderHandler
+
+func (o *OrderHandler) Place(
+	_ *handles.It, place PlaceOrder,
+) error {
+	if o.attempts.Add(1) <= o.failures {
+		return errors.New("order service unavailable")
+	}
+	if o.release != nil {
+		<-o.release
+	}
+	if o.placed != nil {
+		o.placed <- place.Id
+	}
+	return nil
+}
+
+func (o *OrderHandler) Placed(
+	_ *handles.It, placed OrderPlaced,
+) {
+	if o.placed != nil {
+		o.placed <- -placed.Id
+	}
+}
+
+func (o *OrderHandler) New(
+	_*struct{
+		_ creates.It `key:"test.PlaceOrder"`
+		_ creates.It `key:"test.OrderPlaced"`
+	  }, create *creates.It,
+) any {
+	switch create.Key() {
+	case "test.PlaceOrder":
+		return new(PlaceOrder)
+	case "test.OrderPlaced":
+		return new(OrderPlaced)
+	}
+	return nil
+}
+
+
+type QueueTestSuite struct {
+	suite.Suite
+	dir string
+}
+
+func (suite *QueueTestSuite) SetupTest() {
+	suite.dir = suite.T().TempDir()
+}
+
+func (suite *QueueTestSuite) Setup(
+	orders *OrderHandler,
+	config ...func(*queue.Installer),
+) (miruken.Handler, *queue.Broker) {
+	config = append(config, queue.Directory(suite.dir))
+	handler, _ := miruken.Setup(
+		queue.Feature(config...), TestFeature, stdjson.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Handlers(orders).
+		Handler()
+	broker, _, _ := provides.Type[*queue.Broker](handler)
+	return handler, broker
+}
+
+func (suite *QueueTestSuite) TestQueue() {
+	suite.Run("Post", func() {
+		orders := &OrderHandler{placed: make(chan int, 1)}
+		handler, broker := suite.Setup(orders)
+		defer func() { suite.Nil(broker.Close()) }()
+		pv, err := api.Post(handler, api.RouteTo(PlaceOrder{1}, queue.To("orders")))
+		suite.Nil(err)
+		suite.NotNil(pv)
+		_, err = pv.Await()
+		suite.Nil(err)
+		suite.Equal(1, suite.wait(orders.placed))
+		_, err = os.Stat(filepath.Join(suite.dir, "orders.log"))
+		suite.Nil(err)
+	})
+
+	suite.Run("Publish", func() {
+		orders := &OrderHandler{placed: make(chan int, 1)}
+		handler, broker := suite.Setup(orders)
+		defer func() { suite.Nil(broker.Close()) }()
+		pv, err := api.Publish(handler, api.RouteTo(OrderPlaced{2}, "queue://events"))
+		suite.Nil(err)
+		_, err = pv.Await()
+		suite.Nil(err)
+		suite.Equal(-2, suite.wait(orders.placed))
+	})
+
+	suite.Run("Redeliver", func() {
+		orders := &OrderHandler{failures: 2, placed: make(chan int, 1)}
+		handler, broker := suite.Setup(orders,
+			queue.Configure("retries", queue.Config{
+				VisibilityTimeout: 20 * time.Millisecond,
+				PollInterval:      5 * time.Millisecond,
+			}))
+		defer func() { suite.Nil(broker.Close()) }()
+		pv, err := api.Post(handler, api.RouteTo(PlaceOrder{3}, queue.To("retries")))
+		suite.Nil(err)
+		_, err = pv.Await()
+		suite.Nil(err)
+		suite.Equal(3, suite.wait(orders.placed))
+		suite.Equal(int32(3), orders.attempts.Load())
+	})
+
+	suite.Run("Dead", func() {
+		orders := &OrderHandler{failures: 100}
+		handler, broker := suite.Setup(orders,
+			queue.Configure("dead", queue.Config{
+				VisibilityTimeout: 5 * time.Millisecond,
+				MaxDeliveries:     2,
+				PollInterval:      5 * time.Millisecond,
+			}))
+		defer func() { suite.Nil(broker.Close()) }()
+		pv, err := api.Post(handler, api.RouteTo(PlaceOrder{4}, queue.To("dead")))
+		suite.Nil(err)
+		_, err = pv.Await()
+		suite.Nil(err)
+		q, err := broker.Queue("dead")
+		suite.Nil(err)
+		suite.Eventually(func() bool {
+			return q.Len() == 0
+		}, 5*time.Second, 5*time.Millisecond)
+		suite.Equal(int32(2), orders.attempts.Load())
+	})
+
+	suite.Run("Recover", func() {
+		orders := &OrderHandler{failures: 100}
+		handler, broker := suite.Setup(orders,
+			queue.Configure("durable", queue.Config{
+				VisibilityTimeout: time.Hour,
+			}))
+		pv, err := api.Post(handler, api.RouteTo(PlaceOrder{5}, queue.To("durable")))
+		suite.Nil(err)
+		_, err = pv.Await()
+		suite.Nil(err)
+		suite.Eventually(func() bool {
+			return orders.attempts.Load() == 1
+		}, 5*time.Second, 5*time.Millisecond)
+		suite.Nil(broker.Close())
+
+		orders = &OrderHandler{placed: make(chan int, 1)}
+		_, broker = suite.Setup(orders, queue.Configure("durable", queue.Config{}))
+		defer func() { suite.Nil(broker.Close()) }()
+		suite.Equal(5, suite.wait(orders.placed))
+	})
+
+	suite.Run("Settle On Close", func() {
+		orders := &OrderHandler{placed: make(chan int, 1), release: make(chan struct{})}
+		handler, broker := suite.Setup(orders,
+			queue.Configure("draining", queue.Config{
+				VisibilityTimeout: time.Hour,
+			}))
+		pv, err := api.Post(handler, api.RouteTo(PlaceOrder{9}, queue.To("draining")))
+		suite.Nil(err)
+		_, err = pv.Await()
+		suite.Nil(err)
+		suite.Eventually(func() bool {
+			return orders.attempts.Load() == 1
+		}, 5*time.Second, 5*time.Millisecond)
+		time.AfterFunc(20*time.Millisecond, func() { close(orders.release) })
+		suite.Nil(broker.Close())
+		suite.Equal(9, suite.wait(orders.placed))
+
+		_, broker = suite.Setup(&OrderHandler{}, queue.Configure("draining", queue.Config{}))
+		defer func() { suite.Nil(broker.Close()) }()
+		q, err := broker.Queue("draining")
+		suite.Nil(err)
+		suite.Equal(0, q.Len())
+	})
+
+	suite.Run("Recover Corrupt", func() {
+		orders := &OrderHandler{failures: 100}
+		handler, broker := suite.Setup(orders,
+			queue.Configure("corrupt", queue.Config{
+				VisibilityTimeout: time.Hour,
+			}))
+		pv, err := api.Post(handler, api.RouteTo(PlaceOrder{7}, queue.To("corrupt")))
+		suite.Nil(err)
+		_, err = pv.Await()
+		suite.Nil(err)
+		suite.Eventually(func() bool {
+			return orders.attempts.Load() == 1
+		}, 5*time.Second, 5*time.Millisecond)
+		suite.Nil(broker.Close())
+
+		path := filepath.Join(suite.dir, "corrupt.log")
+		log, err := os.ReadFile(path)
+		suite.Nil(err)
+		log = append([]byte("not a record\n"), log...)
+		log = append(log, `{"op":"ack","id":`...)
+		suite.Nil(os.WriteFile(path, log, 0o644))
+
+		orders = &OrderHandler{placed: make(chan int, 1)}
+		_, broker = suite.Setup(orders, queue.Configure("corrupt", queue.Config{}))
+		defer func() { suite.Nil(broker.Close()) }()
+		suite.Equal(7, suite.wait(orders.placed))
+	})
+
+	suite.Run("Missing Name", func() {
+		handler, broker := suite.Setup(&OrderHandler{})
+		defer func() { suite.Nil(broker.Close()) }()
+		pv, err := api.Post(handler, api.RouteTo(PlaceOrder{6}, "queue:"))
+		suite.Nil(err)
+		_, err = pv.Await()
+		suite.ErrorIs(err, queue.ErrMissingQueueName)
+	})
+
+	suite.Run("Invalid Name", func() {
+		handler, broker := suite.Setup(&OrderHandler{})
+		defer func() { suite.Nil(broker.Close()) }()
+		for _, route := range []string{"queue:../orders", "queue://orders/../../escape", `queue:..\orders`} {
+			pv, err := api.Post(handler, api.RouteTo(PlaceOrder{8}, route))
+			suite.Nil(err)
+			_, err = pv.Await()
+			suite.ErrorIs(err, queue.ErrInvalidQueueName)
+		}
+		_, err := broker.Queue("../orders")
+		suite.ErrorIs(err, queue.ErrInvalidQueueName)
+	})
+}
+
+func (suite *QueueTestSuite) wait(placed chan int) int {
+	select {
+	case id := <-placed:
+		return id
+	case <-time.After(5 * time.Second):
+		suite.Fail("timed out waiting for delivery")
+		return 0
+	}
+}
+
+func TestQueueTestSuite(t *testing.T) {
+	suite.Run(t, new(QueueTestSuite))
+}
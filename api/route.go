@@ -178,7 +178,7 @@ func (b *batchRouter) CompleteBatch(
 		messages := slices.Map[pending, any](group, func (p pending) any {
 			return p.message
 		})
-		routeTo := RouteTo(ConcurrentBatch{messages}, route)
+		routeTo := RouteTo(ConcurrentBatch{Requests: messages}, route)
 		complete = append(complete,
 			promise.Then(sendBatch(composer, routeTo),
 				func(results []either.Monad[error, any]) RouteReply {
@@ -224,7 +224,7 @@ func (b *batchRouter) batch(
 
 	msg := routed.Message
 	if publish {
-		msg = Published{msg}
+		msg = Published{Message: msg}
 	}
 	request := pending{
 		message:  msg,
@@ -1,7 +1,10 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/args"
 	"github.com/miruken-go/miruken/creates"
 	"github.com/miruken-go/miruken/either"
 	"github.com/miruken-go/miruken/handles"
@@ -9,14 +12,21 @@ import (
 	"github.com/miruken-go/miruken/promise"
 	"github.com/miruken-go/miruken/provides"
 	"sync"
+	"time"
 )
 
 type (
 	// ConcurrentBatch represents a batch of requests to execute concurrently.
 	// The operation returns after all requests are completed and
 	// includes all successes and failures.
+	// MaxParallel limits the number of requests in flight at once.
+	// FailFast cancels the outstanding requests after the first failure.
+	// Timeout limits the time each request is allowed to take.
 	ConcurrentBatch struct {
-		Requests []any
+		Requests    []any
+		MaxParallel int
+		FailFast    bool
+		Timeout     time.Duration
 	}
 
 	// SequentialBatch represents a batch of requests to execute sequentially.
@@ -27,8 +37,12 @@ type (
 	}
 
 	// Published marks a message to be published to all consumers.
+	// Acks is the minimum number of consumers that must handle the
+	// message successfully, otherwise an InsufficientAcksError fails
+	// the publication.
 	Published struct {
 		Message any
+		Acks    int
 	}
 
 	// ScheduledResult represents the results of a scheduled request.
@@ -42,6 +56,11 @@ type (
 )
 
 
+// ErrBatchCanceled reports a request in a ConcurrentBatch that was
+// canceled or never started due to an earlier failure with FailFast.
+var ErrBatchCanceled = errors.New("api: batch canceled after a failed request")
+
+
 // Scheduler
 
 func (s *Scheduler) Constructor(
@@ -55,19 +74,55 @@ func (s *Scheduler) Constructor(
 func (s *Scheduler) Concurrent(
 	_ *handles.It, concurrent ConcurrentBatch,
 	composer miruken.Handler,
+	_*struct{args.Optional}, parent context.Context,
 ) *promise.Promise[ScheduledResult] {
 	return promise.New(func(resolve func(ScheduledResult), reject func(error)) {
 		requests := concurrent.Requests
 		responses := make([]either.Monad[error, any], len(requests))
 
+		// only bounded batches are processed within a context
+		bounded := concurrent.MaxParallel > 0 || concurrent.FailFast || concurrent.Timeout > 0
+		if parent == nil {
+			parent = context.Background()
+		}
+		ctx, cancel := context.WithCancelCause(parent)
+		defer cancel(nil)
+
+		parallel := concurrent.MaxParallel
+		if parallel <= 0 || parallel > len(requests) {
+			parallel = len(requests)
+		}
+		slots := make(chan struct{}, parallel)
+
 		var waitGroup sync.WaitGroup
 		waitGroup.Add(len(requests))
 
 		for i, request := range requests {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				responses[i] = Failure(context.Cause(ctx))
+				waitGroup.Done()
+				continue
+			}
 			go func(idx int, req any) {
-				defer waitGroup.Done()
-				response, _ := process(req, composer)
+				defer func() {
+					<-slots
+					waitGroup.Done()
+				}()
+				var response either.Monad[error, any]
+				var success bool
+				if bounded {
+					response, success = processWithin(ctx, req, composer, concurrent.Timeout)
+				} else {
+					response, success = process(req, composer)
+				}
 				responses[idx] = response
+				if !success && concurrent.FailFast {
+					cancel(ErrBatchCanceled)
+				}
 			}(i, request)
 		}
 
@@ -100,7 +155,30 @@ func (s *Scheduler) Publish(
 	_ *handles.It, publish Published,
 	composer miruken.Handler,
 ) (p *promise.Promise[any], err error) {
-	return Publish(composer, publish.Message)
+	if publish.Acks <= 0 {
+		return Publish(composer, publish.Message)
+	}
+	pc := PublishCollect[any](composer, publish.Message)
+	return promise.New(func(resolve func(any), reject func(error)) {
+		results, err := pc.Await()
+		if err != nil {
+			reject(err)
+			return
+		}
+		acks := &InsufficientAcksError{Required: publish.Acks}
+		for _, result := range results {
+			either.Match(result, func(err error) {
+				acks.Errors = append(acks.Errors, err)
+			}, func(any) {
+				acks.Received++
+			})
+		}
+		if acks.Received < acks.Required {
+			reject(acks)
+		} else {
+			resolve(nil)
+		}
+	}), nil
 }
 
 func (s *Scheduler) New(
@@ -137,6 +215,19 @@ func Sequential(
 	return sendBatch(handler, SequentialBatch{requests})
 }
 
+// ConcurrentWith processes a batch of requests concurrently
+// using the MaxParallel, FailFast and Timeout of the batch.
+// Returns a batch of corresponding responses (or errors).
+func ConcurrentWith(
+	handler miruken.Handler,
+	batch   ConcurrentBatch,
+) *promise.Promise[[]either.Monad[error, any]] {
+	if internal.IsNil(handler) {
+		panic("handler cannot be nil")
+	}
+	return sendBatch(handler, batch)
+}
+
 // Concurrent processes a batch of requests concurrently.
 // Returns a batch of corresponding responses (or errors).
 func Concurrent(
@@ -146,7 +237,7 @@ func Concurrent(
 	if internal.IsNil(handler) {
 		panic("handler cannot be nil")
 	}
-	return sendBatch(handler, ConcurrentBatch{requests})
+	return sendBatch(handler, ConcurrentBatch{Requests: requests})
 }
 
 func process(
@@ -165,6 +256,43 @@ func process(
 	return Success(res), true
 }
 
+// processWithin processes the request with the context provided
+// to the handlers.  The request fails if the context is canceled
+// or the timeout elapses before it completes.
+func processWithin(
+	ctx     context.Context,
+	request any,
+	handler miruken.Handler,
+	timeout time.Duration,
+) (either.Monad[error, any], bool) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	handler = miruken.BuildUp(handler, provides.With(ctx))
+	res, err := promise.WithContext(func(resolve func(any), reject func(error)) {
+		res, pr, err := Send[any](handler, request)
+		if err == nil && pr != nil {
+			res, err = pr.Await()
+		}
+		if err != nil {
+			reject(err)
+		} else {
+			resolve(res)
+		}
+	}, ctx).Await()
+	if err != nil {
+		// requests canceled by an earlier failure report ErrBatchCanceled
+		if errors.Is(context.Cause(ctx), ErrBatchCanceled) &&
+			(errors.Is(err, context.Canceled) || errors.Is(err, ErrBatchCanceled)) {
+			err = ErrBatchCanceled
+		}
+		return Failure(err), false
+	}
+	return Success(res), true
+}
+
 func sendBatch(
 	handler miruken.Handler,
 	batch   any,
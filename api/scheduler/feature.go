@@ -0,0 +1,73 @@
+package scheduler
+
+import (
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/internal"
+)
+
+// Installer configures delayed and recurring message delivery.
+type Installer struct {
+	store   Store
+	config  Config
+	service *Service
+}
+
+func (i *Installer) DependsOn() []miruken.Feature {
+	return []miruken.Feature{api.Feature()}
+}
+
+func (i *Installer) Install(setup *miruken.SetupBuilder) error {
+	if setup.Tag(&featureTag) {
+		if internal.IsNil(i.store) {
+			i.store = NewMemoryStore()
+		}
+		i.service = NewService(i.store, i.config)
+		setup.Specs(&Service{}).
+			  Handlers(i.service)
+	}
+	return nil
+}
+
+// AfterInstall starts delivering scheduled messages once
+// the handler is available to post them.
+func (i *Installer) AfterInstall(
+	_ *miruken.SetupBuilder,
+	handler miruken.Handler,
+) error {
+	if service := i.service; service != nil {
+		return service.Start(handler)
+	}
+	return nil
+}
+
+// WithStore sets the Store persisting the scheduled messages.
+func WithStore(store Store) func(*Installer) {
+	if internal.IsNil(store) {
+		panic("store cannot be nil")
+	}
+	return func(installer *Installer) {
+		installer.store = store
+	}
+}
+
+// Configure customizes the timer wheel.
+func Configure(config Config) func(*Installer) {
+	return func(installer *Installer) {
+		installer.config = config
+	}
+}
+
+// Feature configures delayed and recurring message delivery.
+// If no Store is provided, a MemoryStore is used.
+func Feature(config ...func(*Installer)) miruken.Feature {
+	installer := &Installer{}
+	for _, configure := range config {
+		if configure != nil {
+			configure(installer)
+		}
+	}
+	return installer
+}
+
+var featureTag byte
@@ -0,0 +1,60 @@
+package scheduler
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// MemoryStore is a Store that keeps entries in memory.
+// It is intended for tests and single process deployments
+// that do not require durability.
+type MemoryStore struct {
+	lock    sync.Mutex
+	entries map[string]Entry
+}
+
+
+func (m *MemoryStore) Save(
+	_     context.Context,
+	entry Entry,
+) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.entries == nil {
+		m.entries = make(map[string]Entry)
+	}
+	m.entries[entry.Id] = entry
+	return nil
+}
+
+func (m *MemoryStore) Delete(
+	_  context.Context,
+	id string,
+) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.entries, id)
+	return nil
+}
+
+func (m *MemoryStore) All(
+	_ context.Context,
+) ([]Entry, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	entries := make([]Entry, 0, len(m.entries))
+	for _, entry := range m.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Due.Before(entries[j].Due)
+	})
+	return entries, nil
+}
+
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]Entry)}
+}
@@ -0,0 +1,348 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/handles"
+	"github.com/miruken-go/miruken/internal"
+	"github.com/miruken-go/miruken/internal/worker"
+	"github.com/miruken-go/miruken/provides"
+	"github.com/miruken-go/miruken/security"
+	"github.com/miruken-go/miruken/security/principal"
+	"reflect"
+	"sync"
+	"time"
+)
+
+type (
+	// Entry is a scheduled message.
+	// Entries with a Cron expression recur until cancelled.
+	// Messages are delivered on behalf of the Principals
+	// of the caller that scheduled them.
+	Entry struct {
+		Id         string
+		Message    json.RawMessage
+		Due        time.Time
+		Cron       string
+		Principals []Principal
+	}
+
+	// Principal is the persisted form of a security.Principal.
+	// Kind identifies the standard principal types.
+	Principal struct {
+		Kind string
+		Name string
+	}
+
+	// Store persists scheduled entries so they survive restarts.
+	Store interface {
+		// Save inserts or replaces the entry.
+		Save(ctx context.Context, entry Entry) error
+
+		// Delete removes the entry.
+		Delete(ctx context.Context, id string) error
+
+		// All returns all the entries.
+		All(ctx context.Context) ([]Entry, error)
+	}
+
+	// Config customizes the timer wheel.
+	Config struct {
+		Tick  time.Duration
+		Slots int
+	}
+
+	// Service schedules messages for later delivery.
+	// Due messages are posted through the handler so the
+	// usual handles pipeline, including filters, applies.
+	Service struct {
+		store   Store
+		config  Config
+		logger  logr.Logger
+		wheel   *wheel
+		lock    sync.Mutex
+		entries map[string]Entry
+		worker  worker.Worker
+		started bool
+	}
+)
+
+
+const (
+	defaultTick  = 100 * time.Millisecond
+	defaultSlots = 512
+)
+
+
+// NoConstructor prevents Service from being created implicitly.
+func (s *Service) NoConstructor() {}
+
+func (s *Service) Delay(
+	_ *handles.It, delayed api.Delayed,
+	ctx miruken.HandleContext,
+) (string, error) {
+	if internal.IsNil(delayed.Message) {
+		return "", fmt.Errorf("scheduler: the delayed message is missing")
+	}
+	composer := miruken.BuildUp(ctx.Composer, api.Polymorphic)
+	msg, err := api.EncodeMessage(composer, delayed.Message)
+	if err != nil {
+		return "", fmt.Errorf("scheduler: %w", err)
+	}
+	entry := Entry{
+		Id:         uuid.NewString(),
+		Message:    msg,
+		Due:        delayed.At.UTC(),
+		Principals: principalsOf(ctx.Composer),
+	}
+	if err := s.Schedule(context.Background(), entry); err != nil {
+		return "", err
+	}
+	return entry.Id, nil
+}
+
+func (s *Service) Recur(
+	_ *handles.It, recurring api.Recurring,
+	ctx miruken.HandleContext,
+) (string, error) {
+	if internal.IsNil(recurring.Message) {
+		return "", fmt.Errorf("scheduler: the recurring message is missing")
+	}
+	cron, err := ParseCron(recurring.Cron)
+	if err != nil {
+		return "", fmt.Errorf("scheduler: %w", err)
+	}
+	due := cron.Next(time.Now().UTC())
+	if due.IsZero() {
+		return "", fmt.Errorf("scheduler: cron %q never activates", recurring.Cron)
+	}
+	composer := miruken.BuildUp(ctx.Composer, api.Polymorphic)
+	msg, err := api.EncodeMessage(composer, recurring.Message)
+	if err != nil {
+		return "", fmt.Errorf("scheduler: %w", err)
+	}
+	id := recurring.Id
+	if len(id) == 0 {
+		id = uuid.NewString()
+	}
+	entry := Entry{
+		Id:         id,
+		Message:    msg,
+		Due:        due,
+		Cron:       recurring.Cron,
+		Principals: principalsOf(ctx.Composer),
+	}
+	if err := s.Schedule(context.Background(), entry); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Schedule persists the entry and adds it to the timer wheel.
+func (s *Service) Schedule(
+	ctx   context.Context,
+	entry Entry,
+) error {
+	if len(entry.Id) == 0 {
+		panic("entry id cannot be empty")
+	}
+	if err := s.store.Save(ctx, entry); err != nil {
+		return fmt.Errorf("scheduler: %w", err)
+	}
+	s.lock.Lock()
+	s.entries[entry.Id] = entry
+	s.lock.Unlock()
+	s.wheel.add(entry.Id, entry.Due)
+	return nil
+}
+
+// Cancel removes the scheduled entry.
+func (s *Service) Cancel(
+	ctx context.Context,
+	id  string,
+) error {
+	s.wheel.cancel(id)
+	s.lock.Lock()
+	delete(s.entries, id)
+	s.lock.Unlock()
+	if err := s.store.Delete(ctx, id); err != nil {
+		return fmt.Errorf("scheduler: %w", err)
+	}
+	return nil
+}
+
+// Start recovers the persisted entries and starts the
+// timer wheel delivering messages through the handler.
+func (s *Service) Start(handler miruken.Handler) error {
+	if internal.IsNil(handler) {
+		panic("handler cannot be nil")
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.started || s.worker.Closed() {
+		return nil
+	}
+	entries, err := s.store.All(context.Background())
+	if err != nil {
+		return fmt.Errorf("scheduler: %w", err)
+	}
+	for _, entry := range entries {
+		s.entries[entry.Id] = entry
+		s.wheel.add(entry.Id, entry.Due)
+	}
+	s.started = true
+	if s.logger.GetSink() == nil {
+		s.logger, _, _ = provides.Type[logr.Logger](handler)
+	}
+	handler = miruken.BuildUp(handler, api.Polymorphic)
+	s.worker.Start(1, s.wheel.tick, func(context.Context) {
+		for _, id := range s.wheel.advance(time.Now()) {
+			if entry, ok := s.expire(id); ok {
+				s.worker.Go(func() { s.deliver(entry, handler) })
+			}
+		}
+	})
+	return nil
+}
+
+// Close stops the timer wheel.
+func (s *Service) Close() {
+	s.worker.Close()
+}
+
+// expire reschedules a recurring entry or removes a
+// single entry and returns the entry to deliver.
+func (s *Service) expire(id string) (Entry, bool) {
+	s.lock.Lock()
+	entry, ok := s.entries[id]
+	s.lock.Unlock()
+	if !ok {
+		return entry, false
+	}
+	// the wheel may fire early for entries due in the future
+	if wait := time.Until(entry.Due); wait > 0 {
+		s.wheel.add(id, entry.Due)
+		return entry, false
+	}
+	ctx := context.Background()
+	if len(entry.Cron) > 0 {
+		if cron, err := ParseCron(entry.Cron); err == nil {
+			next := entry
+			if next.Due = cron.Next(time.Now().UTC()); !next.Due.IsZero() {
+				if err := s.Schedule(ctx, next); err != nil {
+					s.logger.Error(err, "unable to reschedule message", "id", id)
+				}
+				return entry, true
+			}
+		}
+	}
+	s.lock.Lock()
+	delete(s.entries, id)
+	s.lock.Unlock()
+	if err := s.store.Delete(ctx, id); err != nil {
+		s.logger.Error(err, "unable to remove scheduled message", "id", id)
+	}
+	return entry, true
+}
+
+func (s *Service) deliver(
+	entry   Entry,
+	handler miruken.Handler,
+) {
+	// deliver on behalf of the caller that scheduled the message
+	subject := security.NewSubject(security.WithPrincipals(s.principals(entry)...))
+	handler  = miruken.BuildUp(handler, provides.With(subject))
+	payload, err := api.DecodeMessage(handler, entry.Message)
+	if err == nil && payload != nil {
+		pv, e := api.Post(handler, payload)
+		if err = e; err == nil && pv != nil {
+			_, err = pv.Await()
+		}
+	}
+	if err != nil {
+		s.logger.Error(err, "unable to deliver scheduled message", "id", entry.Id)
+	}
+}
+
+
+// principals restores the principals of the entry.
+// Principals of unknown kinds are not restored.
+func (s *Service) principals(entry Entry) []security.Principal {
+	ps := make([]security.Principal, 0, len(entry.Principals))
+	for _, p := range entry.Principals {
+		if restore, ok := principalKinds[p.Kind]; ok {
+			ps = append(ps, restore(p.Name))
+		} else {
+			s.logger.Info("ignoring unknown principal", "id", entry.Id, "kind", p.Kind)
+		}
+	}
+	return ps
+}
+
+
+// Config
+
+func (c Config) withDefaults() Config {
+	if c.Tick <= 0 {
+		c.Tick = defaultTick
+	}
+	if c.Slots <= 0 {
+		c.Slots = defaultSlots
+	}
+	return c
+}
+
+
+// NewService creates a Service persisting entries in the store.
+// Without a logger, the logr.Logger provided by the handler
+// starting the Service is used.
+func NewService(
+	store  Store,
+	config Config,
+	logger ...logr.Logger,
+) *Service {
+	if internal.IsNil(store) {
+		panic("store cannot be nil")
+	}
+	config = config.withDefaults()
+	service := &Service{
+		store:   store,
+		config:  config,
+		wheel:   newWheel(config.Tick, config.Slots),
+		entries: make(map[string]Entry),
+	}
+	if len(logger) > 0 {
+		service.logger = logger[0]
+	}
+	return service
+}
+
+// principalsOf returns the principals of the security.Subject
+// scheduling the message.
+func principalsOf(handler miruken.Handler) []Principal {
+	subject, _, err := provides.Type[security.Subject](handler)
+	if err != nil || internal.IsNil(subject) {
+		return nil
+	}
+	var ps []Principal
+	for _, p := range subject.Principals() {
+		ps = append(ps, Principal{Kind: reflect.TypeOf(p).String(), Name: p.Name()})
+	}
+	return ps
+}
+
+
+var principalKinds = map[string]func(string) security.Principal{
+	"principal.Id":          func(n string) security.Principal { return principal.Id(n) },
+	"principal.User":        func(n string) security.Principal { return principal.User(n) },
+	"principal.Email":       func(n string) security.Principal { return principal.Email(n) },
+	"principal.Role":        func(n string) security.Principal { return principal.Role(n) },
+	"principal.Group":       func(n string) security.Principal { return principal.Group(n) },
+	"principal.Entitlement": func(n string) security.Principal { return principal.Entitlement(n) },
+	reflect.TypeOf(security.System).String(): func(string) security.Principal { return security.System },
+}
@@ -0,0 +1,71 @@
+package test
+
+import (
+	"github.com/miruken-go/miruken/api/scheduler"
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"time"
+)
+
+type CronTestSuite struct {
+	suite.Suite
+}
+
+func (suite *CronTestSuite) TestCron() {
+	start := time.Date(2023, time.March, 15, 10, 30, 45, 0, time.UTC)
+
+	next := func(expr string) time.Time {
+		cron, err := scheduler.ParseCron(expr)
+		suite.Nil(err)
+		return cron.Next(start)
+	}
+
+	suite.Run("Every Minute", func() {
+		suite.Equal(time.Date(2023, time.March, 15, 10, 31, 0, 0, time.UTC), next("* * * * *"))
+	})
+
+	suite.Run("Step", func() {
+		suite.Equal(time.Date(2023, time.March, 15, 10, 45, 0, 0, time.UTC), next("*/15 * * * *"))
+	})
+
+	suite.Run("List", func() {
+		suite.Equal(time.Date(2023, time.March, 15, 12, 0, 0, 0, time.UTC), next("0 9,12 * * *"))
+	})
+
+	suite.Run("Range", func() {
+		suite.Equal(time.Date(2023, time.March, 16, 1, 0, 0, 0, time.UTC), next("0 1-3 * * *"))
+	})
+
+	suite.Run("Day Of Week", func() {
+		// March 15 2023 is a Wednesday
+		suite.Equal(time.Date(2023, time.March, 19, 0, 0, 0, 0, time.UTC), next("0 0 * * sun"))
+		suite.Equal(time.Date(2023, time.March, 19, 0, 0, 0, 0, time.UTC), next("0 0 * * 7"))
+	})
+
+	suite.Run("Day Of Month Or Week", func() {
+		suite.Equal(time.Date(2023, time.March, 17, 0, 0, 0, 0, time.UTC), next("0 0 17 * 1"))
+		suite.Equal(time.Date(2023, time.March, 20, 0, 0, 0, 0, time.UTC), next("0 0 25 * mon"))
+	})
+
+	suite.Run("Month", func() {
+		suite.Equal(time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC), next("0 0 29 feb *"))
+	})
+
+	suite.Run("Descriptors", func() {
+		suite.Equal(time.Date(2023, time.March, 15, 11, 0, 0, 0, time.UTC), next("@hourly"))
+		suite.Equal(time.Date(2023, time.March, 16, 0, 0, 0, 0, time.UTC), next("@daily"))
+		suite.Equal(time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC), next("@monthly"))
+		suite.Equal(start.Add(90*time.Second), next("@every 90s"))
+	})
+
+	suite.Run("Invalid", func() {
+		for _, expr := range []string{"* * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "5-1 * * * *", "@every x"} {
+			_, err := scheduler.ParseCron(expr)
+			suite.NotNil(err, expr)
+		}
+	})
+}
+
+func TestCronTestSuite(t *testing.T) {
+	suite.Run(t, new(CronTestSuite))
+}
@@ -0,0 +1,206 @@
+package test
+
+import (
+	"context"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/api/json/stdjson"
+	"github.com/miruken-go/miruken/api/scheduler"
+	"github.com/miruken-go/miruken/args"
+	"github.com/miruken-go/miruken/creates"
+	"github.com/miruken-go/miruken/handles"
+	"github.com/miruken-go/miruken/promise"
+	"github.com/miruken-go/miruken/provides"
+	"github.com/miruken-go/miruken/security"
+	"github.com/miruken-go/miruken/security/principal"
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"time"
+)
+
+//go:generate $GOPATH/bin/miruken -tests
+
+type (
+	Remind struct {
+		Id int
+	}
+
+	ReminderHandler struct {
+		reminded   chan int
+		principals chan []security.Principal
+	}
+)
+
+
+// ReminderHandler
+
+func (r *ReminderHandler) Remind(
+	_ *handles.It, remind Remind,
+	_*struct{args.Optional}, subject security.Subject,
+) {
+	if r.principals != nil && subject != nil {
+		r.principals <- subject.Principals()
+	}
+	if r.reminded != nil {
+		r.reminded <- remind.Id
+	}
+}
+
+func (r *ReminderHandler) New(
+	_*struct{
+		_ creates.It `key:"test.Remind"`
+	  }, create *creates.It,
+) any {
+	switch create.Key() {
+	case "test.Remind":
+		return new(Remind)
+	}
+	return nil
+}
+
+
+type SchedulerTestSuite struct {
+	suite.Suite
+}
+
+func (suite *SchedulerTestSuite) Setup(
+	reminders *ReminderHandler,
+	config    ...func(*scheduler.Installer),
+) (miruken.Handler, *scheduler.Service) {
+	config  = append([]func(*scheduler.Installer){
+		scheduler.Configure(scheduler.Config{Tick: 5 * time.Millisecond}),
+	}, config...)
+	handler, _ := miruken.Setup(
+		scheduler.Feature(config...), TestFeature, stdjson.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Handlers(reminders).
+		Handler()
+	service, _, _ := provides.Type[*scheduler.Service](handler)
+	return handler, service
+}
+
+func (suite *SchedulerTestSuite) TestScheduler() {
+	suite.Run("PostAfter", func() {
+		reminders := &ReminderHandler{reminded: make(chan int, 1)}
+		handler, service := suite.Setup(reminders)
+		defer service.Close()
+		start := time.Now()
+		pv, err := api.PostAfter(handler, Remind{1}, 50*time.Millisecond)
+		suite.Nil(err)
+		suite.Nil(await(pv))
+		suite.Equal(1, suite.wait(reminders.reminded))
+		suite.GreaterOrEqual(time.Since(start), 50*time.Millisecond)
+	})
+
+	suite.Run("PostAt", func() {
+		reminders := &ReminderHandler{reminded: make(chan int, 1)}
+		handler, service := suite.Setup(reminders)
+		defer service.Close()
+		pv, err := api.PostAt(handler, Remind{2}, time.Now().Add(-time.Minute))
+		suite.Nil(err)
+		suite.Nil(await(pv))
+		suite.Equal(2, suite.wait(reminders.reminded))
+	})
+
+	suite.Run("Recurring", func() {
+		reminders := &ReminderHandler{reminded: make(chan int, 10)}
+		handler, service := suite.Setup(reminders)
+		defer service.Close()
+		pv, err := api.Post(handler, api.Recurring{
+			Id:      "remind",
+			Cron:    "@every 10ms",
+			Message: Remind{3},
+		})
+		suite.Nil(err)
+		suite.Nil(await(pv))
+		for i := 0; i < 3; i++ {
+			suite.Equal(3, suite.wait(reminders.reminded))
+		}
+		suite.Nil(service.Cancel(context.Background(), "remind"))
+	})
+
+	suite.Run("Recover", func() {
+		store := scheduler.NewMemoryStore()
+		handler, service := suite.Setup(&ReminderHandler{}, scheduler.WithStore(store))
+		pv, err := api.PostAfter(handler, Remind{4}, 50*time.Millisecond)
+		suite.Nil(err)
+		suite.Nil(await(pv))
+		service.Close()
+
+		entries, err := store.All(context.Background())
+		suite.Nil(err)
+		suite.Len(entries, 1)
+
+		reminders := &ReminderHandler{reminded: make(chan int, 1)}
+		_, service = suite.Setup(reminders, scheduler.WithStore(store))
+		defer service.Close()
+		suite.Equal(4, suite.wait(reminders.reminded))
+		suite.Eventually(func() bool {
+			entries, _ := store.All(context.Background())
+			return len(entries) == 0
+		}, 5*time.Second, 5*time.Millisecond)
+	})
+
+	suite.Run("Principals", func() {
+		reminders := &ReminderHandler{
+			reminded:   make(chan int, 1),
+			principals: make(chan []security.Principal, 1),
+		}
+		handler, service := suite.Setup(reminders)
+		defer service.Close()
+		subject := security.NewSubject(security.WithPrincipals(
+			principal.User("bob"), principal.Role("admin")))
+		pv, err := api.PostAfter(miruken.BuildUp(handler, provides.With(subject)),
+			Remind{6}, 10*time.Millisecond)
+		suite.Nil(err)
+		suite.Nil(await(pv))
+		suite.Equal([]security.Principal{principal.User("bob"), principal.Role("admin")},
+			<-reminders.principals)
+		suite.Equal(6, suite.wait(reminders.reminded))
+	})
+
+	suite.Run("Wheel Rotations", func() {
+		reminders := &ReminderHandler{reminded: make(chan int, 1)}
+		handler, service := suite.Setup(reminders,
+			scheduler.Configure(scheduler.Config{Tick: 5 * time.Millisecond, Slots: 4}))
+		defer service.Close()
+		start := time.Now()
+		pv, err := api.PostAfter(handler, Remind{7}, 60*time.Millisecond)
+		suite.Nil(err)
+		suite.Nil(await(pv))
+		suite.Equal(7, suite.wait(reminders.reminded))
+		suite.GreaterOrEqual(time.Since(start), 60*time.Millisecond)
+	})
+
+	suite.Run("Invalid Cron", func() {
+		handler, service := suite.Setup(&ReminderHandler{})
+		defer service.Close()
+		pv, err := api.Post(handler, api.Recurring{Cron: "* *", Message: Remind{5}})
+		if err == nil {
+			err = await(pv)
+		}
+		suite.ErrorContains(err, "expected 5 fields")
+	})
+}
+
+func (suite *SchedulerTestSuite) wait(reminded chan int) int {
+	select {
+	case id := <-reminded:
+		return id
+	case <-time.After(5 * time.Second):
+		suite.Fail("timed out waiting for delivery")
+		return 0
+	}
+}
+
+func await(pv *promise.Promise[any]) error {
+	if pv != nil {
+		_, err := pv.Await()
+		return err
+	}
+	return nil
+}
+
+func TestSchedulerTestSuite(t *testing.T) {
+	suite.Run(t, new(SchedulerTestSuite))
+}
@@ -0,0 +1,108 @@
+package scheduler
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// wheel is a hashed timing wheel.  Timers are placed in the
+	// slot they expire in and carry the number of full rotations
+	// remaining, so adding and removing timers is constant time
+	// regardless of how many are scheduled.  The wheel advances
+	// by the elapsed time so late ticks do not delay the timers.
+	wheel struct {
+		tick   time.Duration
+		lock   sync.Mutex
+		slots  []map[string]*timer
+		timers map[string]*timer
+		pos    int
+		last   time.Time
+	}
+
+	// timer is an entry in the wheel.
+	timer struct {
+		id     string
+		slot   int
+		rounds int
+	}
+)
+
+
+func newWheel(tick time.Duration, size int) *wheel {
+	slots := make([]map[string]*timer, size)
+	for i := range slots {
+		slots[i] = make(map[string]*timer)
+	}
+	return &wheel{
+		tick:   tick,
+		slots:  slots,
+		timers: make(map[string]*timer),
+		last:   time.Now(),
+	}
+}
+
+// add schedules the id to expire at due, replacing
+// any existing timer with the same id.
+func (w *wheel) add(id string, due time.Time) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	ticks := int((due.Sub(w.last) + w.tick - 1) / w.tick)
+	if ticks < 1 {
+		ticks = 1
+	}
+	w.remove(id)
+	size := len(w.slots)
+	t := &timer{
+		id:     id,
+		slot:   (w.pos + ticks) % size,
+		rounds: (ticks - 1) / size,
+	}
+	w.slots[t.slot][id] = t
+	w.timers[id] = t
+}
+
+// cancel removes the timer with the id.
+func (w *wheel) cancel(id string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.remove(id)
+}
+
+// advance moves the wheel by the ticks elapsed until now
+// and returns the ids of the expired timers.
+func (w *wheel) advance(now time.Time) []string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	ticks := int(now.Sub(w.last) / w.tick)
+	if ticks < 1 {
+		return nil
+	}
+	w.last = w.last.Add(time.Duration(ticks) * w.tick)
+	size   := len(w.slots)
+	passed := min(ticks, size)
+	var expired []string
+	for step := 1; step <= passed; step++ {
+		slot := (w.pos + step) % size
+		// the slot is passed once more for each full rotation
+		visits := (ticks - step) / size + 1
+		for id, t := range w.slots[slot] {
+			if t.rounds >= visits {
+				t.rounds -= visits
+				continue
+			}
+			delete(w.slots[slot], id)
+			delete(w.timers, id)
+			expired = append(expired, id)
+		}
+	}
+	w.pos = (w.pos + ticks) % size
+	return expired
+}
+
+func (w *wheel) remove(id string) {
+	if t, ok := w.timers[id]; ok {
+		delete(w.slots[t.slot], id)
+		delete(w.timers, id)
+	}
+}
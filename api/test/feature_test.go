@@ -9,7 +9,9 @@ var TestFeature miruken.Feature = miruken.FeatureFunc(func(setup *miruken.SetupB
 		&CancelOrderFilter{},
 		&MissionControlHandler{},
 		&OrderHandler{},
+		&OrderUpcaster{},
 		&PresidentHandler{},
+		&ShippingHandler{},
 		&StockQuoteHandler{},
 		&TrashHandler{},
 	)
@@ -24,6 +24,10 @@ type (
 		Count      int
 	}
 
+	Poll struct {
+		Question string
+	}
+
 	MissionControlHandler struct{}
 
 	PresidentHandler struct {}
@@ -59,6 +63,21 @@ func (p *PresidentHandler) Track(
 	return nil
 }
 
+func (m *MissionControlHandler) Poll(
+	_ *handles.It, poll Poll,
+) *promise.Promise[string] {
+	return promise.Resolve("go")
+}
+
+func (p *PresidentHandler) Poll(
+	_ *handles.It, poll Poll,
+) (string, error) {
+	if poll.Question == "launch" {
+		return "", errors.New("launch not authorized")
+	}
+	return "approved", nil
+}
+
 func (m *MissionControlHandler) launchCode() string {
 	return strconv.FormatInt(time.Now().UnixNano(), 10)
 }
@@ -144,6 +163,72 @@ func (suite *MessageTestSuite) TestMessage() {
 		_, err = pt.Await()
 		suite.Equal(2, tracked.Count)
 	})
+
+	suite.Run("PublishCollect", func() {
+		suite.Run("Responses", func() {
+			results, err := api.PublishCollect[string](
+				suite.Setup(), Poll{"status"}).Await()
+			suite.Nil(err)
+			suite.Len(results, 2)
+			var answers []string
+			for _, result := range results {
+				either.Match(result,
+					func(err error) { suite.Fail("unexpected error", err) },
+					func(s string) { answers = append(answers, s) })
+			}
+			suite.ElementsMatch([]string{"go", "approved"}, answers)
+		})
+
+		suite.Run("Failures", func() {
+			results, err := api.PublishCollect[string](
+				suite.Setup(), Poll{"launch"}).Await()
+			suite.Nil(err)
+			suite.Len(results, 2)
+			var answers, failures []string
+			for _, result := range results {
+				either.Match(result,
+					func(err error) { failures = append(failures, err.Error()) },
+					func(s string) { answers = append(answers, s) })
+			}
+			suite.Equal([]string{"go"}, answers)
+			suite.Equal([]string{"launch not authorized"}, failures)
+		})
+
+		suite.Run("No Consumers", func() {
+			results, err := api.PublishCollect[string](
+				suite.Setup(), Launch{}).Await()
+			suite.Nil(err)
+			suite.Len(results, 1)
+			results, err = api.PublishCollect[string](
+				suite.Setup(), 42).Await()
+			suite.Nil(err)
+			suite.Empty(results)
+		})
+	})
+
+	suite.Run("Published Acks", func() {
+		suite.Run("Satisfied", func() {
+			p, err := api.Post(suite.Setup(),
+				api.Published{Message: Poll{"launch"}, Acks: 1})
+			suite.Nil(err)
+			suite.NotNil(p)
+			_, err = p.Await()
+			suite.Nil(err)
+		})
+
+		suite.Run("Insufficient", func() {
+			p, err := api.Post(suite.Setup(),
+				api.Published{Message: Poll{"launch"}, Acks: 2})
+			suite.Nil(err)
+			suite.NotNil(p)
+			_, err = p.Await()
+			var acks *api.InsufficientAcksError
+			suite.ErrorAs(err, &acks)
+			suite.Equal(2, acks.Required)
+			suite.Equal(1, acks.Received)
+			suite.Len(acks.Errors, 1)
+		})
+	})
 }
 
 func TestMessageTestSuite(t *testing.T) {
@@ -7,9 +7,13 @@ import (
 	"github.com/miruken-go/miruken/either"
 	"github.com/miruken-go/miruken/handles"
 	"github.com/miruken-go/miruken/promise"
+	"github.com/miruken-go/miruken/provides"
 	"github.com/stretchr/testify/suite"
+	"context"
 	"math/rand"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 type (
@@ -27,9 +31,16 @@ type (
 		NumberShares int
 	}
 
+	WatchStockQuote struct {
+		Symbol string
+		Delay  time.Duration
+	}
+
 	StockQuoteHandler struct {}
 )
 
+var watching, maxWatching int32
+
 func (s *StockQuoteHandler) Quote(
 	_ *handles.It, quote GetStockQuote,
 ) *promise.Promise[StockQuote] {
@@ -54,6 +65,29 @@ func (s *StockQuoteHandler) Sell(
 	return promise.Resolve[any](nil)
 }
 
+func (s *StockQuoteHandler) Watch(
+	_ *handles.It, watch WatchStockQuote,
+	ctx context.Context,
+) (StockQuote, error) {
+	current := atomic.AddInt32(&watching, 1)
+	defer atomic.AddInt32(&watching, -1)
+	for {
+		if peak := atomic.LoadInt32(&maxWatching); current <= peak ||
+			atomic.CompareAndSwapInt32(&maxWatching, peak, current) {
+			break
+		}
+	}
+	if watch.Symbol == "EX" {
+		return StockQuote{}, errors.New("stock exchange is down")
+	}
+	select {
+	case <-time.After(watch.Delay):
+		return StockQuote{watch.Symbol, 10}, nil
+	case <-ctx.Done():
+		return StockQuote{}, ctx.Err()
+	}
+}
+
 type ScheduleTestSuite struct {
 	suite.Suite
 }
@@ -229,6 +263,116 @@ func (suite *ScheduleTestSuite) TestSchedule() {
 			}
 			suite.Equal([]string { "APPL", "stock exchange is down", "stock exchange is down"}, symbols)
 		})
+
+		suite.Run("Max Parallel", func() {
+			atomic.StoreInt32(&maxWatching, 0)
+			requests := make([]any, 6)
+			for i := range requests {
+				requests[i] = WatchStockQuote{"APPL", 20 * time.Millisecond}
+			}
+			s, err := api.ConcurrentWith(suite.Setup(), api.ConcurrentBatch{
+				Requests:    requests,
+				MaxParallel: 2,
+			}).Await()
+			suite.Nil(err)
+			suite.Len(s, 6)
+			for _, response := range s {
+				suite.Equal("APPL", either.Fold(response,
+					func(err error) string { return err.Error() },
+					func(quote any) string { return quote.(StockQuote).Symbol }))
+			}
+			suite.LessOrEqual(atomic.LoadInt32(&maxWatching), int32(2))
+		})
+
+		suite.Run("Fail Fast", func() {
+			s, err := api.ConcurrentWith(suite.Setup(), api.ConcurrentBatch{
+				Requests: []any{
+					WatchStockQuote{"APPL", 5 * time.Second},
+					WatchStockQuote{"EX", 0},
+					WatchStockQuote{"MSFT", 5 * time.Second},
+					WatchStockQuote{"GOOGL", 5 * time.Second},
+				},
+				MaxParallel: 2,
+				FailFast:    true,
+			}).Await()
+			suite.Nil(err)
+			suite.Len(s, 4)
+			either.Match(s[1], func(err error) {
+				suite.Equal("stock exchange is down", err.Error())
+			}, func(any) {
+				suite.Fail("expected failure")
+			})
+			for _, i := range []int{0, 2, 3} {
+				either.Match(s[i], func(err error) {
+					suite.ErrorIs(err, api.ErrBatchCanceled)
+				}, func(any) {
+					suite.Fail("expected cancellation")
+				})
+			}
+		})
+
+		suite.Run("Fail Fast In Flight", func() {
+			// in flight requests may observe the cancellation first
+			for i := 0; i < 20; i++ {
+				s, err := api.ConcurrentWith(suite.Setup(), api.ConcurrentBatch{
+					Requests: []any{
+						WatchStockQuote{"APPL", 5 * time.Second},
+						WatchStockQuote{"EX", time.Millisecond},
+					},
+					FailFast: true,
+				}).Await()
+				suite.Nil(err)
+				suite.Len(s, 2)
+				either.Match(s[0], func(err error) {
+					suite.Equal(api.ErrBatchCanceled, err)
+				}, func(any) {
+					suite.Fail("expected cancellation")
+				})
+			}
+		})
+
+		suite.Run("Timeout", func() {
+			start := time.Now()
+			s, err := api.ConcurrentWith(suite.Setup(), api.ConcurrentBatch{
+				Requests: []any{
+					WatchStockQuote{"APPL", 0},
+					WatchStockQuote{"MSFT", 5 * time.Second},
+				},
+				Timeout: 50 * time.Millisecond,
+			}).Await()
+			suite.Nil(err)
+			suite.Less(time.Since(start), time.Second)
+			suite.Len(s, 2)
+			either.Match(s[0], func(err error) {
+				suite.Fail("unexpected error", err)
+			}, func(quote any) {
+				suite.Equal("APPL", quote.(StockQuote).Symbol)
+			})
+			either.Match(s[1], func(err error) {
+				suite.ErrorIs(err, context.DeadlineExceeded)
+			}, func(any) {
+				suite.Fail("expected timeout")
+			})
+		})
+
+		suite.Run("Context", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 50 * time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			handler := miruken.BuildUp(suite.Setup(), provides.With(ctx))
+			s, err := api.ConcurrentWith(handler, api.ConcurrentBatch{
+				Requests: []any{WatchStockQuote{"MSFT", 5 * time.Second}},
+				Timeout:  10 * time.Second,
+			}).Await()
+			suite.Nil(err)
+			suite.Less(time.Since(start), time.Second)
+			suite.Len(s, 1)
+			either.Match(s[0], func(err error) {
+				suite.ErrorIs(err, context.DeadlineExceeded)
+			}, func(any) {
+				suite.Fail("expected cancellation")
+			})
+		})
 	})
 }
 
@@ -8,6 +8,8 @@ import (
 	"github.com/miruken-go/miruken/promise"
 	"github.com/miruken-go/miruken/provides"
 	"github.com/stretchr/testify/suite"
+	"net/textproto"
+	"strings"
 	"testing"
 )
 
@@ -33,8 +35,23 @@ type (
 	CancelOrderFilter struct {}
 
 	OrderHandler struct {}
+
+	Tenant string
+
+	Flags []string
+
+	Quota int
 )
 
+func (f Flags) MarshalText() ([]byte, error) {
+	return []byte(strings.Join(f, ",")), nil
+}
+
+func (f *Flags) UnmarshalText(text []byte) error {
+	*f = strings.Split(string(text), ",")
+	return nil
+}
+
 func (c *CancelOrderFilter) Order() int {
 	return miruken.FilterStage
 }
@@ -156,6 +173,58 @@ func (suite *StashTestSuite) TestStash() {
 		suite.Nil(err)
 		suite.NotNil(order)
 	})
+
+	suite.Run("Propagate", func() {
+		propagate := api.Propagate(
+			api.PropagateType[Tenant]("Tenant"),
+			api.PropagateKey[Flags]("flags", "Feature-Flags"))
+
+		suite.Run("ToHeader", func() {
+			handler := miruken.BuildUp(suite.Setup(), propagate)
+			suite.Nil(api.StashPut(handler, Tenant("acme")))
+			suite.Nil(api.StashPutKey(handler, "flags", Flags{"beta", "dark"}))
+			header := textproto.MIMEHeader{}
+			suite.Nil(api.StashToHeader(handler, header))
+			suite.Equal("acme", header.Get("Miruken-Stash-Tenant"))
+			suite.Equal("beta,dark", header.Get("Miruken-Stash-Feature-Flags"))
+		})
+
+		suite.Run("ToHeaderMissing", func() {
+			handler := miruken.BuildUp(suite.Setup(), propagate)
+			header  := textproto.MIMEHeader{}
+			suite.Nil(api.StashToHeader(handler, header))
+			suite.Empty(header)
+		})
+
+		suite.Run("FromHeader", func() {
+			handler := miruken.BuildUp(suite.Setup(), propagate)
+			header  := textproto.MIMEHeader{}
+			header.Set("Miruken-Stash-Tenant", "acme")
+			header.Set("Miruken-Stash-Feature-Flags", "beta")
+			suite.Nil(api.StashFromHeader(handler, header))
+			tenant, ok := api.StashGet[Tenant](handler)
+			suite.True(ok)
+			suite.Equal(Tenant("acme"), tenant)
+			flags, ok := api.StashGetKey(handler, "flags")
+			suite.True(ok)
+			suite.Equal(Flags{"beta"}, flags)
+		})
+
+		suite.Run("NotDeclared", func() {
+			handler := suite.Setup()
+			header  := textproto.MIMEHeader{}
+			header.Set("Miruken-Stash-Tenant", "acme")
+			suite.Nil(api.StashFromHeader(handler, header))
+			_, ok := api.StashGet[Tenant](handler)
+			suite.False(ok)
+		})
+
+		suite.Run("NotSerializable", func() {
+			suite.Panics(func() {
+				api.PropagateType[Quota]("Quota")
+			})
+		})
+	})
 }
 
 func TestStashTestSuite(t *testing.T) {
@@ -0,0 +1,139 @@
+package test
+
+import (
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/creates"
+	"github.com/miruken-go/miruken/handles"
+	"github.com/miruken-go/miruken/internal"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type (
+	ShipOrder struct {
+		_       struct{} `typeid:"orders.ShipOrder, orders.Ship"`
+		OrderId int
+	}
+
+	RefundOrder struct {
+		OrderId int
+	}
+
+	ShipOrderV0 struct {
+		_ struct{} `typeid:"orders.Ship"`
+	}
+
+	Untyped struct {}
+
+	ShippingHandler struct {}
+
+	// ShippingFeature installs the api.Feature as a dependency.
+	ShippingFeature struct {
+		api miruken.Feature
+	}
+)
+
+func (r RefundOrder) TypeId() string {
+	return "orders.RefundOrder"
+}
+
+func (r RefundOrder) TypeIdAliases() []string {
+	return []string{"Orders.Refund"}
+}
+
+func (s *ShippingHandler) Ship(
+	_ *handles.It, ship ShipOrder,
+) int {
+	return ship.OrderId
+}
+
+func (f *ShippingFeature) DependsOn() []miruken.Feature {
+	return []miruken.Feature{f.api}
+}
+
+func (f *ShippingFeature) Install(*miruken.SetupBuilder) error {
+	return nil
+}
+
+type TypeIdTestSuite struct {
+	suite.Suite
+}
+
+func (suite *TypeIdTestSuite) Setup(
+	config ...func(*api.Installer),
+) (miruken.Handler, error) {
+	return miruken.Setup(TestFeature, api.Feature(config...)).Handler()
+}
+
+func (suite *TypeIdTestSuite) TestTypeId() {
+	suite.Run("Tag", func() {
+		id, ok := api.TypeIdOf(internal.TypeOf[ShipOrder]())
+		suite.True(ok)
+		suite.Equal("orders.ShipOrder", id)
+		id, ok = api.TypeIdOf(internal.TypeOf[*ShipOrder]())
+		suite.True(ok)
+		suite.Equal("orders.ShipOrder", id)
+	})
+
+	suite.Run("Method", func() {
+		id, ok := api.TypeIdOf(internal.TypeOf[RefundOrder]())
+		suite.True(ok)
+		suite.Equal("orders.RefundOrder", id)
+	})
+
+	suite.Run("Missing", func() {
+		_, ok := api.TypeIdOf(internal.TypeOf[Untyped]())
+		suite.False(ok)
+	})
+
+	suite.Run("Registry", func() {
+		registry, err := api.NewTypeRegistry(ShipOrder{}, RefundOrder{})
+		suite.Nil(err)
+		typ, ok := registry.Type("orders.Ship")
+		suite.True(ok)
+		suite.Equal(internal.TypeOf[ShipOrder](), typ)
+		typ, ok = registry.Type("Orders.Refund")
+		suite.True(ok)
+		suite.Equal(internal.TypeOf[RefundOrder](), typ)
+		id, ok := registry.TypeId(internal.TypeOf[*RefundOrder]())
+		suite.True(ok)
+		suite.Equal("orders.RefundOrder", id)
+	})
+
+	suite.Run("Create", func() {
+		handler, err := suite.Setup(api.Types(RefundOrder{}))
+		suite.Nil(err)
+		ship, _, err := creates.Key[any](handler, "orders.Ship")
+		suite.Nil(err)
+		suite.IsType(&ShipOrder{}, ship)
+		refund, _, err := creates.Key[any](handler, "Orders.Refund")
+		suite.Nil(err)
+		suite.IsType(&RefundOrder{}, refund)
+	})
+
+	suite.Run("Duplicate", func() {
+		_, err := suite.Setup(api.Types(ShipOrderV0{}))
+		var dup *api.DuplicateTypeIdError
+		suite.ErrorAs(err, &dup)
+		suite.Equal("orders.Ship", dup.TypeId)
+	})
+
+	suite.Run("Duplicate Dependency", func() {
+		_, err := miruken.Setup(TestFeature,
+			&ShippingFeature{api.Feature(api.Types(ShipOrderV0{}))}).Handler()
+		var dup *api.DuplicateTypeIdError
+		suite.ErrorAs(err, &dup)
+		suite.Equal("orders.Ship", dup.TypeId)
+	})
+
+	suite.Run("Register Missing", func() {
+		_, err := suite.Setup(api.Types(Untyped{}))
+		var missing *api.MissingTypeIdError
+		suite.ErrorAs(err, &missing)
+	})
+}
+
+func TestTypeIdTestSuite(t *testing.T) {
+	suite.Run(t, new(TypeIdTestSuite))
+}
@@ -0,0 +1,124 @@
+package test
+
+import (
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/maps"
+	"github.com/stretchr/testify/suite"
+	"strings"
+	"testing"
+)
+
+type (
+	PlaceOrderV1 struct {
+		Item string
+	}
+
+	PlaceOrderV2 struct {
+		Item     string
+		Quantity int
+	}
+
+	PlaceOrder struct {
+		Sku      string
+		Quantity int
+	}
+
+	Downgrade struct {
+		Version int
+	}
+
+	Loop struct {}
+
+	OrderUpcaster struct {}
+)
+
+func (p PlaceOrderV1) SchemaVersion() int { return 1 }
+func (p PlaceOrderV2) SchemaVersion() int { return 2 }
+func (p PlaceOrder) SchemaVersion() int   { return 3 }
+func (d Downgrade) SchemaVersion() int    { return d.Version }
+
+func (u *OrderUpcaster) V1(
+	_*struct{
+		maps.It
+		maps.Format `to:"api:upcast"`
+	  }, v1 PlaceOrderV1,
+) PlaceOrderV2 {
+	return PlaceOrderV2{Item: v1.Item, Quantity: 1}
+}
+
+func (u *OrderUpcaster) V2(
+	_*struct{
+		maps.It
+		maps.Format `to:"api:upcast"`
+	  }, v2 PlaceOrderV2,
+) PlaceOrder {
+	return PlaceOrder{Sku: strings.ToUpper(v2.Item), Quantity: v2.Quantity}
+}
+
+func (u *OrderUpcaster) Downgrade(
+	_*struct{
+		maps.It
+		maps.Format `to:"api:upcast"`
+	  }, d Downgrade,
+) Downgrade {
+	return Downgrade{d.Version - 1}
+}
+
+func (u *OrderUpcaster) Loop(
+	_*struct{
+		maps.It
+		maps.Format `to:"api:upcast"`
+	  }, l Loop,
+) Loop {
+	return l
+}
+
+type VersionTestSuite struct {
+	suite.Suite
+}
+
+func (suite *VersionTestSuite) Setup() miruken.Handler {
+	handler, _ := miruken.Setup(
+		TestFeature,
+		api.Feature(),
+	).Handler()
+	return handler
+}
+
+func (suite *VersionTestSuite) TestUpcast() {
+	suite.Run("Chain", func() {
+		order, err := api.Upcast(suite.Setup(), PlaceOrderV1{Item: "book"})
+		suite.Nil(err)
+		suite.Equal(PlaceOrder{Sku: "BOOK", Quantity: 1}, order)
+	})
+
+	suite.Run("Pointer", func() {
+		order, err := api.Upcast(suite.Setup(), &PlaceOrderV2{Item: "pen", Quantity: 3})
+		suite.Nil(err)
+		suite.Equal(PlaceOrder{Sku: "PEN", Quantity: 3}, order)
+	})
+
+	suite.Run("Current", func() {
+		current := PlaceOrder{Sku: "CUP", Quantity: 2}
+		order, err := api.Upcast(suite.Setup(), current)
+		suite.Nil(err)
+		suite.Equal(current, order)
+	})
+
+	suite.Run("Version Must Increase", func() {
+		_, err := api.Upcast(suite.Setup(), Downgrade{2})
+		var upcast *api.UpcastError
+		suite.ErrorAs(err, &upcast)
+		suite.ErrorIs(err, api.ErrUpcastVersion)
+	})
+
+	suite.Run("Cycle", func() {
+		_, err := api.Upcast(suite.Setup(), Loop{})
+		suite.ErrorIs(err, api.ErrUpcastCycle)
+	})
+}
+
+func TestVersionTestSuite(t *testing.T) {
+	suite.Run(t, new(VersionTestSuite))
+}
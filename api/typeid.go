@@ -0,0 +1,247 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/creates"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+type (
+	// TypeIdentifier is implemented by types with a stable type id.
+	// The id is used in place of the go type name as the polymorphic
+	// discriminator so packages can be refactored without breaking
+	// the wire format.
+	TypeIdentifier interface {
+		TypeId() string
+	}
+
+	// TypeIdAliases is implemented by TypeIdentifier types that
+	// must also accept legacy type ids.
+	TypeIdAliases interface {
+		TypeIdAliases() []string
+	}
+
+	// TypeRegistry maps stable type ids and their aliases to types.
+	// Types declare a stable id by implementing TypeIdentifier or
+	// tagging a field with `typeid:"id,alias1,alias2"`.
+	//
+	//  type CreateOrder struct {
+	//      _   struct{} `typeid:"orders.CreateOrder,Orders.Create"`
+	//      Sku string
+	//  }
+	TypeRegistry struct {
+		lock  sync.RWMutex
+		ids   map[reflect.Type]string
+		types map[string]reflect.Type
+		errs  []error
+	}
+
+	// DuplicateTypeIdError reports a type id claimed by multiple types.
+	DuplicateTypeIdError struct {
+		TypeId   string
+		Type     reflect.Type
+		Existing reflect.Type
+	}
+
+	// MissingTypeIdError reports a type without a stable type id.
+	MissingTypeIdError struct {
+		Type reflect.Type
+	}
+
+	// typeIds holds the stable id and aliases of a type.
+	typeIds struct {
+		id      string
+		aliases []string
+	}
+)
+
+
+// NoConstructor prevents TypeRegistry from being created implicitly.
+func (r *TypeRegistry) NoConstructor() {}
+
+// Register adds the types with stable ids to the registry.
+func (r *TypeRegistry) Register(types ...any) error {
+	var errs []error
+	for _, t := range types {
+		typ, ok := t.(reflect.Type)
+		if !ok {
+			typ = reflect.TypeOf(t)
+		}
+		if err := r.register(typ, true); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// TypeId returns the stable id registered for the type.
+func (r *TypeRegistry) TypeId(typ reflect.Type) (string, bool) {
+	typ = baseType(typ)
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	id, ok := r.ids[typ]
+	return id, ok
+}
+
+// Type returns the type registered for the id or alias.
+func (r *TypeRegistry) Type(id string) (reflect.Type, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	typ, ok := r.types[id]
+	return typ, ok
+}
+
+func (r *TypeRegistry) New(
+	_*struct{creates.Strict}, create *creates.It,
+) any {
+	if id, ok := create.Key().(string); ok {
+		if typ, ok := r.Type(id); ok {
+			return reflect.New(typ).Interface()
+		}
+	}
+	return nil
+}
+
+func (r *TypeRegistry) HandlerInfoCreated(
+	_ *miruken.HandlerInfo,
+) {
+}
+
+// BindingCreated registers the message types with stable ids
+// handled by the bindings to detect duplicates during setup.
+func (r *TypeRegistry) BindingCreated(
+	_       miruken.Policy,
+	_       *miruken.HandlerInfo,
+	binding miruken.Binding,
+) {
+	if typ, ok := binding.Key().(reflect.Type); ok {
+		if err := r.register(typ, false); err != nil {
+			r.lock.Lock()
+			r.errs = append(r.errs, err)
+			r.lock.Unlock()
+		}
+	}
+}
+
+// Err returns the errors detected while registering types.
+func (r *TypeRegistry) Err() error {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if len(r.errs) > 0 {
+		return errors.Join(r.errs...)
+	}
+	return nil
+}
+
+func (r *TypeRegistry) register(
+	typ      reflect.Type,
+	required bool,
+) error {
+	if typ = baseType(typ); typ == nil {
+		return nil
+	}
+	ids, ok := typeIdsOf(typ)
+	if !ok {
+		if required {
+			return &MissingTypeIdError{typ}
+		}
+		return nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if existing, ok := r.types[ids.id]; ok && existing != typ {
+		return &DuplicateTypeIdError{ids.id, typ, existing}
+	}
+	for _, alias := range ids.aliases {
+		if existing, ok := r.types[alias]; ok && existing != typ {
+			return &DuplicateTypeIdError{alias, typ, existing}
+		}
+	}
+	r.ids[typ] = ids.id
+	r.types[ids.id] = typ
+	for _, alias := range ids.aliases {
+		r.types[alias] = typ
+	}
+	return nil
+}
+
+
+func (e *DuplicateTypeIdError) Error() string {
+	return fmt.Sprintf("type id %q of %v is already registered to %v",
+		e.TypeId, e.Type, e.Existing)
+}
+
+func (e *MissingTypeIdError) Error() string {
+	return fmt.Sprintf("type %v does not declare a stable type id", e.Type)
+}
+
+
+// NewTypeRegistry creates a TypeRegistry containing the types.
+func NewTypeRegistry(types ...any) (*TypeRegistry, error) {
+	registry := &TypeRegistry{
+		ids:   make(map[reflect.Type]string),
+		types: make(map[string]reflect.Type),
+	}
+	return registry, registry.Register(types...)
+}
+
+// TypeIdOf returns the stable type id declared by the type.
+func TypeIdOf(typ reflect.Type) (string, bool) {
+	if ids, ok := typeIdsOf(baseType(typ)); ok {
+		return ids.id, true
+	}
+	return "", false
+}
+
+func typeIdsOf(typ reflect.Type) (typeIds, bool) {
+	if typ == nil {
+		return typeIds{}, false
+	}
+	if ids, ok := typeIdCache.Load(typ); ok {
+		ids := ids.(typeIds)
+		return ids, len(ids.id) > 0
+	}
+	var ids typeIds
+	if typ.Implements(typeIdentifierType) || reflect.PointerTo(typ).Implements(typeIdentifierType) {
+		v := reflect.New(typ).Interface()
+		ids.id = v.(TypeIdentifier).TypeId()
+		if aliases, ok := v.(TypeIdAliases); ok {
+			ids.aliases = aliases.TypeIdAliases()
+		}
+	} else if typ.Kind() == reflect.Struct {
+		for i := 0; i < typ.NumField(); i++ {
+			if tag, ok := typ.Field(i).Tag.Lookup("typeid"); ok {
+				parts := strings.Split(tag, ",")
+				ids.id = strings.TrimSpace(parts[0])
+				for _, alias := range parts[1:] {
+					if alias = strings.TrimSpace(alias); len(alias) > 0 {
+						ids.aliases = append(ids.aliases, alias)
+					}
+				}
+				break
+			}
+		}
+	}
+	typeIdCache.Store(typ, ids)
+	return ids, len(ids.id) > 0
+}
+
+func baseType(typ reflect.Type) reflect.Type {
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ
+}
+
+
+var (
+	typeIdCache        sync.Map
+	typeIdentifierType = reflect.TypeOf((*TypeIdentifier)(nil)).Elem()
+)
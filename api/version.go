@@ -0,0 +1,92 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/internal"
+	"github.com/miruken-go/miruken/maps"
+)
+
+type (
+	// Versioned is implemented by messages with an evolving schema.
+	// The SchemaVersion must increase with each revision so older
+	// messages can be upcast to the current version.
+	Versioned interface {
+		SchemaVersion() int
+	}
+
+	// UpcastError reports a message that could not be upcast.
+	UpcastError struct {
+		Message any
+		Reason  error
+	}
+)
+
+
+var (
+	// ToUpcast formats a message into the next version of its schema.
+	// Upcasters are maps.It bindings from an older message type into
+	// a newer one and are chained until no more apply.
+	//
+	//  func (u *OrderUpcaster) V1(
+	//      _*struct{
+	//          maps.It
+	//          maps.Format `to:"api:upcast"`
+	//        }, v1 CreateOrderV1,
+	//  ) CreateOrder
+	ToUpcast = maps.To("api:upcast", nil)
+
+	// ErrUpcastCycle reports upcasters that never reach a final version.
+	ErrUpcastCycle = errors.New("too many upcasts")
+
+	// ErrUpcastVersion reports an upcaster that did not increase the version.
+	ErrUpcastVersion = errors.New("schema version must increase")
+)
+
+
+func (e *UpcastError) Error() string {
+	return fmt.Sprintf("upcast %T: %s", e.Message, e.Reason.Error())
+}
+
+func (e *UpcastError) Unwrap() error {
+	return e.Reason
+}
+
+
+// Upcast applies the registered upcasters to the message until
+// it reaches the latest version of its schema.
+// The message is returned unchanged if no upcasters apply.
+func Upcast(
+	handler miruken.Handler,
+	message any,
+) (any, error) {
+	if internal.IsNil(handler) {
+		panic("handler cannot be nil")
+	}
+	for i := 0; i < maxUpcasts; i++ {
+		if internal.IsNil(message) {
+			return message, nil
+		}
+		next, _, _, err := maps.Out[any](handler, message, ToUpcast)
+		if err != nil {
+			var nh *miruken.NotHandledError
+			if errors.As(err, &nh) {
+				return message, nil
+			}
+			return nil, &UpcastError{message, err}
+		} else if internal.IsNil(next) {
+			return message, nil
+		}
+		if from, ok := message.(Versioned); ok {
+			if to, ok := next.(Versioned); ok && to.SchemaVersion() <= from.SchemaVersion() {
+				return nil, &UpcastError{message, ErrUpcastVersion}
+			}
+		}
+		message = next
+	}
+	return nil, &UpcastError{message, ErrUpcastCycle}
+}
+
+
+const maxUpcasts = 32
@@ -0,0 +1,107 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type (
+	// Status of a Check or Report.
+	Status string
+
+	// Check is provided by handlers to contribute to the
+	// health of the application.  All checks contribute to
+	// readiness and Live checks also contribute to liveness.
+	// Optional checks degrade rather than fail the application.
+	Check struct {
+		Name     string
+		Live     bool
+		Optional bool
+		Timeout  time.Duration
+		Probe    func(context.Context) error
+	}
+
+	// Result of evaluating a Check.
+	Result struct {
+		Name     string        `json:"name"`
+		Status   Status        `json:"status"`
+		Error    string        `json:"error,omitempty"`
+		Duration time.Duration `json:"duration"`
+	}
+
+	// Report aggregates the results of the checks.
+	Report struct {
+		Status  Status    `json:"status"`
+		Checks  []Result  `json:"checks,omitempty"`
+		Checked time.Time `json:"checked"`
+	}
+
+	// TimeoutError reports a Check that did not
+	// complete within its timeout.
+	TimeoutError struct {
+		Timeout time.Duration
+	}
+)
+
+
+const (
+	StatusUp       Status = "up"
+	StatusDegraded Status = "degraded"
+	StatusDown     Status = "down"
+)
+
+
+func (e *TimeoutError) Error() string {
+	return "check timed out after " + e.Timeout.String()
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+
+// evaluate runs the probe bounded by the timeout.
+func (c *Check) evaluate(
+	ctx     context.Context,
+	timeout time.Duration,
+) Result {
+	if c.Timeout > 0 {
+		timeout = c.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done  := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("check panicked: %v", r)
+			}
+		}()
+		if probe := c.Probe; probe != nil {
+			done <- probe(ctx)
+		} else {
+			done <- nil
+		}
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = &TimeoutError{timeout}
+	}
+
+	result := Result{Name: c.Name, Status: StatusUp, Duration: time.Since(start)}
+	if err != nil {
+		result.Error = err.Error()
+		if c.Optional {
+			result.Status = StatusDegraded
+		} else {
+			result.Status = StatusDown
+		}
+	}
+	return result
+}
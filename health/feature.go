@@ -0,0 +1,41 @@
+package health
+
+import (
+	"github.com/miruken-go/miruken"
+)
+
+// Installer configures health support.
+type Installer struct {
+	options Options
+}
+
+func (i *Installer) Install(setup *miruken.SetupBuilder) error {
+	if setup.Tag(&featureTag) {
+		monitor := NewMonitor(i.options)
+		monitor.setup = setup
+		setup.Specs(&Monitor{}).
+			  Handlers(monitor)
+	}
+	return nil
+}
+
+// Configure customizes the evaluation of checks.
+func Configure(options Options) func(*Installer) {
+	return func(installer *Installer) {
+		installer.options = options
+	}
+}
+
+// Feature configures health support.
+// Checks are provided by handlers and evaluated on demand.
+func Feature(config ...func(*Installer)) miruken.Feature {
+	installer := &Installer{}
+	for _, configure := range config {
+		if configure != nil {
+			configure(installer)
+		}
+	}
+	return installer
+}
+
+var featureTag byte
@@ -0,0 +1,176 @@
+package health
+
+import (
+	"context"
+	"github.com/miruken-go/miruken"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// Options customize the evaluation of checks.
+	// Timeout bounds each Check unless overridden and
+	// reports are reused for CacheFor.
+	Options struct {
+		Timeout  time.Duration
+		CacheFor time.Duration
+	}
+
+	// Monitor evaluates the checks provided by handlers
+	// to report the liveness and readiness of the application.
+	Monitor struct {
+		options Options
+		setup   *miruken.SetupBuilder
+		lock    sync.Mutex
+		live    cachedReport
+		ready   cachedReport
+	}
+
+	// cachedReport retains the last report and the evaluation
+	// in progress so concurrent callers share a single flight.
+	cachedReport struct {
+		report  *Report
+		expires time.Time
+		flight  *flight
+	}
+
+	flight struct {
+		done   chan struct{}
+		report *Report
+		err    error
+	}
+)
+
+
+const defaultTimeout = 5 * time.Second
+
+
+// NewMonitor creates a new Monitor with the options.
+func NewMonitor(options Options) *Monitor {
+	return &Monitor{options: options}
+}
+
+// NoConstructor prevents Monitor from being created implicitly.
+func (m *Monitor) NoConstructor() {}
+
+// Live reports if the application is running.
+// Only the checks marked Live are evaluated.
+func (m *Monitor) Live(
+	ctx     context.Context,
+	handler miruken.Handler,
+) (*Report, error) {
+	return m.report(ctx, handler, &m.live, true)
+}
+
+// Ready reports if the application can accept requests.
+// All checks are evaluated and the application is down
+// if setup completed with errors.
+func (m *Monitor) Ready(
+	ctx     context.Context,
+	handler miruken.Handler,
+) (*Report, error) {
+	return m.report(ctx, handler, &m.ready, false)
+}
+
+// report returns the cached report or joins the evaluation
+// in progress.  The checks are evaluated outside the lock.
+func (m *Monitor) report(
+	ctx     context.Context,
+	handler miruken.Handler,
+	cache   *cachedReport,
+	live    bool,
+) (*Report, error) {
+	m.lock.Lock()
+	if cache.report != nil && time.Now().Before(cache.expires) {
+		report := cache.report
+		m.lock.Unlock()
+		return report, nil
+	}
+	f := cache.flight
+	if f == nil {
+		f = &flight{done: make(chan struct{})}
+		cache.flight = f
+		m.lock.Unlock()
+		// the evaluation is shared so is not bound to this caller
+		f.report, f.err = m.evaluate(context.WithoutCancel(ctx), handler, live)
+		m.lock.Lock()
+		if cacheFor := m.options.CacheFor; cacheFor > 0 && f.err == nil {
+			cache.report  = f.report
+			cache.expires = f.report.Checked.Add(cacheFor)
+		}
+		cache.flight = nil
+		m.lock.Unlock()
+		close(f.done)
+		return f.report, f.err
+	}
+	m.lock.Unlock()
+	select {
+	case <-f.done:
+		return f.report, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// evaluate runs the checks concurrently and aggregates the results.
+func (m *Monitor) evaluate(
+	ctx     context.Context,
+	handler miruken.Handler,
+	live    bool,
+) (*Report, error) {
+	now := time.Now()
+	checks, _, err := miruken.ResolveAll[Check](handler)
+	if err != nil {
+		return nil, err
+	}
+	if !live && m.setup != nil {
+		setup := m.setup
+		checks = append(checks, Check{
+			Name: "setup",
+			Probe: func(context.Context) error {
+				return setup.BuildErrors()
+			},
+		})
+	}
+
+	timeout := m.options.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	results := make([]Result, 0, len(checks))
+	var wg sync.WaitGroup
+	var rl sync.Mutex
+	for i := range checks {
+		check := &checks[i]
+		if live && !check.Live {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := check.evaluate(ctx, timeout)
+			rl.Lock()
+			results = append(results, result)
+			rl.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+
+	report := &Report{Status: StatusUp, Checks: results, Checked: now}
+	for _, result := range results {
+		if result.Status == StatusDown {
+			report.Status = StatusDown
+			break
+		} else if result.Status == StatusDegraded {
+			report.Status = StatusDegraded
+		}
+	}
+
+	return report, nil
+}
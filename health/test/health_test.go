@@ -0,0 +1,222 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/health"
+	"github.com/miruken-go/miruken/provides"
+	"github.com/stretchr/testify/suite"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type (
+	Database struct {
+		err   error
+		delay time.Duration
+		calls atomic.Int32
+	}
+
+	Cache struct {
+		err error
+	}
+
+	DatabaseCheck struct {
+		db *Database
+	}
+
+	CacheCheck struct {
+		cache *Cache
+	}
+
+	BrokenFeature struct {}
+)
+
+
+func (d *DatabaseCheck) Constructor(db *Database) {
+	d.db = db
+}
+
+func (d *DatabaseCheck) Health(
+	_*struct{provides.It},
+) health.Check {
+	db := d.db
+	return health.Check{
+		Name: "database",
+		Live: true,
+		Probe: func(ctx context.Context) error {
+			db.calls.Add(1)
+			select {
+			case <-time.After(db.delay):
+				return db.err
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	}
+}
+
+func (c *CacheCheck) Constructor(cache *Cache) {
+	c.cache = cache
+}
+
+func (c *CacheCheck) Health(
+	_*struct{provides.It},
+) health.Check {
+	cache := c.cache
+	return health.Check{
+		Name:     "cache",
+		Optional: true,
+		Timeout:  50 * time.Millisecond,
+		Probe: func(context.Context) error {
+			return cache.err
+		},
+	}
+}
+
+func (b BrokenFeature) Install(*miruken.SetupBuilder) error {
+	return errors.New("broken feature")
+}
+
+
+type HealthTestSuite struct {
+	suite.Suite
+}
+
+func (suite *HealthTestSuite) Setup(
+	config  []func(*health.Installer),
+	values  ...any,
+) (miruken.Handler, *health.Monitor) {
+	handler, err := miruken.Setup(health.Feature(config...)).
+		Specs(&DatabaseCheck{}, &CacheCheck{}).
+		With(values...).
+		Handler()
+	suite.Nil(err)
+	monitor, _, _ := provides.Type[*health.Monitor](handler)
+	return handler, monitor
+}
+
+func (suite *HealthTestSuite) TestHealth() {
+	suite.Run("Up", func() {
+		handler, monitor := suite.Setup(nil, &Database{}, &Cache{})
+		report, err := monitor.Ready(context.Background(), handler)
+		suite.Nil(err)
+		suite.Equal(health.StatusUp, report.Status)
+		suite.Len(report.Checks, 3)
+		suite.Equal("cache", report.Checks[0].Name)
+		suite.Equal("database", report.Checks[1].Name)
+		suite.Equal("setup", report.Checks[2].Name)
+	})
+
+	suite.Run("Live", func() {
+		handler, monitor := suite.Setup(nil, &Database{}, &Cache{err: errors.New("miss")})
+		report, err := monitor.Live(context.Background(), handler)
+		suite.Nil(err)
+		suite.Equal(health.StatusUp, report.Status)
+		suite.Len(report.Checks, 1)
+		suite.Equal("database", report.Checks[0].Name)
+	})
+
+	suite.Run("Degraded", func() {
+		handler, monitor := suite.Setup(nil, &Database{}, &Cache{err: errors.New("miss")})
+		report, err := monitor.Ready(context.Background(), handler)
+		suite.Nil(err)
+		suite.Equal(health.StatusDegraded, report.Status)
+		suite.Equal(health.StatusDegraded, report.Checks[0].Status)
+		suite.Equal("miss", report.Checks[0].Error)
+	})
+
+	suite.Run("Down", func() {
+		handler, monitor := suite.Setup(nil,
+			&Database{err: errors.New("refused")}, &Cache{err: errors.New("miss")})
+		report, err := monitor.Ready(context.Background(), handler)
+		suite.Nil(err)
+		suite.Equal(health.StatusDown, report.Status)
+		suite.Equal(health.StatusDown, report.Checks[1].Status)
+		suite.Equal("refused", report.Checks[1].Error)
+	})
+
+	suite.Run("Timeout", func() {
+		handler, monitor := suite.Setup(
+			[]func(*health.Installer){health.Configure(health.Options{
+				Timeout: 50 * time.Millisecond,
+			})},
+			&Database{delay: time.Second}, &Cache{})
+		start := time.Now()
+		report, err := monitor.Ready(context.Background(), handler)
+		suite.Nil(err)
+		suite.Less(time.Since(start), 500*time.Millisecond)
+		suite.Equal(health.StatusDown, report.Status)
+		suite.Equal("check timed out after 50ms", report.Checks[1].Error)
+	})
+
+	suite.Run("Cached", func() {
+		db := &Database{}
+		handler, monitor := suite.Setup(
+			[]func(*health.Installer){health.Configure(health.Options{
+				CacheFor: time.Minute,
+			})},
+			db, &Cache{})
+		first, err := monitor.Ready(context.Background(), handler)
+		suite.Nil(err)
+		second, err := monitor.Ready(context.Background(), handler)
+		suite.Nil(err)
+		suite.Same(first, second)
+		suite.Equal(int32(1), db.calls.Load())
+		_, err = monitor.Live(context.Background(), handler)
+		suite.Nil(err)
+		suite.Equal(int32(2), db.calls.Load())
+	})
+
+	suite.Run("Single Flight", func() {
+		db := &Database{delay: 100 * time.Millisecond}
+		handler, monitor := suite.Setup(nil, db, &Cache{})
+		reports := make(chan *health.Report, 3)
+		for i := 0; i < 3; i++ {
+			go func() {
+				report, _ := monitor.Ready(context.Background(), handler)
+				reports <- report
+			}()
+		}
+		first := <-reports
+		suite.Same(first, <-reports)
+		suite.Same(first, <-reports)
+		suite.Equal(int32(1), db.calls.Load())
+
+		// liveness is not blocked by readiness
+		db = &Database{delay: 200 * time.Millisecond}
+		handler, monitor = suite.Setup(nil, db, &Cache{})
+		start := time.Now()
+		go func() { _, _ = monitor.Ready(context.Background(), handler) }()
+		_, err := monitor.Live(context.Background(), handler)
+		suite.Nil(err)
+		suite.Less(time.Since(start), 350*time.Millisecond)
+	})
+
+	suite.Run("Setup Errors", func() {
+		handler, err := miruken.Setup(health.Feature(), BrokenFeature{}).Handler()
+		suite.NotNil(err)
+		monitor, _, _ := provides.Type[*health.Monitor](handler)
+		report, err := monitor.Ready(context.Background(), handler)
+		suite.Nil(err)
+		suite.Equal(health.StatusDown, report.Status)
+		suite.Equal("setup", report.Checks[0].Name)
+		suite.Contains(report.Checks[0].Error, "broken feature")
+		report, err = monitor.Live(context.Background(), handler)
+		suite.Nil(err)
+		suite.Equal(health.StatusUp, report.Status)
+	})
+
+	suite.Run("Resolve", func() {
+		handler, monitor := suite.Setup(nil)
+		m, _, err := provides.Type[*health.Monitor](handler)
+		suite.Nil(err)
+		suite.Same(monitor, m)
+	})
+}
+
+func TestHealthTestSuite(t *testing.T) {
+	suite.Run(t, new(HealthTestSuite))
+}
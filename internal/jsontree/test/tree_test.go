@@ -0,0 +1,57 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/miruken-go/miruken/internal/jsontree"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+type TreeTestSuite struct {
+	suite.Suite
+}
+
+func (suite *TreeTestSuite) TestTree() {
+	suite.Run("Parse", func() {
+		tree, err := jsontree.Parse([]byte(`{"z":1,"a":[true,null,"x"],"m":2.5}`))
+		suite.Nil(err)
+		suite.Equal(jsontree.Object{
+			{Key: "z", Value: json.Number("1")},
+			{Key: "a", Value: []any{true, nil, "x"}},
+			{Key: "m", Value: json.Number("2.5")},
+		}, tree)
+	})
+
+	suite.Run("ParseTrailing", func() {
+		_, err := jsontree.Parse([]byte(`{} {}`))
+		suite.NotNil(err)
+	})
+
+	suite.Run("Write", func() {
+		var buf bytes.Buffer
+		err := jsontree.Write(&buf, jsontree.Object{
+			{Key: "z", Value: int64(-1)},
+			{Key: "a", Value: []any{uint64(18446744073709551615), float32(1.5), []byte{1, 2}}},
+		})
+		suite.Nil(err)
+		suite.Equal(`{"z":-1,"a":[18446744073709551615,1.5,"AQI="]}`, buf.String())
+	})
+
+	suite.Run("Number", func() {
+		for n, expected := range map[json.Number]any{
+			"42":                   int64(42),
+			"-7":                   int64(-7),
+			"18446744073709551615": uint64(18446744073709551615),
+			"0.25":                 0.25,
+		} {
+			v, err := jsontree.Number(n)
+			suite.Nil(err)
+			suite.Equal(expected, v)
+		}
+	})
+}
+
+func TestTreeTestSuite(t *testing.T) {
+	suite.Run(t, new(TreeTestSuite))
+}
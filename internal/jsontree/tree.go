@@ -0,0 +1,156 @@
+package jsontree
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+type (
+	// Member is a named value of an Object.
+	Member struct {
+		Key   string
+		Value any
+	}
+
+	// Object is a json object preserving the order of its members.
+	Object []Member
+)
+
+
+// MaxDepth is the maximum nesting of arrays and objects.
+const MaxDepth = 10000
+
+var ErrMaxDepth = errors.New("exceeded max depth")
+
+
+// Parse decodes json into a tree of Object, []any, json.Number,
+// string, bool and nil values.
+func Parse(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	v, err := parse(dec, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("invalid character after top-level value")
+	}
+	return v, nil
+}
+
+// Write encodes a tree as json.  In addition to the values
+// produced by Parse, integers, floats and []byte are supported.
+func Write(buf *bytes.Buffer, v any) error {
+	switch t := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(t))
+	case json.Number:
+		buf.WriteString(string(t))
+	case int64:
+		buf.WriteString(strconv.FormatInt(t, 10))
+	case uint64:
+		buf.WriteString(strconv.FormatUint(t, 10))
+	case string, float32, float64, []byte:
+		js, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		buf.Write(js)
+	case []any:
+		buf.WriteByte('[')
+		for i, item := range t {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := Write(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case Object:
+		buf.WriteByte('{')
+		for i, member := range t {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := Write(buf, member.Key); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := Write(buf, member.Value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("unsupported json value %T", v)
+	}
+	return nil
+}
+// Number converts the json number to the narrowest of
+// int64, uint64 or float64 able to represent it.
+func Number(n json.Number) (any, error) {
+	s := string(n)
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, nil
+	}
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return u, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %q", s)
+	}
+	return f, nil
+}
+
+
+func parse(dec *json.Decoder, depth int) (any, error) {
+	if depth > MaxDepth {
+		return nil, ErrMaxDepth
+	}
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '[':
+			items := make([]any, 0)
+			for dec.More() {
+				item, err := parse(dec, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+			_, err = dec.Token()
+			return items, err
+		case '{':
+			obj := make(Object, 0)
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := parse(dec, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				obj = append(obj, Member{key.(string), value})
+			}
+			_, err = dec.Token()
+			return obj, err
+		}
+		return nil, fmt.Errorf("unexpected delimiter %v", t)
+	default:
+		return t, nil
+	}
+}
@@ -0,0 +1,298 @@
+package transcode
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/internal"
+	"github.com/miruken-go/miruken/internal/jsontree"
+	"github.com/miruken-go/miruken/maps"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Codec converts between a binary format and a json tree.
+// Values are encoded to and decoded from json using the
+// installed json mappers, so polymorphism, surrogates and
+// either values are represented identically in every format.
+type Codec struct {
+	// Name prefixes the errors of the format.
+	Name string
+
+	// Encode writes the tree in the binary format.
+	// The tree may contain []byte values for binary data.
+	Encode func(buf *bytes.Buffer, tree any) error
+
+	// Decode reads the binary format into a tree.
+	Decode func(data []byte) (any, error)
+}
+
+
+// To maps the source of the mapping into the *[]byte
+// or *io.Writer target using the codec.
+func To(
+	it       *maps.It,
+	composer miruken.Handler,
+	codec    Codec,
+) (any, error) {
+	switch t := it.Target().(type) {
+	case *[]byte:
+		byt, err := encode(it, composer, codec)
+		if err != nil {
+			return nil, err
+		}
+		*t = byt
+		return *t, nil
+	case *io.Writer:
+		byt, err := encode(it, composer, codec)
+		if err != nil {
+			return nil, err
+		}
+		if internal.IsNil(*t) {
+			*t = new(bytes.Buffer)
+		}
+		if _, err = (*t).Write(byt); err != nil {
+			return nil, err
+		}
+		return *t, nil
+	}
+	return nil, nil
+}
+
+// From maps the data into the target of the mapping using the codec.
+func From(
+	it       *maps.It,
+	data     []byte,
+	composer miruken.Handler,
+	codec    Codec,
+) (any, error) {
+	tree, err := codec.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	var js bytes.Buffer
+	if err = jsontree.Write(&js, tree); err != nil {
+		return nil, fmt.Errorf("%s: %w", codec.Name, err)
+	}
+	target := it.TargetForWrite()
+	var src any = js.Bytes()
+	if _, ok := target.(*api.Message); ok {
+		// message surrogates decode from a reader
+		src = bytes.NewReader(js.Bytes())
+	}
+	_, _, err = maps.Into(composer, src, &target, api.FromJson)
+	return target, err
+}
+
+// FromReader maps the data read into the target of
+// the mapping using the codec.
+func FromReader(
+	it       *maps.It,
+	reader   io.Reader,
+	composer miruken.Handler,
+	codec    Codec,
+) (any, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	return From(it, data, composer, codec)
+}
+
+
+// encode encodes the source of the mapping as json and
+// writes the json tree with the codec.
+func encode(
+	it       *maps.It,
+	composer miruken.Handler,
+	codec    Codec,
+) ([]byte, error) {
+	var js bytes.Buffer
+	out := io.Writer(&js)
+	_, _, err := maps.Into(composer, it.Source(), &out, api.ToJson)
+	it.TargetForWrite()
+	if err != nil {
+		return nil, err
+	}
+	tree, err := jsontree.Parse(js.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", codec.Name, err)
+	}
+	tree = binary(tree, reflect.ValueOf(it.Source()), 0)
+	var buf bytes.Buffer
+	if err = codec.Encode(&buf, tree); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// binary replaces the base64 strings json uses for []byte
+// values of the source with the bytes so they are encoded
+// natively.  Members of the tree that cannot be matched to
+// the source are left unchanged.
+func binary(tree any, v reflect.Value, depth int) any {
+	if depth > jsontree.MaxDepth {
+		return tree
+	}
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return tree
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() || marshals(v.Type()) {
+		return tree
+	}
+	switch t := tree.(type) {
+	case string:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			if byt, err := base64.StdEncoding.DecodeString(t); err == nil {
+				return byt
+			}
+		}
+	case []any:
+		if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+			for i := range t {
+				if i < v.Len() {
+					t[i] = binary(t[i], v.Index(i), depth+1)
+				}
+			}
+		}
+	case jsontree.Object:
+		switch v.Kind() {
+		case reflect.Struct:
+			fields := fieldsOf(v.Type())
+			for i, member := range t {
+				if index, ok := fields.lookup(member.Key); ok {
+					if field, err := v.FieldByIndexErr(index); err == nil {
+						t[i].Value = binary(member.Value, field, depth+1)
+					}
+				}
+			}
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				break
+			}
+			for i, member := range t {
+				key := reflect.ValueOf(member.Key).Convert(v.Type().Key())
+				if value := v.MapIndex(key); value.IsValid() {
+					t[i].Value = binary(member.Value, value, depth+1)
+				}
+			}
+		case reflect.Slice, reflect.Array:
+			// polymorphic collections wrap their values
+			for i, member := range t {
+				if member.Key == "@values" || member.Key == "$values" {
+					t[i].Value = binary(member.Value, v, depth+1)
+				}
+			}
+		}
+	}
+	return tree
+}
+
+// marshals returns true if the type controls its own json.
+func marshals(typ reflect.Type) bool {
+	ptr := reflect.PointerTo(typ)
+	return typ.Implements(marshalerType) || ptr.Implements(marshalerType) ||
+		typ.Implements(textMarshalerType) || ptr.Implements(textMarshalerType)
+}
+
+
+// fields maps the json names of struct fields to their index.
+type fields map[string][]int
+
+// lookup returns the field with the exact name or the
+// first field in declaration order matching without case.
+func (f fields) lookup(name string) ([]int, bool) {
+	if index, ok := f[name]; ok {
+		return index, true
+	}
+	var match []int
+	for key, index := range f {
+		if strings.EqualFold(key, name) && (match == nil || less(index, match)) {
+			match = index
+		}
+	}
+	return match, match != nil
+}
+
+func less(a, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// fieldsOf returns the json fields of the struct type.
+// Fields of embedded structs are promoted unless hidden
+// by a shallower field with the same name.
+func fieldsOf(typ reflect.Type) fields {
+	if f, ok := fieldCache.Load(typ); ok {
+		return f.(fields)
+	}
+	type level struct {
+		typ   reflect.Type
+		index []int
+	}
+	f    := make(fields)
+	next := []level{{typ, nil}}
+	for depth := 0; len(next) > 0 && depth < maxEmbedding; depth++ {
+		current := next
+		next = nil
+		found := make(fields)
+		for _, l := range current {
+			for i := 0; i < l.typ.NumField(); i++ {
+				field := l.typ.Field(i)
+				tag   := field.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				index := append(append([]int(nil), l.index...), i)
+				name, _, _ := strings.Cut(tag, ",")
+				if field.Anonymous && len(name) == 0 {
+					ft := field.Type
+					if ft.Kind() == reflect.Pointer {
+						ft = ft.Elem()
+					}
+					if ft.Kind() == reflect.Struct {
+						next = append(next, level{ft, index})
+						continue
+					}
+				}
+				if !field.IsExported() {
+					continue
+				}
+				if len(name) == 0 {
+					name = field.Name
+				}
+				if _, ok := f[name]; !ok {
+					if _, ok := found[name]; !ok {
+						found[name] = index
+					}
+				}
+			}
+		}
+		for name, index := range found {
+			f[name] = index
+		}
+	}
+	fieldCache.Store(typ, f)
+	return f
+}
+
+const maxEmbedding = 16
+
+var (
+	fieldCache        sync.Map
+	marshalerType     = internal.TypeOf[json.Marshaler]()
+	textMarshalerType = internal.TypeOf[encoding.TextMarshaler]()
+)
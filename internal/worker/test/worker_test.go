@@ -0,0 +1,75 @@
+package test
+
+import (
+	"context"
+	"github.com/miruken-go/miruken/internal/worker"
+	"github.com/stretchr/testify/suite"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type WorkerTestSuite struct {
+	suite.Suite
+}
+
+func (suite *WorkerTestSuite) TestWorker() {
+	suite.Run("Start", func() {
+		var w worker.Worker
+		var polls atomic.Int32
+		suite.True(w.Start(2, time.Hour, func(context.Context) {
+			polls.Add(1)
+		}))
+		suite.False(w.Start(1, time.Hour, func(context.Context) {}))
+		suite.Eventually(func() bool {
+			return polls.Load() == 2
+		}, time.Second, time.Millisecond)
+		suite.True(w.Close())
+		suite.False(w.Close())
+	})
+
+	suite.Run("Notify", func() {
+		var w worker.Worker
+		polled := make(chan struct{}, 2)
+		w.Start(1, time.Hour, func(context.Context) {
+			polled <- struct{}{}
+		})
+		defer w.Close()
+		<-polled
+		w.Notify()
+		select {
+		case <-polled:
+		case <-time.After(time.Second):
+			suite.Fail("expected notified poll")
+		}
+	})
+
+	suite.Run("Close", func() {
+		var w worker.Worker
+		canceled := make(chan struct{})
+		w.Start(1, time.Hour, func(ctx context.Context) {
+			<-ctx.Done()
+			close(canceled)
+		})
+		w.Close()
+		<-canceled
+		suite.True(w.Closed())
+		suite.False(w.Go(func() {}))
+		suite.False(w.Start(1, time.Hour, func(context.Context) {}))
+	})
+
+	suite.Run("Go", func() {
+		var w worker.Worker
+		var ran atomic.Bool
+		suite.True(w.Go(func() {
+			time.Sleep(10 * time.Millisecond)
+			ran.Store(true)
+		}))
+		w.Close()
+		suite.True(ran.Load())
+	})
+}
+
+func TestWorkerTestSuite(t *testing.T) {
+	suite.Run(t, new(WorkerTestSuite))
+}
@@ -0,0 +1,126 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Worker runs polling functions on background goroutines
+// until it is closed.  The zero value is ready to use.
+type Worker struct {
+	lock    sync.Mutex
+	notify  chan struct{}
+	done    chan struct{}
+	cancel  context.CancelFunc
+	group   sync.WaitGroup
+	started bool
+	closed  bool
+}
+
+
+// Start runs poll on n goroutines immediately and then every
+// interval or when notified, until the Worker is closed.  The
+// context passed to poll is canceled when the Worker is closed.
+// Returns false if the Worker was already started or closed.
+func (w *Worker) Start(
+	n        int,
+	interval time.Duration,
+	poll     func(context.Context),
+) bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.started || w.closed {
+		return false
+	}
+	w.init()
+	w.started = true
+	var ctx context.Context
+	ctx, w.cancel = context.WithCancel(context.Background())
+	for i := 0; i < n; i++ {
+		w.group.Add(1)
+		go w.run(ctx, interval, poll)
+	}
+	return true
+}
+
+// Go runs f on a goroutine the Worker waits for when closed.
+// Returns false if the Worker is closed.
+func (w *Worker) Go(f func()) bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return false
+	}
+	w.group.Add(1)
+	go func() {
+		defer w.group.Done()
+		f()
+	}()
+	return true
+}
+
+// Notify wakes a polling goroutine without waiting for
+// the next interval.
+func (w *Worker) Notify() {
+	w.lock.Lock()
+	w.init()
+	notify := w.notify
+	w.lock.Unlock()
+	select {
+	case notify <- struct{}{}:
+	default:
+	}
+}
+
+// Closed returns true if the Worker was closed.
+func (w *Worker) Closed() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.closed
+}
+
+// Close stops the polling goroutines and waits for them
+// to finish.  Returns false if the Worker was already closed.
+func (w *Worker) Close() bool {
+	w.lock.Lock()
+	if w.closed {
+		w.lock.Unlock()
+		return false
+	}
+	w.init()
+	w.closed = true
+	close(w.done)
+	if cancel := w.cancel; cancel != nil {
+		cancel()
+	}
+	w.lock.Unlock()
+	w.group.Wait()
+	return true
+}
+
+func (w *Worker) init() {
+	if w.done == nil {
+		w.done   = make(chan struct{})
+		w.notify = make(chan struct{}, 1)
+	}
+}
+
+func (w *Worker) run(
+	ctx      context.Context,
+	interval time.Duration,
+	poll     func(context.Context),
+) {
+	defer w.group.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		poll(ctx)
+		select {
+		case <-w.done:
+			return
+		case <-w.notify:
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package saga
+
+import (
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/internal"
+)
+
+// Installer configures saga support.
+type Installer struct {
+	store   Store
+	config  Config
+	manager *Manager
+}
+
+func (i *Installer) DependsOn() []miruken.Feature {
+	return []miruken.Feature{api.Feature()}
+}
+
+func (i *Installer) Install(setup *miruken.SetupBuilder) error {
+	if setup.Tag(&featureTag) {
+		if internal.IsNil(i.store) {
+			i.store = NewMemoryStore()
+		}
+		i.manager = NewManager(i.store, i.config)
+		setup.Specs(&Manager{}).
+			  Handlers(i.manager)
+	}
+	return nil
+}
+
+// AfterInstall starts delivering saga timeouts once
+// the handler is available to post them.
+func (i *Installer) AfterInstall(
+	_ *miruken.SetupBuilder,
+	handler miruken.Handler,
+) error {
+	if manager := i.manager; manager != nil {
+		manager.Start(handler)
+	}
+	return nil
+}
+
+// WithStore sets the Store persisting the sagas.
+func WithStore(store Store) func(*Installer) {
+	if internal.IsNil(store) {
+		panic("store cannot be nil")
+	}
+	return func(installer *Installer) {
+		installer.store = store
+	}
+}
+
+// Configure customizes the delivery of saga timeouts.
+func Configure(config Config) func(*Installer) {
+	return func(installer *Installer) {
+		installer.config = config
+	}
+}
+
+// Feature configures saga support.
+// If no Store is provided, a MemoryStore is used.
+func Feature(config ...func(*Installer)) miruken.Feature {
+	installer := &Installer{}
+	for _, configure := range config {
+		if configure != nil {
+			configure(installer)
+		}
+	}
+	return installer
+}
+
+var featureTag byte
@@ -0,0 +1,126 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/handles"
+	"github.com/miruken-go/miruken/internal"
+	"github.com/miruken-go/miruken/promise"
+	"github.com/miruken-go/miruken/provides"
+)
+
+type (
+	// Starts is a FilterProvider for messages that start
+	// a new saga or continue an existing one.
+	Starts struct {}
+
+	// Continues is a FilterProvider for messages that only
+	// continue an existing saga.  Messages for unknown or
+	// completed sagas are not handled.
+	Continues struct {}
+
+	// filter loads the saga state before the message is handled
+	// and saves it afterwards.
+	filter struct {}
+)
+
+
+var ErrMissingManager = errors.New("saga: the saga feature has not been installed")
+
+
+// Starts
+
+func (s *Starts) Required() bool {
+	return true
+}
+
+func (s *Starts) AppliesTo(
+	callback miruken.Callback,
+) bool {
+	return appliesTo(callback)
+}
+
+func (s *Starts) Filters(
+	binding  miruken.Binding,
+	callback any,
+	composer miruken.Handler,
+) ([]miruken.Filter, error) {
+	return filters, nil
+}
+
+
+// Continues
+
+func (c *Continues) Required() bool {
+	return true
+}
+
+func (c *Continues) AppliesTo(
+	callback miruken.Callback,
+) bool {
+	return appliesTo(callback)
+}
+
+func (c *Continues) Filters(
+	binding  miruken.Binding,
+	callback any,
+	composer miruken.Handler,
+) ([]miruken.Filter, error) {
+	return filters, nil
+}
+
+
+// filter
+
+func (f filter) Order() int {
+	return miruken.FilterStageValidation + 10
+}
+
+func (f filter) Next(
+	self     miruken.Filter,
+	next     miruken.Next,
+	ctx      miruken.HandleContext,
+	provider miruken.FilterProvider,
+)  (out []any, pout *promise.Promise[[]any], err error) {
+	var starts bool
+	switch provider.(type) {
+	case *Starts:
+		starts = true
+	case *Continues:
+	default:
+		return next.Abort()
+	}
+	st, ok := ctx.Handler.(stateful)
+	if !ok {
+		return nil, nil, ErrSagaRequired
+	}
+	id, err := CorrelationId(ctx.Callback.Source())
+	if err != nil {
+		return nil, nil, err
+	}
+	manager, _, err := provides.Type[*Manager](ctx.Composer)
+	if err != nil {
+		return nil, nil, err
+	} else if manager == nil {
+		return nil, nil, ErrMissingManager
+	}
+	return manager.handle(ctx, handlingContext(ctx.Composer), st, id, starts, next)
+}
+
+
+// handlingContext returns the context.Context the message
+// is handled in or context.Background if none.
+func handlingContext(composer miruken.Handler) context.Context {
+	if c, _, err := provides.Type[context.Context](composer); err == nil && c != nil {
+		return c
+	}
+	return context.Background()
+}
+
+func appliesTo(callback miruken.Callback) bool {
+	h, ok := callback.(*handles.It)
+	return ok && !internal.IsNil(h.Source())
+}
+
+var filters = []miruken.Filter{filter{}}
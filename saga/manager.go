@@ -0,0 +1,320 @@
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/internal"
+	"github.com/miruken-go/miruken/internal/worker"
+	"github.com/miruken-go/miruken/promise"
+	"github.com/miruken-go/miruken/provides"
+	"reflect"
+	"slices"
+	"time"
+)
+
+type (
+	// Config customizes the delivery of saga timeouts.
+	Config struct {
+		PollInterval time.Duration
+		BatchSize    int
+	}
+
+	// Manager loads and saves saga instances through a Store
+	// and delivers the timeouts requested by them.
+	Manager struct {
+		store  Store
+		config Config
+		logger logr.Logger
+		worker worker.Worker
+	}
+)
+
+
+const (
+	defaultPollInterval = time.Second
+	defaultBatchSize    = 100
+	maxRestoreAttempts  = 3
+)
+
+
+// NoConstructor prevents Manager from being created implicitly.
+func (m *Manager) NoConstructor() {}
+
+// Store returns the Store persisting the sagas.
+func (m *Manager) Store() Store {
+	return m.store
+}
+
+// Start starts the worker that delivers due timeouts
+// using the handler.
+func (m *Manager) Start(handler miruken.Handler) {
+	if internal.IsNil(handler) {
+		panic("handler cannot be nil")
+	}
+	if m.logger.GetSink() == nil {
+		m.logger, _, _ = provides.Type[logr.Logger](handler)
+	}
+	handler = miruken.BuildUp(handler, api.Polymorphic)
+	m.worker.Start(1, m.config.PollInterval, func(ctx context.Context) {
+		if _, err := m.DeliverTimeouts(ctx, handler); err != nil && ctx.Err() == nil {
+			m.logger.Error(err, "unable to deliver saga timeouts")
+		}
+	})
+}
+
+// Close stops the timeout worker.
+func (m *Manager) Close() {
+	m.worker.Close()
+}
+
+// DeliverTimeouts posts the due timeouts once and returns
+// the number delivered.
+func (m *Manager) DeliverTimeouts(
+	ctx     context.Context,
+	handler miruken.Handler,
+) (int, error) {
+	now := time.Now().UTC()
+	records, err := m.store.Due(ctx, now, m.config.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var errs []error
+	delivered := 0
+	for _, record := range records {
+		var due, remaining []Timeout
+		for _, t := range record.Timeouts {
+			if t.Due.After(now) {
+				remaining = append(remaining, t)
+			} else {
+				due = append(due, t)
+			}
+		}
+		if len(due) == 0 {
+			continue
+		}
+		// claim the timeouts before delivering them
+		record.Timeouts = remaining
+		if err := m.store.Save(ctx, record); err != nil {
+			if !errors.Is(err, ErrConcurrency) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		var failed []Timeout
+		for _, t := range due {
+			if err := post(handler, t.Message); err != nil {
+				m.logger.Error(err, "unable to deliver saga timeout",
+					"type", record.Type, "id", record.Id)
+				errs   = append(errs, err)
+				failed = append(failed, t)
+				continue
+			}
+			delivered++
+		}
+		if len(failed) > 0 {
+			if err := m.restore(ctx, record, failed); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return delivered, errors.Join(errs...)
+}
+
+// restore returns timeouts that could not be delivered to
+// the saga so the next poll retries them.  Timeouts of a
+// saga that has since completed are dropped.
+func (m *Manager) restore(
+	ctx     context.Context,
+	record  Record,
+	failed  []Timeout,
+) error {
+	for i := 0; i < maxRestoreAttempts; i++ {
+		current, found, err := m.store.Load(ctx, record.Type, record.Id)
+		if err != nil {
+			return err
+		} else if !found {
+			return nil
+		}
+		current.Timeouts = append(slices.Clone(current.Timeouts), failed...)
+		if err = m.store.Save(ctx, current); !errors.Is(err, ErrConcurrency) {
+			return err
+		}
+	}
+	return ErrConcurrency
+}
+
+// handle loads the saga, handles the message and saves
+// or removes the saga depending on its outcome.
+func (m *Manager) handle(
+	hc     miruken.HandleContext,
+	ctx    context.Context,
+	saga   stateful,
+	id     string,
+	starts bool,
+	next   miruken.Next,
+) ([]any, *promise.Promise[[]any], error) {
+	typ := TypeName(hc.Handler)
+	record, found, err := m.store.Load(ctx, typ, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	progress, state := saga.saga()
+	// saga handlers may be reused across messages
+	progress.reset(id)
+	reflect.ValueOf(state).Elem().SetZero()
+	if !found {
+		if !starts {
+			return next.Abort()
+		}
+		record = Record{Type: typ, Id: id}
+	} else if len(record.State) > 0 {
+		if err := json.Unmarshal(record.State, state); err != nil {
+			return nil, nil, fmt.Errorf("saga: %w", err)
+		}
+	}
+
+	out, pout, err := next.Pipe()
+	if err != nil {
+		return nil, nil, err
+	} else if pout == nil {
+		if err := m.finish(ctx, record, progress, state, hc.Composer); err != nil {
+			return nil, nil, err
+		}
+		return out, nil, nil
+	}
+	return nil, promise.New(func(resolve func([]any), reject func(error)) {
+		oo, err := pout.Await()
+		if err == nil {
+			err = m.finish(ctx, record, progress, state, hc.Composer)
+		}
+		if err != nil {
+			reject(err)
+			return
+		}
+		resolve(oo)
+	}), nil
+}
+
+func (m *Manager) finish(
+	ctx      context.Context,
+	record   Record,
+	saga     *progress,
+	state    any,
+	composer miruken.Handler,
+) error {
+	composer = miruken.BuildUp(composer, api.Polymorphic)
+	if saga.completed {
+		if record.Version > 0 {
+			if err := m.store.Delete(ctx, record); err != nil {
+				return err
+			}
+		}
+		if saga.aborted {
+			return m.compensate(record, saga, composer)
+		}
+		return nil
+	}
+	encoded, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("saga: %w", err)
+	}
+	record.State = encoded
+	now := time.Now().UTC()
+	for _, t := range saga.timeouts {
+		msg, err := api.EncodeMessage(composer, t.message)
+		if err != nil {
+			return fmt.Errorf("saga: %w", err)
+		}
+		record.Timeouts = append(record.Timeouts, Timeout{Due: now.Add(t.after), Message: msg})
+	}
+	for _, c := range saga.compensations {
+		msg, err := api.EncodeMessage(composer, c)
+		if err != nil {
+			return fmt.Errorf("saga: %w", err)
+		}
+		record.Compensations = append(record.Compensations, msg)
+	}
+	return m.store.Save(ctx, record)
+}
+
+// compensate posts the compensation messages in reverse order.
+func (m *Manager) compensate(
+	record   Record,
+	saga     *progress,
+	composer miruken.Handler,
+) error {
+	var errs []error
+	for i := len(saga.compensations)-1; i >= 0; i-- {
+		if err := await(api.Post(composer, saga.compensations[i])); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for i := len(record.Compensations)-1; i >= 0; i-- {
+		if err := post(composer, record.Compensations[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+
+// Config
+
+func (c Config) withDefaults() Config {
+	if c.PollInterval <= 0 {
+		c.PollInterval = defaultPollInterval
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = defaultBatchSize
+	}
+	return c
+}
+
+
+// NewManager creates a Manager persisting sagas in the store.
+// Without a logger, the logr.Logger provided by the handler
+// starting the Manager is used.
+func NewManager(
+	store  Store,
+	config Config,
+	logger ...logr.Logger,
+) *Manager {
+	if internal.IsNil(store) {
+		panic("store cannot be nil")
+	}
+	manager := &Manager{
+		store:  store,
+		config: config.withDefaults(),
+	}
+	if len(logger) > 0 {
+		manager.logger = logger[0]
+	}
+	return manager
+}
+
+func post(
+	handler miruken.Handler,
+	message json.RawMessage,
+) error {
+	payload, err := api.DecodeMessage(handler, message)
+	if err != nil {
+		return fmt.Errorf("saga: %w", err)
+	}
+	if payload == nil {
+		return nil
+	}
+	return await(api.Post(handler, payload))
+}
+
+func await(pv *promise.Promise[any], err error) error {
+	if err == nil && pv != nil {
+		_, err = pv.Await()
+	}
+	return err
+}
+
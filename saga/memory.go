@@ -0,0 +1,99 @@
+package saga
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps sagas in memory.
+// It is intended for tests and single process deployments
+// that do not require durability.
+type MemoryStore struct {
+	lock    sync.Mutex
+	records map[memoryKey]Record
+}
+
+type memoryKey struct {
+	typ string
+	id  string
+}
+
+
+func (m *MemoryStore) Load(
+	_   context.Context,
+	typ string,
+	id  string,
+) (Record, bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	record, ok := m.records[memoryKey{typ, id}]
+	return record, ok, nil
+}
+
+func (m *MemoryStore) Save(
+	_      context.Context,
+	record Record,
+) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.records == nil {
+		m.records = make(map[memoryKey]Record)
+	}
+	key := memoryKey{record.Type, record.Id}
+	if record.Version != m.records[key].Version {
+		return ErrConcurrency
+	}
+	record.Version++
+	m.records[key] = record
+	return nil
+}
+
+func (m *MemoryStore) Delete(
+	_      context.Context,
+	record Record,
+) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	key := memoryKey{record.Type, record.Id}
+	if stored, ok := m.records[key]; !ok || stored.Version != record.Version {
+		return ErrConcurrency
+	}
+	delete(m.records, key)
+	return nil
+}
+
+func (m *MemoryStore) Due(
+	_     context.Context,
+	now   time.Time,
+	limit int,
+) ([]Record, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var due []Record
+	for _, record := range m.records {
+		for _, t := range record.Timeouts {
+			if !t.Due.After(now) {
+				due = append(due, record)
+				break
+			}
+		}
+		if limit > 0 && len(due) >= limit {
+			break
+		}
+	}
+	return due, nil
+}
+
+// Len returns the number of active sagas.
+func (m *MemoryStore) Len() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return len(m.records)
+}
+
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[memoryKey]Record)}
+}
@@ -0,0 +1,213 @@
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+type (
+	// Saga is embedded in a saga type to coordinate a long-running
+	// workflow across multiple messages.  Only the State is persisted
+	// between messages so the saga type is free to hold dependencies.
+	//
+	//   type OrderState struct {
+	//     Paid bool
+	//   }
+	//
+	//   type OrderSaga struct {
+	//     saga.Saga[OrderState]
+	//   }
+	//
+	//   func (s *OrderSaga) Placed(
+	//     _*struct{
+	//        handles.It
+	//        saga.Starts
+	//      }, placed OrderPlaced,
+	//   ) { ... }
+	//
+	// Messages are correlated to a saga instance by the field
+	// tagged `saga:"id"`.
+	Saga[S any] struct {
+		State    S
+		progress progress
+	}
+
+	// progress tracks the outcome of the current message.
+	progress struct {
+		id            string
+		completed     bool
+		aborted       bool
+		timeouts      []timeout
+		compensations []any
+	}
+
+	// Record is the persisted form of a saga instance.
+	Record struct {
+		Type          string
+		Id            string
+		Version       int
+		State         json.RawMessage
+		Timeouts      []Timeout
+		Compensations []json.RawMessage
+	}
+
+	// Timeout is a message to deliver to the saga when due.
+	Timeout struct {
+		Due     time.Time
+		Message json.RawMessage
+	}
+
+	// Store loads and saves saga instances.
+	Store interface {
+		// Load returns the saga record if it exists.
+		Load(ctx context.Context, typ, id string) (Record, bool, error)
+
+		// Save inserts or updates the saga record.  The record
+		// Version must match the stored version, which is zero for
+		// new sagas, or ErrConcurrency is returned.
+		Save(ctx context.Context, record Record) error
+
+		// Delete removes the saga record.  The record Version
+		// must match the stored version or ErrConcurrency is returned.
+		Delete(ctx context.Context, record Record) error
+
+		// Due returns up to limit records with timeouts due
+		// at or before now.
+		Due(ctx context.Context, now time.Time, limit int) ([]Record, error)
+	}
+
+	// stateful is implemented by types embedding Saga.
+	stateful interface {
+		saga() (*progress, any)
+	}
+
+	timeout struct {
+		after   time.Duration
+		message any
+	}
+)
+
+
+var (
+	ErrConcurrency        = errors.New("saga: the saga was modified concurrently")
+	ErrMissingCorrelation = errors.New("saga: the message is missing a `saga:\"id\"` field")
+	ErrSagaRequired       = errors.New("saga: the handler must embed saga.Saga")
+)
+
+
+// Saga
+
+// Id returns the correlation id of the saga instance.
+func (s *Saga[S]) Id() string {
+	return s.progress.id
+}
+
+// Completed returns true if the saga completed or aborted.
+func (s *Saga[S]) Completed() bool {
+	return s.progress.completed
+}
+
+// Aborted returns true if the saga aborted.
+func (s *Saga[S]) Aborted() bool {
+	return s.progress.aborted
+}
+
+// Complete ends the saga successfully.
+// The saga is removed once the current message is handled.
+func (s *Saga[S]) Complete() {
+	s.progress.completed = true
+}
+
+// Abort ends the saga unsuccessfully.  The compensation
+// messages are posted in reverse order once the current
+// message is handled.
+func (s *Saga[S]) Abort() {
+	s.progress.completed = true
+	s.progress.aborted   = true
+}
+
+// Timeout requests the message be delivered to the saga
+// after the duration unless the saga completes first.
+func (s *Saga[S]) Timeout(after time.Duration, message any) {
+	if message == nil {
+		panic("message cannot be nil")
+	}
+	s.progress.timeouts = append(s.progress.timeouts, timeout{after, message})
+}
+
+// Compensate registers a message to post if the saga aborts.
+func (s *Saga[S]) Compensate(message any) {
+	if message == nil {
+		panic("message cannot be nil")
+	}
+	s.progress.compensations = append(s.progress.compensations, message)
+}
+
+func (s *Saga[S]) saga() (*progress, any) {
+	return &s.progress, &s.State
+}
+
+
+// progress
+
+func (p *progress) reset(id string) {
+	*p = progress{id: id}
+}
+
+
+// CorrelationId returns the value of the message field
+// tagged `saga:"id"`.
+func CorrelationId(message any) (string, error) {
+	v := reflect.ValueOf(message)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", ErrMissingCorrelation
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return "", ErrMissingCorrelation
+	}
+	index, ok := correlationIndex(v.Type())
+	if !ok {
+		return "", ErrMissingCorrelation
+	}
+	id := fmt.Sprint(v.FieldByIndex(index).Interface())
+	if len(id) == 0 {
+		return "", ErrMissingCorrelation
+	}
+	return id, nil
+}
+
+func correlationIndex(typ reflect.Type) ([]int, bool) {
+	if cached, ok := correlations.Load(typ); ok {
+		index := cached.([]int)
+		return index, index != nil
+	}
+	var index []int
+	for _, field := range reflect.VisibleFields(typ) {
+		if tag, ok := field.Tag.Lookup("saga"); ok && tag == "id" {
+			index = field.Index
+			break
+		}
+	}
+	correlations.Store(typ, index)
+	return index, index != nil
+}
+
+// TypeName returns the name used to persist the saga type.
+func TypeName(saga any) string {
+	typ := reflect.TypeOf(saga)
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	return typ.String()
+}
+
+
+var correlations sync.Map
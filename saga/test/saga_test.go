@@ -0,0 +1,343 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/miruken-go/miruken"
+	"github.com/miruken-go/miruken/api"
+	"github.com/miruken-go/miruken/api/json/stdjson"
+	"github.com/miruken-go/miruken/creates"
+	"github.com/miruken-go/miruken/handles"
+	"github.com/miruken-go/miruken/promise"
+	"github.com/miruken-go/miruken/provides"
+	"github.com/miruken-go/miruken/saga"
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"time"
+)
+
+//go:generate $GOPATH/bin/miruken -tests
+
+type (
+	OrderPlaced struct {
+		OrderId int `saga:"id"`
+		Amount  float64
+	}
+
+	PaymentReceived struct {
+		OrderId int `saga:"id"`
+		Amount  float64
+	}
+
+	PaymentTimeout struct {
+		OrderId int `saga:"id"`
+	}
+
+	PaymentPending struct {
+		OrderId int `saga:"id"`
+	}
+
+	CancelOrder struct {
+		OrderId int
+	}
+
+	Untracked struct {
+		OrderId int
+	}
+
+	OrderState struct {
+		Amount   float64
+		Received float64
+	}
+
+	OrderSaga struct {
+		saga.Saga[OrderState]
+	}
+
+	// ContextStore records the context.Context of each Load.
+	ContextStore struct {
+		*saga.MemoryStore
+		tenants []any
+	}
+
+	// FailingStore fails to save sagas once err is set.
+	FailingStore struct {
+		*saga.MemoryStore
+		err error
+	}
+
+	CancelHandler struct {
+		cancelled chan int
+	}
+)
+
+
+// OrderSaga
+
+func (o *OrderSaga) Placed(
+	_*struct{
+		handles.It
+		saga.Starts
+	  }, placed OrderPlaced,
+) {
+	o.State.Amount = placed.Amount
+	o.Timeout(timeout, PaymentTimeout{placed.OrderId})
+	o.Compensate(CancelOrder{placed.OrderId})
+}
+
+func (o *OrderSaga) Paid(
+	_*struct{
+		handles.It
+		saga.Continues
+	  }, paid PaymentReceived,
+) {
+	if o.State.Received += paid.Amount; o.State.Received >= o.State.Amount {
+		o.Complete()
+	}
+}
+
+func (o *OrderSaga) Expired(
+	_*struct{
+		handles.It
+		saga.Continues
+	  }, _ PaymentTimeout,
+) {
+	o.Abort()
+}
+
+func (o *OrderSaga) Pending(
+	_*struct{
+		handles.It
+		saga.Continues
+	  }, _ PaymentPending,
+) *promise.Promise[any] {
+	return promise.Delay(time.Millisecond)
+}
+
+func (o *OrderSaga) Untracked(
+	_*struct{
+		handles.It
+		saga.Starts
+	  }, _ Untracked,
+) {
+}
+
+
+// CancelHandler
+
+func (c *CancelHandler) Cancel(
+	_ *handles.It, cancel CancelOrder,
+) {
+	if c.cancelled != nil {
+		c.cancelled <- cancel.OrderId
+	}
+}
+
+func (c *CancelHandler) New(
+	_*struct{
+		_ creates.It `key:"test.PaymentTimeout"`
+		_ creates.It `key:"test.CancelOrder"`
+	  }, create *creates.It,
+) any {
+	switch create.Key() {
+	case "test.PaymentTimeout":
+		return new(PaymentTimeout)
+	case "test.CancelOrder":
+		return new(CancelOrder)
+	}
+	return nil
+}
+
+
+// ContextStore
+
+func (c *ContextStore) Load(
+	ctx context.Context,
+	typ string,
+	id  string,
+) (saga.Record, bool, error) {
+	c.tenants = append(c.tenants, ctx.Value(tenantKey{}))
+	return c.MemoryStore.Load(ctx, typ, id)
+}
+
+
+// FailingStore
+
+func (f *FailingStore) Save(
+	ctx    context.Context,
+	record saga.Record,
+) error {
+	if f.err != nil {
+		return f.err
+	}
+	return f.MemoryStore.Save(ctx, record)
+}
+
+
+type tenantKey struct{}
+
+var timeout = time.Hour
+
+
+type SagaTestSuite struct {
+	suite.Suite
+}
+
+func (suite *SagaTestSuite) Setup(
+	cancels *CancelHandler,
+	config  ...func(*saga.Installer),
+) (miruken.Handler, *saga.Manager) {
+	handler, _ := miruken.Setup(
+		saga.Feature(config...), TestFeature, stdjson.Feature()).
+		Specs(&api.GoPolymorphism{}).
+		Handlers(cancels).
+		Handler()
+	manager, _, _ := provides.Type[*saga.Manager](handler)
+	return handler, manager
+}
+
+func (suite *SagaTestSuite) TestSaga() {
+	ctx := context.Background()
+
+	suite.Run("Start", func() {
+		store := saga.NewMemoryStore()
+		handler, manager := suite.Setup(&CancelHandler{}, saga.WithStore(store))
+		defer manager.Close()
+		suite.Nil(post(handler, OrderPlaced{1, 100}))
+		record, ok, err := store.Load(ctx, "test.OrderSaga", "1")
+		suite.Nil(err)
+		suite.True(ok)
+		suite.Equal(1, record.Version)
+		var state OrderState
+		suite.Nil(json.Unmarshal(record.State, &state))
+		suite.Equal(100.0, state.Amount)
+		suite.Len(record.Timeouts, 1)
+		suite.Len(record.Compensations, 1)
+	})
+
+	suite.Run("Continue", func() {
+		store := saga.NewMemoryStore()
+		handler, manager := suite.Setup(&CancelHandler{}, saga.WithStore(store))
+		defer manager.Close()
+		suite.Nil(post(handler, OrderPlaced{2, 100}))
+		suite.Nil(post(handler, PaymentReceived{2, 40}))
+		record, ok, err := store.Load(ctx, "test.OrderSaga", "2")
+		suite.Nil(err)
+		suite.True(ok)
+		suite.Equal(2, record.Version)
+		var state OrderState
+		suite.Nil(json.Unmarshal(record.State, &state))
+		suite.Equal(40.0, state.Received)
+	})
+
+	suite.Run("Complete", func() {
+		store := saga.NewMemoryStore()
+		handler, manager := suite.Setup(&CancelHandler{}, saga.WithStore(store))
+		defer manager.Close()
+		suite.Nil(post(handler, OrderPlaced{3, 100}))
+		suite.Nil(post(handler, PaymentReceived{3, 60}))
+		suite.Nil(post(handler, PaymentReceived{3, 40}))
+		suite.Equal(0, store.Len())
+	})
+
+	suite.Run("Unknown", func() {
+		handler, manager := suite.Setup(&CancelHandler{})
+		defer manager.Close()
+		err := post(handler, PaymentReceived{4, 10})
+		suite.IsType(&miruken.NotHandledError{}, err)
+	})
+
+	suite.Run("Timeout", func() {
+		defer func(t time.Duration) { timeout = t }(timeout)
+		timeout = 10 * time.Millisecond
+		store   := saga.NewMemoryStore()
+		cancels := &CancelHandler{cancelled: make(chan int, 1)}
+		handler, manager := suite.Setup(cancels,
+			saga.WithStore(store),
+			saga.Configure(saga.Config{PollInterval: 5 * time.Millisecond}))
+		defer manager.Close()
+		suite.Nil(post(handler, OrderPlaced{5, 100}))
+		select {
+		case id := <-cancels.cancelled:
+			suite.Equal(5, id)
+		case <-time.After(5 * time.Second):
+			suite.Fail("expected order to be cancelled")
+		}
+		suite.Eventually(func() bool {
+			return store.Len() == 0
+		}, 5*time.Second, 5*time.Millisecond)
+	})
+
+	suite.Run("Timeout Redelivered", func() {
+		defer func(t time.Duration) { timeout = t }(timeout)
+		timeout = time.Millisecond
+		store   := saga.NewMemoryStore()
+		cancels := &CancelHandler{cancelled: make(chan int, 1)}
+		handler, manager := suite.Setup(cancels, saga.WithStore(store))
+		// deliver the timeouts explicitly
+		manager.Close()
+		suite.Nil(post(handler, OrderPlaced{9, 100}))
+		time.Sleep(5 * time.Millisecond)
+		empty, _ := miruken.Setup().Handler()
+		delivered, err := manager.DeliverTimeouts(ctx, empty)
+		suite.NotNil(err)
+		suite.Equal(0, delivered)
+		record, found, err := store.Load(ctx, "test.OrderSaga", "9")
+		suite.Nil(err)
+		suite.True(found)
+		suite.Len(record.Timeouts, 1)
+		delivered, err = manager.DeliverTimeouts(ctx, miruken.BuildUp(handler, api.Polymorphic))
+		suite.Nil(err)
+		suite.Equal(1, delivered)
+		suite.Equal(0, store.Len())
+		suite.Equal(9, <-cancels.cancelled)
+	})
+
+	suite.Run("Async Failure", func() {
+		store := &FailingStore{MemoryStore: saga.NewMemoryStore()}
+		handler, manager := suite.Setup(&CancelHandler{}, saga.WithStore(store))
+		defer manager.Close()
+		suite.Nil(post(handler, OrderPlaced{10, 100}))
+		store.err = errors.New("store unavailable")
+		suite.ErrorIs(post(handler, PaymentPending{10}), store.err)
+	})
+
+	suite.Run("Missing Correlation", func() {
+		handler, manager := suite.Setup(&CancelHandler{})
+		defer manager.Close()
+		suite.ErrorIs(post(handler, Untracked{6}), saga.ErrMissingCorrelation)
+	})
+
+	suite.Run("Concurrency", func() {
+		store := saga.NewMemoryStore()
+		record := saga.Record{Type: "test.OrderSaga", Id: "7"}
+		suite.Nil(store.Save(ctx, record))
+		suite.ErrorIs(store.Save(ctx, record), saga.ErrConcurrency)
+		suite.ErrorIs(store.Delete(ctx, record), saga.ErrConcurrency)
+		record.Version = 1
+		suite.Nil(store.Delete(ctx, record))
+		suite.ErrorIs(store.Delete(ctx, record), saga.ErrConcurrency)
+	})
+
+	suite.Run("Context", func() {
+		store := &ContextStore{MemoryStore: saga.NewMemoryStore()}
+		handler, manager := suite.Setup(&CancelHandler{}, saga.WithStore(store))
+		defer manager.Close()
+		tenant := context.WithValue(ctx, tenantKey{}, "acme")
+		suite.Nil(post(miruken.BuildUp(handler, provides.With(tenant)), OrderPlaced{8, 100}))
+		suite.Equal([]any{"acme"}, store.tenants)
+	})
+}
+
+func post(handler miruken.Handler, message any) error {
+	pv, err := api.Post(handler, message)
+	if err == nil && pv != nil {
+		_, err = pv.Await()
+	}
+	return err
+}
+
+func TestSagaTestSuite(t *testing.T) {
+	suite.Run(t, new(SagaTestSuite))
+}
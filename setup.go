@@ -19,12 +19,16 @@ type (
 		handlers  []any
 		specs     []any
 		features  []Feature
+		installed []Feature
 		builders  []Builder
 		exclude   Predicate[HandlerSpec]
 		factory   func([]BindingParser, []HandlerInfoObserver) HandlerInfoFactory
 		parsers   []BindingParser
 		observers []HandlerInfoObserver
 		tags      map[any]struct{}
+		tagged    bool
+		claimed   bool
+		errors    error
 	}
 )
 
@@ -123,11 +127,14 @@ func (s *SetupBuilder) WithoutInference() *SetupBuilder {
 }
 
 func (s *SetupBuilder) Tag(tag any) bool {
+	s.tagged = true
 	if tags := s.tags; tags == nil {
 		s.tags = map[any]struct{}{tag: {}}
+		s.claimed = true
 		return true
 	} else if _, found := tags[tag]; !found {
 		tags[tag] = struct{}{}
+		s.claimed = true
 		return true
 	}
 	return false
@@ -181,8 +188,8 @@ func (s *SetupBuilder) Handler() (handler Handler, buildErrors error) {
 		handler = BuildUp(handler, builders...)
 	}
 
-	// call after setup hooks
-	for _, feature := range s.features {
+	// call after setup hooks of the installed features
+	for _, feature := range s.installed {
 		if after, ok := feature.(interface{
 			AfterInstall(*SetupBuilder, Handler) error
 		}); ok {
@@ -192,13 +199,21 @@ func (s *SetupBuilder) Handler() (handler Handler, buildErrors error) {
 		}
 	}
 
+	s.errors = buildErrors
 	return handler, buildErrors
 }
 
+// BuildErrors returns the errors encountered by the last
+// call to Handler or nil if setup completed successfully.
+func (s *SetupBuilder) BuildErrors() error {
+	return s.errors
+}
+
 func (s *SetupBuilder) installGraph(
 	features []Feature,
 ) (err error) {
 	// traverse level-order so overrides can be applied in any order
+	s.installed = s.installed[:0]
 	queue := list.New()
 	for _, feature := range features {
 		if !internal.IsNil(feature) {
@@ -218,9 +233,14 @@ func (s *SetupBuilder) installGraph(
 				}
 			}
 		}
+		s.tagged, s.claimed = false, false
 		if ie := feature.Install(s); ie != nil {
 			err = multierror.Append(err, ie)
 		}
+		// features losing their tag to another were not installed
+		if !s.tagged || s.claimed {
+			s.installed = append(s.installed, feature)
+		}
 	}
 	return err
 }
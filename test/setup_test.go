@@ -36,6 +36,38 @@ func (i *RootInstaller) Install(
 	return nil
 }
 
+type StartInstaller struct {
+	started *int
+}
+
+func (i *StartInstaller) Install(
+	setup *miruken.SetupBuilder,
+) error {
+	setup.Tag(reflect.TypeOf(i))
+	return nil
+}
+
+func (i *StartInstaller) AfterInstall(
+	*miruken.SetupBuilder, miruken.Handler,
+) error {
+	*i.started++
+	return nil
+}
+
+type StartRootInstaller struct {
+	started *int
+}
+
+func (i *StartRootInstaller) DependsOn() []miruken.Feature {
+	return []miruken.Feature{&StartInstaller{i.started}}
+}
+
+func (i *StartRootInstaller) Install(
+	*miruken.SetupBuilder,
+) error {
+	return nil
+}
+
 type BadInstaller struct {}
 
 func (i BadInstaller) Install(
@@ -138,6 +170,14 @@ func (suite *SetupTestSuite) TestSetup() {
 		suite.Equal(11, installer.count)
 	})
 
+	suite.Run("After Install Once", func () {
+		var started int
+		installer := &StartInstaller{&started}
+		_, err := miruken.Setup(&StartRootInstaller{&started}, installer, installer).Handler()
+		suite.Nil(err)
+		suite.Equal(1, started)
+	})
+
 	suite.Run("Errors", func () {
 		installer := BadInstaller{}
 		_, err := miruken.Setup(installer).Handler()